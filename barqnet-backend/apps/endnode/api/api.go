@@ -63,6 +63,19 @@ func (api *EndNodeAPI) Start(port int) error {
 	// OVPN download endpoints
 	mux.HandleFunc("/api/ovpn/", api.handleDownloadOVPN)
 
+	// Client certificate inventory
+	mux.HandleFunc("/api/certs", api.handleListCertificates)
+
+	// WireGuard peer endpoints (delete must be registered before /api/wireguard/)
+	mux.HandleFunc("/api/wireguard/create", api.handleCreateWireGuard)
+	mux.HandleFunc("/api/wireguard/delete/", api.handleDeleteWireGuard)
+	mux.HandleFunc("/api/wireguard/", api.handleDownloadWireGuard)
+
+	// OpenVPN hooks run by the end-node binary (loopback only)
+	mux.HandleFunc("/api/hooks/client-connect", api.handleClientConnectHook)
+	mux.HandleFunc("/api/hooks/client-disconnect", api.handleClientDisconnectHook)
+	mux.HandleFunc("/api/hooks/tls-crypt-v2-verify", api.handleTLSCryptV2VerifyHook)
+
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
 		Handler:      api.middleware(mux),
@@ -70,7 +83,41 @@ func (api *EndNodeAPI) Start(port int) error {
 		WriteTimeout: 15 * time.Second,
 	}
 
-	return server.ListenAndServe()
+	nodeTLS := api.manager.NodeTLS()
+	if !nodeTLS.Enabled() {
+		return server.ListenAndServe()
+	}
+
+	// Only the management server, with its node certificate, may call the API
+	tlsConfig, err := nodeTLS.ServerTLSConfig(shared.ManagementNodeName, nil)
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = tlsConfig
+	api.startHookServer()
+	return server.ListenAndServeTLS("", "")
+}
+
+// startHookServer serves the OpenVPN hooks and the health check on loopback over plain HTTP,
+// for callers on this host that hold no node certificate
+func (api *EndNodeAPI) startHookServer() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", api.handleHealth)
+	mux.HandleFunc("/api/hooks/client-connect", api.handleClientConnectHook)
+	mux.HandleFunc("/api/hooks/client-disconnect", api.handleClientDisconnectHook)
+	mux.HandleFunc("/api/hooks/tls-crypt-v2-verify", api.handleTLSCryptV2VerifyHook)
+
+	server := &http.Server{
+		Addr:         fmt.Sprintf("127.0.0.1:%d", api.manager.HookPort()),
+		Handler:      api.middleware(mux),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			log.Fatalf("Failed to start hook API server: %v", err)
+		}
+	}()
 }
 
 // handleHealth handles health check requests
@@ -84,7 +131,8 @@ func (api *EndNodeAPI) handleHealth(w http.ResponseWriter, r *http.Request) {
 		Status:    "healthy",
 		Timestamp: time.Now().Unix(),
 		Version:   "1.0.0",
-		ServerID:  "endnode-server", // TODO: Get from manager
+		ServerID:  api.manager.GetServerID(),
+		Outbox:    api.manager.OutboxStatus(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -103,10 +151,12 @@ func (api *EndNodeAPI) handleUsers(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleListUsers handles listing users
+// handleListUsers handles listing users held by this end-node
+// Profiles, certificate status and live sessions are combined into one inventory
 func (api *EndNodeAPI) handleListUsers(w http.ResponseWriter, r *http.Request) {
 	users, err := api.manager.ListUsers()
 	if err != nil {
+		log.Printf("❌ Failed to list users: %v", err)
 		http.Error(w, "Failed to list users", http.StatusInternalServerError)
 		return
 	}
@@ -122,6 +172,38 @@ func (api *EndNodeAPI) handleListUsers(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleListCertificates returns client certificates issued by this end-node
+// GET /api/certs?expiring_within=30d
+func (api *EndNodeAPI) handleListCertificates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window, err := shared.ParseExpiryWindow(r.URL.Query().Get("expiring_within"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	certs, err := api.manager.ListCertificates(window)
+	if err != nil {
+		log.Printf("❌ Failed to list certificates: %v", err)
+		http.Error(w, "Failed to list certificates", http.StatusInternalServerError)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Certificates retrieved successfully",
+		Data:      certs,
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // handleCreateUser handles user creation sync from management server
 func (api *EndNodeAPI) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -167,6 +249,15 @@ func (api *EndNodeAPI) handleUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if strings.HasSuffix(username, "/disconnect") {
+		api.handleDisconnectUser(w, r, strings.TrimSuffix(username, "/disconnect"))
+		return
+	}
+	if strings.HasSuffix(username, "/block") {
+		api.handleBlockUser(w, r, strings.TrimSuffix(username, "/block"))
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		api.handleGetUser(w, r, username)
@@ -185,7 +276,7 @@ func (api *EndNodeAPI) handleGetUser(w http.ResponseWriter, r *http.Request, use
 		return
 	}
 
-	var user *shared.User
+	var user *shared.EndNodeUser
 	for _, u := range users {
 		if u.Username == username {
 			user = &u
@@ -313,7 +404,7 @@ func (api *EndNodeAPI) handleCreateOVPN(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Create OVPN file with certificates
-	ovpnPath := fmt.Sprintf("/opt/vpnmanager/clients/%s.ovpn", req.Username)
+	ovpnPath := filepath.Join(manager.ClientsDir(), req.Username+".ovpn")
 	certData := struct {
 		CA   string
 		Cert string
@@ -476,14 +567,8 @@ func (api *EndNodeAPI) handleDownloadOVPN(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get clients directory from environment or use default
-	clientsDir := os.Getenv("CLIENTS_DIR")
-	if clientsDir == "" {
-		clientsDir = "/opt/vpnmanager/clients"
-	}
-
 	// SECURITY: Use filepath.Join to safely construct path
-	ovpnPath := filepath.Join(clientsDir, username+".ovpn")
+	ovpnPath := filepath.Join(manager.ClientsDir(), username+".ovpn")
 
 	// Check if file exists
 	if _, err := os.Stat(ovpnPath); os.IsNotExist(err) {
@@ -528,14 +613,8 @@ func (api *EndNodeAPI) handleDeleteOVPN(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get clients directory from environment or use default
-	clientsDir := os.Getenv("CLIENTS_DIR")
-	if clientsDir == "" {
-		clientsDir = "/opt/vpnmanager/clients"
-	}
-
 	// SECURITY: Use filepath.Join to safely construct path
-	ovpnPath := filepath.Join(clientsDir, username+".ovpn")
+	ovpnPath := filepath.Join(manager.ClientsDir(), username+".ovpn")
 
 	// Log the deletion attempt
 	fmt.Printf("Attempting to delete OVPN file: %s\n", ovpnPath)
@@ -565,128 +644,32 @@ func (api *EndNodeAPI) handleDeleteOVPN(w http.ResponseWriter, r *http.Request)
 
 	fmt.Printf("Successfully deleted file: %s\n", ovpnPath)
 
-	// Get EasyRSA and OpenVPN directories from environment
-	easyrsaDir := os.Getenv("EASYRSA_DIR")
-	if easyrsaDir == "" {
-		easyrsaDir = "/opt/vpnmanager/easyrsa"
-	}
-	openvpnDir := os.Getenv("OPENVPN_DIR")
-	if openvpnDir == "" {
-		openvpnDir = "/etc/openvpn"
-	}
-	pkiDir := filepath.Join(easyrsaDir, "pki")
-	easyrsaPath := filepath.Join(easyrsaDir, "easyrsa")
-
-	// Remove certificate files from EasyRSA to allow recreation
-	fmt.Printf("Removing certificate files for user: %s\n", username)
-
-	// SECURITY: Username already validated, use filepath.Join for safe path construction
-	certFiles := []string{
-		filepath.Join(pkiDir, "issued", username+".crt"),
-		filepath.Join(pkiDir, "private", username+".key"),
-		filepath.Join(pkiDir, "reqs", username+".req"),
-	}
-
-	for _, file := range certFiles {
-		if err := os.Remove(file); err != nil {
-			if !os.IsNotExist(err) {
-				fmt.Printf("Failed to remove file %s: %v\n", file, err)
-			}
-		} else {
-			fmt.Printf("Removed file: %s\n", file)
-		}
-	}
-
-	// Also revoke the certificate to update CRL (in case it was already signed)
-	// SECURITY: Use exec.Command with separate arguments to prevent shell injection
+	// Revoke the certificate; its issued files are archived under pki/revoked so the user can be recreated
 	fmt.Printf("Revoking certificate for user: %s\n", username)
-	revokeCmd := exec.Command(easyrsaPath, "revoke", username)
-	revokeCmd.Dir = easyrsaDir
-	revokeCmd.Env = append(os.Environ(), "EASYRSA_BATCH=1", "EASYRSA_PKI="+pkiDir)
-
-	revokeOutput, revokeErr := revokeCmd.CombinedOutput()
-	if revokeErr != nil {
-		fmt.Printf("Revoke failed (expected if cert was already removed): %v, output: %s\n", revokeErr, string(revokeOutput))
+	if err := api.manager.RevokeUserCertificate(username); err != nil {
+		fmt.Printf("Revoke failed (expected if no certificate was issued): %v\n", err)
 	} else {
-		fmt.Printf("Certificate revoked successfully: %s\n", string(revokeOutput))
+		fmt.Printf("Certificate revoked successfully\n")
 	}
 
-	// Update CRL
-	fmt.Printf("Updating Certificate Revocation List...\n")
-	crlCmd := exec.Command(easyrsaPath, "gen-crl")
-	crlCmd.Dir = easyrsaDir
-	crlCmd.Env = append(os.Environ(), "EASYRSA_BATCH=1", "EASYRSA_PKI="+pkiDir)
-
-	crlOutput, crlErr := crlCmd.CombinedOutput()
-	if crlErr != nil {
-		fmt.Printf("Failed to update CRL: %v, output: %s\n", crlErr, string(crlOutput))
+	// Publish CRL (atomic replace, revoked clients are kicked, no server restart)
+	fmt.Printf("Publishing Certificate Revocation List...\n")
+	if crl, err := api.manager.PublishCRL(); err != nil {
+		fmt.Printf("Failed to publish CRL: %v\n", err)
 	} else {
-		fmt.Printf("CRL updated successfully: %s\n", string(crlOutput))
-
-		// Copy CRL to OpenVPN directory
-		srcCRL := filepath.Join(pkiDir, "crl.pem")
-		dstCRL := filepath.Join(openvpnDir, "crl.pem")
-		copyCmd := exec.Command("cp", srcCRL, dstCRL)
-		copyErr := copyCmd.Run()
-		if copyErr != nil {
-			fmt.Printf("Failed to copy CRL to OpenVPN directory: %v\n", copyErr)
-		} else {
-			fmt.Printf("CRL copied to OpenVPN directory\n")
-		}
+		fmt.Printf("CRL #%d published successfully (%d revoked, %d session(s) kicked)\n", crl.CRLNumber, crl.RevokedCount, crl.KickedSessions)
 	}
 
 	// Disconnect active OpenVPN sessions for this user
 	fmt.Printf("Disconnecting active sessions for user: %s\n", username)
 
-	// Signal OpenVPN to reload CRL (SIGUSR1 does not disconnect active clients, just reloads config)
-	fmt.Printf("Signaling OpenVPN to reload CRL...\n")
-	reloadCmd := exec.Command("pkill", "-SIGUSR1", "openvpn")
-	reloadErr := reloadCmd.Run()
-	if reloadErr != nil {
-		fmt.Printf("Failed to signal OpenVPN to reload CRL: %v\n", reloadErr)
-	} else {
-		fmt.Printf("OpenVPN signaled to reload CRL successfully\n")
-	}
+	// No server restart or SIGUSR1 is needed: OpenVPN re-reads the crl-verify file on every
+	// new handshake, so only this user's sessions are killed below
 
-	// Use management interface to disconnect user immediately
-	// Try multiple possible socket paths
-	socketPaths := []string{
-		"/var/run/openvpn/server.sock",
-		"/var/run/openvpn-server/server.sock",
-		"/run/openvpn/server.sock",
-	}
-
-	disconnected := false
-	for _, socketPath := range socketPaths {
-		// Check if socket exists
-		if _, err := os.Stat(socketPath); os.IsNotExist(err) {
-			continue
-		}
-
-		fmt.Printf("Attempting disconnect via management socket: %s\n", socketPath)
-		disconnectCmd := exec.Command("bash", "-c",
-			fmt.Sprintf("echo 'kill %s' | nc -U %s", username, socketPath))
-		disconnectOutput, disconnectErr := disconnectCmd.CombinedOutput()
-
-		if disconnectErr != nil {
-			fmt.Printf("Management interface disconnect failed: %v\n", disconnectErr)
-			continue
-		}
-
-		// Check if the kill command was successful
-		outputStr := string(disconnectOutput)
-		if strings.Contains(outputStr, "SUCCESS") || strings.Contains(outputStr, "killed") {
-			fmt.Printf("User session disconnected successfully via management interface\n")
-			fmt.Printf("Output: %s\n", outputStr)
-			disconnected = true
-			break
-		} else {
-			fmt.Printf("Disconnect command sent but uncertain result: %s\n", outputStr)
-		}
-	}
-
-	if !disconnected {
-		fmt.Printf("WARNING: Could not disconnect via management interface\n")
+	// Use management interface to disconnect only this user immediately
+	killed, disconnectErr := api.manager.DisconnectUser(username)
+	if disconnectErr != nil {
+		fmt.Printf("WARNING: Could not disconnect via management interface: %v\n", disconnectErr)
 		fmt.Printf("User will be rejected on next connection attempt due to CRL\n")
 		fmt.Printf("IMPORTANT: Ensure OpenVPN server.conf has 'crl-verify /etc/openvpn/crl.pem'\n")
 
@@ -702,29 +685,19 @@ func (api *EndNodeAPI) handleDeleteOVPN(w http.ResponseWriter, r *http.Request)
 				fmt.Printf("Helper script output: %s\n", string(scriptOutput))
 			}
 		}
-	}
-
-	// Wait a moment for disconnect to process
-	time.Sleep(1 * time.Second)
-
-	// Verify user is disconnected by checking management interface status
-	for _, socketPath := range socketPaths {
-		if _, err := os.Stat(socketPath); os.IsNotExist(err) {
-			continue
-		}
-
-		statusCmd := exec.Command("bash", "-c",
-			fmt.Sprintf("echo 'status' | nc -U %s | grep -i '%s'", socketPath, username))
-		statusOutput, _ := statusCmd.CombinedOutput()
-
-		if len(statusOutput) > 0 {
-			fmt.Printf("WARNING: User %s still appears in OpenVPN status:\n%s\n",
-				username, string(statusOutput))
-			fmt.Printf("User may still be connected - will be blocked on next authentication\n")
-		} else {
-			fmt.Printf("Verified: User %s is no longer in active connections list\n", username)
+	} else {
+		fmt.Printf("Disconnected %d session(s) for user %s via management interface\n", killed, username)
+
+		// Verify user is no longer in the active connections list
+		if sessions, err := api.manager.ListSessions(); err == nil {
+			for _, session := range sessions {
+				if session.CommonName == username {
+					fmt.Printf("WARNING: User %s still appears in OpenVPN status (%s)\n", username, session.RealAddress)
+					fmt.Printf("User may still be connected - will be blocked on next authentication\n")
+					break
+				}
+			}
 		}
-		break
 	}
 
 	// Log audit event for disconnection
@@ -876,6 +849,10 @@ func isProtectedEndpoint(path string) bool {
 	if path == "/health" {
 		return false
 	}
+	// OpenVPN hooks have no API key, their handlers only accept loopback requests
+	if strings.HasPrefix(path, "/api/hooks/") {
+		return false
+	}
 	// All other endpoints require authentication
 	return true
 }
@@ -908,8 +885,15 @@ func (api *EndNodeAPI) middleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// SECURITY: Validate API key for protected endpoints
-		if isProtectedEndpoint(r.URL.Path) {
+		// SECURITY: With a node credential, protected endpoints only accept requests management
+		// signed with it; otherwise they validate the shared API key
+		if isProtectedEndpoint(r.URL.Path) && api.manager.SignedRequests() {
+			if err := api.manager.VerifyManagementRequest(r); err != nil {
+				log.Printf("SECURITY: Rejected request from %s for %s: %v", r.RemoteAddr, r.URL.Path, err)
+				http.Error(w, "Unauthorized: Invalid or missing request signature", http.StatusUnauthorized)
+				return
+			}
+		} else if isProtectedEndpoint(r.URL.Path) {
 			if !api.validateAPIKey(r) {
 				log.Printf("SECURITY: Invalid API key from %s for %s", r.RemoteAddr, r.URL.Path)
 				http.Error(w, "Unauthorized: Invalid or missing API key", http.StatusUnauthorized)
@@ -1014,8 +998,13 @@ func (api *EndNodeAPI) logSecurityEvent(r *http.Request) {
 	api.logAudit("api_request", "", fmt.Sprintf("%s %s", r.Method, r.URL.Path), r.RemoteAddr)
 }
 
-// logAudit logs audit events using the audit logger (file-only logging for endnode)
+// logAudit logs audit events using the audit logger (file-only logging for endnode) and
+// ships them to the management audit log, except the trace of every API request
 func (api *EndNodeAPI) logAudit(action, username, details, ipAddress string) {
+	if action != "api_request" {
+		api.manager.ReportAuditEvent(action, username, details, ipAddress)
+	}
+
 	if api.auditLogger != nil {
 		// Get server ID from environment or use default
 		serverID := os.Getenv("SERVER_ID")
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// isLoopbackRequest reports whether a request comes from this host. The OpenVPN hooks
+// run as the unprivileged OpenVPN user without the API key, so their endpoints are
+// restricted to loopback instead.
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && addr.Unmap().IsLoopback()
+}
+
+// handleClientConnectHook decides whether a connecting client is let in, for the client-connect hook
+// POST /api/hooks/client-connect (loopback only)
+func (api *EndNodeAPI) handleClientConnectHook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isLoopbackRequest(r) {
+		log.Printf("SECURITY: Hook request from non-loopback address %s rejected", r.RemoteAddr)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req shared.ConnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	decision := api.manager.AuthorizeConnect(req)
+	message := fmt.Sprintf("Connection of %s allowed", req.Username)
+	if !decision.Allowed {
+		log.Printf("[ACCESS] ❌ Rejected connection of %q from %s: %s", req.Username, req.RealAddress, decision.Reason)
+		message = fmt.Sprintf("Connection of %s rejected", req.Username)
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   message,
+		Data:      decision,
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleClientDisconnectHook takes the usage of a finished session from the client-disconnect hook
+// POST /api/hooks/client-disconnect (loopback only)
+func (api *EndNodeAPI) handleClientDisconnectHook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isLoopbackRequest(r) {
+		log.Printf("SECURITY: Hook request from non-loopback address %s rejected", r.RemoteAddr)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var usage shared.SessionUsage
+	if err := json.NewDecoder(r.Body).Decode(&usage); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Release the tunnel address before anything else, the pool may hand it out again
+	api.manager.UnshapeSession(usage.VirtualAddress)
+
+	if err := api.manager.RecordSessionUsage(usage); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("Session usage of %s recorded", usage.Username),
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleTLSCryptV2VerifyHook decides whether a client's tls-crypt-v2 key is accepted, for the tls-crypt-v2-verify hook
+// POST /api/hooks/tls-crypt-v2-verify (loopback only)
+func (api *EndNodeAPI) handleTLSCryptV2VerifyHook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isLoopbackRequest(r) {
+		log.Printf("SECURITY: Hook request from non-loopback address %s rejected", r.RemoteAddr)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req shared.TLSCryptV2VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	decision := api.manager.VerifyTLSCryptV2(req)
+	message := fmt.Sprintf("tls-crypt-v2 key of %s accepted", req.Username)
+	if !decision.Allowed {
+		log.Printf("[ACCESS] ❌ Rejected tls-crypt-v2 key of %q: %s", req.Username, decision.Reason)
+		message = fmt.Sprintf("tls-crypt-v2 key of %s rejected", req.Username)
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   message,
+		Data:      decision,
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// handleDisconnectUser ends the VPN sessions of a user on this end-node without touching its
+// certificate, so the user can connect again. The management server calls it to make room
+// under the kick-oldest session limit policy.
+// POST /api/users/{username}/disconnect
+func (api *EndNodeAPI) handleDisconnectUser(w http.ResponseWriter, r *http.Request, username string) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	killed, err := api.manager.DisconnectUser(username)
+	if err != nil {
+		log.Printf("❌ Failed to disconnect %s: %v", username, err)
+		http.Error(w, fmt.Sprintf("Failed to disconnect user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	api.logAudit("user_kicked", username,
+		fmt.Sprintf("%d session(s) of %s disconnected by the management server", killed, username),
+		r.RemoteAddr)
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("%d session(s) disconnected", killed),
+		Data:      map[string]int{"disconnected": killed},
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleBlockUser rejects further connections of a user on this end-node and ends its sessions,
+// until the next access list from the management server says otherwise. The management server
+// calls it on every end-node when a user exhausts its data quota.
+// POST /api/users/{username}/block - body {"reason": ...}
+func (api *EndNodeAPI) handleBlockUser(w http.ResponseWriter, r *http.Request, username string) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "blocked by the management server"
+	}
+
+	killed, err := api.manager.BlockUser(username, req.Reason)
+	if err != nil {
+		log.Printf("❌ Failed to block %s: %v", username, err)
+		http.Error(w, fmt.Sprintf("Failed to block user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	api.logAudit("user_blocked", username,
+		fmt.Sprintf("%s blocked by the management server (%s), %d session(s) disconnected", username, req.Reason, killed),
+		r.RemoteAddr)
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("User blocked, %d session(s) disconnected", killed),
+		Data:      map[string]int{"disconnected": killed},
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"barqnet-backend/apps/endnode/manager"
+	"barqnet-backend/pkg/shared"
+)
+
+// handleCreateWireGuard handles WireGuard peer creation requests from management server
+// POST /api/wireguard/create
+func (api *EndNodeAPI) handleCreateWireGuard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		ServerID string `json:"server_id"`
+		ServerIP string `json:"server_ip"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := api.validateUsername(req.Username); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid input: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.ServerIP == "" || strings.ContainsAny(req.ServerIP, " \t\r\n") {
+		http.Error(w, "Invalid input: server IP is required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := api.manager.CreateWireGuardPeer(req.Username, req.ServerIP); err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to create WireGuard peer: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	api.logAudit("wireguard_created", req.Username, fmt.Sprintf("WireGuard peer created for user %s on server %s", req.Username, req.ServerID), r.RemoteAddr)
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("WireGuard peer created for user %s", req.Username),
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleDownloadWireGuard handles WireGuard client config download requests
+// GET /api/wireguard/{username}
+func (api *EndNodeAPI) handleDownloadWireGuard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := strings.TrimPrefix(r.URL.Path, "/api/wireguard/")
+	if username == "" {
+		http.Error(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	// SECURITY: Validate username to prevent path traversal attacks
+	if err := api.validateUsernameForPath(username); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid username: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	content, err := os.ReadFile(filepath.Join(manager.ClientsDir(), username+".conf"))
+	if os.IsNotExist(err) {
+		http.Error(w, "WireGuard peer does not exist", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read WireGuard config: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.conf\"", username))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+	w.Write(content)
+}
+
+// handleDeleteWireGuard handles WireGuard peer deletion requests
+// DELETE /api/wireguard/delete/{username}
+func (api *EndNodeAPI) handleDeleteWireGuard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := strings.TrimPrefix(r.URL.Path, "/api/wireguard/delete/")
+	if err := api.validateUsernameForPath(username); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid username: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := api.manager.RemoveWireGuardPeer(username); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to remove WireGuard peer: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	api.logAudit("wireguard_deleted", username, fmt.Sprintf("WireGuard peer removed for user %s", username), r.RemoteAddr)
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("WireGuard peer removed for user %s", username),
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
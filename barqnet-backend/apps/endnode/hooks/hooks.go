@@ -0,0 +1,230 @@
+// Package hooks implements the OpenVPN script hooks built into the end-node binary.
+// OpenVPN runs them as "endnode <hook> -api <url> [-fail-open] [file]"; they pass what
+// OpenVPN reports in their environment to the end-node API on loopback and return quickly,
+// since OpenVPN waits for them.
+package hooks
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"barqnet-backend/apps/endnode/openvpn"
+	"barqnet-backend/pkg/shared"
+)
+
+// DefaultAPI is the end-node API the hooks report to when -api is not given
+const DefaultAPI = "http://127.0.0.1:8081"
+
+// hookTimeout bounds a hook run; OpenVPN blocks while it runs
+const hookTimeout = 3 * time.Second
+
+// A hook gets the arguments OpenVPN appends after the flags, such as the dynamic config file.
+// failOpen lets clients in when the end-node API cannot be reached.
+var hooks = map[string]func(api string, failOpen bool, args []string, getenv func(string) string) error{
+	"client-connect":      clientConnect,
+	"client-disconnect":   clientDisconnect,
+	"tls-crypt-v2-verify": tlsCryptV2Verify,
+}
+
+// IsHook reports whether name is a built-in hook
+func IsHook(name string) bool {
+	_, ok := hooks[name]
+	return ok
+}
+
+// Run runs a built-in hook and returns the process exit code
+func Run(name string, args []string) int {
+	hook, ok := hooks[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown hook %q\n", name)
+		return 2
+	}
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	api := flags.String("api", DefaultAPI, "End-node API on loopback")
+	failOpen := flags.Bool("fail-open", false, "Let clients in when the end-node API cannot be reached")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := hook(*api, *failOpen, flags.Args(), os.Getenv); err != nil {
+		fmt.Fprintf(os.Stderr, "%s hook: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// clientConnect asks the end-node whether the connecting client may connect and writes the
+// per-user config it returns to the file OpenVPN passes. A non-zero exit rejects the client.
+// When the end-node API cannot be reached the client is rejected, unless failOpen leaves it
+// to the CRL.
+func clientConnect(api string, failOpen bool, args []string, getenv func(string) string) error {
+	req := shared.ConnectRequest{
+		Username:       getenv("common_name"),
+		RealAddress:    realAddress(getenv),
+		VirtualAddress: getenv("ifconfig_pool_remote_ip"),
+	}
+	if req.Username == "" {
+		return fmt.Errorf("common_name is not set, not run by OpenVPN?")
+	}
+
+	var decision shared.ConnectDecision
+	if err := post(api+"/api/hooks/client-connect", req, &decision); err != nil {
+		if !failOpen {
+			return fmt.Errorf("connection of %s rejected, access could not be checked: %v", req.Username, err)
+		}
+		fmt.Fprintf(os.Stderr, "client-connect hook: allowing %s unchecked: %v\n", req.Username, err)
+		return nil
+	}
+	if !decision.Allowed {
+		return fmt.Errorf("connection of %s rejected: %s", req.Username, decision.Reason)
+	}
+
+	if len(args) > 0 && decision.Config != "" {
+		if err := os.WriteFile(args[0], []byte(decision.Config), 0600); err != nil {
+			return fmt.Errorf("failed to write client config: %v", err)
+		}
+	}
+	return nil
+}
+
+// tlsCryptV2Verify asks the end-node whether the tls-crypt-v2 key a client presents is still
+// valid, before the TLS handshake. OpenVPN passes the key's metadata in the file named by
+// metadata_file. Keys without metadata this node wrote are rejected, and so are all keys when
+// the end-node API cannot be reached, unless failOpen leaves it to the CRL.
+func tlsCryptV2Verify(api string, failOpen bool, args []string, getenv func(string) string) error {
+	metadataType, err := strconv.Atoi(getenv("metadata_type"))
+	if err != nil {
+		return fmt.Errorf("metadata_type is not set, not run by OpenVPN?")
+	}
+	data, err := os.ReadFile(getenv("metadata_file"))
+	if err != nil {
+		return fmt.Errorf("failed to read metadata_file: %v", err)
+	}
+	metadata, err := openvpn.ParseTLSCryptV2Metadata(metadataType, data)
+	if err != nil {
+		return err
+	}
+
+	req := shared.TLSCryptV2VerifyRequest{Username: metadata.Username, IssuedAt: metadata.IssuedAt}
+	var decision shared.ConnectDecision
+	if err := post(api+"/api/hooks/tls-crypt-v2-verify", req, &decision); err != nil {
+		if !failOpen {
+			return fmt.Errorf("tls-crypt-v2 key of %s rejected, it could not be checked: %v", req.Username, err)
+		}
+		fmt.Fprintf(os.Stderr, "tls-crypt-v2-verify hook: accepting key of %s unchecked: %v\n", req.Username, err)
+		return nil
+	}
+	if !decision.Allowed {
+		return fmt.Errorf("tls-crypt-v2 key of %s rejected: %s", req.Username, decision.Reason)
+	}
+	return nil
+}
+
+// clientDisconnect reports the traffic of the session that ended
+func clientDisconnect(api string, _ bool, args []string, getenv func(string) string) error {
+	usage, err := sessionUsageFromEnv(getenv, time.Now())
+	if err != nil {
+		return err
+	}
+	return post(api+"/api/hooks/client-disconnect", usage, nil)
+}
+
+// realAddress returns the client's public address and port as reported by OpenVPN
+func realAddress(getenv func(string) string) string {
+	ip := getenv("trusted_ip")
+	if ip == "" {
+		ip = getenv("trusted_ip6")
+	}
+	if ip == "" {
+		return ""
+	}
+	if port := getenv("trusted_port"); port != "" {
+		return net.JoinHostPort(ip, port)
+	}
+	return ip
+}
+
+// sessionUsageFromEnv builds the usage record from the variables OpenVPN sets for client-disconnect
+func sessionUsageFromEnv(getenv func(string) string, now time.Time) (*shared.SessionUsage, error) {
+	usage := &shared.SessionUsage{
+		Username:       getenv("common_name"),
+		RealAddress:    realAddress(getenv),
+		VirtualAddress: getenv("ifconfig_pool_remote_ip"),
+		DisconnectedAt: now,
+	}
+	if usage.Username == "" {
+		return nil, fmt.Errorf("common_name is not set, not run by OpenVPN?")
+	}
+
+	var err error
+	if usage.BytesReceived, err = envInt(getenv, "bytes_received"); err != nil {
+		return nil, err
+	}
+	if usage.BytesSent, err = envInt(getenv, "bytes_sent"); err != nil {
+		return nil, err
+	}
+	duration, err := envInt(getenv, "time_duration")
+	if err != nil {
+		return nil, err
+	}
+	usage.DurationSeconds = int(duration)
+
+	connectedAt, err := envInt(getenv, "time_unix")
+	if err != nil {
+		connectedAt = now.Unix() - duration
+	}
+	usage.ConnectedAt = time.Unix(connectedAt, 0)
+
+	// Stable across retries, so management can drop a batch it already stored
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s", usage.Username, connectedAt, usage.RealAddress)))
+	usage.SessionID = hex.EncodeToString(sum[:16])
+
+	return usage, nil
+}
+
+// envInt parses a non-negative integer variable
+func envInt(getenv func(string) string, name string) (int64, error) {
+	value, err := strconv.ParseInt(getenv(name), 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, getenv(name))
+	}
+	return value, nil
+}
+
+// post sends a hook payload to the end-node API and decodes the response data into result, if given
+func post(url string, payload interface{}, result interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %v", err)
+	}
+
+	client := &http.Client{Timeout: hookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to reach end-node API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("end-node API returned status %d", resp.StatusCode)
+	}
+	if result == nil {
+		return nil
+	}
+
+	response := shared.APIResponse{Data: result}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to decode end-node API response: %v", err)
+	}
+	return nil
+}
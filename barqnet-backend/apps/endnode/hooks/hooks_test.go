@@ -0,0 +1,175 @@
+package hooks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+func testEnv(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+// TestSessionUsageFromEnv verifies the client-disconnect variables are mapped and the session ID is stable
+func TestSessionUsageFromEnv(t *testing.T) {
+	env := map[string]string{
+		"common_name":             "alice",
+		"bytes_received":          "1024",
+		"bytes_sent":              "4096",
+		"time_duration":           "60",
+		"time_unix":               "1700000000",
+		"trusted_ip":              "198.51.100.7",
+		"trusted_port":            "51234",
+		"ifconfig_pool_remote_ip": "10.8.0.6",
+	}
+	now := time.Unix(1700000060, 0)
+
+	usage, err := sessionUsageFromEnv(testEnv(env), now)
+	if err != nil {
+		t.Fatalf("sessionUsageFromEnv failed: %v", err)
+	}
+	if usage.Username != "alice" || usage.BytesReceived != 1024 || usage.BytesSent != 4096 || usage.DurationSeconds != 60 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+	if usage.RealAddress != "198.51.100.7:51234" || usage.VirtualAddress != "10.8.0.6" {
+		t.Errorf("Expected addresses 198.51.100.7:51234 and 10.8.0.6, got %s and %s", usage.RealAddress, usage.VirtualAddress)
+	}
+	if !usage.ConnectedAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Expected connected_at from time_unix, got %v", usage.ConnectedAt)
+	}
+
+	again, _ := sessionUsageFromEnv(testEnv(env), now.Add(time.Minute))
+	if again.SessionID != usage.SessionID || len(usage.SessionID) != 32 {
+		t.Errorf("Expected a stable 32 character session ID, got %q and %q", usage.SessionID, again.SessionID)
+	}
+
+	env["bytes_sent"] = "-1"
+	if _, err := sessionUsageFromEnv(testEnv(env), now); err == nil {
+		t.Error("Expected negative byte count to be rejected")
+	}
+	if _, err := sessionUsageFromEnv(testEnv(map[string]string{}), now); err == nil {
+		t.Error("Expected missing common_name to be rejected")
+	}
+}
+
+// TestClientDisconnect verifies the hook posts the session to the end-node API
+func TestClientDisconnect(t *testing.T) {
+	var got shared.SessionUsage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/hooks/client-disconnect" {
+			t.Errorf("Expected /api/hooks/client-disconnect, got %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	err := clientDisconnect(server.URL, false, nil, testEnv(map[string]string{
+		"common_name":    "bob",
+		"bytes_received": "10",
+		"bytes_sent":     "20",
+		"time_duration":  "5",
+	}))
+	if err != nil {
+		t.Fatalf("clientDisconnect failed: %v", err)
+	}
+	if got.Username != "bob" || got.BytesSent != 20 {
+		t.Errorf("Unexpected usage posted: %+v", got)
+	}
+}
+
+// TestClientConnect verifies the decision of the end-node API is enforced and its config written
+func TestClientConnect(t *testing.T) {
+	var decision shared.ConnectDecision
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req shared.ConnectRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Username != "alice" || req.RealAddress != "198.51.100.7:51234" {
+			t.Errorf("Unexpected connect request: %+v", req)
+		}
+		json.NewEncoder(w).Encode(shared.APIResponse{Success: true, Data: decision})
+	}))
+	defer server.Close()
+
+	env := testEnv(map[string]string{
+		"common_name":  "alice",
+		"trusted_ip":   "198.51.100.7",
+		"trusted_port": "51234",
+	})
+	configFile := filepath.Join(t.TempDir(), "client-connect.conf")
+
+	decision = shared.ConnectDecision{Allowed: true, Config: "session-timeout 60\n"}
+	if err := clientConnect(server.URL, false, []string{configFile}, env); err != nil {
+		t.Fatalf("Expected connection to be allowed, got %v", err)
+	}
+	if content, _ := os.ReadFile(configFile); string(content) != decision.Config {
+		t.Errorf("Expected config %q written, got %q", decision.Config, content)
+	}
+
+	decision = shared.ConnectDecision{Reason: "account is deactivated"}
+	if err := clientConnect(server.URL, false, []string{configFile}, env); err == nil {
+		t.Error("Expected connection to be rejected")
+	}
+
+	// An unreachable end-node API rejects everyone unless the hook fails open
+	server.Close()
+	if err := clientConnect(server.URL, false, nil, env); err == nil {
+		t.Error("Expected connection to be rejected when the end-node API is down")
+	}
+	if err := clientConnect(server.URL, true, nil, env); err != nil {
+		t.Errorf("Expected connection to be allowed with fail-open when the end-node API is down, got %v", err)
+	}
+}
+
+// TestTLSCryptV2Verify verifies revoked keys are rejected and keys without valid metadata never reach the API
+func TestTLSCryptV2Verify(t *testing.T) {
+	var decision shared.ConnectDecision
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req shared.TLSCryptV2VerifyRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Username != "alice" || req.IssuedAt != 1700000000 {
+			t.Errorf("Unexpected verify request: %+v", req)
+		}
+		json.NewEncoder(w).Encode(shared.APIResponse{Success: true, Data: decision})
+	}))
+	defer server.Close()
+
+	metadataFile := filepath.Join(t.TempDir(), "metadata")
+	if err := os.WriteFile(metadataFile, []byte(`{"cn":"alice","iat":1700000000}`), 0600); err != nil {
+		t.Fatalf("Failed to write metadata: %v", err)
+	}
+	env := testEnv(map[string]string{"metadata_type": "0", "metadata_file": metadataFile})
+
+	decision = shared.ConnectDecision{Allowed: true}
+	if err := tlsCryptV2Verify(server.URL, false, nil, env); err != nil {
+		t.Fatalf("Expected key to be accepted, got %v", err)
+	}
+
+	decision = shared.ConnectDecision{Reason: "tls-crypt-v2 key revoked"}
+	if err := tlsCryptV2Verify(server.URL, false, nil, env); err == nil {
+		t.Error("Expected revoked key to be rejected")
+	}
+
+	if err := tlsCryptV2Verify(server.URL, false, nil, testEnv(map[string]string{"metadata_type": "1", "metadata_file": metadataFile})); err == nil {
+		t.Error("Expected timestamp metadata to be rejected")
+	}
+
+	// An unreachable end-node API rejects every key unless the hook fails open, and bad
+	// metadata is rejected even then
+	server.Close()
+	if err := tlsCryptV2Verify(server.URL, false, nil, env); err == nil {
+		t.Error("Expected key to be rejected when the end-node API is down")
+	}
+	if err := tlsCryptV2Verify(server.URL, true, nil, env); err != nil {
+		t.Errorf("Expected key to be accepted with fail-open when the end-node API is down, got %v", err)
+	}
+	os.WriteFile(metadataFile, []byte("garbage"), 0600)
+	if err := tlsCryptV2Verify(server.URL, true, nil, env); err == nil {
+		t.Error("Expected key with unparsable metadata to be rejected")
+	}
+}
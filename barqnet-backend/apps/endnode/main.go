@@ -7,7 +7,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,17 +16,25 @@ import (
 
 	"barqnet-backend/pkg/shared"
 	"barqnet-backend/apps/endnode/api"
+	"barqnet-backend/apps/endnode/hooks"
 	"barqnet-backend/apps/endnode/manager"
+	"barqnet-backend/apps/endnode/shaping"
 )
 
 func main() {
+	// OpenVPN runs the built-in hooks as "endnode <hook> -api <url>"
+	if len(os.Args) > 1 && hooks.IsHook(os.Args[1]) {
+		os.Exit(hooks.Run(os.Args[1], os.Args[2:]))
+	}
+
 	var (
-		configFile  = flag.String("config", "endnode-config.json", "Configuration file path")
+		configFile  = flag.String("config", "endnode-config.json", "Configuration file path, JSON or YAML")
 		serverID    = flag.String("server-id", "", "Server ID for this end-node")
 		port        = flag.Int("port", 8081, "API server port")
 		openvpnDir  = flag.String("openvpn-dir", "/etc/openvpn", "OpenVPN configuration directory")
 		clientsDir  = flag.String("clients-dir", "/opt/vpnmanager/clients", "Directory to store client OVPN files")
 		easyrsaDir  = flag.String("easyrsa-dir", "/opt/vpnmanager/easyrsa", "EasyRSA directory for certificate generation")
+		checkConfig = flag.Bool("check-config", false, "Print the effective configuration with secrets masked and exit")
 		help        = flag.Bool("help", false, "Show help")
 	)
 	flag.Parse()
@@ -35,11 +44,9 @@ func main() {
 		return
 	}
 
-	// Store directories in environment for use by other components
-	os.Setenv("OPENVPN_DIR", *openvpnDir)
-	os.Setenv("CLIENTS_DIR", *clientsDir)
-	os.Setenv("EASYRSA_DIR", *easyrsaDir)
-	os.Setenv("ENDNODE_PORT", fmt.Sprintf("%d", *port))
+	// Flags only override the config file and environment when given
+	flagsSet := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { flagsSet[f.Name] = true })
 
 	// Load .env file if it exists
 	log.Println("========================================")
@@ -52,6 +59,39 @@ func main() {
 		log.Printf("[ENV] ✅ Loaded configuration from .env file")
 	}
 
+	// Load configuration: config file, then environment, then flags
+	config, err := loadConfig(*configFile, flagsSet["config"])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if flagsSet["server-id"] {
+		config.ServerID = *serverID
+	}
+	if flagsSet["port"] {
+		config.Port = *port
+	}
+	if flagsSet["openvpn-dir"] {
+		config.OpenVPNDir = *openvpnDir
+	}
+	if flagsSet["clients-dir"] {
+		config.ClientsDir = *clientsDir
+	}
+	if flagsSet["easyrsa-dir"] {
+		config.PKIDir = filepath.Join(*easyrsaDir, "pki")
+	}
+	if err := finishConfig(config); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	exportConfigEnv(config)
+
+	if *checkConfig {
+		masked, err := shared.MaskedConfig(config)
+		if err != nil {
+			log.Fatalf("Failed to render configuration: %v", err)
+		}
+		fmt.Println(string(masked))
+	}
+
 	// Validate environment variables before proceeding
 	// Note: Endnodes use ValidateEndnodeEnvironment() which doesn't require database credentials
 	// Endnodes communicate with Management API only, no direct database access needed
@@ -59,14 +99,13 @@ func main() {
 		log.Fatalf("❌ Environment validation failed: %v", err)
 	}
 
-	if *serverID == "" {
-		log.Fatal("Server ID is required. Use -server-id flag or set ENDNODE_SERVER_ID environment variable")
+	if config.ServerID == "" {
+		log.Fatal("Server ID is required. Use -server-id flag, set ENDNODE_SERVER_ID environment variable or server_id in the config file")
 	}
 
-	// Load configuration
-	config, err := loadConfig(*configFile)
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+	if *checkConfig {
+		log.Println("✅ Configuration is valid")
+		return
 	}
 
 	// End-nodes don't need direct database access
@@ -76,23 +115,39 @@ func main() {
 
 	// Create end-node manager (no database managers needed)
 	endNodeManager := manager.NewEndNodeManager(
-		*serverID,
+		config.ServerID,
 		config,
 	)
 
+	// Calls to the management server use mutual TLS when a node certificate is configured
+	if err := endNodeManager.EnableNodeTLS(); err != nil {
+		log.Fatalf("Failed to set up mutual TLS with the management server: %v", err)
+	}
+
+	// At first boot an enrollment token is exchanged for the end-node's own credential
+	if err := endNodeManager.Enroll(); err != nil {
+		log.Fatalf("Failed to enroll with the management server: %v", err)
+	}
+
+	// Reports queued while management was unreachable are replayed before anything new
+	if err := endNodeManager.OpenOutbox(); err != nil {
+		log.Fatalf("Failed to open outbox: %v", err)
+	}
+	go endNodeManager.StartOutboxReplay()
+
 	// Start API server
 	apiServer := api.NewEndNodeAPI(endNodeManager)
 	
 	// Start the API server in a goroutine
 	go func() {
-		if err := apiServer.Start(*port); err != nil {
+		if err := apiServer.Start(config.Port); err != nil {
 			log.Fatalf("Failed to start API server: %v", err)
 		}
 	}()
 
 	// Wait for the API server to fully start and be ready
 	log.Printf("Waiting for API server to fully initialize...")
-	healthURL := fmt.Sprintf("http://localhost:%d/health", *port)
+	healthURL := endNodeManager.LocalAPIURL() + "/health"
 	if err := waitForAPIServer(healthURL, 10*time.Second); err != nil {
 		log.Printf("Warning: API server health check failed: %v", err)
 		log.Printf("Proceeding with registration anyway...")
@@ -114,17 +169,44 @@ func main() {
 		log.Printf("✅ Successfully registered with management server")
 	}
 
+	// Fetch the user access list before OpenVPN asks the client-connect hook about anyone
+	if _, err := endNodeManager.SyncUserAccess(); err != nil {
+		log.Printf("Warning: Failed to fetch user access list: %v", err)
+	}
+
+	// Drop shaping rules of a previous run, then shape sessions that are still connected
+	if err := endNodeManager.ResetShaping(); err != nil {
+		log.Printf("Warning: Failed to reset bandwidth shaping: %v", err)
+	}
+	if err := endNodeManager.SyncShaping(); err != nil {
+		log.Printf("Warning: Failed to shape connected sessions: %v", err)
+	}
+
+	// Render server.conf from the server profile before any client profile is issued
+	if _, err := endNodeManager.SyncServerProfile(); err != nil {
+		log.Printf("Warning: Failed to apply server profile: %v", err)
+	}
+
 	// Start health check routine
 	go endNodeManager.StartHealthCheck()
 
 	// Start sync routine
 	go endNodeManager.StartSyncRoutine()
 
-	log.Printf("End-node server started with ID: %s", *serverID)
-	log.Printf("API server running on port %d", *port)
-	log.Printf("OpenVPN directory: %s", *openvpnDir)
-	log.Printf("Clients directory: %s", *clientsDir)
-	log.Printf("EasyRSA directory: %s", *easyrsaDir)
+	// Start client certificate renewal routine
+	go endNodeManager.StartCertRenewal()
+
+	// Ship server-counted session usage from the client-disconnect hook
+	go endNodeManager.StartUsageReporting()
+
+	// Keep the user access list checked by the client-connect hook current
+	go endNodeManager.StartAccessSync()
+
+	log.Printf("End-node server started with ID: %s", config.ServerID)
+	log.Printf("API server running on port %d", config.Port)
+	log.Printf("OpenVPN directory: %s", config.OpenVPNDir)
+	log.Printf("Clients directory: %s", config.ClientsDir)
+	log.Printf("PKI directory: %s", config.PKIDir)
 	log.Printf("Management URL: %s", config.ManagementURL)
 
 	// Wait for shutdown signal
@@ -133,6 +215,11 @@ func main() {
 	<-sigChan
 
 	log.Println("Shutting down end-node server...")
+
+	// Ship the usage of sessions that ended since the last report
+	if _, err := endNodeManager.FlushSessionUsage(); err != nil {
+		log.Printf("Warning: Failed to ship session usage: %v", err)
+	}
 	
 	// Deregister from management server
 	if err := endNodeManager.DeregisterFromManagement(); err != nil {
@@ -140,32 +227,221 @@ func main() {
 	}
 }
 
-func loadConfig(configFile string) (*shared.EndNodeConfig, error) {
-	// For now, return a default config
-	// In production, this would load from JSON file
+// loadConfig loads the configuration file over the defaults, then applies environment
+// variables. The file may only be missing when its path was not given explicitly.
+func loadConfig(configFile string, required bool) (*shared.EndNodeConfig, error) {
+	config := &shared.EndNodeConfig{
+		Port: 8081,
+		Database: shared.DatabaseConfig{
+			Host:    "localhost",
+			Port:    5432,
+			User:    "vpnmanager",
+			DBName:  "vpnmanager",
+			SSLMode: "disable",
+		},
+		OpenVPNManagement: "/var/run/openvpn/server.sock",
+		OpenVPNDir:        "/etc/openvpn",
+		ClientsDir:        "/opt/vpnmanager/clients",
+		PKIDir:            "/opt/vpnmanager/easyrsa/pki",
+		CertKeyType:       "ecdsa",
+		// Client certificate lifetime, default matches EasyRSA's 825 days
+		CertLifetimeDays:    825,
+		CertRenewBeforeDays: 30,
+		WireGuardInterface:  "wg0",
+		WireGuardConfigPath: "/etc/wireguard/wg0.conf",
+		WireGuardDNS:        []string{"1.1.1.1", "1.0.0.1"},
+		// Bandwidth shaping needs tc and CAP_NET_ADMIN
+		ShapingDevice: "tun0",
+		// Reports to management are queued on disk while it is unreachable
+		OutboxPath: "/opt/vpnmanager/outbox.log",
+		// Credential obtained by enrollment
+		NodeSecretFile: "/opt/vpnmanager/node_secret",
+		HookPort:       8082,
+	}
+	// The end-node binary itself runs the built-in OpenVPN hooks
+	if exe, err := os.Executable(); err == nil {
+		config.OpenVPNHookBinary = exe
+	}
 
-	// Get port from environment, default to 8081
-	port := 8081
-	if portStr := os.Getenv("ENDNODE_PORT"); portStr != "" {
-		if p, err := strconv.Atoi(portStr); err == nil && p > 0 {
-			port = p
+	if err := shared.LoadConfigFile(configFile, config); err != nil {
+		if !os.IsNotExist(err) || required {
+			return nil, err
+		}
+	} else {
+		log.Printf("[CONFIG] ✅ Loaded configuration from %s", configFile)
+	}
+
+	for key, value := range map[string]*string{
+		"ENDNODE_SERVER_ID":           &config.ServerID,
+		"MANAGEMENT_URL":              &config.ManagementURL,
+		"API_KEY":                     &config.APIKey,
+		"NODE_SECRET":                 &config.NodeSecret,
+		"ENROLLMENT_TOKEN":            &config.EnrollmentToken,
+		"NODE_SECRET_FILE":            &config.NodeSecretFile,
+		"ENDNODE_API_ADDRESS":         &config.APIAddress,
+		"DB_HOST":                     &config.Database.Host,
+		"DB_USER":                     &config.Database.User,
+		"DB_PASSWORD":                 &config.Database.Password,
+		"DB_NAME":                     &config.Database.DBName,
+		"DB_SSLMODE":                  &config.Database.SSLMode,
+		"OPENVPN_MANAGEMENT":          &config.OpenVPNManagement,
+		"OPENVPN_MANAGEMENT_PASSWORD": &config.OpenVPNManagementPassword,
+		"OPENVPN_CRL_PATH":            &config.CRLPath,
+		"OPENVPN_DIR":                 &config.OpenVPNDir,
+		"OPENVPN_SERVER_CONF":         &config.OpenVPNServerConfig,
+		"OPENVPN_CLIENT_CONNECT":      &config.OpenVPNClientConnect,
+		"OPENVPN_CLIENT_DISCONNECT":   &config.OpenVPNClientDisconnect,
+		"OPENVPN_CCD_DIR":             &config.OpenVPNCCDDir,
+		"OPENVPN_HOOK_BINARY":         &config.OpenVPNHookBinary,
+		"CLIENTS_DIR":                 &config.ClientsDir,
+		"CERT_KEY_TYPE":               &config.CertKeyType,
+		"WIREGUARD_INTERFACE":         &config.WireGuardInterface,
+		"WIREGUARD_CONFIG":            &config.WireGuardConfigPath,
+		"SHAPING_DEVICE":              &config.ShapingDevice,
+		"OUTBOX_PATH":                 &config.OutboxPath,
+		"NODE_TLS_CA_FILE":            &config.TLS.CAFile,
+		"NODE_TLS_CERT_FILE":          &config.TLS.CertFile,
+		"NODE_TLS_KEY_FILE":           &config.TLS.KeyFile,
+	} {
+		shared.EnvString(key, value)
+	}
+	for key, value := range map[string]*int{
+		"ENDNODE_PORT":           &config.Port,
+		"DB_PORT":                &config.Database.Port,
+		"CERT_LIFETIME_DAYS":     &config.CertLifetimeDays,
+		"CERT_RENEW_BEFORE_DAYS": &config.CertRenewBeforeDays,
+		"ENDNODE_HOOK_PORT":      &config.HookPort,
+	} {
+		if err := shared.EnvInt(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := shared.EnvBool("OPENVPN_HOOK_FAIL_OPEN", &config.OpenVPNHookFailOpen); err != nil {
+		return nil, err
+	}
+	if dir := os.Getenv("EASYRSA_DIR"); dir != "" {
+		config.PKIDir = filepath.Join(dir, "pki")
+	}
+
+	if value := os.Getenv("WIREGUARD_DNS"); value != "" {
+		config.WireGuardDNS = nil
+		for _, dns := range strings.Split(value, ",") {
+			if dns = strings.TrimSpace(dns); dns != "" {
+				config.WireGuardDNS = append(config.WireGuardDNS, dns)
+			}
+		}
+	}
+	if value := os.Getenv("ENDNODE_PUBLIC_ENDPOINTS"); value != "" {
+		publicEndpoints, err := shared.ParseEndpoints(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ENDNODE_PUBLIC_ENDPOINTS: %v", err)
+		}
+		config.PublicEndpoints = publicEndpoints
+	}
+	if value := os.Getenv("OPENVPN_LISTENERS"); value != "" {
+		listeners, err := shared.ParseListeners(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OPENVPN_LISTENERS: %v", err)
+		}
+		config.OpenVPNListeners = listeners
+	}
+
+	return config, nil
+}
+
+// finishConfig derives the paths left empty from the OpenVPN directory, applies "none"
+// and checks the effective configuration, whichever layer a setting came from
+func finishConfig(config *shared.EndNodeConfig) error {
+	if config.OpenVPNServerConfig == "" {
+		config.OpenVPNServerConfig = filepath.Join(config.OpenVPNDir, "server.conf")
+	}
+	if config.CRLPath == "" {
+		config.CRLPath = filepath.Join(config.OpenVPNDir, "crl.pem")
+	}
+	if config.OpenVPNCCDDir == "" {
+		config.OpenVPNCCDDir = filepath.Join(config.OpenVPNDir, "ccd")
+	}
+
+	// "none" disables the built-in hooks, bandwidth shaping, the outbox and keeping the credential
+	for _, value := range []*string{&config.OpenVPNHookBinary, &config.ShapingDevice, &config.OutboxPath, &config.NodeSecretFile} {
+		if *value == "none" {
+			*value = ""
+		}
+	}
+
+	if config.Port < 1 || config.Port > 65535 {
+		return fmt.Errorf("port %d must be between 1 and 65535", config.Port)
+	}
+	if config.CertLifetimeDays < 1 {
+		return fmt.Errorf("cert_lifetime_days must be positive")
+	}
+	if config.CertRenewBeforeDays < 1 {
+		return fmt.Errorf("cert_renew_before_days must be positive")
+	}
+	if config.ShapingDevice != "" {
+		if err := shaping.ValidateDevice(config.ShapingDevice); err != nil {
+			return fmt.Errorf("invalid shaping_device: %v", err)
+		}
+	}
+	// Advertised addresses; guessing them is wrong behind NAT
+	if config.APIAddress != "" {
+		if err := shared.ValidateEndpoint(config.APIAddress); err != nil {
+			return fmt.Errorf("invalid api_address: %v", err)
+		}
+	}
+	if err := shared.ValidateEndpoints(config.PublicEndpoints); err != nil {
+		return fmt.Errorf("invalid public_endpoints: %v", err)
+	}
+	// Transports the OpenVPN server listens on, declared to management at registration
+	if err := shared.ValidateListeners(config.OpenVPNListeners); err != nil {
+		return fmt.Errorf("invalid openvpn_listeners: %v", err)
+	}
+	// Mutual TLS with management; the hooks then reach the API on a loopback port of their own
+	if err := config.TLS.Validate(); err != nil {
+		return fmt.Errorf("invalid tls: %v", err)
+	}
+	if config.TLS.Enabled() {
+		if config.HookPort < 1 || config.HookPort > 65535 || config.HookPort == config.Port {
+			return fmt.Errorf("hook_port %d must be between 1 and 65535 and differ from port", config.HookPort)
+		}
+		if !strings.HasPrefix(config.ManagementURL, "https://") {
+			return fmt.Errorf("management_url %q must use https with mutual TLS", config.ManagementURL)
+		}
+	}
+	// Management only accepts end-nodes that present a credential of their own; one obtained
+	// by enrollment is kept in node_secret_file
+	if config.NodeSecret == "" && config.NodeSecretFile != "" {
+		secret, err := os.ReadFile(config.NodeSecretFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read node_secret_file: %v", err)
+		}
+		config.NodeSecret = strings.TrimSpace(string(secret))
+	}
+	if config.NodeSecret == "" && !config.TLS.Enabled() && config.EnrollmentToken == "" {
+		return fmt.Errorf("node_secret, enrollment_token or tls is required: management refuses end-nodes without a credential")
+	}
+	if config.NodeSecret == "" && config.EnrollmentToken != "" && config.NodeSecretFile == "" {
+		return fmt.Errorf("enrollment_token needs node_secret_file to keep the credential it is exchanged for")
+	}
+	if config.NodeSecret != "" && len(config.NodeSecret) < 32 {
+		return fmt.Errorf("node_secret must be the credential issued by management, at least 32 characters")
+	}
+	return nil
+}
+
+// exportConfigEnv sets the environment variables that are still read directly, and checked
+// by ValidateEndnodeEnvironment, to the effective settings
+func exportConfigEnv(config *shared.EndNodeConfig) {
+	vars := map[string]string{
+		"MANAGEMENT_URL": config.ManagementURL,
+		"API_KEY":        config.APIKey,
+		"CLIENTS_DIR":    config.ClientsDir,
+	}
+	for key, value := range vars {
+		if value != "" {
+			os.Setenv(key, value)
 		}
 	}
-	
-	return &shared.EndNodeConfig{
-		ServerID:      os.Getenv("ENDNODE_SERVER_ID"),
-		ManagementURL: os.Getenv("MANAGEMENT_URL"),
-		APIKey:        os.Getenv("API_KEY"),
-		Port:          port,
-		Database: shared.DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     5432,
-			User:     getEnv("DB_USER", "vpnmanager"),
-			Password: getEnv("DB_PASSWORD", ""),
-			DBName:   getEnv("DB_NAME", "vpnmanager"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
-		},
-	}, nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -204,7 +480,7 @@ func showHelp() {
 	fmt.Println("")
 	fmt.Println("Options:")
 	fmt.Println("  -config string")
-	fmt.Println("        Configuration file path (default: endnode-config.json)")
+	fmt.Println("        Configuration file path, JSON or YAML by extension (.yaml, .yml) (default: endnode-config.json)")
 	fmt.Println("  -server-id string")
 	fmt.Println("        Server ID for this end-node (required)")
 	fmt.Println("  -port int")
@@ -215,19 +491,63 @@ func showHelp() {
 	fmt.Println("        Directory to store client OVPN files (default: /opt/vpnmanager/clients)")
 	fmt.Println("  -easyrsa-dir string")
 	fmt.Println("        EasyRSA directory for certificate generation (default: /opt/vpnmanager/easyrsa)")
+	fmt.Println("  -check-config")
+	fmt.Println("        Print the effective configuration with secrets masked and exit")
 	fmt.Println("  -help")
 	fmt.Println("        Show this help message")
 	fmt.Println("")
+	fmt.Println("Configuration:")
+	fmt.Println("  Settings are read from the JSON or YAML config file, then from environment variables,")
+	fmt.Println("  then from command line flags; each overrides the one before. Unknown keys in")
+	fmt.Println("  the config file are rejected. The config file may be missing unless -config is given.")
+	fmt.Println("")
 	fmt.Println("Environment Variables:")
 	fmt.Println("  ENDNODE_SERVER_ID    Server ID for this end-node")
 	fmt.Println("  MANAGEMENT_URL       Management server URL")
 	fmt.Println("  API_KEY              API key for authentication")
+	fmt.Println("  NODE_SECRET          Credential issued with vpnmanager-management -issue-node-credential; requests to and from management are then signed with it instead of carrying API_KEY (required unless mutual TLS or ENROLLMENT_TOKEN is configured)")
+	fmt.Println("  ENROLLMENT_TOKEN     Single-use token minted on management with POST /api/enrollment-tokens, exchanged at first boot for NODE_SECRET")
+	fmt.Println("  NODE_SECRET_FILE     File the credential obtained by enrollment is kept in and loaded from when NODE_SECRET is unset (default: /opt/vpnmanager/node_secret, \"none\" disables)")
+	fmt.Println("  ENDNODE_PORT         API server port (default: 8081)")
+	fmt.Println("  ENDNODE_API_ADDRESS  Address the management server reaches this end-node's API on (default: guessed local IP)")
+	fmt.Println("  ENDNODE_PUBLIC_ENDPOINTS  Comma separated hosts or IPs (IPv4/IPv6) VPN clients connect to, in order of preference (default: the API address)")
+	fmt.Println("  OPENVPN_LISTENERS    Comma separated protocol/port listeners in order of preference, e.g. udp/1194,tcp/443 (default: the server profile's port and protocol; several need OpenVPN 2.7 or later)")
 	fmt.Println("  OPENVPN_DIR          OpenVPN configuration directory")
 	fmt.Println("  CLIENTS_DIR          Directory to store client OVPN files")
 	fmt.Println("  EASYRSA_DIR          EasyRSA directory for certificate generation")
+	fmt.Println("  OPENVPN_MANAGEMENT   OpenVPN management socket path or host:port (default: /var/run/openvpn/server.sock)")
+	fmt.Println("  OPENVPN_MANAGEMENT_PASSWORD  OpenVPN management interface password (optional)")
+	fmt.Println("  OPENVPN_CRL_PATH     CRL file read by OpenVPN crl-verify (default: $OPENVPN_DIR/crl.pem)")
+	fmt.Println("  OPENVPN_SERVER_CONF  server.conf rendered from the management server profile (default: $OPENVPN_DIR/server.conf)")
+	fmt.Println("  OPENVPN_CLIENT_CONNECT     client-connect hook added to server.conf (optional)")
+	fmt.Println("  OPENVPN_CLIENT_DISCONNECT  client-disconnect hook added to server.conf (optional)")
+	fmt.Println("  OPENVPN_CCD_DIR      Per-user client-config-dir synced from the management server (default: $OPENVPN_DIR/ccd)")
+	fmt.Println("  OPENVPN_HOOK_BINARY  End-node binary OpenVPN runs for the built-in client-connect, client-disconnect and tls-crypt-v2-verify hooks (default: this binary, \"none\" disables)")
+	fmt.Println("  OPENVPN_HOOK_FAIL_OPEN  Let clients in when the client-connect and tls-crypt-v2-verify hooks cannot reach the end-node API (default: false, they are rejected)")
+	fmt.Println("  CERT_KEY_TYPE        Client certificate key type: ecdsa, ed25519 or rsa (default: ecdsa)")
+	fmt.Println("  CERT_LIFETIME_DAYS   Client certificate lifetime in days (default: 825)")
+	fmt.Println("  CERT_RENEW_BEFORE_DAYS  Renew client certificates this many days before expiry (default: 30)")
+	fmt.Println("  WIREGUARD_INTERFACE  WireGuard interface name (default: wg0)")
+	fmt.Println("  WIREGUARD_CONFIG     WireGuard server config managed by the end-node (default: /etc/wireguard/wg0.conf)")
+	fmt.Println("  WIREGUARD_DNS        Comma separated DNS servers for WireGuard clients (default: 1.1.1.1,1.0.0.1)")
+	fmt.Println("  SHAPING_DEVICE       OpenVPN tunnel device per-user bandwidth limits are applied on with tc (default: tun0, \"none\" disables)")
+	fmt.Println("  NODE_TLS_CA_FILE     Node CA certificate of the management server; with the two below, the API requires the management certificate and MANAGEMENT_URL must be https (default: plain HTTP)")
+	fmt.Println("  NODE_TLS_CERT_FILE   End-node certificate issued with vpnmanager-management -issue-node-cert")
+	fmt.Println("  NODE_TLS_KEY_FILE    Private key of the end-node certificate")
+	fmt.Println("  ENDNODE_HOOK_PORT    Loopback port the OpenVPN hooks use while the API requires mutual TLS (default: 8082)")
+	fmt.Println("  OUTBOX_PATH          File health reports, user syncs, audit events, certificate reports, session usage and CRL publications are queued in while management is unreachable (default: /opt/vpnmanager/outbox.log, \"none\" disables)")
+	fmt.Println("")
+	fmt.Println("Hooks (run by OpenVPN, see OPENVPN_HOOK_BINARY):")
+	fmt.Println("  endnode client-connect [-api http://127.0.0.1:8081] [-fail-open] [config-file]")
+	fmt.Println("        Reject unknown, deactivated and expired users and users over their session limit,")
+	fmt.Println("        and write the per-user config for the session to config-file. Clients are")
+	fmt.Println("        rejected when the end-node API cannot be reached, unless -fail-open is given")
+	fmt.Println("  endnode client-disconnect [-api http://127.0.0.1:8081]")
+	fmt.Println("        Report the traffic of a finished session for server-side accounting")
 	fmt.Println("")
 	fmt.Println("Examples:")
 	fmt.Println("  endnode -server-id server-1 -port 8081")
 	fmt.Println("  endnode -server-id server-1 -openvpn-dir /etc/openvpn -clients-dir /opt/vpnmanager/clients")
 	fmt.Println("  ENDNODE_SERVER_ID=server-1 MANAGEMENT_URL=http://management:8085 endnode")
+	fmt.Println("  endnode -config /etc/vpnmanager/endnode-config.json -check-config")
 }
@@ -0,0 +1,273 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// StartAccessSync keeps the user access list current so deactivated users are
+// rejected at connect time well before their certificate is revoked
+func (enm *EndNodeManager) StartAccessSync() {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := enm.SyncUserAccess(); err != nil {
+			log.Printf("[ACCESS] Warning: %v", err)
+		}
+	}
+}
+
+// SyncUserAccess pulls the user access list from the management server and caches it next
+// to server.conf, so connections are still checked while management is unreachable.
+// It returns true if the list changed.
+func (enm *EndNodeManager) SyncUserAccess() (bool, error) {
+	enm.accessSyncMu.Lock()
+	defer enm.accessSyncMu.Unlock()
+
+	var knownVersion string
+	if current := enm.accessList(); current != nil {
+		knownVersion = current.Version
+	}
+
+	list, err := enm.fetchAccessList(knownVersion)
+	if err != nil {
+		return false, err
+	}
+	if list == nil {
+		return false, nil
+	}
+
+	enm.setAccessList(list)
+
+	data, err := json.Marshal(list)
+	if err == nil {
+		err = os.WriteFile(enm.accessCachePath(), data, 0600)
+	}
+	if err != nil {
+		log.Printf("[ACCESS] Warning: Failed to cache access list: %v", err)
+	}
+
+	log.Printf("[ACCESS] ✅ Access list version %s applied (%d users)", list.Version, len(list.Users))
+
+	// Bandwidth limits of connected users may have changed
+	if err := enm.SyncShaping(); err != nil {
+		log.Printf("[SHAPING] Warning: %v", err)
+	}
+	return true, nil
+}
+
+// AuthorizeConnect decides whether a connecting OpenVPN client is let in, for the client-connect
+// hook. Users must be known to the management server, active, unexpired and within their session
+// limit, which management checks across end-nodes. Before the first access list was received
+// connections are allowed, leaving it to the CRL.
+func (enm *EndNodeManager) AuthorizeConnect(req shared.ConnectRequest) *shared.ConnectDecision {
+	if err := validateUsernameForCommand(req.Username); err != nil {
+		return &shared.ConnectDecision{Reason: fmt.Sprintf("invalid common name: %v", err)}
+	}
+
+	list := enm.accessList()
+	if list == nil {
+		log.Printf("[ACCESS] ⚠️  No access list received yet, allowing %s", req.Username)
+		return &shared.ConnectDecision{Allowed: true}
+	}
+
+	enm.accessMu.Lock()
+	access, ok := enm.accessUsers[req.Username]
+	enm.accessMu.Unlock()
+	if !ok {
+		return &shared.ConnectDecision{Reason: "unknown user"}
+	}
+
+	now := time.Now()
+	if reason := access.Authorize(now); reason != "" {
+		return &shared.ConnectDecision{Reason: reason}
+	}
+
+	if access.MaxSessions > 0 {
+		decision, err := enm.checkSessionLimit(req)
+		if err != nil {
+			// Better to let one session too many in than to lock everyone out
+			log.Printf("[ACCESS] ⚠️  Failed to check session limit of %s, not enforcing it: %v", req.Username, err)
+		} else if !decision.Allowed {
+			return &shared.ConnectDecision{Reason: decision.Reason}
+		}
+	}
+
+	enm.ShapeSession(req.Username, req.VirtualAddress)
+
+	return &shared.ConnectDecision{
+		Allowed: true,
+		Config:  shared.RenderClientConnectConfig(&access, now),
+	}
+}
+
+// BlockUser rejects further connections of a user and disconnects its sessions. The block
+// holds until an access list from the management server replaces it.
+func (enm *EndNodeManager) BlockUser(username, reason string) (int, error) {
+	if err := validateUsernameForCommand(username); err != nil {
+		return 0, fmt.Errorf("invalid username for block: %v", err)
+	}
+
+	// Block before disconnecting, so the client cannot reconnect in between
+	enm.accessMu.Lock()
+	if enm.accessUsers != nil {
+		access, ok := enm.accessUsers[username]
+		if !ok {
+			access = shared.UserAccess{Username: username, Active: true}
+		}
+		access.Blocked = reason
+		enm.accessUsers[username] = access
+	}
+	enm.accessMu.Unlock()
+
+	log.Printf("[ACCESS] ❌ %s blocked: %s", username, reason)
+	return enm.DisconnectUser(username)
+}
+
+// checkSessionLimit asks the management server whether a user with a session limit may open
+// one more session. The timeout stays under the hook's, so OpenVPN is not kept waiting.
+func (enm *EndNodeManager) checkSessionLimit(connect shared.ConnectRequest) (*shared.ConnectDecision, error) {
+	data, err := json.Marshal(connect)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal session check: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/api/endnodes-sessions/%s", enm.config.ManagementURL, enm.serverID)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if err := enm.authorize(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := enm.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach management server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("session check failed with status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Success bool                   `json:"success"`
+		Data    shared.ConnectDecision `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode session check: %v", err)
+	}
+	if !response.Success {
+		return nil, fmt.Errorf("management server rejected the session check")
+	}
+
+	return &response.Data, nil
+}
+
+// hasSessionLimit reports whether the access list limits a user's concurrent sessions
+func (enm *EndNodeManager) hasSessionLimit(username string) bool {
+	enm.accessMu.Lock()
+	defer enm.accessMu.Unlock()
+	return enm.accessUsers[username].MaxSessions > 0
+}
+
+// accessList returns the current access list, loading it from the cache after a restart.
+// It returns nil if no list was received yet.
+func (enm *EndNodeManager) accessList() *shared.AccessList {
+	enm.accessMu.Lock()
+	list := enm.access
+	enm.accessMu.Unlock()
+	if list != nil {
+		return list
+	}
+
+	data, err := os.ReadFile(enm.accessCachePath())
+	if err != nil {
+		return nil
+	}
+	var cached shared.AccessList
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Version == "" {
+		log.Printf("[ACCESS] Warning: Ignoring invalid access list cache %s", enm.accessCachePath())
+		return nil
+	}
+
+	enm.setAccessList(&cached)
+	return &cached
+}
+
+// setAccessList replaces the access list and its lookup index
+func (enm *EndNodeManager) setAccessList(list *shared.AccessList) {
+	users := make(map[string]shared.UserAccess, len(list.Users))
+	for _, user := range list.Users {
+		users[user.Username] = user
+	}
+
+	enm.accessMu.Lock()
+	enm.access = list
+	enm.accessUsers = users
+	enm.accessMu.Unlock()
+}
+
+// accessCachePath is where the access list is kept across end-node restarts
+func (enm *EndNodeManager) accessCachePath() string {
+	return filepath.Join(filepath.Dir(enm.config.OpenVPNServerConfig), "user-access.json")
+}
+
+// fetchAccessList gets the user access list from the management server.
+// It returns nil when management answers 304 Not Modified for the known version.
+func (enm *EndNodeManager) fetchAccessList(knownVersion string) (*shared.AccessList, error) {
+	url := fmt.Sprintf("%s/api/endnodes-access/%s", enm.config.ManagementURL, enm.serverID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	if err := enm.authorize(req); err != nil {
+		return nil, err
+	}
+	if knownVersion != "" {
+		req.Header.Set("If-None-Match", fmt.Sprintf("\"%s\"", knownVersion))
+	}
+
+	resp, err := enm.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch access list: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("access list request failed with status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Success bool              `json:"success"`
+		Data    shared.AccessList `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode access list: %v", err)
+	}
+	if !response.Success || response.Data.Version == "" {
+		return nil, fmt.Errorf("management server returned an invalid access list")
+	}
+
+	return &response.Data, nil
+}
@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+const (
+	// usageBatchSize is the number of finished sessions shipped per request
+	usageBatchSize = 100
+	// maxPendingUsage caps the sessions kept in memory while management is unreachable and
+	// no outbox is configured; with an outbox batches are queued on disk instead
+	maxPendingUsage = 10000
+)
+
+// RecordSessionUsage queues the usage of a finished session, reported by the
+// client-disconnect hook, for shipping to the management server
+func (enm *EndNodeManager) RecordSessionUsage(usage shared.SessionUsage) error {
+	if err := validateUsernameForCommand(usage.Username); err != nil {
+		return fmt.Errorf("invalid username in session usage: %v", err)
+	}
+	if usage.BytesReceived < 0 || usage.BytesSent < 0 || usage.DurationSeconds < 0 {
+		return fmt.Errorf("invalid session usage: negative counters")
+	}
+
+	enm.usageMu.Lock()
+	enm.pendingUsage = append(enm.pendingUsage, usage)
+	if dropped := len(enm.pendingUsage) - maxPendingUsage; dropped > 0 {
+		enm.pendingUsage = enm.pendingUsage[dropped:]
+		log.Printf("[USAGE] ⚠️  Dropped %d session usage records, management server unreachable", dropped)
+	}
+	full := len(enm.pendingUsage) >= usageBatchSize
+	enm.usageMu.Unlock()
+
+	// Ended sessions of users with a session limit stop counting once management has them
+	if full || enm.hasSessionLimit(usage.Username) {
+		go func() {
+			if _, err := enm.FlushSessionUsage(); err != nil {
+				log.Printf("[USAGE] Warning: %v", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// StartUsageReporting ships queued session usage to the management server every 30 seconds
+func (enm *EndNodeManager) StartUsageReporting() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := enm.FlushSessionUsage(); err != nil {
+			log.Printf("[USAGE] Warning: %v", err)
+		}
+	}
+}
+
+// FlushSessionUsage ships queued session usage in batches. Records that could not be
+// shipped stay queued for the next flush. It returns the number of records shipped.
+func (enm *EndNodeManager) FlushSessionUsage() (int, error) {
+	enm.usageFlushMu.Lock()
+	defer enm.usageFlushMu.Unlock()
+
+	enm.usageMu.Lock()
+	pending := enm.pendingUsage
+	enm.pendingUsage = nil
+	enm.usageMu.Unlock()
+
+	shipped := 0
+	for shipped < len(pending) {
+		end := shipped + usageBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+
+		if err := enm.sendSessionUsage(pending[shipped:end]); err != nil {
+			// Requeue ahead of sessions recorded meanwhile, keeping the order
+			enm.usageMu.Lock()
+			enm.pendingUsage = append(append([]shared.SessionUsage{}, pending[shipped:]...), enm.pendingUsage...)
+			if dropped := len(enm.pendingUsage) - maxPendingUsage; dropped > 0 {
+				enm.pendingUsage = enm.pendingUsage[dropped:]
+				log.Printf("[USAGE] ⚠️  Dropped %d session usage records, management server unreachable", dropped)
+			}
+			enm.usageMu.Unlock()
+			return shipped, fmt.Errorf("failed to ship session usage (%d records queued): %v", len(pending)-shipped, err)
+		}
+		shipped = end
+	}
+
+	if shipped > 0 {
+		log.Printf("[USAGE] ✅ Shipped usage of %d finished sessions", shipped)
+	}
+	return shipped, nil
+}
+
+// sendSessionUsage ships one batch of server-counted session usage to the management server
+// through the outbox, so billing records survive restarts while management is unreachable
+func (enm *EndNodeManager) sendSessionUsage(records []shared.SessionUsage) error {
+	batch := shared.SessionUsageBatch{
+		ServerID: enm.serverID,
+		Source:   shared.UsageSourceServer,
+		Records:  records,
+		SentAt:   time.Now(),
+	}
+
+	path := fmt.Sprintf("/api/endnodes-usage/%s", enm.serverID)
+	_, err := enm.report("usage", path, batch)
+
+	// A batch management rejects would be rejected again on every retry
+	if rejected, ok := err.(*errReportRejected); ok {
+		log.Printf("[USAGE] ❌ Management rejected usage of %d sessions, dropping them: %v", len(records), rejected)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send session usage: %v", err)
+	}
+	return nil
+}
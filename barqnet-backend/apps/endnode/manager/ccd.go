@@ -0,0 +1,225 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// SyncClientConfigs pulls the client-config-dir entries for this end-node from the management
+// server and writes them to ccd/<username>, rendered against the applied server profile.
+// Managed files of users without an entry are removed; files created by hand are left alone.
+// OpenVPN reads a CCD file when a client connects, so sessions of changed users are disconnected
+// and reconnect with the new settings. It returns the number of users whose file changed.
+func (enm *EndNodeManager) SyncClientConfigs() (int, error) {
+	enm.ccdSyncMu.Lock()
+	defer enm.ccdSyncMu.Unlock()
+
+	dir := enm.config.OpenVPNCCDDir
+	if dir == "" {
+		return 0, nil
+	}
+
+	var knownVersion string
+	if enm.ccdSet != nil {
+		knownVersion = enm.ccdSet.Version
+	}
+	set, err := enm.fetchClientConfigs(knownVersion)
+	if err != nil {
+		return 0, err
+	}
+	if set == nil {
+		// Unchanged on management, still re-render in case the server profile changed
+		set = enm.ccdSet
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create client config directory: %v", err)
+	}
+
+	networksBefore := strings.Join(clientNetworks(dir), ",")
+	profile := enm.serverProfile()
+
+	desired := make(map[string][]byte, len(set.Entries))
+	for i := range set.Entries {
+		entry := &set.Entries[i]
+		content, err := shared.RenderCCD(profile, entry)
+		if err != nil {
+			// A file the profile no longer accepts is dropped rather than left stale
+			log.Printf("[CCD] ⚠️  Skipping client config for %s: %v", entry.Username, err)
+			continue
+		}
+		desired[entry.Username] = content
+	}
+
+	var changed []string
+	for username, content := range desired {
+		path := filepath.Join(dir, username)
+		current, err := os.ReadFile(path)
+		if err == nil && bytes.Equal(current, content) {
+			continue
+		}
+		if err == nil && !isManagedCCD(current) {
+			log.Printf("[CCD] Replacing hand-written client config %s", path)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			log.Printf("[CCD] ❌ Failed to write %s: %v", path, err)
+			continue
+		}
+		changed = append(changed, username)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read client config directory: %v", err)
+	}
+	for _, file := range files {
+		if file.IsDir() || desired[file.Name()] != nil {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		content, err := os.ReadFile(path)
+		if err != nil || !isManagedCCD(content) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("[CCD] ❌ Failed to remove %s: %v", path, err)
+			continue
+		}
+		changed = append(changed, file.Name())
+	}
+
+	enm.ccdSet = set
+	if len(changed) == 0 {
+		return 0, nil
+	}
+	sort.Strings(changed)
+
+	// Networks behind site-to-site clients need a route in server.conf
+	if strings.Join(clientNetworks(dir), ",") != networksBefore {
+		enm.profileSyncMu.Lock()
+		if applied := enm.appliedServerProfile(); applied != nil {
+			if _, err := enm.applyServerConfig(applied); err != nil {
+				log.Printf("[CCD] ⚠️  Failed to update server routes for iroutes: %v", err)
+			}
+		} else {
+			log.Printf("[CCD] ⚠️  iroutes changed but server.conf is not managed yet, add the routes manually")
+		}
+		enm.profileSyncMu.Unlock()
+	}
+
+	for _, username := range changed {
+		if validateUsernameForCommand(username) != nil {
+			continue
+		}
+		if _, err := enm.DisconnectUser(username); err != nil {
+			log.Printf("[CCD] ⚠️  Failed to disconnect %s to apply its client config: %v", username, err)
+		}
+	}
+
+	log.Printf("[CCD] ✅ Client configs version %s applied (%d entries, changed: %v)", set.Version, len(desired), changed)
+	return len(changed), nil
+}
+
+// isManagedCCD reports whether a CCD file was written by the end-node
+func isManagedCCD(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(shared.CCDHeader))
+}
+
+// clientNetworks returns the iroute networks of the managed CCD files in dir, sorted
+func clientNetworks(dir string) []string {
+	if dir == "" {
+		return nil
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil || !isManagedCCD(content) {
+			continue
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 3 || fields[0] != "iroute" {
+				continue
+			}
+			addr, err := netip.ParseAddr(fields[1])
+			mask := net.ParseIP(fields[2])
+			if err != nil || mask == nil {
+				continue
+			}
+			bits, _ := net.IPMask(mask.To4()).Size()
+			seen[netip.PrefixFrom(addr, bits).String()] = true
+		}
+	}
+
+	networks := make([]string, 0, len(seen))
+	for network := range seen {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+	return networks
+}
+
+// fetchClientConfigs gets the client-config-dir entries for this end-node from the management
+// server. It returns nil when management answers 304 Not Modified for the known version.
+func (enm *EndNodeManager) fetchClientConfigs(knownVersion string) (*shared.ClientConfigSet, error) {
+	url := fmt.Sprintf("%s/api/endnodes-ccd/%s", enm.config.ManagementURL, enm.serverID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	if err := enm.authorize(req); err != nil {
+		return nil, err
+	}
+	if knownVersion != "" {
+		req.Header.Set("If-None-Match", fmt.Sprintf("\"%s\"", knownVersion))
+	}
+
+	resp, err := enm.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch client configs: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("client config request failed with status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Success bool                   `json:"success"`
+		Data    shared.ClientConfigSet `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode client configs: %v", err)
+	}
+	if !response.Success || response.Data.Version == "" {
+		return nil, fmt.Errorf("management server returned invalid client configs")
+	}
+
+	return &response.Data, nil
+}
@@ -0,0 +1,228 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/pki"
+	"barqnet-backend/pkg/shared"
+)
+
+// ListCertificates returns the newest certificate of every common name in the PKI index.
+// When expiringWithin is positive only unrevoked certificates expiring before now+expiringWithin are returned.
+func (enm *EndNodeManager) ListCertificates(expiringWithin time.Duration) ([]shared.ClientCertificate, error) {
+	ca, err := enm.certificateAuthority()
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := latestCertificates(ca)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cutoff := now.Add(expiringWithin)
+	certs := []shared.ClientCertificate{}
+	for commonName, entry := range latest {
+		cert := shared.ClientCertificate{
+			Username:      commonName,
+			ServerID:      enm.serverID,
+			Serial:        entry.SerialHex(),
+			NotAfter:      entry.Expiry,
+			Status:        certificateStatus(entry, now),
+			DaysRemaining: shared.DaysUntil(entry.Expiry, now),
+		}
+
+		if expiringWithin > 0 && (cert.Status == shared.CertStatusRevoked || entry.Expiry.After(cutoff)) {
+			continue
+		}
+		certs = append(certs, cert)
+	}
+
+	sort.Slice(certs, func(i, j int) bool {
+		return certs[i].NotAfter.Before(certs[j].NotAfter)
+	})
+
+	return certs, nil
+}
+
+// RenewCertificate re-issues a user's client certificate and rewrites the certificate and key
+// embedded in the user's .ovpn file. The previous certificate stays valid until it expires.
+func (enm *EndNodeManager) RenewCertificate(username string) (*shared.ClientCertificate, error) {
+	// SECURITY: Validate username before using in paths
+	if err := validateUsernameForCommand(username); err != nil {
+		return nil, fmt.Errorf("invalid username for certificate renewal: %v", err)
+	}
+
+	ovpnPath := filepath.Join(ClientsDir(), username+".ovpn")
+	ovpnContent, err := os.ReadFile(ovpnPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OVPN file %s: %v", ovpnPath, err)
+	}
+
+	ca, err := enm.certificateAuthority()
+	if err != nil {
+		return nil, err
+	}
+
+	issued, err := ca.RenewClient(username, pki.IssueOptions{
+		KeyType:  pki.KeyType(enm.config.CertKeyType),
+		Lifetime: time.Duration(enm.config.CertLifetimeDays) * 24 * time.Hour,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew certificate: %v", err)
+	}
+
+	content := string(ovpnContent)
+	for _, block := range []struct{ tag, value string }{
+		{"ca", string(ca.CACertPEM())},
+		{"cert", string(issued.CertPEM)},
+		{"key", string(issued.KeyPEM)},
+	} {
+		var ok bool
+		if content, ok = replaceInlineBlock(content, block.tag, block.value); !ok {
+			return nil, fmt.Errorf("OVPN file %s has no <%s> block to update", ovpnPath, block.tag)
+		}
+	}
+
+	if err := os.WriteFile(ovpnPath, []byte(content), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write OVPN file: %v", err)
+	}
+
+	log.Printf("✅ Certificate renewed for user %s (serial %X, expires %s)", username, issued.Serial, issued.NotAfter.Format(time.RFC3339))
+
+	now := time.Now()
+	return &shared.ClientCertificate{
+		Username:      username,
+		ServerID:      enm.serverID,
+		Serial:        fmt.Sprintf("%X", issued.Serial),
+		NotAfter:      issued.NotAfter,
+		Status:        shared.CertStatusValid,
+		DaysRemaining: shared.DaysUntil(issued.NotAfter, now),
+	}, nil
+}
+
+// StartCertRenewal starts the routine that renews client certificates before they expire
+func (enm *EndNodeManager) StartCertRenewal() {
+	// Report the current inventory once at startup so management has expiry data
+	if err := enm.renewExpiringCertificates(); err != nil {
+		log.Printf("Certificate renewal failed: %v", err)
+	}
+
+	ticker := time.NewTicker(6 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := enm.renewExpiringCertificates(); err != nil {
+			log.Printf("Certificate renewal failed: %v", err)
+		}
+	}
+}
+
+// renewExpiringCertificates renews client certificates inside the renewal window and
+// reports the resulting inventory to the management server
+func (enm *EndNodeManager) renewExpiringCertificates() error {
+	window := time.Duration(enm.config.CertRenewBeforeDays) * 24 * time.Hour
+
+	expiring, err := enm.ListCertificates(window)
+	if err != nil {
+		return err
+	}
+
+	var renewed []string
+	for _, cert := range expiring {
+		// Only certificates with a client profile on this node are renewed
+		if _, err := os.Stat(filepath.Join(ClientsDir(), cert.Username+".ovpn")); err != nil {
+			continue
+		}
+
+		log.Printf("Certificate for user %s expires in %d day(s), renewing", cert.Username, cert.DaysRemaining)
+		if _, err := enm.RenewCertificate(cert.Username); err != nil {
+			log.Printf("❌ Failed to renew certificate for user %s: %v", cert.Username, err)
+			continue
+		}
+		renewed = append(renewed, cert.Username)
+	}
+
+	if len(renewed) > 0 {
+		log.Printf("✅ Renewed %d client certificate(s)", len(renewed))
+	}
+
+	return enm.reportCertificates(renewed)
+}
+
+// reportCertificates sends the client certificate inventory to the management server through
+// the outbox. Only common names with a client profile in the clients directory are reported.
+func (enm *EndNodeManager) reportCertificates(renewed []string) error {
+	certs, err := enm.ListCertificates(0)
+	if err != nil {
+		return err
+	}
+
+	report := shared.CertificateReport{
+		ServerID:     enm.serverID,
+		Certificates: []shared.ClientCertificate{},
+		Renewed:      renewed,
+	}
+	for _, cert := range certs {
+		if validateUsernameForCommand(cert.Username) != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(ClientsDir(), cert.Username+".ovpn")); err != nil {
+			continue
+		}
+		report.Certificates = append(report.Certificates, cert)
+	}
+
+	// Queued while management is unreachable, so renewed users are still marked unsynced
+	path := fmt.Sprintf("/api/endnodes-certs/%s", enm.serverID)
+	if _, err := enm.report("certs", path, report); err != nil {
+		return fmt.Errorf("failed to send certificate report: %v", err)
+	}
+	return nil
+}
+
+// certificateStatus maps an index entry to valid, expired or revoked
+func certificateStatus(entry pki.IndexEntry, now time.Time) string {
+	switch {
+	case entry.Status == pki.StatusRevoked:
+		return shared.CertStatusRevoked
+	case entry.IsValid(now):
+		return shared.CertStatusValid
+	default:
+		return shared.CertStatusExpired
+	}
+}
+
+// replaceInlineBlock replaces the content of an inline <tag>...</tag> block in an OpenVPN profile
+func replaceInlineBlock(content, tag, value string) (string, bool) {
+	open := "<" + tag + ">"
+	close := "</" + tag + ">"
+
+	start := strings.Index(content, open)
+	if start == -1 {
+		return content, false
+	}
+	end := strings.Index(content[start:], close)
+	if end == -1 {
+		return content, false
+	}
+	end += start
+
+	return content[:start+len(open)] + "\n" + value + "\n" + content[end:], true
+}
+
+// ClientsDir returns the directory holding client .ovpn and WireGuard files, CLIENTS_DIR
+// or the default
+func ClientsDir() string {
+	if dir := os.Getenv("CLIENTS_DIR"); dir != "" {
+		return dir
+	}
+	return "/opt/vpnmanager/clients"
+}
@@ -0,0 +1,85 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Enroll exchanges the configured enrollment token for the credential of this end-node and
+// keeps it in the node secret file, so later starts load it from there. It does nothing once
+// the end-node has a credential.
+func (enm *EndNodeManager) Enroll() error {
+	if enm.config.NodeSecret != "" || enm.config.EnrollmentToken == "" {
+		return nil
+	}
+
+	// The token is used up by the exchange, so make sure the credential can be kept first
+	if err := os.MkdirAll(filepath.Dir(enm.config.NodeSecretFile), 0700); err != nil {
+		return fmt.Errorf("failed to create directory for node secret file: %v", err)
+	}
+
+	jsonData, err := json.Marshal(map[string]string{
+		"token":     enm.config.EnrollmentToken,
+		"server_id": enm.serverID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal enrollment request: %v", err)
+	}
+
+	url := fmt.Sprintf("%s/api/endnodes/enroll", enm.config.ManagementURL)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	log.Printf("End-node %s enrolling with management server at %s", enm.serverID, enm.config.ManagementURL)
+	resp, err := enm.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to enroll with management server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("enrollment failed with status: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		Data struct {
+			NodeSecret string `json:"node_secret"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("failed to decode enrollment response: %v", err)
+	}
+	if response.Data.NodeSecret == "" {
+		return fmt.Errorf("management returned no credential")
+	}
+
+	if err := writeNodeSecret(enm.config.NodeSecretFile, response.Data.NodeSecret); err != nil {
+		return err
+	}
+	enm.config.NodeSecret = response.Data.NodeSecret
+	log.Printf("✅ End-node %s enrolled, credential kept in %s", enm.serverID, enm.config.NodeSecretFile)
+	return nil
+}
+
+// writeNodeSecret replaces the node secret file so a crash never leaves it half written
+func writeNodeSecret(path, secret string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(secret+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write node secret file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write node secret file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/pki"
+	"barqnet-backend/pkg/shared"
+)
+
+// ListUsers builds the user inventory of this end-node from the client profiles in the
+// clients directory, the certificate index and the live OpenVPN session list.
+// Users with a valid certificate but no profile, or a session but no profile, are included
+// so management can spot orphans. Revoked certificates without a profile are deleted users.
+func (enm *EndNodeManager) ListUsers() ([]shared.EndNodeUser, error) {
+	users := make(map[string]*shared.EndNodeUser)
+	get := func(username string) *shared.EndNodeUser {
+		user, ok := users[username]
+		if !ok {
+			user = &shared.EndNodeUser{
+				User: shared.User{
+					Username: username,
+					ServerID: enm.serverID,
+				},
+				CertStatus: shared.CertStatusNone,
+			}
+			users[username] = user
+		}
+		return user
+	}
+
+	// Client profiles: OpenVPN .ovpn and WireGuard .conf files
+	entries, err := os.ReadDir(ClientsDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read clients directory: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		if ext != ".ovpn" && ext != ".conf" {
+			continue
+		}
+		username := strings.TrimSuffix(entry.Name(), ext)
+		if validateUsernameForCommand(username) != nil {
+			continue
+		}
+
+		path := filepath.Join(ClientsDir(), entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Warning: Failed to read client profile %s: %v", path, err)
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		user := get(username)
+		sum := sha256.Sum256(content)
+		if ext == ".conf" {
+			user.WireGuard = true
+			user.WireGuardChecksum = hex.EncodeToString(sum[:])
+			if user.OvpnPath == "" {
+				user.Protocol = shared.ProtocolWireGuard
+			}
+		} else {
+			user.OvpnPath = path
+			user.Checksum = hex.EncodeToString(sum[:])
+			user.Port, user.Protocol = parseOVPNProfile(content)
+		}
+
+		// The profile's modification time is the closest record of when it was issued
+		if user.CreatedAt.IsZero() || info.ModTime().Before(user.CreatedAt) {
+			user.CreatedAt = info.ModTime()
+		}
+	}
+
+	// Certificate state from the PKI index
+	now := time.Now()
+	if ca, err := enm.certificateAuthority(); err != nil {
+		log.Printf("Warning: Certificate status unavailable for user inventory: %v", err)
+	} else if latest, err := latestCertificates(ca); err != nil {
+		log.Printf("Warning: Certificate status unavailable for user inventory: %v", err)
+	} else {
+		for commonName, entry := range latest {
+			if validateUsernameForCommand(commonName) != nil {
+				continue
+			}
+			status := certificateStatus(entry, now)
+			if _, ok := users[commonName]; !ok && status != shared.CertStatusValid {
+				continue
+			}
+
+			user := get(commonName)
+			user.CertStatus = status
+			user.CertSerial = entry.SerialHex()
+			user.CertExpiresAt = entry.Expiry
+			user.ExpiresAt = entry.Expiry
+		}
+	}
+
+	// Live sessions from the OpenVPN management interface
+	sessions, err := enm.ListSessions()
+	if err != nil {
+		log.Printf("Warning: Session list unavailable for user inventory: %v", err)
+	}
+	for _, session := range sessions {
+		if validateUsernameForCommand(session.CommonName) != nil {
+			continue
+		}
+		user := get(session.CommonName)
+		user.Connected = true
+		user.Sessions++
+		if session.ConnectedSince.After(user.LastAccess) {
+			user.LastAccess = session.ConnectedSince
+		}
+	}
+
+	result := make([]shared.EndNodeUser, 0, len(users))
+	for _, user := range users {
+		// A user is active when it holds a usable profile: a WireGuard peer or an OpenVPN
+		// profile whose certificate is still valid
+		user.Active = user.WireGuard || (user.OvpnPath != "" && user.CertStatus == shared.CertStatusValid)
+		result = append(result, *user)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Username < result[j].Username
+	})
+
+	return result, nil
+}
+
+// latestCertificates returns the newest index entry per common name.
+// Renewals leave the old certificate valid until it expires, so the newest one is authoritative.
+func latestCertificates(ca *pki.PKI) (map[string]pki.IndexEntry, error) {
+	entries, err := ca.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate index: %v", err)
+	}
+
+	latest := make(map[string]pki.IndexEntry)
+	for _, entry := range entries {
+		commonName := entry.CommonName()
+		if commonName == "" {
+			continue
+		}
+		if current, ok := latest[commonName]; !ok || entry.Expiry.After(current.Expiry) {
+			latest[commonName] = entry
+		}
+	}
+	return latest, nil
+}
+
+// parseOVPNProfile extracts the port and protocol of the first remote in an OpenVPN profile
+func parseOVPNProfile(content []byte) (int, string) {
+	port, protocol := 1194, "udp"
+	remoteSeen := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+
+		switch fields[0] {
+		case "proto":
+			if len(fields) > 1 {
+				protocol = normalizeProto(fields[1])
+			}
+		case "remote":
+			if remoteSeen {
+				continue
+			}
+			remoteSeen = true
+			if len(fields) > 2 {
+				if p, err := strconv.Atoi(fields[2]); err == nil {
+					port = p
+				}
+			}
+			if len(fields) > 3 {
+				protocol = normalizeProto(fields[3])
+			}
+		}
+	}
+
+	return port, protocol
+}
+
+// normalizeProto maps OpenVPN proto values such as "tcp-client" or "udp6" to "tcp" or "udp"
+func normalizeProto(proto string) string {
+	if strings.HasPrefix(proto, "tcp") {
+		return "tcp"
+	}
+	return "udp"
+}
@@ -8,11 +8,17 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"barqnet-backend/apps/endnode/metrics"
+	"barqnet-backend/apps/endnode/openvpn"
+	"barqnet-backend/apps/endnode/outbox"
+	"barqnet-backend/apps/endnode/shaping"
+	"barqnet-backend/apps/endnode/wireguard"
+	"barqnet-backend/pkg/pki"
 	"barqnet-backend/pkg/shared"
 )
 
@@ -21,6 +27,57 @@ type EndNodeManager struct {
 	serverID   string
 	config     *shared.EndNodeConfig
 	httpClient *http.Client
+	ovpnMgmt   *openvpn.ManagementClient
+	wg         *wireguard.Manager
+
+	caMu sync.Mutex
+	ca   *pki.PKI
+
+	// Desired-state reconciliation, see reconcile.go
+	reconcileMu     sync.Mutex
+	desired         *shared.DesiredState
+	lastDriftReport time.Time
+	lastVersion     string
+
+	// OpenVPN server profile, see profile.go
+	profileSyncMu        sync.Mutex
+	profileMu            sync.Mutex
+	profile              *shared.ServerProfile
+	profileFailedVersion string
+	localConfigApplied   bool
+
+	// Resource metrics for health reports
+	metrics        *metrics.Collector
+	lastHealthRTT  int
+	lastHealthStat string
+
+	// Per-user client-config-dir entries, see ccd.go
+	ccdSyncMu sync.Mutex
+	ccdSet    *shared.ClientConfigSet
+
+	// User access checked by the client-connect hook, see access.go
+	accessSyncMu sync.Mutex
+	accessMu     sync.Mutex
+	access       *shared.AccessList
+	accessUsers  map[string]shared.UserAccess
+
+	// Server-counted session usage waiting to be shipped, see accounting.go
+	usageMu      sync.Mutex
+	usageFlushMu sync.Mutex
+	pendingUsage []shared.SessionUsage
+
+	// Per-user bandwidth limits on the tunnel device, nil when shaping is disabled; see shaping.go
+	shaper *shaping.Shaper
+
+	// Revoked tls-crypt-v2 keys, see tlscrypt.go
+	tlsCryptMu sync.Mutex
+
+	// Reports queued while management is unreachable, nil when disabled; see outbox.go
+	outbox     *outbox.Queue
+	outboxWake chan struct{}
+
+	// Nonces of signed requests from management, see signing.go
+	requestVerifier *shared.RequestVerifier
 }
 
 // NewEndNodeManager creates a new end-node manager
@@ -28,12 +85,27 @@ func NewEndNodeManager(
 	serverID string,
 	config *shared.EndNodeConfig,
 ) *EndNodeManager {
+	var shaper *shaping.Shaper
+	if config.ShapingDevice != "" {
+		shaper = shaping.NewShaper(config.ShapingDevice, shaping.CommandApplier{})
+	}
+
 	return &EndNodeManager{
 		serverID: serverID,
 		config:   config,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		ovpnMgmt: openvpn.NewManagementClient(config.OpenVPNManagement, config.OpenVPNManagementPassword),
+		metrics:  metrics.NewCollector(metrics.DefaultProcDir),
+		wg: wireguard.NewManager(wireguard.ManagerConfig{
+			Interface:           config.WireGuardInterface,
+			ConfigPath:          config.WireGuardConfigPath,
+			DNS:                 config.WireGuardDNS,
+			PersistentKeepalive: 25,
+		}, wireguard.CommandApplier{}),
+		shaper:          shaper,
+		requestVerifier: shared.NewRequestVerifier(),
 	}
 }
 
@@ -69,16 +141,23 @@ func (enm *EndNodeManager) registerWithRetry(maxRetries int) error {
 
 // attemptRegistration makes a single registration attempt
 func (enm *EndNodeManager) attemptRegistration() error {
-	// Get local IP address
-	localIP := getLocalIP()
+	// The API address is for the management server, public endpoints are for VPN clients
+	apiAddress := enm.apiAddress()
 	log.Printf("End-node %s attempting to register with management server at %s", enm.serverID, enm.config.ManagementURL)
-	log.Printf("Local IP address: %s", localIP)
+	log.Printf("API address: %s", apiAddress)
+	if len(enm.config.PublicEndpoints) > 0 {
+		log.Printf("Public endpoints: %s", strings.Join(enm.config.PublicEndpoints, ", "))
+	} else {
+		log.Printf("Warning: ENDNODE_PUBLIC_ENDPOINTS not set, clients will connect to the API address %s", apiAddress)
+	}
 
 	registrationData := map[string]interface{}{
-		"server_id": enm.serverID,
-		"host":      localIP,
-		"port":      enm.GetServerPort(),
-		"status":    "online",
+		"server_id":        enm.serverID,
+		"host":             apiAddress,
+		"public_endpoints": enm.config.PublicEndpoints,
+		"listeners":        enm.listeners(""),
+		"port":             enm.GetServerPort(),
+		"status":           "online",
 	}
 
 	jsonData, err := json.Marshal(registrationData)
@@ -95,8 +174,8 @@ func (enm *EndNodeManager) attemptRegistration() error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	if enm.config.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+enm.config.APIKey)
+	if err := enm.authorize(req); err != nil {
+		return err
 	}
 
 	log.Printf("Sending registration request...")
@@ -129,7 +208,9 @@ func (enm *EndNodeManager) DeregisterFromManagement() error {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+enm.config.APIKey)
+	if err := enm.authorize(req); err != nil {
+		return err
+	}
 
 	resp, err := enm.httpClient.Do(req)
 	if err != nil {
@@ -159,41 +240,59 @@ func (enm *EndNodeManager) StartHealthCheck() {
 	}
 }
 
-// sendHealthCheck sends a health check to the management server
+// sendHealthCheck sends a health check with the node's resource metrics to the management
+// server, queueing it while management is unreachable
 func (enm *EndNodeManager) sendHealthCheck() error {
-	healthData := map[string]interface{}{
-		"server_id":     enm.serverID,
-		"status":        "healthy",
-		"timestamp":     time.Now().Unix(),
-		"response_time": 0, // Could measure actual response time
-	}
-
-	jsonData, err := json.Marshal(healthData)
-	if err != nil {
-		return fmt.Errorf("failed to marshal health data: %v", err)
-	}
+	report := enm.collectHealth()
 
 	// Use the dedicated health check endpoint (no JWT auth required)
-	url := fmt.Sprintf("%s/api/endnodes-health/%s", enm.config.ManagementURL, enm.serverID)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	path := fmt.Sprintf("/api/endnodes-health/%s", enm.serverID)
+
+	start := time.Now()
+	queued, err := enm.report("health", path, report)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		return fmt.Errorf("failed to send health check: %v", err)
+	}
+	if !queued {
+		enm.lastHealthRTT = int(time.Since(start).Milliseconds())
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	// No Authorization header needed for health checks
+	return nil
+}
 
-	resp, err := enm.httpClient.Do(req)
+// collectHealth samples the node metrics and derives the health status from them
+func (enm *EndNodeManager) collectHealth() *shared.HealthReport {
+	report := &shared.HealthReport{
+		ServerID:     enm.serverID,
+		Timestamp:    time.Now().Unix(),
+		ResponseTime: enm.lastHealthRTT,
+	}
+
+	m, err := enm.metrics.Collect(ClientsDir())
 	if err != nil {
-		return fmt.Errorf("failed to send health check: %v", err)
+		log.Printf("Warning: %v", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("health check failed with status: %d", resp.StatusCode)
+	// The management interface answers only while OpenVPN runs, also when it runs in another container
+	if stats, err := enm.ovpnMgmt.LoadStats(); err == nil {
+		m.ConnectedClients = stats.Clients
+		m.OpenVPNRunning = true
 	}
 
-	return nil
+	report.Metrics = m
+	report.Status, report.Error = m.HealthStatus()
+
+	if report.Status != enm.lastHealthStat {
+		if report.Status == shared.HealthStatusHealthy {
+			log.Printf("[HEALTH] ✅ End-node is healthy (%d clients, CPU %.1f%%, memory %.1f%%)",
+				m.ConnectedClients, m.CPUPercent, m.MemoryPercent)
+		} else {
+			log.Printf("[HEALTH] ⚠️  End-node is %s: %s", report.Status, report.Error)
+		}
+		enm.lastHealthStat = report.Status
+	}
+
+	return report
 }
 
 // StartSyncRoutine starts the sync routine to get updates from management server
@@ -208,15 +307,23 @@ func (enm *EndNodeManager) StartSyncRoutine() {
 	}
 }
 
-// syncWithManagement syncs data with the management server
+// syncWithManagement applies the server profile and pulls the desired user set from the
+// management server, converging the local profiles on it
 func (enm *EndNodeManager) syncWithManagement() error {
-	// End-nodes don't have local database, so they just send health checks
-	// The management server handles all data synchronization
-	log.Printf("End-node %s syncing with management server", enm.serverID)
-	return nil
+	// The server profile goes first so users created below get the current settings
+	if _, err := enm.SyncServerProfile(); err != nil {
+		log.Printf("Warning: Failed to apply server profile: %v", err)
+	}
+	if _, err := enm.SyncClientConfigs(); err != nil {
+		log.Printf("Warning: Failed to sync client configs: %v", err)
+	}
+
+	_, err := enm.Reconcile()
+	return err
 }
 
-// syncUserToManagement syncs a user to the management server
+// syncUserToManagement syncs a user to the management server, queueing the sync while
+// management is unreachable
 func (enm *EndNodeManager) syncUserToManagement(user shared.User) error {
 	userData := map[string]interface{}{
 		"username":   user.Username,
@@ -229,34 +336,16 @@ func (enm *EndNodeManager) syncUserToManagement(user shared.User) error {
 		"created_by": user.CreatedBy,
 	}
 
-	jsonData, err := json.Marshal(userData)
-	if err != nil {
-		return fmt.Errorf("failed to marshal user data: %v", err)
-	}
-
-	url := fmt.Sprintf("%s/api/users/sync", enm.config.ManagementURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+enm.config.APIKey)
-
-	resp, err := enm.httpClient.Do(req)
-	if err != nil {
+	if _, err := enm.report("user_sync", "/api/users/sync", userData); err != nil {
 		return fmt.Errorf("failed to sync user: %v", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("user sync failed with status: %d", resp.StatusCode)
-	}
 
 	return nil
 }
 
-// CreateOVPNWithCerts creates an OVPN file with certificates
+// CreateOVPNWithCerts creates an OVPN file with certificates.
+// The profile lists every listener of the end-node, those of the requested protocol first;
+// the requested port is only logged.
 func (enm *EndNodeManager) CreateOVPNWithCerts(username, ovpnPath string, port int, protocol, serverID, serverIP string, certData struct {
 	CA   string
 	Cert string
@@ -264,10 +353,13 @@ func (enm *EndNodeManager) CreateOVPNWithCerts(username, ovpnPath string, port i
 	TA   string
 }) error {
 	log.Printf("End-node %s: Creating user %s", enm.serverID, username)
+	if listeners := enm.listeners(protocol); listeners[0] != (shared.Listener{Protocol: protocol, Port: port}) {
+		log.Printf("Requested %s/%d is not a listener of this end-node, using %s first", protocol, port, listeners[0])
+	}
 
 	// Use /opt directory if the original path is not writable
 	if !isWritable(filepath.Dir(ovpnPath)) {
-		ovpnPath = fmt.Sprintf("/opt/vpnmanager/clients/%s.ovpn", username)
+		ovpnPath = filepath.Join(ClientsDir(), username+".ovpn")
 		log.Printf("Using alternative path: %s", ovpnPath)
 	}
 
@@ -292,7 +384,7 @@ func (enm *EndNodeManager) CreateOVPNWithCerts(username, ovpnPath string, port i
 
 	// Generate OVPN content with certificates
 	log.Printf("Generating OVPN content for user %s", username)
-	ovpnContent, err := enm.generateOVPNContentWithCerts(username, port, protocol, serverID, serverIP, realCertData)
+	ovpnContent, err := enm.generateOVPNContentWithCerts(username, serverID, serverIP, protocol, realCertData)
 	if err != nil {
 		log.Printf("❌ Failed to generate OVPN content: %v", err)
 		return fmt.Errorf("failed to generate OVPN content: %v", err)
@@ -319,6 +411,13 @@ func (enm *EndNodeManager) CreateOVPNWithCerts(username, ovpnPath string, port i
 		log.Printf("✅ OVPN file verified: size=%d bytes, mode=%s", stat.Size(), stat.Mode())
 	}
 
+	// Let management track the new certificate's expiry
+	go func() {
+		if err := enm.reportCertificates(nil); err != nil {
+			log.Printf("Warning: Failed to report certificates to management: %v", err)
+		}
+	}()
+
 	// Double-check file exists after a brief delay
 	time.Sleep(100 * time.Millisecond)
 	if _, err := os.Stat(ovpnPath); err != nil {
@@ -331,99 +430,10 @@ func (enm *EndNodeManager) CreateOVPNWithCerts(username, ovpnPath string, port i
 	return nil
 }
 
-// generateOVPNContent generates OVPN configuration content for a user
-func (enm *EndNodeManager) generateOVPNContent(username string, port int, protocol string) ([]byte, error) {
-	serverHost := enm.GetServerHost()
-	serverPort := enm.GetServerPort()
-
-	// Create OVPN configuration content
-	ovpnConfig := fmt.Sprintf(`# OpenVPN Configuration for %s on %s
-# Generated by VPN Manager End-Node
-# Server: %s (%s:%d)
-# User: %s
-# Port: %d
-# Protocol: %s
-
-# Client configuration
-client
-dev tun
-proto %s
-remote %s %d
-nobind
-cipher AES-256-CBC
-verb 3
-
-# Authentication (certificate-based)
-# auth-user-pass
-# auth-nocache
-
-# SSL/TLS settings
-tls-client
-remote-cert-tls server
-
-# Compression (disabled for security)
-# comp-lzo
-
-# Logging
-# log-append /var/log/openvpn/%s.log
-
-# Security
-tls-version-min 1.2
-tls-cipher TLS-ECDHE-RSA-WITH-AES-256-GCM-SHA384:TLS-ECDHE-RSA-WITH-AES-256-CBC-SHA
-
-# Keepalive
-keepalive 10 60
-
-# Route settings (if needed)
-# route 0.0.0.0 0.0.0.0
-
-# DNS settings
-# dhcp-option DNS 8.8.8.8
-# dhcp-option DNS 8.8.4.4
-
-# Scripts
-# script-security 2
-# up /etc/openvpn/up.sh
-# down /etc/openvpn/down.sh
-
-# Additional settings
-# mute-replay-warnings
-# replay-window 64
-# mute 20
-
-# Certificate and key placeholders
-# <ca>
-# [CA certificate content would go here]
-# </ca>
-# <cert>
-# [Client certificate content would go here]
-# </cert>
-# <key>
-# [Client private key content would go here]
-# </key>
-# <tls-auth>
-# [TLS auth key content would go here]
-# </tls-auth>
-`,
-		username,
-		enm.serverID,
-		enm.serverID,
-		serverHost,
-		serverPort,
-		username,
-		port,
-		protocol,
-		protocol,
-		serverHost,
-		port,
-		username,
-	)
-
-	return []byte(ovpnConfig), nil
-}
-
-// generateOVPNContentWithCerts generates OVPN configuration content with certificates
-func (enm *EndNodeManager) generateOVPNContentWithCerts(username string, port int, protocol, serverID, serverIP string, certData struct {
+// generateOVPNContentWithCerts renders a user's OVPN profile from the node's server profile and
+// listeners, so the transports and ciphers always match what the server runs. The file is a
+// full-tunnel profile; split-tunnel route profiles are baked in by the management server when it serves it.
+func (enm *EndNodeManager) generateOVPNContentWithCerts(username, serverID, serverIP, protocol string, certData struct {
 	CA   string
 	Cert string
 	Key  string
@@ -433,100 +443,21 @@ func (enm *EndNodeManager) generateOVPNContentWithCerts(username string, port in
 	// No need to generate again - certificates were already created before calling this function
 	log.Printf("Generating OVPN content for user %s", username)
 
-	// Create OVPN configuration content with certificates
-	ovpnConfig := fmt.Sprintf(`# OpenVPN Configuration for %s on %s
-# Generated by VPN Manager End-Node
-# Server: %s (%s:%d)
-# User: %s
-# Port: %d
-# Protocol: %s
-
-# Client configuration
-client
-dev tun
-proto %s
-remote %s %d
-nobind
-cipher AES-256-CBC
-verb 3
-
-# Authentication (certificate-based)
-# auth-user-pass
-# auth-nocache
-
-# SSL/TLS settings
-tls-client
-remote-cert-tls server
-
-# Compression (disabled for security)
-# comp-lzo
-
-# Logging
-# log-append /var/log/openvpn/%s.log
-
-# Security
-tls-version-min 1.2
-tls-cipher TLS-ECDHE-RSA-WITH-AES-256-GCM-SHA384:TLS-ECDHE-RSA-WITH-AES-256-CBC-SHA
-
-# Keepalive
-keepalive 10 60
-
-# Route settings (if needed)
-# route 0.0.0.0 0.0.0.0
-
-# DNS settings
-# dhcp-option DNS 8.8.8.8
-# dhcp-option DNS 8.8.4.4
-
-# Scripts
-# script-security 2
-# up /etc/openvpn/up.sh
-# down /etc/openvpn/down.sh
-
-# Additional settings
-# mute-replay-warnings
-# replay-window 64
-# mute 20
-
-# Certificate Authority
-<ca>
-%s
-</ca>
-
-# Client Certificate
-<cert>
-%s
-</cert>
-
-# Client Private Key
-<key>
-%s
-</key>
-
-# TLS-Crypt Key (more secure than tls-auth)
-<tls-crypt>
-%s
-</tls-crypt>
-    `,
-		username,
-		serverID,
-		serverID,
-		serverIP,
-		port,
-		username,
-		port,
-		protocol,
-		protocol,
-		serverIP,
-		port,
-		username,
-		certData.CA,
-		certData.Cert,
-		certData.Key,
-		certData.TA,
-	)
-
-	return []byte(ovpnConfig), nil
+	profile := enm.serverProfile()
+	if (profile.TLSCrypt || profile.TLSCryptV2) && certData.TA == "" {
+		log.Printf("Warning: Server profile %s requires tls-crypt but no key is available for user %s", profile.Name, username)
+	}
+
+	return shared.RenderClientConfig(profile, shared.OpenVPNClientParams{
+		Username:    username,
+		ServerID:    serverID,
+		Hosts:       enm.remoteHosts(serverIP),
+		Listeners:   enm.listeners(protocol),
+		CA:          certData.CA,
+		Cert:        certData.Cert,
+		Key:         certData.Key,
+		TLSCryptKey: certData.TA,
+	})
 }
 
 // validateUsernameForCommand validates username to prevent command injection
@@ -560,7 +491,7 @@ func validateUsernameForCommand(username string) error {
 	return nil
 }
 
-// generateCertificates generates certificates using EasyRSA
+// generateCertificates issues a client certificate from the node's certificate authority
 func (enm *EndNodeManager) generateCertificates(username string) (struct {
 	CA   string
 	Cert string
@@ -575,109 +506,43 @@ func (enm *EndNodeManager) generateCertificates(username string) (struct {
 		TA   string
 	}{}
 
-	// SECURITY: Validate username before using in commands/paths
+	// SECURITY: Validate username before using in paths
 	if err := validateUsernameForCommand(username); err != nil {
 		return certData, fmt.Errorf("invalid username for certificate generation: %v", err)
 	}
 
-	// Get EasyRSA directory from environment or use default
-	easyrsaDir := os.Getenv("EASYRSA_DIR")
-	if easyrsaDir == "" {
-		easyrsaDir = "/opt/vpnmanager/easyrsa"
-	}
-	pkiDir := filepath.Join(easyrsaDir, "pki")
-
-	// Check if EasyRSA is available
-	if _, err := os.Stat(easyrsaDir); os.IsNotExist(err) {
-		return certData, fmt.Errorf("EasyRSA not found at %s", easyrsaDir)
-	}
-
-	// Check if PKI directory is accessible
-	if _, err := os.Stat(pkiDir); os.IsNotExist(err) {
-		return certData, fmt.Errorf("PKI directory not found at %s", pkiDir)
-	}
-
-	log.Printf("EasyRSA directory: %s", easyrsaDir)
-	log.Printf("PKI directory: %s", pkiDir)
-
-	// Generate client certificate
-	// SECURITY: Use exec.Command with separate arguments to prevent shell injection
-	log.Printf("Generating certificate request for user: %s", username)
-	easyrsaPath := filepath.Join(easyrsaDir, "easyrsa")
-	
-	cmd := exec.Command(easyrsaPath, "gen-req", username, "nopass")
-	cmd.Dir = easyrsaDir
-	cmd.Env = append(os.Environ(), "EASYRSA_BATCH=1", "EASYRSA_PKI="+pkiDir)
-
-	output, err := cmd.CombinedOutput()
+	ca, err := enm.certificateAuthority()
 	if err != nil {
-		log.Printf("❌ Certificate request generation failed: %v", err)
-		log.Printf("Command output: %s", string(output))
-		return certData, fmt.Errorf("failed to generate certificate request: %v", err)
+		return certData, err
 	}
-	log.Printf("✅ Certificate request generated successfully")
-	log.Printf("Command output: %s", string(output))
 
-	// Sign client certificate
-	// SECURITY: Use exec.Command with separate arguments to prevent shell injection
-	log.Printf("Signing certificate for user: %s", username)
-	
-	cmd = exec.Command(easyrsaPath, "sign-req", "client", username)
-	cmd.Dir = easyrsaDir
-	cmd.Env = append(os.Environ(), "EASYRSA_BATCH=1", "EASYRSA_PKI="+pkiDir)
+	log.Printf("Issuing %s client certificate for user %s (PKI: %s)", enm.config.CertKeyType, username, ca.Dir())
 
-	output, err = cmd.CombinedOutput()
+	issued, err := ca.IssueClient(username, pki.IssueOptions{
+		KeyType:  pki.KeyType(enm.config.CertKeyType),
+		Lifetime: time.Duration(enm.config.CertLifetimeDays) * 24 * time.Hour,
+	})
 	if err != nil {
-		log.Printf("❌ Certificate signing failed: %v", err)
-		log.Printf("Command output: %s", string(output))
-		return certData, fmt.Errorf("failed to sign certificate: %v", err)
-	}
-	log.Printf("✅ Certificate signed successfully")
-	log.Printf("Command output: %s", string(output))
-
-	// Read CA certificate
-	caCertPath := fmt.Sprintf("%s/ca.crt", pkiDir)
-	log.Printf("Reading CA certificate from: %s", caCertPath)
-	if caCert, err := os.ReadFile(caCertPath); err == nil {
-		certData.CA = string(caCert)
-		log.Printf("✅ CA certificate loaded (%d bytes)", len(certData.CA))
-	} else {
-		log.Printf("❌ Failed to read CA certificate: %v", err)
-	}
-
-	// Read client certificate using OpenSSL to get proper PEM format
-	clientCertPath := fmt.Sprintf("%s/issued/%s.crt", pkiDir, username)
-	log.Printf("Reading client certificate from: %s", clientCertPath)
-
-	// Use OpenSSL to convert certificate to proper PEM format
-	cmd = exec.Command("openssl", "x509", "-in", clientCertPath, "-outform", "PEM")
-	output, err = cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("❌ Failed to convert client certificate: %v", err)
-		log.Printf("OpenSSL output: %s", string(output))
-	} else {
-		certData.Cert = string(output)
-		log.Printf("✅ Client certificate loaded (%d bytes)", len(certData.Cert))
-	}
-
-	// Read client private key
-	clientKeyPath := fmt.Sprintf("%s/private/%s.key", pkiDir, username)
-	log.Printf("Reading client private key from: %s", clientKeyPath)
-	if clientKey, err := os.ReadFile(clientKeyPath); err == nil {
-		certData.Key = string(clientKey)
-		log.Printf("✅ Client private key loaded (%d bytes)", len(certData.Key))
-	} else {
-		log.Printf("❌ Failed to read client private key: %v", err)
-	}
-
-	// Read TLS-crypt key
-	taKeyPath := "/etc/openvpn/tls-crypt.key"
-	log.Printf("Reading TLS-crypt key from: %s", taKeyPath)
-	if taKey, err := os.ReadFile(taKeyPath); err == nil {
-		certData.TA = string(taKey)
-		log.Printf("✅ TLS-crypt key loaded (%d bytes)", len(certData.TA))
+		log.Printf("❌ Certificate issuance failed: %v", err)
+		return certData, fmt.Errorf("failed to issue certificate: %v", err)
+	}
+	log.Printf("✅ Certificate issued for user %s (serial %X, expires %s)", username, issued.Serial, issued.NotAfter.Format(time.RFC3339))
+
+	certData.CA = string(ca.CACertPEM())
+	certData.Cert = string(issued.CertPEM)
+	certData.Key = string(issued.KeyPEM)
+
+	// The shared tls-crypt key, or a tls-crypt-v2 key of the user's own
+	profile := enm.serverProfile()
+	if taKey, err := enm.tlsCryptKey(profile, username, ""); err == nil {
+		certData.TA = taKey
+		if profile.TLSCryptV2 {
+			log.Printf("✅ tls-crypt-v2 client key issued for user %s", username)
+		} else if profile.TLSCrypt {
+			log.Printf("✅ TLS-crypt key loaded (%d bytes)", len(certData.TA))
+		}
 	} else {
-		log.Printf("❌ Failed to read TLS-crypt key: %v", err)
+		log.Printf("❌ Failed to get TLS-crypt key: %v", err)
 	}
 
 	return certData, nil
@@ -688,17 +553,23 @@ func (enm *EndNodeManager) DeleteUser(username string) error {
 	log.Printf("End-node %s: Deleting user %s", enm.serverID, username)
 
 	// Step 1: Revoke the user's certificate
-	if err := enm.revokeUserCertificate(username); err != nil {
+	if err := enm.RevokeUserCertificate(username); err != nil {
 		log.Printf("Warning: Failed to revoke certificate for user %s: %v", username, err)
 	}
 
-	// Step 2: Disconnect active VPN sessions
-	if err := enm.disconnectUserSessions(username); err != nil {
+	// Step 2: Publish the CRL so the revoked certificate cannot reconnect; this also
+	// disconnects the user's active sessions without touching anyone else
+	if _, err := enm.PublishCRL(); err != nil {
+		log.Printf("Warning: Failed to publish CRL: %v", err)
+	}
+
+	// Step 3: Make sure no session survives, even if the user had no certificate to revoke
+	if _, err := enm.DisconnectUser(username); err != nil {
 		log.Printf("Warning: Failed to disconnect sessions for user %s: %v", username, err)
 	}
 
-	// Step 3: Remove the OVPN file
-	ovpnPath := fmt.Sprintf("/opt/vpnmanager/clients/%s.ovpn", username)
+	// Step 4: Remove the OVPN file
+	ovpnPath := filepath.Join(ClientsDir(), username+".ovpn")
 	if err := os.Remove(ovpnPath); err != nil {
 		if !os.IsNotExist(err) {
 			return fmt.Errorf("failed to remove OVPN file %s: %v", ovpnPath, err)
@@ -708,32 +579,72 @@ func (enm *EndNodeManager) DeleteUser(username string) error {
 		log.Printf("✅ OVPN file %s removed successfully", ovpnPath)
 	}
 
-	// Step 4: Update CRL and restart OpenVPN server
-	if err := enm.updateCRLAndRestartServer(); err != nil {
-		log.Printf("Warning: Failed to update CRL and restart server: %v", err)
+	// Step 5: Remove the WireGuard peer, if the user had one
+	if err := enm.RemoveWireGuardPeer(username); err != nil {
+		log.Printf("Warning: Failed to remove WireGuard peer for user %s: %v", username, err)
 	}
 
 	log.Printf("✅ User %s deleted successfully with certificate revocation", username)
 	return nil
 }
 
-// ListUsers lists all users for this end-node (requests from management server)
-func (enm *EndNodeManager) ListUsers() ([]shared.User, error) {
-	// End-nodes don't have local database, they request data from management server
-	log.Printf("End-node %s: User list request", enm.serverID)
-	return []shared.User{}, nil
-}
-
 // GetServerID returns the server ID
 func (enm *EndNodeManager) GetServerID() string {
 	return enm.serverID
 }
 
-// GetServerHost returns the server host
+// GetServerHost returns the preferred public endpoint VPN clients connect to
 func (enm *EndNodeManager) GetServerHost() string {
+	return enm.PublicEndpoints()[0]
+}
+
+// PublicEndpoints returns the hosts VPN clients connect to, in order of preference.
+// Without configured endpoints the API address is advertised.
+func (enm *EndNodeManager) PublicEndpoints() []string {
+	if enm.config != nil && len(enm.config.PublicEndpoints) > 0 {
+		return append([]string{}, enm.config.PublicEndpoints...)
+	}
+	return []string{enm.apiAddress()}
+}
+
+// apiAddress returns the address the management server reaches the API on
+func (enm *EndNodeManager) apiAddress() string {
+	if enm.config != nil && enm.config.APIAddress != "" {
+		return enm.config.APIAddress
+	}
 	return getLocalIP()
 }
 
+// remoteHosts returns the hosts for the remote lines of a client profile. The requested host
+// goes first when this end-node advertises it; other hosts are only used when it advertises none.
+func (enm *EndNodeManager) remoteHosts(requested string) []string {
+	if enm.config == nil || len(enm.config.PublicEndpoints) == 0 {
+		if requested != "" {
+			return []string{requested}
+		}
+		return enm.PublicEndpoints()
+	}
+
+	hosts := []string{}
+	for _, host := range enm.config.PublicEndpoints {
+		if strings.EqualFold(host, requested) {
+			hosts = append([]string{host}, hosts...)
+		} else {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// listeners returns the OpenVPN listeners of this end-node with those of the preferred protocol
+// first. Without configured listeners the server profile's port and protocol are used.
+func (enm *EndNodeManager) listeners(protocol string) []shared.Listener {
+	if enm.config != nil && len(enm.config.OpenVPNListeners) > 0 {
+		return shared.OrderListeners(enm.config.OpenVPNListeners, protocol)
+	}
+	return []shared.Listener{enm.serverProfile().Listener()}
+}
+
 // GetServerPort returns the server port
 func (enm *EndNodeManager) GetServerPort() int {
 	if enm.config != nil && enm.config.Port > 0 {
@@ -742,133 +653,220 @@ func (enm *EndNodeManager) GetServerPort() int {
 	return 8081 // Default fallback
 }
 
-// getLocalIP gets the local IP address
+// getLocalIP guesses the local IP address when ENDNODE_API_ADDRESS is not set
 func getLocalIP() string {
-	// Try to get the actual local IP address
+	// The address of the default route; no packet is sent
 	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
-		log.Printf("Warning: Could not determine local IP, using 127.0.0.1")
-		return "127.0.0.1"
+	if err == nil {
+		defer conn.Close()
+		return conn.LocalAddr().(*net.UDPAddr).IP.String()
+	}
+
+	// Offline: the first non-loopback interface address
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && !ipNet.IP.IsLoopback() {
+				return ipNet.IP.String()
+			}
+		}
 	}
-	defer conn.Close()
 
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
-	return localAddr.IP.String()
+	log.Printf("Warning: Could not determine local IP, using 127.0.0.1")
+	return "127.0.0.1"
 }
 
-// revokeUserCertificate revokes a user's certificate using EasyRSA
-func (enm *EndNodeManager) revokeUserCertificate(username string) error {
+// RevokeUserCertificate revokes every valid certificate issued to the user
+func (enm *EndNodeManager) RevokeUserCertificate(username string) error {
 	log.Printf("Revoking certificate for user: %s", username)
 
-	// SECURITY: Validate username before using in commands
+	// SECURITY: Validate username before using it as a common name
 	if err := validateUsernameForCommand(username); err != nil {
 		return fmt.Errorf("invalid username for certificate revocation: %v", err)
 	}
 
-	// Get EasyRSA directory from environment or use default
-	easyrsaDir := os.Getenv("EASYRSA_DIR")
-	if easyrsaDir == "" {
-		easyrsaDir = "/opt/vpnmanager/easyrsa"
+	ca, err := enm.certificateAuthority()
+	if err != nil {
+		return err
 	}
-	pkiDir := filepath.Join(easyrsaDir, "pki")
-	easyrsaPath := filepath.Join(easyrsaDir, "easyrsa")
-
-	// SECURITY: Use exec.Command with separate arguments to prevent shell injection
-	cmd := exec.Command(easyrsaPath, "revoke", username)
-	cmd.Dir = easyrsaDir
-	cmd.Env = append(os.Environ(), "EASYRSA_BATCH=1", "EASYRSA_PKI="+pkiDir)
 
-	output, err := cmd.CombinedOutput()
+	serials, err := ca.RevokeCommonName(username, pki.ReasonCessationOfOperation)
 	if err != nil {
-		return fmt.Errorf("failed to revoke certificate: %v, output: %s", err, string(output))
+		return fmt.Errorf("failed to revoke certificate: %v", err)
+	}
+
+	// tls-crypt-v2 keys outlive the certificate in the user's profile, block them as well
+	if err := enm.revokeTLSCryptV2Keys(username); err != nil {
+		log.Printf("Warning: Failed to revoke tls-crypt-v2 keys of user %s: %v", username, err)
 	}
 
-	log.Printf("✅ Certificate revoked for user %s", username)
+	log.Printf("✅ %d certificate(s) revoked for user %s", len(serials), username)
 	return nil
 }
 
-// disconnectUserSessions disconnects active VPN sessions for a user
-func (enm *EndNodeManager) disconnectUserSessions(username string) error {
+// DisconnectUser kills the active VPN sessions of a single user through the OpenVPN
+// management interface. Other users on the node stay connected.
+func (enm *EndNodeManager) DisconnectUser(username string) (int, error) {
 	log.Printf("Disconnecting VPN sessions for user: %s", username)
 
-	// Get list of connected clients from OpenVPN status
-	statusFile := "/etc/openvpn/openvpn-status.log"
-	if _, err := os.Stat(statusFile); os.IsNotExist(err) {
-		log.Printf("OpenVPN status file not found, skipping session disconnect")
-		return nil
+	// SECURITY: Validate username before sending it to the management interface
+	if err := validateUsernameForCommand(username); err != nil {
+		return 0, fmt.Errorf("invalid username for session disconnect: %v", err)
 	}
 
-	// Read OpenVPN status to find connected clients
-	content, err := os.ReadFile(statusFile)
+	killed, err := enm.ovpnMgmt.KillCommonName(username)
 	if err != nil {
-		return fmt.Errorf("failed to read OpenVPN status: %v", err)
-	}
-
-	// Parse status file to find connected clients
-	// This is a simplified approach - in production you'd want more robust parsing
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "CLIENT_LIST") && strings.Contains(line, username) {
-			// Extract client info and disconnect
-			// For now, we'll restart the OpenVPN server to disconnect all clients
-			// In production, you'd use OpenVPN management interface
-			log.Printf("Found active session for user %s, will restart server", username)
-			break
-		}
+		return 0, fmt.Errorf("failed to disconnect sessions via %s: %v", enm.ovpnMgmt.Address(), err)
 	}
 
-	log.Printf("✅ VPN sessions disconnected for user %s", username)
-	return nil
+	log.Printf("✅ %d VPN session(s) disconnected for user %s", killed, username)
+	return killed, nil
 }
 
-// updateCRLAndRestartServer updates the Certificate Revocation List and restarts the server
-func (enm *EndNodeManager) updateCRLAndRestartServer() error {
-	log.Printf("Updating Certificate Revocation List and restarting OpenVPN server")
+// ListSessions returns the clients currently connected to the OpenVPN server
+func (enm *EndNodeManager) ListSessions() ([]openvpn.ClientSession, error) {
+	return enm.ovpnMgmt.ListClients()
+}
 
-	// Get EasyRSA directory from environment or use default
-	easyrsaDir := os.Getenv("EASYRSA_DIR")
-	if easyrsaDir == "" {
-		easyrsaDir = "/opt/vpnmanager/easyrsa"
-	}
-	pkiDir := filepath.Join(easyrsaDir, "pki")
-	easyrsaPath := filepath.Join(easyrsaDir, "easyrsa")
+// GetLoadStats returns the OpenVPN server-wide client count and byte counters
+func (enm *EndNodeManager) GetLoadStats() (*openvpn.LoadStats, error) {
+	return enm.ovpnMgmt.LoadStats()
+}
 
-	// SECURITY: Use exec.Command with separate arguments to prevent shell injection
-	cmd := exec.Command(easyrsaPath, "gen-crl")
-	cmd.Dir = easyrsaDir
-	cmd.Env = append(os.Environ(), "EASYRSA_BATCH=1", "EASYRSA_PKI="+pkiDir)
+// PublishCRL regenerates the Certificate Revocation List, atomically installs it at the
+// crl-verify path and disconnects only the sessions of clients whose certificates are revoked.
+// OpenVPN re-reads the CRL on every new TLS handshake, so no restart is needed and other
+// users stay connected. The result is reported to the management server.
+func (enm *EndNodeManager) PublishCRL() (*shared.CRLPublication, error) {
+	log.Printf("Publishing Certificate Revocation List to %s", enm.config.CRLPath)
 
-	output, err := cmd.CombinedOutput()
+	ca, err := enm.certificateAuthority()
 	if err != nil {
-		return fmt.Errorf("failed to generate CRL: %v, output: %s", err, string(output))
+		return nil, err
 	}
 
-	// Copy CRL to OpenVPN directory
-	crlSource := "/opt/vpnmanager/easyrsa/pki/crl.pem"
-	crlDest := "/etc/openvpn/crl.pem"
+	info, err := ca.GenerateCRL(pki.DefaultCRLLifetime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CRL: %v", err)
+	}
 
-	if err := exec.Command("sudo", "cp", crlSource, crlDest).Run(); err != nil {
-		return fmt.Errorf("failed to copy CRL to OpenVPN directory: %v", err)
+	if err := openvpn.InstallCRL(enm.config.CRLPath, info.PEM); err != nil {
+		return nil, err
+	}
+
+	publication := &shared.CRLPublication{
+		ServerID:     enm.serverID,
+		CRLNumber:    info.Number.Int64(),
+		RevokedCount: info.RevokedCount,
+		ThisUpdate:   info.ThisUpdate,
+		NextUpdate:   info.NextUpdate,
+		PublishedAt:  time.Now(),
+	}
+
+	kicked, err := enm.kickRevokedClients(ca)
+	if err != nil {
+		log.Printf("Warning: CRL published but revoked clients could not be disconnected: %v", err)
 	}
+	publication.KickedSessions = kicked
 
-	// Set proper permissions
-	if err := exec.Command("sudo", "chown", "root:root", crlDest).Run(); err != nil {
-		return fmt.Errorf("failed to set CRL permissions: %v", err)
+	log.Printf("✅ CRL #%d published (%d revoked, next update %s, %d session(s) kicked)",
+		publication.CRLNumber, publication.RevokedCount, publication.NextUpdate.Format(time.RFC3339), kicked)
+
+	go func() {
+		if err := enm.reportCRLPublication(publication); err != nil {
+			log.Printf("Warning: Failed to report CRL publication to management: %v", err)
+		}
+		if err := enm.reportCertificates(nil); err != nil {
+			log.Printf("Warning: Failed to report certificates to management: %v", err)
+		}
+	}()
+
+	return publication, nil
+}
+
+// kickRevokedClients disconnects connected clients that may be using a revoked certificate.
+// Existing sessions are not re-checked against the CRL by OpenVPN, so they are killed explicitly.
+// The management interface does not tell which certificate a session uses, so every session
+// of a user that started before one of the user's certificates was revoked is killed; a user
+// who still holds a valid certificate, e.g. a renewed one, reconnects with it.
+func (enm *EndNodeManager) kickRevokedClients(ca *pki.PKI) (int, error) {
+	sessions, err := enm.ovpnMgmt.ListClients()
+	if err != nil {
+		return 0, err
+	}
+	if len(sessions) == 0 {
+		return 0, nil
 	}
 
-	if err := exec.Command("sudo", "chmod", "644", crlDest).Run(); err != nil {
-		return fmt.Errorf("failed to set CRL permissions: %v", err)
+	entries, err := ca.Index()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	valid := make(map[string]bool)
+	lastRevoked := make(map[string]time.Time)
+	for _, entry := range entries {
+		commonName := entry.CommonName()
+		if entry.IsValid(now) {
+			valid[commonName] = true
+		} else if entry.Status == pki.StatusRevoked && entry.RevokedAt.After(lastRevoked[commonName]) {
+			lastRevoked[commonName] = entry.RevokedAt
+		}
 	}
 
-	// Restart OpenVPN server to apply CRL
-	if err := exec.Command("sudo", "systemctl", "restart", "openvpn@server").Run(); err != nil {
-		return fmt.Errorf("failed to restart OpenVPN server: %v", err)
+	kicked := 0
+	seen := make(map[string]bool)
+	for _, session := range sessions {
+		commonName := session.CommonName
+		revokedAt, revoked := lastRevoked[commonName]
+		if seen[commonName] || !revoked {
+			continue
+		}
+		// Sessions that started after the revocation passed crl-verify with another certificate
+		if valid[commonName] && session.ConnectedSince.After(revokedAt) {
+			continue
+		}
+		seen[commonName] = true
+
+		count, err := enm.DisconnectUser(commonName)
+		if err != nil {
+			log.Printf("Warning: Failed to disconnect revoked client %s: %v", commonName, err)
+			continue
+		}
+		kicked += count
 	}
 
-	log.Printf("✅ CRL updated and OpenVPN server restarted")
+	return kicked, nil
+}
+
+// reportCRLPublication sends the result of a CRL publish to the management server,
+// queued while it is unreachable
+func (enm *EndNodeManager) reportCRLPublication(publication *shared.CRLPublication) error {
+	path := fmt.Sprintf("/api/endnodes-crl/%s", enm.serverID)
+	if _, err := enm.report("crl", path, publication); err != nil {
+		return fmt.Errorf("failed to send CRL publication: %v", err)
+	}
 	return nil
 }
 
+// certificateAuthority opens the PKI directory on first use
+func (enm *EndNodeManager) certificateAuthority() (*pki.PKI, error) {
+	enm.caMu.Lock()
+	defer enm.caMu.Unlock()
+
+	if enm.ca != nil {
+		return enm.ca, nil
+	}
+
+	ca, err := pki.Open(enm.config.PKIDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PKI at %s: %v", enm.config.PKIDir, err)
+	}
+
+	enm.ca = ca
+	return ca, nil
+}
+
 // isWritable checks if a directory is writable
 func isWritable(path string) bool {
 	// Try to create a temporary file in the directory
@@ -0,0 +1,41 @@
+package manager
+
+import (
+	"fmt"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// EnableNodeTLS makes calls to the management server present the end-node certificate and
+// only trust the management certificate issued by the node CA
+func (enm *EndNodeManager) EnableNodeTLS() error {
+	if !enm.config.TLS.Enabled() {
+		return nil
+	}
+
+	transport, err := shared.NewNodeTransport(enm.config.TLS)
+	if err != nil {
+		return err
+	}
+	enm.httpClient.Transport = transport
+	return nil
+}
+
+// NodeTLS returns the mutual TLS settings of the link to the management server, empty when disabled
+func (enm *EndNodeManager) NodeTLS() shared.NodeTLSConfig {
+	return enm.config.TLS
+}
+
+// HookPort returns the loopback port the OpenVPN hooks reach the API on: a plain HTTP
+// listener of its own while the API requires mutual TLS, otherwise the API port
+func (enm *EndNodeManager) HookPort() int {
+	if enm.config.TLS.Enabled() {
+		return enm.config.HookPort
+	}
+	return enm.GetServerPort()
+}
+
+// LocalAPIURL returns the loopback URL the OpenVPN hooks and the startup check reach the API on
+func (enm *EndNodeManager) LocalAPIURL() string {
+	return fmt.Sprintf("http://127.0.0.1:%d", enm.HookPort())
+}
@@ -0,0 +1,206 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"barqnet-backend/apps/endnode/outbox"
+	"barqnet-backend/pkg/shared"
+)
+
+// Delays between replays of queued reports while management stays unreachable
+const (
+	outboxMinBackoff = 5 * time.Second
+	outboxMaxBackoff = 5 * time.Minute
+)
+
+// errReportRejected marks a report management refused; sending it again would not help
+type errReportRejected struct {
+	status int
+	body   string
+}
+
+func (e *errReportRejected) Error() string {
+	return fmt.Sprintf("management rejected report with status %d: %s", e.status, e.body)
+}
+
+// OpenOutbox opens the on-disk queue reports are kept in while management is unreachable.
+// Without an outbox path reports that cannot be delivered are dropped.
+func (enm *EndNodeManager) OpenOutbox() error {
+	if enm.config.OutboxPath == "" {
+		return nil
+	}
+
+	queue, err := outbox.Open(enm.config.OutboxPath, outbox.DefaultMaxEntries)
+	if err != nil {
+		return err
+	}
+	enm.outbox = queue
+	enm.outboxWake = make(chan struct{}, 1)
+	if depth := queue.Len(); depth > 0 {
+		log.Printf("[OUTBOX] %d reports queued before the restart will be replayed", depth)
+	}
+	return nil
+}
+
+// OutboxStatus returns the depth of the outbox, nil when reports are not queued
+func (enm *EndNodeManager) OutboxStatus() *shared.OutboxStatus {
+	if enm.outbox == nil {
+		return nil
+	}
+	stats := enm.outbox.Stats()
+	return &stats
+}
+
+// report delivers a report to a management API path. While management is unreachable, or
+// earlier reports still wait, the report is queued so management receives them in order.
+// It returns whether the report was queued rather than delivered.
+func (enm *EndNodeManager) report(kind, path string, payload interface{}) (bool, error) {
+	if enm.outbox == nil || enm.outbox.Len() == 0 {
+		err := enm.postReport(path, payload)
+		if err == nil || enm.outbox == nil {
+			return false, err
+		}
+		if _, rejected := err.(*errReportRejected); rejected {
+			return false, err
+		}
+		log.Printf("[OUTBOX] ⚠️  Management unreachable, queueing reports: %v", err)
+	}
+
+	if err := enm.outbox.Enqueue(kind, path, payload); err != nil {
+		return false, fmt.Errorf("failed to queue %s report: %v", kind, err)
+	}
+	enm.wakeOutbox()
+	return true, nil
+}
+
+// wakeOutbox makes the replay routine try the queue without waiting for its backoff
+func (enm *EndNodeManager) wakeOutbox() {
+	select {
+	case enm.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartOutboxReplay delivers queued reports in order, backing off while management stays unreachable
+func (enm *EndNodeManager) StartOutboxReplay() {
+	if enm.outbox == nil {
+		return
+	}
+
+	failures := 0
+	for {
+		if failures > 0 {
+			// New reports are no reason to retry before the backoff is over
+			time.Sleep(outbox.Backoff(failures, outboxMinBackoff, outboxMaxBackoff))
+		} else if enm.outbox.Len() == 0 {
+			<-enm.outboxWake
+		}
+
+		delivered, err := enm.outbox.Drain(enm.deliverQueued)
+		if err != nil {
+			failures++
+			if failures == 1 || delivered > 0 {
+				log.Printf("[OUTBOX] Management still unreachable or refusing the end-node, %d reports queued: %v", enm.outbox.Len(), err)
+			}
+			continue
+		}
+		if delivered > 0 {
+			log.Printf("[OUTBOX] ✅ Replayed %d queued reports to the management server", delivered)
+		}
+		failures = 0
+	}
+}
+
+// deliverQueued sends one queued report. Reports management rejects are dropped.
+func (enm *EndNodeManager) deliverQueued(entry outbox.Entry) error {
+	err := enm.postReport(entry.Path, entry.Body)
+	if rejected, ok := err.(*errReportRejected); ok {
+		log.Printf("[OUTBOX] ❌ Dropping %s report queued at %s: %v", entry.Kind, entry.QueuedAt.Format(time.RFC3339), rejected)
+		return nil
+	}
+	return err
+}
+
+// postReport posts a JSON report to a management API path. Reports management refuses for
+// their content are returned as errReportRejected, see reportRejected.
+func (enm *EndNodeManager) postReport(path string, payload interface{}) error {
+	// Queued reports are already encoded
+	body, ok := payload.(json.RawMessage)
+	if !ok {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal report: %v", err)
+		}
+		body = data
+	}
+
+	req, err := http.NewRequest("POST", enm.config.ManagementURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := enm.authorize(req); err != nil {
+		return err
+	}
+
+	resp, err := enm.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach management server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if reportRejected(resp.StatusCode) {
+		return &errReportRejected{status: resp.StatusCode, body: strings.TrimSpace(string(data))}
+	}
+	return fmt.Errorf("management server returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+}
+
+// reportRejected reports whether management refused a report for its content, so sending it
+// again cannot succeed. Authentication failures are not: a rotated credential or clock skew
+// is fixed on the end-node, and the queued reports must survive until then.
+func reportRejected(status int) bool {
+	switch status {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// ReportAuditEvent ships an audit event of this end-node to the management audit log,
+// through the outbox so events are never lost or reordered
+func (enm *EndNodeManager) ReportAuditEvent(action, username, details, ipAddress string) {
+	event := shared.EndNodeAuditEvent{
+		Action:     action,
+		Username:   username,
+		Details:    details,
+		IPAddress:  ipAddress,
+		OccurredAt: time.Now(),
+	}
+	path := fmt.Sprintf("/api/endnodes-audit/%s", enm.serverID)
+
+	// Events come from API handlers, which must not wait for management
+	if enm.outbox == nil {
+		go func() {
+			if err := enm.postReport(path, event); err != nil {
+				log.Printf("[AUDIT] ⚠️  Failed to ship audit event %s: %v", action, err)
+			}
+		}()
+		return
+	}
+	if err := enm.outbox.Enqueue("audit", path, event); err != nil {
+		log.Printf("[AUDIT] ⚠️  Failed to queue audit event %s: %v", action, err)
+		return
+	}
+	enm.wakeOutbox()
+}
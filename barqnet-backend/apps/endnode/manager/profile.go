@@ -0,0 +1,412 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"barqnet-backend/apps/endnode/openvpn"
+	"barqnet-backend/pkg/shared"
+)
+
+// SyncServerProfile pulls the OpenVPN server profile from the management server and applies
+// it when it changed: server.conf is rendered, checked against the files it references,
+// installed and OpenVPN is restarted. Existing client profiles are then re-rendered from the
+// same profile, so clients and server never run different settings.
+// It returns true if a new profile was applied.
+func (enm *EndNodeManager) SyncServerProfile() (bool, error) {
+	enm.profileSyncMu.Lock()
+	defer enm.profileSyncMu.Unlock()
+
+	applied := enm.appliedServerProfile()
+
+	var appliedVersion string
+	if applied != nil {
+		appliedVersion = applied.Version
+
+		// Node-local settings such as hooks may have changed since the end-node last ran
+		if !enm.localConfigApplied {
+			enm.localConfigApplied = true
+			if _, err := enm.applyServerConfig(applied); err != nil {
+				log.Printf("Warning: Failed to re-render server config from the applied profile: %v", err)
+			}
+		}
+	}
+
+	profile, err := enm.fetchServerProfile(appliedVersion)
+	if err != nil {
+		return false, err
+	}
+	if profile == nil || profile.Version == appliedVersion {
+		return false, nil
+	}
+
+	report := &shared.ServerProfileReport{
+		ServerID: enm.serverID,
+		Version:  profile.Version,
+	}
+
+	restarted, err := enm.applyServerConfig(profile)
+	if err != nil {
+		// Report a broken profile once, not on every sync
+		if profile.Version != enm.profileFailedVersion {
+			enm.profileFailedVersion = profile.Version
+			report.Error = err.Error()
+			report.AppliedAt = time.Now()
+			if reportErr := enm.reportServerProfile(report); reportErr != nil {
+				log.Printf("Warning: Failed to report server profile failure: %v", reportErr)
+			}
+		}
+		return false, fmt.Errorf("failed to apply server profile %s: %v", profile.Version, err)
+	}
+	enm.profileFailedVersion = ""
+
+	enm.setServerProfile(profile)
+
+	report.Applied = true
+	report.Restarted = restarted
+	report.Rerendered = enm.rerenderClientProfiles(profile)
+	report.AppliedAt = time.Now()
+
+	log.Printf("[PROFILE] ✅ Server profile %q version %s applied (restarted=%v, client profiles re-rendered=%d)",
+		profile.Name, profile.Version, restarted, len(report.Rerendered))
+
+	if err := enm.reportServerProfile(report); err != nil {
+		log.Printf("Warning: Failed to report applied server profile: %v", err)
+	}
+
+	return true, nil
+}
+
+// serverProfile returns the profile client configurations are rendered from: the applied
+// profile, or the built-in default before the first successful sync
+func (enm *EndNodeManager) serverProfile() *shared.ServerProfile {
+	if profile := enm.appliedServerProfile(); profile != nil {
+		return profile
+	}
+	return shared.DefaultServerProfile()
+}
+
+// appliedServerProfile returns the profile server.conf was last rendered from, loading it
+// from the profile cache after a restart. It returns nil if no profile was applied yet.
+func (enm *EndNodeManager) appliedServerProfile() *shared.ServerProfile {
+	enm.profileMu.Lock()
+	defer enm.profileMu.Unlock()
+
+	if enm.profile == nil {
+		data, err := os.ReadFile(enm.serverProfileCachePath())
+		if err != nil {
+			return nil
+		}
+		var profile shared.ServerProfile
+		if err := json.Unmarshal(data, &profile); err != nil || profile.Validate() != nil {
+			log.Printf("Warning: Ignoring invalid server profile cache %s", enm.serverProfileCachePath())
+			return nil
+		}
+		enm.profile = &profile
+	}
+
+	return enm.profile
+}
+
+// setServerProfile records the applied profile and caches it next to server.conf
+func (enm *EndNodeManager) setServerProfile(profile *shared.ServerProfile) {
+	enm.profileMu.Lock()
+	enm.profile = profile
+	enm.profileMu.Unlock()
+
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err == nil {
+		err = os.WriteFile(enm.serverProfileCachePath(), data, 0644)
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to cache server profile: %v", err)
+	}
+}
+
+// serverProfileCachePath is where the applied profile is kept across end-node restarts
+func (enm *EndNodeManager) serverProfileCachePath() string {
+	return filepath.Join(filepath.Dir(enm.config.OpenVPNServerConfig), "server-profile.json")
+}
+
+// serverConfigPaths returns the node-local files referenced by the rendered server.conf
+func (enm *EndNodeManager) serverConfigPaths() shared.OpenVPNServerPaths {
+	dir := enm.config.OpenVPNDir
+	_, management := openvpn.ParseManagementAddress(enm.config.OpenVPNManagement)
+
+	paths := shared.OpenVPNServerPaths{
+		Listeners:        enm.config.OpenVPNListeners,
+		CA:               filepath.Join(dir, "ca.crt"),
+		Cert:             filepath.Join(dir, "server.crt"),
+		Key:              filepath.Join(dir, "server.key"),
+		TLSCryptKey:      filepath.Join(dir, "tls-crypt.key"),
+		TLSCryptV2Key:    filepath.Join(dir, "tls-crypt-v2-server.key"),
+		CRL:              enm.config.CRLPath,
+		Management:       management,
+		ClientConnect:    enm.config.OpenVPNClientConnect,
+		ClientDisconnect: enm.config.OpenVPNClientDisconnect,
+		StatusFile:       filepath.Join(dir, "openvpn-status.log"),
+		ClientConfigDir:  enm.config.OpenVPNCCDDir,
+		ClientNetworks:   clientNetworks(enm.config.OpenVPNCCDDir),
+	}
+
+	// Built-in hooks report to the API on loopback
+	if enm.config.OpenVPNHookBinary != "" {
+		paths.HookBinary = enm.config.OpenVPNHookBinary
+		paths.HookAPI = enm.LocalAPIURL()
+		paths.HookFailOpen = enm.config.OpenVPNHookFailOpen
+	}
+
+	// RSA setups made by setup-endnode.sh carry DH parameters; without them ECDHE is used
+	if _, err := os.Stat(filepath.Join(dir, "dh.pem")); err == nil {
+		paths.DH = filepath.Join(dir, "dh.pem")
+	}
+	if enm.config.OpenVPNManagementPassword != "" {
+		paths.ManagementPasswordFile = filepath.Join(dir, "management.pw")
+	}
+
+	return paths
+}
+
+// applyServerConfig renders server.conf from the profile and installs it, restarting
+// OpenVPN if the file changed. It returns true if OpenVPN was restarted.
+func (enm *EndNodeManager) applyServerConfig(profile *shared.ServerProfile) (bool, error) {
+	paths := enm.serverConfigPaths()
+
+	content, err := shared.RenderServerConfig(profile, paths)
+	if err != nil {
+		return false, err
+	}
+
+	// Several listeners in one server need OpenVPN 2.7; earlier releases would not start
+	if len(paths.Listeners) > 1 {
+		if err := openvpn.CheckMultipleListeners(); err != nil {
+			return false, err
+		}
+	}
+
+	// OpenVPN refuses to start when a referenced file is missing
+	required := []string{paths.CA, paths.Cert, paths.Key, paths.CRL}
+	if profile.TLSCrypt {
+		required = append(required, paths.TLSCryptKey)
+	}
+	if profile.TLSCryptV2 {
+		// Client keys are wrapped with the server key, so it is created once and then kept
+		created, err := openvpn.EnsureTLSCryptV2ServerKey(paths.TLSCryptV2Key)
+		if err != nil {
+			return false, err
+		}
+		if created {
+			log.Printf("[PROFILE] Created tls-crypt-v2 server key %s", paths.TLSCryptV2Key)
+		}
+		required = append(required, paths.TLSCryptV2Key)
+	}
+	for _, path := range []string{paths.ClientConnect, paths.ClientDisconnect, paths.HookBinary} {
+		if path != "" {
+			required = append(required, path)
+		}
+	}
+	for _, path := range required {
+		if _, err := os.Stat(path); err != nil {
+			return false, fmt.Errorf("server config references %s: %v", path, err)
+		}
+	}
+
+	// OpenVPN refuses to start when client-config-dir does not exist
+	if paths.ClientConfigDir != "" {
+		if err := os.MkdirAll(paths.ClientConfigDir, 0755); err != nil {
+			return false, fmt.Errorf("failed to create client config directory: %v", err)
+		}
+	}
+
+	if paths.ManagementPasswordFile != "" {
+		if err := os.WriteFile(paths.ManagementPasswordFile, []byte(enm.config.OpenVPNManagementPassword+"\n"), 0600); err != nil {
+			return false, fmt.Errorf("failed to write management password file: %v", err)
+		}
+	}
+
+	changed, err := openvpn.InstallServerConfig(enm.config.OpenVPNServerConfig, content)
+	if err != nil {
+		return false, err
+	}
+	if !changed {
+		return false, nil
+	}
+	log.Printf("[PROFILE] Installed %s (previous config kept as %s.bak)", enm.config.OpenVPNServerConfig, enm.config.OpenVPNServerConfig)
+
+	if err := enm.ovpnMgmt.Restart(); err != nil {
+		log.Printf("[PROFILE] ⚠️  OpenVPN could not be restarted, restart it manually to apply %s: %v", enm.config.OpenVPNServerConfig, err)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// rerenderClientProfiles renders every .ovpn file in the clients directory from the profile,
+// keeping its embedded certificates and keys. It returns the users whose profile changed.
+func (enm *EndNodeManager) rerenderClientProfiles(profile *shared.ServerProfile) []string {
+	entries, err := os.ReadDir(ClientsDir())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Failed to read clients directory: %v", err)
+		}
+		return nil
+	}
+
+	var rerendered []string
+	for _, entry := range entries {
+		username := strings.TrimSuffix(entry.Name(), ".ovpn")
+		if entry.IsDir() || username == entry.Name() || validateUsernameForCommand(username) != nil {
+			continue
+		}
+
+		path := filepath.Join(ClientsDir(), entry.Name())
+		current, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Warning: Failed to read client profile %s: %v", path, err)
+			continue
+		}
+
+		// Keep the transport the profile tried first
+		_, protocol := parseOVPNProfile(current)
+		params := shared.OpenVPNClientParams{
+			Username:  username,
+			ServerID:  enm.serverID,
+			Hosts:     enm.remoteHosts(remoteHost(current)),
+			Listeners: enm.listeners(protocol),
+		}
+		params.CA, _ = inlineBlock(string(current), "ca")
+		params.Cert, _ = inlineBlock(string(current), "cert")
+		params.Key, _ = inlineBlock(string(current), "key")
+		// Switching between tls-crypt and tls-crypt-v2 hands the user the key of the new mode
+		params.TLSCryptKey, err = enm.tlsCryptKey(profile, username, string(current))
+		if err != nil {
+			log.Printf("Warning: Failed to get TLS-crypt key for %s: %v", username, err)
+		}
+
+		content, err := shared.RenderClientConfig(profile, params)
+		if err != nil {
+			log.Printf("Warning: Failed to render client profile for %s: %v", username, err)
+			continue
+		}
+		if bytes.Equal(content, current) {
+			continue
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			log.Printf("Warning: Failed to write client profile %s: %v", path, err)
+			continue
+		}
+		rerendered = append(rerendered, username)
+	}
+
+	return rerendered
+}
+
+// remoteHost returns the host of the first remote line of an OpenVPN profile
+func remoteHost(content []byte) string {
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "remote" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// inlineBlock returns the content of an inline <tag> block written by replaceInlineBlock
+func inlineBlock(content, tag string) (string, bool) {
+	open := "<" + tag + ">\n"
+	close := "\n</" + tag + ">"
+
+	start := strings.Index(content, open)
+	if start == -1 {
+		return "", false
+	}
+	start += len(open)
+	end := strings.Index(content[start:], close)
+	if end == -1 {
+		return "", false
+	}
+
+	return content[start : start+end], true
+}
+
+// fetchServerProfile gets the server profile for this end-node from the management server.
+// It returns nil when management answers 304 Not Modified for the applied version.
+func (enm *EndNodeManager) fetchServerProfile(appliedVersion string) (*shared.ServerProfile, error) {
+	url := fmt.Sprintf("%s/api/endnodes-profile/%s", enm.config.ManagementURL, enm.serverID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	if err := enm.authorize(req); err != nil {
+		return nil, err
+	}
+	if appliedVersion != "" {
+		req.Header.Set("If-None-Match", fmt.Sprintf("\"%s\"", appliedVersion))
+	}
+
+	resp, err := enm.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch server profile: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server profile request failed with status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Success bool                 `json:"success"`
+		Data    shared.ServerProfile `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode server profile: %v", err)
+	}
+	if !response.Success || response.Data.Version == "" {
+		return nil, fmt.Errorf("management server returned an invalid server profile")
+	}
+
+	return &response.Data, nil
+}
+
+// reportServerProfile tells the management server whether a server profile was applied
+func (enm *EndNodeManager) reportServerProfile(report *shared.ServerProfileReport) error {
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal server profile report: %v", err)
+	}
+
+	url := fmt.Sprintf("%s/api/endnodes-profile/%s", enm.config.ManagementURL, enm.serverID)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if err := enm.authorize(req); err != nil {
+		return err
+	}
+
+	resp, err := enm.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send server profile report: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server profile report failed with status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+const (
+	// maxRevocationsPerPass limits how many users one reconciliation pass may revoke, so a
+	// bad desired state cannot wipe a node in one go; the rest follow on later passes
+	maxRevocationsPerPass = 25
+
+	// driftReportInterval is how often a report is sent when nothing changed, so
+	// management can tell a converged node from one that stopped reconciling
+	driftReportInterval = time.Hour
+)
+
+// Reconcile pulls the desired user set from the management server, compares it with the
+// local inventory, creates missing profiles and revokes users that should not exist.
+// A drift report is sent when anything differed, the desired version changed or the
+// last report is older than driftReportInterval.
+func (enm *EndNodeManager) Reconcile() (*shared.DriftReport, error) {
+	enm.reconcileMu.Lock()
+	defer enm.reconcileMu.Unlock()
+
+	desired, err := enm.fetchDesiredState()
+	if err != nil {
+		return nil, err
+	}
+
+	actual, err := enm.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build local inventory: %v", err)
+	}
+
+	missing, unexpected := shared.DiffUsers(desired.Users, actual)
+
+	report := &shared.DriftReport{
+		ServerID:     enm.serverID,
+		Version:      desired.Version,
+		DesiredCount: len(desired.Users),
+		ActualCount:  len(actual),
+		Missing:      []string{},
+		Unexpected:   []string{},
+		Created:      []string{},
+		Revoked:      []string{},
+		Failed:       make(map[string]string),
+	}
+
+	for _, user := range missing {
+		report.Missing = append(report.Missing, user.Username)
+
+		log.Printf("[RECONCILE] User %s is missing (%s), creating profile", user.Username, user.Protocol)
+		if err := enm.createDesiredUser(user); err != nil {
+			log.Printf("[RECONCILE] ❌ Failed to create user %s: %v", user.Username, err)
+			report.Failed[user.Username] = err.Error()
+			continue
+		}
+		report.Created = append(report.Created, user.Username)
+	}
+
+	report.Unexpected = append(report.Unexpected, unexpected...)
+	if len(unexpected) > 0 && len(desired.Users) == 0 {
+		// An empty desired set is far more likely a management fault than a real wipe
+		log.Printf("[RECONCILE] Desired state %s is empty, not revoking %d local user(s)", desired.Version, len(unexpected))
+	} else {
+		for i, username := range unexpected {
+			if i >= maxRevocationsPerPass {
+				log.Printf("[RECONCILE] Revocation limit reached, %d user(s) left for the next pass", len(unexpected)-i)
+				break
+			}
+
+			log.Printf("[RECONCILE] User %s should not exist on this node, revoking", username)
+			if err := enm.DeleteUser(username); err != nil {
+				log.Printf("[RECONCILE] ❌ Failed to revoke user %s: %v", username, err)
+				report.Failed[username] = err.Error()
+				continue
+			}
+			report.Revoked = append(report.Revoked, username)
+		}
+	}
+
+	report.ReconciledAt = time.Now()
+
+	if report.HasDrift() || desired.Version != enm.lastVersion || time.Since(enm.lastDriftReport) >= driftReportInterval {
+		if err := enm.reportDrift(report); err != nil {
+			return report, fmt.Errorf("reconciled but failed to report drift: %v", err)
+		}
+		enm.lastVersion = desired.Version
+		enm.lastDriftReport = report.ReconciledAt
+	}
+
+	if report.HasDrift() {
+		log.Printf("[RECONCILE] ✅ Converged on version %s (created=%d revoked=%d failed=%d)",
+			desired.Version, len(report.Created), len(report.Revoked), len(report.Failed))
+	}
+
+	return report, nil
+}
+
+// createDesiredUser provisions the profile of a desired user for its protocol
+func (enm *EndNodeManager) createDesiredUser(user shared.DesiredUser) error {
+	if err := validateUsernameForCommand(user.Username); err != nil {
+		return err
+	}
+
+	serverIP := enm.GetServerHost()
+
+	if user.Protocol == shared.ProtocolWireGuard {
+		// A stale peer without its client config is replaced
+		if err := enm.RemoveWireGuardPeer(user.Username); err != nil {
+			return err
+		}
+		_, err := enm.CreateWireGuardPeer(user.Username, serverIP)
+		return err
+	}
+
+	port, protocol := user.Port, user.Protocol
+	if port == 0 {
+		port = 1194
+	}
+	if protocol != "tcp" {
+		protocol = "udp"
+	}
+
+	// A valid certificate whose profile is gone is revoked, so the reissued
+	// certificate is the only one that can connect
+	hadValidCert := false
+	if ca, err := enm.certificateAuthority(); err == nil {
+		if entries, err := ca.FindByCommonName(user.Username); err == nil {
+			for _, entry := range entries {
+				if entry.IsValid(time.Now()) {
+					hadValidCert = true
+				}
+			}
+		}
+	}
+	if hadValidCert {
+		if err := enm.RevokeUserCertificate(user.Username); err != nil {
+			return err
+		}
+	}
+
+	// Empty certificate data makes CreateOVPNWithCerts issue a new certificate
+	var certData struct {
+		CA   string
+		Cert string
+		Key  string
+		TA   string
+	}
+	ovpnPath := filepath.Join(ClientsDir(), user.Username+".ovpn")
+	err := enm.CreateOVPNWithCerts(user.Username, ovpnPath, port, protocol, enm.serverID, serverIP, certData)
+
+	if hadValidCert {
+		if _, crlErr := enm.PublishCRL(); crlErr != nil {
+			log.Printf("[RECONCILE] Warning: Failed to publish CRL: %v", crlErr)
+		}
+	}
+
+	return err
+}
+
+// fetchDesiredState gets the desired user set from the management server.
+// The cached set is reused when management answers 304 Not Modified.
+func (enm *EndNodeManager) fetchDesiredState() (*shared.DesiredState, error) {
+	url := fmt.Sprintf("%s/api/endnodes-desired/%s", enm.config.ManagementURL, enm.serverID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	if err := enm.authorize(req); err != nil {
+		return nil, err
+	}
+	if enm.desired != nil {
+		req.Header.Set("If-None-Match", fmt.Sprintf("\"%s\"", enm.desired.Version))
+	}
+
+	resp, err := enm.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch desired state: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && enm.desired != nil {
+		return enm.desired, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("desired state request failed with status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Success bool                `json:"success"`
+		Data    shared.DesiredState `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode desired state: %v", err)
+	}
+	if !response.Success || response.Data.Version == "" {
+		return nil, fmt.Errorf("management server returned an invalid desired state")
+	}
+
+	enm.desired = &response.Data
+	return enm.desired, nil
+}
+
+// reportDrift sends a reconciliation report to the management server
+func (enm *EndNodeManager) reportDrift(report *shared.DriftReport) error {
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal drift report: %v", err)
+	}
+
+	url := fmt.Sprintf("%s/api/endnodes-drift/%s", enm.config.ManagementURL, enm.serverID)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if err := enm.authorize(req); err != nil {
+		return err
+	}
+
+	resp, err := enm.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send drift report: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("drift report failed with status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
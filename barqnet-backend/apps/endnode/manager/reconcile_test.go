@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barqnet-backend/pkg/pki"
+	"barqnet-backend/pkg/shared"
+)
+
+// TestReconcileClientsDir verifies reconciliation converges with profiles outside the default clients directory
+func TestReconcileClientsDir(t *testing.T) {
+	dir := t.TempDir()
+	clients := filepath.Join(dir, "clients")
+	t.Setenv("CLIENTS_DIR", clients)
+
+	ca, err := pki.Init(filepath.Join(dir, "pki"), "Test CA", pki.KeyTypeECDSA, 0)
+	if err != nil {
+		t.Fatalf("Failed to init PKI: %v", err)
+	}
+	if err := os.MkdirAll(clients, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := ca.IssueClient(username, pki.IssueOptions{KeyType: pki.KeyTypeECDSA, Lifetime: 30 * 24 * time.Hour}); err != nil {
+			t.Fatalf("IssueClient(%s) failed: %v", username, err)
+		}
+		profile := []byte("client\nremote vpn.example.com 1194 udp\n")
+		if err := os.WriteFile(filepath.Join(clients, username+".ovpn"), profile, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Management wants alice only
+	management := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/endnodes-desired/node-1" {
+			json.NewEncoder(w).Encode(shared.APIResponse{Success: true, Data: shared.DesiredState{
+				Version: "v1",
+				Users:   []shared.DesiredUser{{Username: "alice", Port: 1194, Protocol: "udp"}},
+			}})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer management.Close()
+
+	enm := NewEndNodeManager("node-1", &shared.EndNodeConfig{
+		ManagementURL:       management.URL,
+		OpenVPNManagement:   filepath.Join(dir, "missing.sock"),
+		OpenVPNServerConfig: filepath.Join(dir, "server.conf"),
+		CRLPath:             filepath.Join(dir, "crl.pem"),
+		PKIDir:              ca.Dir(),
+		WireGuardConfigPath: filepath.Join(dir, "wg0.conf"),
+	})
+
+	report, err := enm.Reconcile()
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if len(report.Missing) != 0 || len(report.Created) != 0 {
+		t.Errorf("alice was treated as missing: missing=%v created=%v", report.Missing, report.Created)
+	}
+	if len(report.Revoked) != 1 || report.Revoked[0] != "bob" {
+		t.Errorf("revoked = %v, want [bob]", report.Revoked)
+	}
+	if _, err := os.Stat(filepath.Join(clients, "bob.ovpn")); !os.IsNotExist(err) {
+		t.Errorf("bob.ovpn was not removed from %s", clients)
+	}
+	if _, err := os.Stat(filepath.Join(clients, "alice.ovpn")); err != nil {
+		t.Errorf("alice.ovpn is gone: %v", err)
+	}
+
+	// The second pass finds nothing left to do
+	report, err = enm.Reconcile()
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if report.HasDrift() {
+		t.Errorf("reconciliation did not converge: missing=%v unexpected=%v failed=%v",
+			report.Missing, report.Unexpected, report.Failed)
+	}
+}
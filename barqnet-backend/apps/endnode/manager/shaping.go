@@ -0,0 +1,102 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+
+	"barqnet-backend/apps/endnode/shaping"
+)
+
+// userLimit returns the rate limit the access list sets for a user, zero for line rate
+func (enm *EndNodeManager) userLimit(username string) shaping.Limit {
+	enm.accessMu.Lock()
+	defer enm.accessMu.Unlock()
+
+	bw := enm.accessUsers[username].Bandwidth
+	if bw == nil {
+		return shaping.Limit{}
+	}
+	return shaping.Limit{DownKbps: bw.DownKbps, UpKbps: bw.UpKbps}
+}
+
+// ShapeSession applies a user's bandwidth limit to the tunnel address of a session that
+// just connected. Failures are logged rather than returned, so they never keep users out.
+func (enm *EndNodeManager) ShapeSession(username, virtualAddress string) {
+	if enm.shaper == nil || virtualAddress == "" {
+		return
+	}
+	addr, err := netip.ParseAddr(virtualAddress)
+	if err != nil {
+		log.Printf("[SHAPING] Warning: Invalid tunnel address %q of %s", virtualAddress, username)
+		return
+	}
+
+	limit := enm.userLimit(username)
+	if err := enm.shaper.Shape(addr, limit); err != nil {
+		log.Printf("[SHAPING] Warning: Failed to shape %s at %s: %v", username, addr, err)
+		return
+	}
+	if !limit.IsZero() {
+		log.Printf("[SHAPING] %s at %s limited to %d/%d kbps down/up", username, addr, limit.DownKbps, limit.UpKbps)
+	}
+}
+
+// UnshapeSession removes the shaping of a session's tunnel address when it disconnects,
+// so the address is at line rate when the pool hands it to the next client
+func (enm *EndNodeManager) UnshapeSession(virtualAddress string) {
+	if enm.shaper == nil || virtualAddress == "" {
+		return
+	}
+	addr, err := netip.ParseAddr(virtualAddress)
+	if err != nil {
+		return
+	}
+	if err := enm.shaper.Unshape(addr); err != nil {
+		log.Printf("[SHAPING] Warning: Failed to remove shaping of %s: %v", addr, err)
+	}
+}
+
+// SyncShaping brings the shaping of connected sessions in line with the access list:
+// changed limits are applied and addresses no longer in use are released. It is run
+// when the access list changes and at startup, after clearing rules of a previous run.
+func (enm *EndNodeManager) SyncShaping() error {
+	if enm.shaper == nil {
+		return nil
+	}
+
+	sessions, err := enm.ovpnMgmt.ListClients()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions for shaping: %v", err)
+	}
+
+	live := make(map[netip.Addr]bool, len(sessions))
+	for _, session := range sessions {
+		addr, err := netip.ParseAddr(session.VirtualAddress)
+		if err != nil {
+			continue
+		}
+		live[addr.Unmap()] = true
+		if err := enm.shaper.Shape(addr, enm.userLimit(session.CommonName)); err != nil {
+			log.Printf("[SHAPING] Warning: Failed to shape %s at %s: %v", session.CommonName, addr, err)
+		}
+	}
+
+	for _, addr := range enm.shaper.Addresses() {
+		if !live[addr] {
+			if err := enm.shaper.Unshape(addr); err != nil {
+				log.Printf("[SHAPING] Warning: Failed to remove shaping of %s: %v", addr, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ResetShaping removes shaping rules left on the tunnel device by a previous run
+func (enm *EndNodeManager) ResetShaping() error {
+	if enm.shaper == nil {
+		return nil
+	}
+	return enm.shaper.Reset()
+}
@@ -0,0 +1,38 @@
+package manager
+
+import (
+	"fmt"
+	"net/http"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// authorize authenticates a request to the management server: signed with the end-node
+// credential when one is configured, otherwise with the shared API key
+func (enm *EndNodeManager) authorize(req *http.Request) error {
+	if enm.config.NodeSecret != "" {
+		return shared.SignRequest(req, enm.serverID, enm.config.NodeSecret, shared.SignedByNode)
+	}
+	if enm.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+enm.config.APIKey)
+	}
+	return nil
+}
+
+// SignedRequests reports whether requests from management must be signed with the end-node
+// credential rather than carry the shared API key
+func (enm *EndNodeManager) SignedRequests() bool {
+	return enm.config.NodeSecret != ""
+}
+
+// VerifyManagementRequest checks that a request was signed by management with the credential
+// of this end-node and is not a replay
+func (enm *EndNodeManager) VerifyManagementRequest(r *http.Request) error {
+	_, err := enm.requestVerifier.Verify(r, shared.SignedByManagement, func(nodeID string) (string, error) {
+		if nodeID != enm.serverID {
+			return "", fmt.Errorf("request is signed for end-node %s, not %s", nodeID, enm.serverID)
+		}
+		return enm.config.NodeSecret, nil
+	})
+	return err
+}
@@ -0,0 +1,130 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"barqnet-backend/apps/endnode/openvpn"
+	"barqnet-backend/pkg/shared"
+)
+
+// tlsCryptV2RevokedPath is where the revocation times of users' tls-crypt-v2 keys are kept.
+// Keys wrap their issue time, so a key issued after a user was revoked (a re-created user)
+// still works while every key issued before is rejected.
+func (enm *EndNodeManager) tlsCryptV2RevokedPath() string {
+	return filepath.Join(filepath.Dir(enm.config.OpenVPNServerConfig), "tls-crypt-v2-revoked.json")
+}
+
+// issueTLSCryptV2Key wraps a new tls-crypt-v2 client key for a user with the node's server key
+func (enm *EndNodeManager) issueTLSCryptV2Key(username string) (string, error) {
+	key, err := openvpn.LoadTLSCryptV2ServerKey(enm.serverConfigPaths().TLSCryptV2Key)
+	if err != nil {
+		return "", err
+	}
+
+	clientKey, err := key.WrapClientKey(openvpn.TLSCryptV2Metadata{
+		Username: username,
+		IssuedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(clientKey)), nil
+}
+
+// tlsCryptKey returns the user's tls-crypt or tls-crypt-v2 key, whichever the server profile
+// enables. The key embedded in the user's current profile is kept; otherwise the
+// shared tls-crypt key is read or a tls-crypt-v2 key wrapped for the user.
+func (enm *EndNodeManager) tlsCryptKey(profile *shared.ServerProfile, username, current string) (string, error) {
+	switch {
+	case profile.TLSCryptV2:
+		if key, ok := inlineBlock(current, "tls-crypt-v2"); ok && key != "" {
+			return key, nil
+		}
+		return enm.issueTLSCryptV2Key(username)
+	case profile.TLSCrypt:
+		if key, ok := inlineBlock(current, "tls-crypt"); ok && key != "" {
+			return key, nil
+		}
+		key, err := os.ReadFile(enm.serverConfigPaths().TLSCryptKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to read TLS-crypt key: %v", err)
+		}
+		return string(key), nil
+	}
+	return "", nil
+}
+
+// loadTLSCryptV2Revoked reads the revocation times of users' tls-crypt-v2 keys
+func (enm *EndNodeManager) loadTLSCryptV2Revoked() (map[string]int64, error) {
+	revoked := make(map[string]int64)
+	data, err := os.ReadFile(enm.tlsCryptV2RevokedPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return revoked, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &revoked); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", enm.tlsCryptV2RevokedPath(), err)
+	}
+	return revoked, nil
+}
+
+// revokeTLSCryptV2Keys blocks every tls-crypt-v2 key issued to a user until now. The
+// tls-crypt-v2-verify hook rejects them before the TLS handshake even starts.
+func (enm *EndNodeManager) revokeTLSCryptV2Keys(username string) error {
+	enm.tlsCryptMu.Lock()
+	defer enm.tlsCryptMu.Unlock()
+
+	revoked, err := enm.loadTLSCryptV2Revoked()
+	if err != nil {
+		return err
+	}
+	revoked[username] = time.Now().Unix()
+
+	data, err := json.MarshalIndent(revoked, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := enm.tlsCryptV2RevokedPath()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to move %s into place: %v", path, err)
+	}
+
+	log.Printf("✅ tls-crypt-v2 keys of user %s revoked", username)
+	return nil
+}
+
+// VerifyTLSCryptV2 decides whether a client presenting a tls-crypt-v2 key may start a TLS
+// handshake, for the tls-crypt-v2-verify hook. Keys issued to a user before the user was
+// revoked are rejected.
+func (enm *EndNodeManager) VerifyTLSCryptV2(req shared.TLSCryptV2VerifyRequest) *shared.ConnectDecision {
+	if err := validateUsernameForCommand(req.Username); err != nil {
+		return &shared.ConnectDecision{Reason: fmt.Sprintf("invalid key owner: %v", err)}
+	}
+
+	enm.tlsCryptMu.Lock()
+	revoked, err := enm.loadTLSCryptV2Revoked()
+	enm.tlsCryptMu.Unlock()
+	if err != nil {
+		// The CRL still stops a revoked user at the TLS handshake
+		log.Printf("[ACCESS] ⚠️  Failed to read revoked tls-crypt-v2 keys, allowing key of %s: %v", req.Username, err)
+		return &shared.ConnectDecision{Allowed: true}
+	}
+
+	if revokedAt, ok := revoked[req.Username]; ok && req.IssuedAt <= revokedAt {
+		return &shared.ConnectDecision{Reason: fmt.Sprintf("tls-crypt-v2 key revoked at %s", time.Unix(revokedAt, 0).UTC().Format(time.RFC3339))}
+	}
+	return &shared.ConnectDecision{Allowed: true}
+}
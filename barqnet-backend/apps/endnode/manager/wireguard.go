@@ -0,0 +1,59 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// CreateWireGuardPeer provisions a WireGuard peer for a user and writes the client
+// configuration to {username}.conf in the clients directory
+func (enm *EndNodeManager) CreateWireGuardPeer(username, serverIP string) ([]byte, error) {
+	// SECURITY: Validate username before using in paths and config files
+	if err := validateUsernameForCommand(username); err != nil {
+		return nil, fmt.Errorf("invalid username for WireGuard peer: %v", err)
+	}
+
+	client, err := enm.wg.AddPeer(username, serverIP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add WireGuard peer: %v", err)
+	}
+	content := client.Render()
+
+	dir := ClientsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %v", dir, err)
+	}
+
+	// The client config contains the private key, so it is only readable by the service
+	confPath := filepath.Join(dir, username+".conf")
+	if err := os.WriteFile(confPath, content, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write WireGuard config: %v", err)
+	}
+
+	log.Printf("✅ WireGuard peer created for user %s (address %s)", username, client.Address[0])
+	return content, nil
+}
+
+// RemoveWireGuardPeer removes a user's WireGuard peer and client configuration
+func (enm *EndNodeManager) RemoveWireGuardPeer(username string) error {
+	if err := validateUsernameForCommand(username); err != nil {
+		return fmt.Errorf("invalid username for WireGuard peer: %v", err)
+	}
+
+	removed, err := enm.wg.RemovePeer(username)
+	if err != nil {
+		return err
+	}
+	if removed {
+		log.Printf("✅ WireGuard peer removed for user %s", username)
+	}
+
+	confPath := filepath.Join(ClientsDir(), username+".conf")
+	if err := os.Remove(confPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove WireGuard config %s: %v", confPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,319 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// DefaultProcDir is where the kernel exposes process and system information
+const DefaultProcDir = "/proc"
+
+// cpuTimes are the aggregate jiffies of the "cpu" line of /proc/stat
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// netCounters are the byte counters of an interface in /proc/net/dev
+type netCounters struct {
+	rx uint64
+	tx uint64
+}
+
+// Collector reads node metrics from /proc. CPU usage and interface throughput are rates,
+// so the collector keeps the previous sample; the first sample reports averages since boot
+// and zero throughput.
+type Collector struct {
+	procDir string
+
+	mu      sync.Mutex
+	prevCPU *cpuTimes
+	prevNet map[string]netCounters
+	prevAt  time.Time
+}
+
+// NewCollector creates a collector reading from procDir (usually DefaultProcDir)
+func NewCollector(procDir string) *Collector {
+	return &Collector{procDir: procDir}
+}
+
+// Collect samples the node metrics, with disk usage for the file system holding diskPath.
+// Metrics that cannot be read are left zero and reported in the error; the rest are returned.
+// The connected client count comes from the OpenVPN management interface and is set by the caller.
+func (c *Collector) Collect(diskPath string) (*shared.NodeMetrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	m := &shared.NodeMetrics{CollectedAt: now, DiskPath: diskPath}
+	var failed []string
+
+	if data, err := os.ReadFile(filepath.Join(c.procDir, "stat")); err == nil {
+		cpu, count, err := parseCPUStat(data)
+		if err != nil {
+			failed = append(failed, err.Error())
+		} else {
+			m.CPUCount = count
+			m.CPUPercent = cpuPercent(c.prevCPU, cpu)
+			c.prevCPU = &cpu
+		}
+	} else {
+		failed = append(failed, err.Error())
+	}
+
+	if data, err := os.ReadFile(filepath.Join(c.procDir, "loadavg")); err == nil {
+		if m.LoadAvg1, m.LoadAvg5, m.LoadAvg15, err = parseLoadAvg(data); err != nil {
+			failed = append(failed, err.Error())
+		}
+	} else {
+		failed = append(failed, err.Error())
+	}
+
+	if data, err := os.ReadFile(filepath.Join(c.procDir, "meminfo")); err == nil {
+		if m.MemoryTotal, m.MemoryAvailable, err = parseMemInfo(data); err != nil {
+			failed = append(failed, err.Error())
+		} else if m.MemoryTotal > 0 {
+			m.MemoryPercent = percent(m.MemoryTotal-m.MemoryAvailable, m.MemoryTotal)
+		}
+	} else {
+		failed = append(failed, err.Error())
+	}
+
+	if data, err := os.ReadFile(filepath.Join(c.procDir, "net", "dev")); err == nil {
+		counters, err := parseNetDev(data)
+		if err != nil {
+			failed = append(failed, err.Error())
+		} else {
+			m.Interfaces = throughput(c.prevNet, counters, now.Sub(c.prevAt))
+			c.prevNet = counters
+		}
+	} else {
+		failed = append(failed, err.Error())
+	}
+	c.prevAt = now
+
+	if diskPath != "" {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(diskPath, &st); err == nil {
+			m.DiskTotal = st.Blocks * uint64(st.Bsize)
+			m.DiskFree = st.Bavail * uint64(st.Bsize)
+			if m.DiskTotal > 0 {
+				m.DiskPercent = percent(m.DiskTotal-st.Bfree*uint64(st.Bsize), m.DiskTotal)
+			}
+		} else {
+			failed = append(failed, fmt.Sprintf("statfs %s: %v", diskPath, err))
+		}
+	}
+
+	m.OpenVPNRunning = c.processRunning("openvpn")
+
+	if len(failed) > 0 {
+		return m, fmt.Errorf("failed to collect some metrics: %s", strings.Join(failed, "; "))
+	}
+	return m, nil
+}
+
+// processRunning reports whether a process with the given command name exists
+func (c *Collector) processRunning(name string) bool {
+	entries, err := os.ReadDir(c.procDir)
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil || !entry.IsDir() {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(c.procDir, entry.Name(), "comm"))
+		if err == nil && strings.TrimSpace(string(comm)) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCPUStat returns the aggregate CPU times and the number of CPUs from /proc/stat
+func parseCPUStat(data []byte) (cpuTimes, int, error) {
+	var (
+		times cpuTimes
+		found bool
+		count int
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			count++
+			continue
+		}
+		if len(fields) < 5 {
+			return cpuTimes{}, 0, fmt.Errorf("malformed cpu line in /proc/stat")
+		}
+
+		// user nice system idle iowait irq softirq steal; guest time is already in user
+		for i, field := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return cpuTimes{}, 0, fmt.Errorf("malformed cpu line in /proc/stat: %v", err)
+			}
+			times.total += value
+			if i == 3 || i == 4 { // idle and iowait
+				times.idle += value
+			}
+		}
+		found = true
+	}
+
+	if !found {
+		return cpuTimes{}, 0, fmt.Errorf("no cpu line in /proc/stat")
+	}
+	return times, count, nil
+}
+
+// cpuPercent returns the busy share between two samples, or since boot without a previous sample
+func cpuPercent(prev *cpuTimes, cur cpuTimes) float64 {
+	idle, total := cur.idle, cur.total
+	if prev != nil && cur.total >= prev.total && cur.idle >= prev.idle {
+		idle, total = cur.idle-prev.idle, cur.total-prev.total
+	}
+	if total == 0 {
+		return 0
+	}
+	return percent(total-idle, total)
+}
+
+// parseLoadAvg returns the 1, 5 and 15 minute load averages from /proc/loadavg
+func parseLoadAvg(data []byte) (float64, float64, float64, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return 0, 0, 0, fmt.Errorf("malformed /proc/loadavg")
+	}
+
+	var loads [3]float64
+	for i := range loads {
+		value, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("malformed /proc/loadavg: %v", err)
+		}
+		loads[i] = value
+	}
+	return loads[0], loads[1], loads[2], nil
+}
+
+// parseMemInfo returns total and available memory in bytes from /proc/meminfo
+func parseMemInfo(data []byte) (uint64, uint64, error) {
+	values := make(map[string]uint64)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			value *= 1024
+		}
+		values[key] = value
+	}
+
+	total, ok := values["MemTotal"]
+	if !ok {
+		return 0, 0, fmt.Errorf("no MemTotal in /proc/meminfo")
+	}
+	available, ok := values["MemAvailable"]
+	if !ok {
+		// Kernels before 3.14 have no MemAvailable
+		available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	return total, available, nil
+}
+
+// parseNetDev returns the byte counters per interface from /proc/net/dev, without loopback
+func parseNetDev(data []byte) (map[string]netCounters, error) {
+	counters := make(map[string]netCounters)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue // header lines
+		}
+		name = strings.TrimSpace(name)
+		if name == "lo" {
+			continue
+		}
+
+		// Receive: bytes packets errs drop fifo frame compressed multicast, then transmit bytes
+		fields := strings.Fields(rest)
+		if len(fields) < 9 {
+			return nil, fmt.Errorf("malformed /proc/net/dev line for %s", name)
+		}
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed /proc/net/dev line for %s: %v", name, err)
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed /proc/net/dev line for %s: %v", name, err)
+		}
+		counters[name] = netCounters{rx: rx, tx: tx}
+	}
+
+	return counters, nil
+}
+
+// throughput converts two interface samples into rates, sorted by interface name.
+// Interfaces without a previous sample, or whose counters were reset, report zero rates.
+func throughput(prev, cur map[string]netCounters, elapsed time.Duration) []shared.InterfaceThroughput {
+	names := make([]string, 0, len(cur))
+	for name := range cur {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	interfaces := make([]shared.InterfaceThroughput, 0, len(names))
+	for _, name := range names {
+		counters := cur[name]
+		iface := shared.InterfaceThroughput{Name: name, RxBytes: counters.rx, TxBytes: counters.tx}
+
+		if before, ok := prev[name]; ok && elapsed > 0 && counters.rx >= before.rx && counters.tx >= before.tx {
+			seconds := elapsed.Seconds()
+			iface.RxBytesPerSec = float64(counters.rx-before.rx) / seconds
+			iface.TxBytesPerSec = float64(counters.tx-before.tx) / seconds
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces
+}
+
+// percent returns part/total as a percentage rounded to one decimal
+func percent(part, total uint64) float64 {
+	return math.Round(float64(part)/float64(total)*1000) / 10
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testStat = `cpu  100 0 100 700 100 0 0 0 0 0
+cpu0 50 0 50 350 50 0 0 0 0 0
+cpu1 50 0 50 350 50 0 0 0 0 0
+intr 12345
+`
+
+const testMemInfo = `MemTotal:        2048000 kB
+MemFree:          512000 kB
+MemAvailable:    1024000 kB
+Buffers:           10000 kB
+`
+
+const testNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    5000      50    0    0    0     0          0         0     5000      50    0    0    0     0       0          0
+  eth0: 1000000    1000    0    0    0     0          0         0  2000000    2000    0    0    0     0       0          0
+  tun0:   30000     300    0    0    0     0          0         0    40000     400    0    0    0     0       0          0
+`
+
+// TestParsers verifies the /proc parsers on sample files
+func TestParsers(t *testing.T) {
+	cpu, count, err := parseCPUStat([]byte(testStat))
+	if err != nil {
+		t.Fatalf("parseCPUStat failed: %v", err)
+	}
+	if count != 2 || cpu.total != 1000 || cpu.idle != 800 {
+		t.Errorf("Expected 2 CPUs with 800/1000 idle, got %d with %d/%d", count, cpu.idle, cpu.total)
+	}
+
+	load1, load5, load15, err := parseLoadAvg([]byte("0.50 0.25 0.10 1/123 4567\n"))
+	if err != nil || load1 != 0.5 || load5 != 0.25 || load15 != 0.1 {
+		t.Errorf("Expected load 0.5 0.25 0.1, got %v %v %v (%v)", load1, load5, load15, err)
+	}
+
+	total, available, err := parseMemInfo([]byte(testMemInfo))
+	if err != nil || total != 2048000*1024 || available != 1024000*1024 {
+		t.Errorf("Expected 2048000 kB total and 1024000 kB available, got %d and %d (%v)", total, available, err)
+	}
+
+	counters, err := parseNetDev([]byte(testNetDev))
+	if err != nil {
+		t.Fatalf("parseNetDev failed: %v", err)
+	}
+	if _, ok := counters["lo"]; ok {
+		t.Error("Expected loopback to be skipped")
+	}
+	if counters["eth0"].rx != 1000000 || counters["eth0"].tx != 2000000 {
+		t.Errorf("Expected eth0 1000000/2000000 bytes, got %+v", counters["eth0"])
+	}
+}
+
+// TestRates verifies CPU usage and throughput are computed between samples
+func TestRates(t *testing.T) {
+	prev := &cpuTimes{idle: 800, total: 1000}
+	if got := cpuPercent(prev, cpuTimes{idle: 850, total: 1200}); got != 75 {
+		t.Errorf("Expected 75%% CPU, got %v", got)
+	}
+	if got := cpuPercent(nil, cpuTimes{idle: 800, total: 1000}); got != 20 {
+		t.Errorf("Expected 20%% CPU since boot, got %v", got)
+	}
+
+	before := map[string]netCounters{"eth0": {rx: 1000, tx: 2000}}
+	after := map[string]netCounters{"eth0": {rx: 3000, tx: 2500}, "tun0": {rx: 10, tx: 20}}
+	interfaces := throughput(before, after, 2*time.Second)
+	if len(interfaces) != 2 || interfaces[0].Name != "eth0" {
+		t.Fatalf("Expected eth0 and tun0, got %+v", interfaces)
+	}
+	if interfaces[0].RxBytesPerSec != 1000 || interfaces[0].TxBytesPerSec != 250 {
+		t.Errorf("Expected eth0 at 1000/250 B/s, got %v/%v", interfaces[0].RxBytesPerSec, interfaces[0].TxBytesPerSec)
+	}
+	if interfaces[1].RxBytesPerSec != 0 {
+		t.Error("Expected an interface without a previous sample to report zero throughput")
+	}
+}
+
+// TestCollect verifies a full sample from a fake /proc
+func TestCollect(t *testing.T) {
+	proc := t.TempDir()
+	files := map[string]string{
+		"stat":    testStat,
+		"loadavg": "0.50 0.25 0.10 1/123 4567\n",
+		"meminfo": testMemInfo,
+		"net/dev": testNetDev,
+		"42/comm": "openvpn\n",
+		"43/comm": "sshd\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(proc, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	m, err := NewCollector(proc).Collect(proc)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if !m.OpenVPNRunning {
+		t.Error("Expected OpenVPN to be detected as running")
+	}
+	if m.MemoryPercent != 50 || m.CPUCount != 2 || len(m.Interfaces) != 2 {
+		t.Errorf("Expected 50%% memory, 2 CPUs and 2 interfaces, got %+v", m)
+	}
+	if m.DiskTotal == 0 {
+		t.Error("Expected disk usage of the temporary directory")
+	}
+}
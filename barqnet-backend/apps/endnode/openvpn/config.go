@@ -0,0 +1,60 @@
+package openvpn
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// InstallServerConfig atomically replaces server.conf and keeps the previous file as
+// server.conf.bak. It returns false without touching anything if the content is unchanged.
+// OpenVPN only reads server.conf at startup, so the caller must restart it to apply the file.
+func InstallServerConfig(path string, data []byte) (bool, error) {
+	previous, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read current server config: %v", err)
+	}
+	if err == nil && bytes.Equal(previous, data) {
+		return false, nil
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+
+	if previous != nil {
+		if err := os.WriteFile(path+".bak", previous, 0644); err != nil {
+			return false, fmt.Errorf("failed to back up server config: %v", err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary server config in %s: %v", dir, err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to write temporary server config: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to sync temporary server config: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return false, fmt.Errorf("failed to close temporary server config: %v", err)
+	}
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		return false, fmt.Errorf("failed to set server config permissions: %v", err)
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return false, fmt.Errorf("failed to move server config into place at %s: %v", path, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,34 @@
+package openvpn
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestInstallServerConfig verifies the config is only replaced when it changed and the old one is kept
+func TestInstallServerConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.conf")
+
+	changed, err := InstallServerConfig(path, []byte("port 1194\n"))
+	if err != nil || !changed {
+		t.Fatalf("Expected first install to change the config, got %v (%v)", changed, err)
+	}
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Error("Expected no backup when there was no previous config")
+	}
+
+	if changed, err := InstallServerConfig(path, []byte("port 1194\n")); err != nil || changed {
+		t.Errorf("Expected identical config to be left alone, got %v (%v)", changed, err)
+	}
+
+	if changed, err := InstallServerConfig(path, []byte("port 443\n")); err != nil || !changed {
+		t.Fatalf("Expected new config to be installed, got %v (%v)", changed, err)
+	}
+
+	current, _ := os.ReadFile(path)
+	backup, _ := os.ReadFile(path + ".bak")
+	if string(current) != "port 443\n" || string(backup) != "port 1194\n" {
+		t.Errorf("Expected new config with previous as backup, got %q and %q", current, backup)
+	}
+}
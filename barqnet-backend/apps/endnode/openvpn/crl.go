@@ -0,0 +1,52 @@
+package openvpn
+
+import (
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultCRLPath is the crl-verify path configured in scripts/openvpn-server.conf.template
+const DefaultCRLPath = "/etc/openvpn/crl.pem"
+
+// InstallCRL atomically replaces the CRL file read by OpenVPN's crl-verify.
+// The CRL is written to a temporary file in the same directory and renamed over the
+// target, so a handshake never sees a partially written file. OpenVPN re-reads the
+// file on every new TLS handshake, so no restart or signal is needed.
+func InstallCRL(path string, data []byte) error {
+	if block, _ := pem.Decode(data); block == nil || block.Type != "X509 CRL" {
+		return fmt.Errorf("refusing to install CRL: data is not a PEM encoded X509 CRL")
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, ".crl.pem.tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary CRL in %s: %v", dir, err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary CRL: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temporary CRL: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary CRL: %v", err)
+	}
+
+	// OpenVPN drops privileges after startup and must still be able to read the CRL
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		return fmt.Errorf("failed to set CRL permissions: %v", err)
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to move CRL into place at %s: %v", path, err)
+	}
+
+	return nil
+}
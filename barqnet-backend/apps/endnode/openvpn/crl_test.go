@@ -0,0 +1,47 @@
+package openvpn
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestInstallCRL verifies the CRL replaces the target atomically and garbage is rejected
+func TestInstallCRL(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "crl.pem")
+
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatalf("Failed to write existing CRL: %v", err)
+	}
+
+	crl := []byte("-----BEGIN X509 CRL-----\nMAA=\n-----END X509 CRL-----\n")
+	if err := InstallCRL(path, crl); err != nil {
+		t.Fatalf("InstallCRL failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read installed CRL: %v", err)
+	}
+	if string(data) != string(crl) {
+		t.Errorf("Expected installed CRL to match, got %q", string(data))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat CRL: %v", err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644, got %v", info.Mode().Perm())
+	}
+
+	if err := InstallCRL(path, []byte("not a crl")); err == nil {
+		t.Error("Expected non-PEM data to be rejected")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only crl.pem in directory, found %d entries", len(entries))
+	}
+}
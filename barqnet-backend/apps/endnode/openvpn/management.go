@@ -0,0 +1,325 @@
+package openvpn
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultManagementAddress is the management socket configured in
+// scripts/openvpn-server.conf.template
+const DefaultManagementAddress = "/var/run/openvpn/server.sock"
+
+// ManagementClient talks to the OpenVPN management interface over a TCP or unix socket.
+// Each call opens its own connection, so the client is safe for concurrent use.
+type ManagementClient struct {
+	network  string
+	address  string
+	password string
+	timeout  time.Duration
+}
+
+// ClientSession represents a connected client as reported by "status 2"
+type ClientSession struct {
+	CommonName     string    `json:"common_name"`
+	RealAddress    string    `json:"real_address"`
+	VirtualAddress string    `json:"virtual_address"`
+	VirtualIPv6    string    `json:"virtual_ipv6,omitempty"`
+	BytesReceived  int64     `json:"bytes_received"`
+	BytesSent      int64     `json:"bytes_sent"`
+	ConnectedSince time.Time `json:"connected_since"`
+	Username       string    `json:"username,omitempty"`
+	ClientID       int64     `json:"client_id"`
+	PeerID         int64     `json:"peer_id"`
+	Cipher         string    `json:"cipher,omitempty"`
+}
+
+// LoadStats represents the server-wide counters reported by "load-stats"
+type LoadStats struct {
+	Clients  int   `json:"clients"`
+	BytesIn  int64 `json:"bytes_in"`
+	BytesOut int64 `json:"bytes_out"`
+}
+
+// NewManagementClient creates a management client for the given address.
+// The address may be "unix:///path", "tcp://host:port", an absolute socket path or host:port.
+func NewManagementClient(address, password string) *ManagementClient {
+	network, addr := ParseManagementAddress(address)
+	return &ManagementClient{
+		network:  network,
+		address:  addr,
+		password: password,
+		timeout:  5 * time.Second,
+	}
+}
+
+// ParseManagementAddress splits a management address into a network and dial address
+func ParseManagementAddress(address string) (string, string) {
+	switch {
+	case address == "":
+		return "unix", DefaultManagementAddress
+	case strings.HasPrefix(address, "unix://"):
+		return "unix", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "tcp://"):
+		return "tcp", strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "/"):
+		return "unix", address
+	default:
+		return "tcp", address
+	}
+}
+
+// Address returns the network and address the client dials
+func (mc *ManagementClient) Address() string {
+	return mc.network + "://" + mc.address
+}
+
+// SetTimeout sets the per-command I/O timeout
+func (mc *ManagementClient) SetTimeout(timeout time.Duration) {
+	mc.timeout = timeout
+}
+
+// ListClients returns all clients currently connected to the server
+func (mc *ManagementClient) ListClients() ([]ClientSession, error) {
+	lines, err := mc.command("status 2", true)
+	if err != nil {
+		return nil, err
+	}
+	return parseStatus(lines), nil
+}
+
+// FindClients returns the sessions for a single common name
+func (mc *ManagementClient) FindClients(commonName string) ([]ClientSession, error) {
+	clients, err := mc.ListClients()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []ClientSession
+	for _, client := range clients {
+		if client.CommonName == commonName {
+			matches = append(matches, client)
+		}
+	}
+	return matches, nil
+}
+
+// KillCommonName disconnects every session using the given common name.
+// It returns the number of sessions killed; a common name with no sessions is not an error.
+func (mc *ManagementClient) KillCommonName(commonName string) (int, error) {
+	if commonName == "" || strings.ContainsAny(commonName, " \t\r\n\"'") {
+		return 0, fmt.Errorf("invalid common name %q", commonName)
+	}
+
+	lines, err := mc.command("kill "+commonName, false)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	// SUCCESS: common name 'alice' found, 2 client(s) killed
+	killed := 0
+	if idx := strings.Index(lines[0], "found, "); idx != -1 {
+		fmt.Sscanf(lines[0][idx+len("found, "):], "%d", &killed)
+	}
+	return killed, nil
+}
+
+// KillClient disconnects a single session by its management client ID
+func (mc *ManagementClient) KillClient(clientID int64) error {
+	_, err := mc.command(fmt.Sprintf("client-kill %d", clientID), false)
+	return err
+}
+
+// Restart makes OpenVPN re-read its configuration (SIGHUP). Every client is disconnected
+// and reconnects on its own; the management interface stays up.
+func (mc *ManagementClient) Restart() error {
+	_, err := mc.command("signal SIGHUP", false)
+	return err
+}
+
+// LoadStats returns the server-wide client count and byte counters
+func (mc *ManagementClient) LoadStats() (*LoadStats, error) {
+	lines, err := mc.command("load-stats", false)
+	if err != nil {
+		return nil, err
+	}
+
+	// SUCCESS: nclients=1,bytesin=5337,bytesout=5245
+	stats := &LoadStats{}
+	body := strings.TrimSpace(strings.TrimPrefix(lines[0], "SUCCESS:"))
+	for _, field := range strings.Split(body, ",") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "nclients":
+			stats.Clients, _ = strconv.Atoi(value)
+		case "bytesin":
+			stats.BytesIn, _ = strconv.ParseInt(value, 10, 64)
+		case "bytesout":
+			stats.BytesOut, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return stats, nil
+}
+
+// command sends a single command and returns its response lines.
+// Multi-line responses are terminated by "END"; single-line responses start with SUCCESS or ERROR.
+func (mc *ManagementClient) command(cmd string, multiline bool) ([]string, error) {
+	conn, err := net.DialTimeout(mc.network, mc.address, mc.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to OpenVPN management interface at %s: %v", mc.Address(), err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(mc.timeout)); err != nil {
+		return nil, fmt.Errorf("failed to set management deadline: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+
+	if mc.password != "" {
+		if err := mc.authenticate(conn, reader); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := fmt.Fprintf(conn, "%s\n", cmd); err != nil {
+		return nil, fmt.Errorf("failed to send management command: %v", err)
+	}
+
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read management response: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		// Skip real-time notifications (>INFO, >LOG, >CLIENT, ...)
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "ERROR:") {
+			return nil, fmt.Errorf("management command %q failed: %s", strings.Fields(cmd)[0], strings.TrimSpace(strings.TrimPrefix(line, "ERROR:")))
+		}
+
+		if !multiline {
+			if strings.HasPrefix(line, "SUCCESS:") {
+				return []string{line}, nil
+			}
+			continue
+		}
+
+		if line == "END" {
+			return lines, nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+// authenticate answers the management password prompt
+func (mc *ManagementClient) authenticate(conn net.Conn, reader *bufio.Reader) error {
+	prompt, err := reader.ReadString(':')
+	if err != nil {
+		return fmt.Errorf("failed to read management password prompt: %v", err)
+	}
+	if !strings.Contains(prompt, "ENTER PASSWORD") {
+		return fmt.Errorf("unexpected management greeting: %q", strings.TrimSpace(prompt))
+	}
+
+	if _, err := fmt.Fprintf(conn, "%s\n", mc.password); err != nil {
+		return fmt.Errorf("failed to send management password: %v", err)
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read management authentication result: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "SUCCESS:"):
+			return nil
+		case strings.HasPrefix(line, "ERROR:"):
+			return fmt.Errorf("management authentication failed: %s", line)
+		}
+	}
+}
+
+// parseStatus parses "status 2" output into client sessions.
+// Column positions are taken from the HEADER line so newer OpenVPN versions with extra columns still parse.
+func parseStatus(lines []string) []ClientSession {
+	columns := map[string]int{
+		"Common Name":              1,
+		"Real Address":             2,
+		"Virtual Address":          3,
+		"Virtual IPv6 Address":     4,
+		"Bytes Received":           5,
+		"Bytes Sent":               6,
+		"Connected Since (time_t)": 8,
+		"Username":                 9,
+		"Client ID":                10,
+		"Peer ID":                  11,
+		"Data Channel Cipher":      12,
+	}
+
+	field := func(fields []string, name string) string {
+		idx, ok := columns[name]
+		if !ok || idx >= len(fields) {
+			return ""
+		}
+		return fields[idx]
+	}
+
+	clients := []ClientSession{}
+	for _, line := range lines {
+		fields := strings.Split(line, ",")
+		if len(fields) < 2 {
+			continue
+		}
+
+		if fields[0] == "HEADER" && fields[1] == "CLIENT_LIST" {
+			columns = make(map[string]int)
+			for i, name := range fields[2:] {
+				columns[name] = i + 1
+			}
+			continue
+		}
+
+		if fields[0] != "CLIENT_LIST" {
+			continue
+		}
+
+		client := ClientSession{
+			CommonName:     field(fields, "Common Name"),
+			RealAddress:    field(fields, "Real Address"),
+			VirtualAddress: field(fields, "Virtual Address"),
+			VirtualIPv6:    field(fields, "Virtual IPv6 Address"),
+			Username:       field(fields, "Username"),
+			Cipher:         field(fields, "Data Channel Cipher"),
+		}
+		if client.Username == "UNDEF" {
+			client.Username = ""
+		}
+		client.BytesReceived, _ = strconv.ParseInt(field(fields, "Bytes Received"), 10, 64)
+		client.BytesSent, _ = strconv.ParseInt(field(fields, "Bytes Sent"), 10, 64)
+		client.ClientID, _ = strconv.ParseInt(field(fields, "Client ID"), 10, 64)
+		client.PeerID, _ = strconv.ParseInt(field(fields, "Peer ID"), 10, 64)
+		if since, err := strconv.ParseInt(field(fields, "Connected Since (time_t)"), 10, 64); err == nil {
+			client.ConnectedSince = time.Unix(since, 0)
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients
+}
@@ -0,0 +1,241 @@
+package openvpn
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeManagementServer emulates the OpenVPN management interface for a fixed set of clients
+type fakeManagementServer struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	clients  map[string]int
+	commands []string
+}
+
+func newFakeManagementServer(t *testing.T, network, address, password string) *fakeManagementServer {
+	t.Helper()
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("Failed to start fake management server: %v", err)
+	}
+
+	server := &fakeManagementServer{
+		listener: listener,
+		password: password,
+		clients:  map[string]int{"alice": 2, "bob": 1},
+	}
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+func (s *fakeManagementServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeManagementServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	if s.password != "" {
+		fmt.Fprint(conn, "ENTER PASSWORD:")
+		line, _ := reader.ReadString('\n')
+		if strings.TrimSpace(line) != s.password {
+			fmt.Fprint(conn, "ERROR: bad password\r\n")
+			return
+		}
+		fmt.Fprint(conn, "SUCCESS: password is correct\r\n")
+	}
+	fmt.Fprint(conn, ">INFO:OpenVPN Management Interface Version 5 -- type 'help' for more info\r\n")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd)
+		s.mu.Unlock()
+
+		switch {
+		case cmd == "status 2":
+			fmt.Fprint(conn, s.status())
+		case cmd == "load-stats":
+			fmt.Fprint(conn, "SUCCESS: nclients=3,bytesin=5337,bytesout=5245\r\n")
+		case strings.HasPrefix(cmd, "kill "):
+			name := strings.TrimPrefix(cmd, "kill ")
+			s.mu.Lock()
+			count := s.clients[name]
+			delete(s.clients, name)
+			s.mu.Unlock()
+			if count == 0 {
+				fmt.Fprintf(conn, "ERROR: common name '%s' not found\r\n", name)
+			} else {
+				fmt.Fprintf(conn, "SUCCESS: common name '%s' found, %d client(s) killed\r\n", name, count)
+			}
+		case cmd == "quit":
+			return
+		default:
+			fmt.Fprint(conn, "ERROR: unknown command, enter 'help' for more options\r\n")
+		}
+	}
+}
+
+func (s *fakeManagementServer) status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("TITLE,OpenVPN 2.6.8 x86_64-pc-linux-gnu\r\n")
+	b.WriteString("TIME,2025-01-01 00:00:00,1735689600\r\n")
+	b.WriteString("HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Virtual IPv6 Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username,Client ID,Peer ID,Data Channel Cipher\r\n")
+	id := 0
+	for _, name := range []string{"alice", "bob"} {
+		for i := 0; i < s.clients[name]; i++ {
+			fmt.Fprintf(&b, "CLIENT_LIST,%s,203.0.113.%d:51820,10.8.0.%d,,%d,%d,2025-01-01 00:00:00,1735689600,UNDEF,%d,%d,AES-256-GCM\r\n",
+				name, id+10, id+2, 1000*(id+1), 2000*(id+1), id, id)
+			id++
+		}
+	}
+	b.WriteString("HEADER,ROUTING_TABLE,Virtual Address,Common Name,Real Address,Last Ref,Last Ref (time_t)\r\n")
+	b.WriteString("GLOBAL_STATS,Max bcast/mcast queue length,0\r\n")
+	b.WriteString("END\r\n")
+	return b.String()
+}
+
+// TestParseManagementAddress verifies address parsing for unix and tcp sockets
+func TestParseManagementAddress(t *testing.T) {
+	tests := []struct {
+		input   string
+		network string
+		address string
+	}{
+		{"", "unix", DefaultManagementAddress},
+		{"/run/openvpn/server.sock", "unix", "/run/openvpn/server.sock"},
+		{"unix:///tmp/mgmt.sock", "unix", "/tmp/mgmt.sock"},
+		{"tcp://127.0.0.1:7505", "tcp", "127.0.0.1:7505"},
+		{"localhost:7505", "tcp", "localhost:7505"},
+	}
+
+	for _, tt := range tests {
+		network, address := ParseManagementAddress(tt.input)
+		if network != tt.network || address != tt.address {
+			t.Errorf("ParseManagementAddress(%q) = %s %s, expected %s %s", tt.input, network, address, tt.network, tt.address)
+		}
+	}
+}
+
+// TestListClients verifies status parsing over a TCP management socket
+func TestListClients(t *testing.T) {
+	server := newFakeManagementServer(t, "tcp", "127.0.0.1:0", "")
+	client := NewManagementClient("tcp://"+server.listener.Addr().String(), "")
+
+	sessions, err := client.ListClients()
+	if err != nil {
+		t.Fatalf("ListClients failed: %v", err)
+	}
+
+	if len(sessions) != 3 {
+		t.Fatalf("Expected 3 sessions, got %d", len(sessions))
+	}
+
+	first := sessions[0]
+	if first.CommonName != "alice" {
+		t.Errorf("Expected common name alice, got %s", first.CommonName)
+	}
+	if first.VirtualAddress != "10.8.0.2" {
+		t.Errorf("Expected virtual address 10.8.0.2, got %s", first.VirtualAddress)
+	}
+	if first.BytesReceived != 1000 || first.BytesSent != 2000 {
+		t.Errorf("Expected counters 1000/2000, got %d/%d", first.BytesReceived, first.BytesSent)
+	}
+	if first.Username != "" {
+		t.Errorf("Expected UNDEF username to be cleared, got %s", first.Username)
+	}
+	if !first.ConnectedSince.Equal(time.Unix(1735689600, 0)) {
+		t.Errorf("Unexpected connected since: %v", first.ConnectedSince)
+	}
+	if sessions[2].ClientID != 2 {
+		t.Errorf("Expected client ID 2, got %d", sessions[2].ClientID)
+	}
+}
+
+// TestKillCommonName verifies per-user disconnects over a unix management socket
+func TestKillCommonName(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "server.sock")
+	server := newFakeManagementServer(t, "unix", socketPath, "")
+	client := NewManagementClient(socketPath, "")
+
+	killed, err := client.KillCommonName("alice")
+	if err != nil {
+		t.Fatalf("KillCommonName failed: %v", err)
+	}
+	if killed != 2 {
+		t.Errorf("Expected 2 sessions killed, got %d", killed)
+	}
+
+	// A user without sessions is not an error
+	killed, err = client.KillCommonName("alice")
+	if err != nil {
+		t.Fatalf("KillCommonName for disconnected user failed: %v", err)
+	}
+	if killed != 0 {
+		t.Errorf("Expected 0 sessions killed, got %d", killed)
+	}
+
+	// Only bob should remain connected
+	sessions, err := client.ListClients()
+	if err != nil {
+		t.Fatalf("ListClients failed: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].CommonName != "bob" {
+		t.Errorf("Expected only bob to remain connected, got %+v", sessions)
+	}
+
+	if _, err := client.KillCommonName("bob\nsignal SIGTERM"); err == nil {
+		t.Error("Expected common name with newline to be rejected")
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	for _, cmd := range server.commands {
+		if strings.HasPrefix(cmd, "signal") {
+			t.Errorf("Injected command reached management interface: %s", cmd)
+		}
+	}
+}
+
+// TestLoadStats verifies byte counter parsing with password authentication
+func TestLoadStats(t *testing.T) {
+	server := newFakeManagementServer(t, "tcp", "127.0.0.1:0", "s3cret")
+
+	stats, err := NewManagementClient(server.listener.Addr().String(), "s3cret").LoadStats()
+	if err != nil {
+		t.Fatalf("LoadStats failed: %v", err)
+	}
+	if stats.Clients != 3 || stats.BytesIn != 5337 || stats.BytesOut != 5245 {
+		t.Errorf("Unexpected load stats: %+v", stats)
+	}
+
+	if _, err := NewManagementClient(server.listener.Addr().String(), "wrong").LoadStats(); err == nil {
+		t.Error("Expected authentication failure with wrong password")
+	}
+}
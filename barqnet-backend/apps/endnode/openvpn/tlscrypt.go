@@ -0,0 +1,216 @@
+package openvpn
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// PEM types of the tls-crypt-v2 keys, as written by "openvpn --genkey tls-crypt-v2-server/-client"
+const (
+	tlsCryptV2ServerKeyType = "OpenVPN tls-crypt-v2 server key"
+	tlsCryptV2ClientKeyType = "OpenVPN tls-crypt-v2 client key"
+)
+
+// Sizes of the tls-crypt-v2 format (OpenVPN doc/tls-crypt-v2.txt)
+const (
+	tlsCryptV2ServerKeyLen = 128  // struct key: 64 byte cipher key, 64 byte HMAC key
+	tlsCryptV2ClientKeyLen = 256  // struct key2: two 128 byte keys, Kc
+	tlsCryptV2TagLen       = 32   // HMAC-SHA256
+	tlsCryptV2MaxWKcLen    = 1024 // Kc wrapped with its metadata, tag and length
+	tlsCryptV2MaxMetadata  = tlsCryptV2MaxWKcLen - tlsCryptV2ClientKeyLen - tlsCryptV2TagLen - 2
+)
+
+// Metadata types OpenVPN passes to --tls-crypt-v2-verify as metadata_type
+const (
+	TLSCryptV2MetadataUser      = 0x00
+	TLSCryptV2MetadataTimestamp = 0x01
+)
+
+// TLSCryptV2ServerKey is the key an OpenVPN server unwraps its clients' tls-crypt-v2 keys with
+type TLSCryptV2ServerKey struct {
+	encrypt [32]byte // Ke, AES-256-CTR
+	auth    [32]byte // Ka, HMAC-SHA256
+}
+
+// TLSCryptV2Metadata is the user metadata wrapped into every client key this node issues,
+// so the verify hook can tell whose key is presented and when it was issued
+type TLSCryptV2Metadata struct {
+	Username string `json:"cn"`
+	IssuedAt int64  `json:"iat"` // unix seconds
+}
+
+// GenerateTLSCryptV2ServerKey creates a new PEM encoded tls-crypt-v2 server key
+func GenerateTLSCryptV2ServerKey() ([]byte, error) {
+	raw := make([]byte, tlsCryptV2ServerKeyLen)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate tls-crypt-v2 server key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: tlsCryptV2ServerKeyType, Bytes: raw}), nil
+}
+
+// EnsureTLSCryptV2ServerKey creates the server key at path unless one exists.
+// It returns true if a key was created.
+func EnsureTLSCryptV2ServerKey(path string) (bool, error) {
+	if _, err := os.Stat(path); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	key, err := GenerateTLSCryptV2ServerKey()
+	if err != nil {
+		return false, err
+	}
+	// O_EXCL so a key written concurrently is never replaced: clients wrapped with it would break
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create tls-crypt-v2 server key %s: %v", path, err)
+	}
+	if _, err := file.Write(key); err != nil {
+		file.Close()
+		os.Remove(path)
+		return false, fmt.Errorf("failed to write tls-crypt-v2 server key: %v", err)
+	}
+	return true, file.Close()
+}
+
+// ParseTLSCryptV2ServerKey parses a PEM encoded tls-crypt-v2 server key
+func ParseTLSCryptV2ServerKey(data []byte) (*TLSCryptV2ServerKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != tlsCryptV2ServerKeyType {
+		return nil, fmt.Errorf("not a PEM encoded tls-crypt-v2 server key")
+	}
+	if len(block.Bytes) != tlsCryptV2ServerKeyLen {
+		return nil, fmt.Errorf("tls-crypt-v2 server key is %d bytes, expected %d", len(block.Bytes), tlsCryptV2ServerKeyLen)
+	}
+
+	key := &TLSCryptV2ServerKey{}
+	copy(key.encrypt[:], block.Bytes[:32])
+	copy(key.auth[:], block.Bytes[64:96])
+	return key, nil
+}
+
+// LoadTLSCryptV2ServerKey reads a PEM encoded tls-crypt-v2 server key from a file
+func LoadTLSCryptV2ServerKey(path string) (*TLSCryptV2ServerKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tls-crypt-v2 server key: %v", err)
+	}
+	return ParseTLSCryptV2ServerKey(data)
+}
+
+// WrapClientKey generates a client key and wraps it with the server key and user metadata,
+// as "openvpn --tls-crypt-v2 <server key> --genkey tls-crypt-v2-client" does. It returns the
+// PEM encoded client key to embed in a profile as <tls-crypt-v2>.
+func (k *TLSCryptV2ServerKey) WrapClientKey(metadata TLSCryptV2Metadata) ([]byte, error) {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tls-crypt-v2 metadata: %v", err)
+	}
+	meta := append([]byte{TLSCryptV2MetadataUser}, data...)
+	if len(meta) > tlsCryptV2MaxMetadata {
+		return nil, fmt.Errorf("tls-crypt-v2 metadata is %d bytes, at most %d are allowed", len(meta), tlsCryptV2MaxMetadata)
+	}
+
+	clientKey := make([]byte, tlsCryptV2ClientKeyLen)
+	if _, err := rand.Read(clientKey); err != nil {
+		return nil, fmt.Errorf("failed to generate tls-crypt-v2 client key: %v", err)
+	}
+
+	// WKc = T || AES-256-CTR(Ke, IV=T, Kc || metadata) || len, T = HMAC-SHA256(Ka, len || Kc || metadata)
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(tlsCryptV2ClientKeyLen+len(meta)+tlsCryptV2TagLen+2))
+	plain := append(append([]byte{}, clientKey...), meta...)
+
+	mac := hmac.New(sha256.New, k.auth[:])
+	mac.Write(length)
+	mac.Write(plain)
+	tag := mac.Sum(nil)
+
+	ciphertext, err := k.ctr(tag, plain)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(clientKey)+len(tag)+len(ciphertext)+len(length))
+	out = append(out, clientKey...)
+	out = append(out, tag...)
+	out = append(out, ciphertext...)
+	out = append(out, length...)
+	return pem.EncodeToMemory(&pem.Block{Type: tlsCryptV2ClientKeyType, Bytes: out}), nil
+}
+
+// UnwrapClientKey authenticates a PEM encoded client key against the server key and
+// returns its metadata, including the type byte
+func (k *TLSCryptV2ServerKey) UnwrapClientKey(data []byte) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != tlsCryptV2ClientKeyType {
+		return nil, fmt.Errorf("not a PEM encoded tls-crypt-v2 client key")
+	}
+	if len(block.Bytes) < 2*tlsCryptV2ClientKeyLen+tlsCryptV2TagLen+2 {
+		return nil, fmt.Errorf("tls-crypt-v2 client key is too short")
+	}
+
+	clientKey, wkc := block.Bytes[:tlsCryptV2ClientKeyLen], block.Bytes[tlsCryptV2ClientKeyLen:]
+	length := wkc[len(wkc)-2:]
+	if int(binary.BigEndian.Uint16(length)) != len(wkc) {
+		return nil, fmt.Errorf("tls-crypt-v2 client key has an inconsistent length")
+	}
+	tag, ciphertext := wkc[:tlsCryptV2TagLen], wkc[tlsCryptV2TagLen:len(wkc)-2]
+
+	plain, err := k.ctr(tag, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, k.auth[:])
+	mac.Write(length)
+	mac.Write(plain)
+	if !hmac.Equal(mac.Sum(nil), tag) {
+		return nil, fmt.Errorf("tls-crypt-v2 client key was not wrapped with this server key")
+	}
+	if !bytes.Equal(plain[:tlsCryptV2ClientKeyLen], clientKey) {
+		return nil, fmt.Errorf("tls-crypt-v2 client key does not match its wrapped copy")
+	}
+
+	return plain[tlsCryptV2ClientKeyLen:], nil
+}
+
+// ctr runs AES-256-CTR with Ke and the first block of the tag as IV
+func (k *TLSCryptV2ServerKey) ctr(tag, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(k.encrypt[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up tls-crypt-v2 cipher: %v", err)
+	}
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, tag[:aes.BlockSize]).XORKeyStream(out, data)
+	return out, nil
+}
+
+// ParseTLSCryptV2Metadata parses the user metadata of a client key this node issued, as OpenVPN
+// hands it to --tls-crypt-v2-verify: the metadata type and the metadata without its type byte
+func ParseTLSCryptV2Metadata(metadataType int, data []byte) (*TLSCryptV2Metadata, error) {
+	if metadataType != TLSCryptV2MetadataUser {
+		return nil, fmt.Errorf("unexpected tls-crypt-v2 metadata type %d", metadataType)
+	}
+
+	var metadata TLSCryptV2Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("invalid tls-crypt-v2 metadata: %v", err)
+	}
+	if metadata.Username == "" || metadata.IssuedAt <= 0 {
+		return nil, fmt.Errorf("tls-crypt-v2 metadata lacks a username or issue time")
+	}
+	return &metadata, nil
+}
@@ -0,0 +1,85 @@
+package openvpn
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestTLSCryptV2ClientKey verifies client keys unwrap with their server key only and carry their metadata
+func TestTLSCryptV2ClientKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tls-crypt-v2-server.key")
+	created, err := EnsureTLSCryptV2ServerKey(path)
+	if err != nil || !created {
+		t.Fatalf("EnsureTLSCryptV2ServerKey failed: %v (created %v)", err, created)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat server key: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+	before, _ := os.ReadFile(path)
+	if created, err := EnsureTLSCryptV2ServerKey(path); err != nil || created {
+		t.Errorf("Expected an existing server key to be kept, got created %v (%v)", created, err)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Error("Expected the server key to be left untouched")
+	}
+
+	key, err := LoadTLSCryptV2ServerKey(path)
+	if err != nil {
+		t.Fatalf("LoadTLSCryptV2ServerKey failed: %v", err)
+	}
+	clientKey, err := key.WrapClientKey(TLSCryptV2Metadata{Username: "alice", IssuedAt: 1700000000})
+	if err != nil {
+		t.Fatalf("WrapClientKey failed: %v", err)
+	}
+	block, _ := pem.Decode(clientKey)
+	if block == nil || block.Type != "OpenVPN tls-crypt-v2 client key" {
+		t.Fatalf("Expected a PEM encoded client key, got %q", clientKey)
+	}
+
+	metadata, err := key.UnwrapClientKey(clientKey)
+	if err != nil {
+		t.Fatalf("UnwrapClientKey failed: %v", err)
+	}
+	if metadata[0] != TLSCryptV2MetadataUser {
+		t.Errorf("Expected user metadata, got type %d", metadata[0])
+	}
+	parsed, err := ParseTLSCryptV2Metadata(int(metadata[0]), metadata[1:])
+	if err != nil {
+		t.Fatalf("ParseTLSCryptV2Metadata failed: %v", err)
+	}
+	if parsed.Username != "alice" || parsed.IssuedAt != 1700000000 {
+		t.Errorf("Unexpected metadata %+v", parsed)
+	}
+
+	other, _ := GenerateTLSCryptV2ServerKey()
+	otherKey, err := ParseTLSCryptV2ServerKey(other)
+	if err != nil {
+		t.Fatalf("ParseTLSCryptV2ServerKey failed: %v", err)
+	}
+	if _, err := otherKey.UnwrapClientKey(clientKey); err == nil {
+		t.Error("Expected a client key of another server to be rejected")
+	}
+
+	block.Bytes[len(block.Bytes)-10] ^= 0xff
+	if _, err := key.UnwrapClientKey(pem.EncodeToMemory(block)); err == nil {
+		t.Error("Expected a tampered client key to be rejected")
+	}
+}
+
+// TestParseTLSCryptV2Metadata verifies metadata without a username, issue time or of another type is rejected
+func TestParseTLSCryptV2Metadata(t *testing.T) {
+	for _, data := range []string{"", "not json", `{"iat":1700000000}`, `{"cn":"alice"}`} {
+		if _, err := ParseTLSCryptV2Metadata(TLSCryptV2MetadataUser, []byte(data)); err == nil {
+			t.Errorf("Expected metadata %q to be rejected", data)
+		}
+	}
+	if _, err := ParseTLSCryptV2Metadata(TLSCryptV2MetadataTimestamp, []byte(`{"cn":"alice","iat":1700000000}`)); err == nil {
+		t.Error("Expected timestamp metadata to be rejected")
+	}
+}
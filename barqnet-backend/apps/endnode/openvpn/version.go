@@ -0,0 +1,72 @@
+package openvpn
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is an OpenVPN release
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// String formats the version as OpenVPN prints it
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether the version is major.minor or later
+func (v Version) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// "OpenVPN 2.6.12 x86_64-pc-linux-gnu ...", "OpenVPN 2.7_beta1 ..." or "OpenVPN 2.7.0 ..."
+var versionRegex = regexp.MustCompile(`OpenVPN (\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseVersion reads the release from the output of "openvpn --version"
+func ParseVersion(output string) (Version, error) {
+	match := versionRegex.FindStringSubmatch(output)
+	if match == nil {
+		return Version{}, fmt.Errorf("no OpenVPN version in %q", strings.SplitN(output, "\n", 2)[0])
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(match[1])
+	v.Minor, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		v.Patch, _ = strconv.Atoi(match[3])
+	}
+	return v, nil
+}
+
+// InstalledVersion returns the release of the openvpn binary on the PATH
+func InstalledVersion() (Version, error) {
+	// OpenVPN before 2.6 exits with status 1 after printing its version
+	output, err := exec.Command("openvpn", "--version").CombinedOutput()
+	v, parseErr := ParseVersion(string(output))
+	if parseErr != nil {
+		if err != nil {
+			return Version{}, fmt.Errorf("failed to run openvpn --version: %v", err)
+		}
+		return Version{}, parseErr
+	}
+	return v, nil
+}
+
+// CheckMultipleListeners returns an error unless the installed OpenVPN binds several
+// listeners in one server. The "local" lines a server.conf with several listeners is
+// rendered with need OpenVPN 2.7 or later; earlier releases refuse to start with them.
+func CheckMultipleListeners() error {
+	v, err := InstalledVersion()
+	if err != nil {
+		return fmt.Errorf("several listeners need OpenVPN 2.7 or later: %v", err)
+	}
+	if !v.AtLeast(2, 7) {
+		return fmt.Errorf("several listeners need OpenVPN 2.7 or later, %s is installed; declare one listener in openvpn_listeners", v)
+	}
+	return nil
+}
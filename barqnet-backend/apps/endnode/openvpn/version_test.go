@@ -0,0 +1,36 @@
+package openvpn
+
+import "testing"
+
+// TestParseVersion verifies releases, pre-releases and garbage in openvpn --version output
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		output    string
+		want      Version
+		multiple  bool
+		wantError bool
+	}{
+		{"OpenVPN 2.6.12 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL]\nlibrary versions: OpenSSL 3.0.13", Version{2, 6, 12}, false, false},
+		{"OpenVPN 2.5.1 x86_64-pc-linux-gnu [SSL (OpenSSL)]", Version{2, 5, 1}, false, false},
+		{"OpenVPN 2.7_beta1 x86_64-pc-linux-gnu [SSL (OpenSSL)]", Version{2, 7, 0}, true, false},
+		{"OpenVPN 2.7.0 x86_64-pc-linux-gnu [SSL (OpenSSL)]", Version{2, 7, 0}, true, false},
+		{"OpenVPN 3.0.1", Version{3, 0, 1}, true, false},
+		{"openvpn: command not found", Version{}, false, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.output)
+		if tt.wantError {
+			if err == nil {
+				t.Errorf("ParseVersion(%q) = %v, want an error", tt.output, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseVersion(%q) = %v, %v, want %v", tt.output, got, err, tt.want)
+			continue
+		}
+		if got.AtLeast(2, 7) != tt.multiple {
+			t.Errorf("%v.AtLeast(2, 7) = %v, want %v", got, !tt.multiple, tt.multiple)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Package outbox buffers the end-node's reports to the management server on disk while
+// management is unreachable. Reports are appended to a write-ahead file, delivered in the
+// order they were queued and acknowledged in the same file, so a restart replays exactly
+// the reports management never got.
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// DefaultMaxEntries caps the reports kept while management is unreachable; the oldest are dropped
+const DefaultMaxEntries = 10000
+
+// compactAfter is the number of acknowledged records after which the file is rewritten
+const compactAfter = 1000
+
+// Entry is one queued report: a request body for a management API path
+type Entry struct {
+	Seq      int64           `json:"seq"`
+	Kind     string          `json:"kind"` // health, user_sync, audit, certs, usage, crl
+	Path     string          `json:"path"`
+	Body     json.RawMessage `json:"body"`
+	QueuedAt time.Time       `json:"queued_at"`
+}
+
+// record is a line of the write-ahead file: an entry, or the acknowledgement of one
+type record struct {
+	Entry
+	Ack int64 `json:"ack,omitempty"`
+}
+
+// Queue is an append-only, file-backed FIFO of reports. It is safe for concurrent use.
+type Queue struct {
+	path       string
+	maxEntries int
+
+	mu      sync.Mutex
+	file    *os.File
+	pending []Entry
+	nextSeq int64
+	acked   int
+	dropped int64
+}
+
+// Open opens the queue file at path, creating it if needed, and loads the reports not yet
+// acknowledged. A torn last line, left by a crash during a write, is ignored.
+func Open(path string, maxEntries int) (*Queue, error) {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %v", err)
+	}
+
+	q := &Queue{path: path, maxEntries: maxEntries, nextSeq: 1}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	// Start from a compact file holding only what is still pending
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// load replays the queue file into the pending list
+func (q *Queue) load() error {
+	file, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open outbox: %v", err)
+	}
+	defer file.Close()
+
+	acked := make(map[int64]bool)
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		if rec.Ack > 0 {
+			acked[rec.Ack] = true
+			continue
+		}
+		if rec.Seq > 0 {
+			entries = append(entries, rec.Entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read outbox: %v", err)
+	}
+
+	for _, entry := range entries {
+		if entry.Seq >= q.nextSeq {
+			q.nextSeq = entry.Seq + 1
+		}
+		if !acked[entry.Seq] {
+			q.pending = append(q.pending, entry)
+		}
+	}
+	return nil
+}
+
+// compact rewrites the queue file with the pending entries only and reopens it for appending
+func (q *Queue) compact() error {
+	tmp := q.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create outbox: %v", err)
+	}
+	writer := bufio.NewWriter(file)
+	for _, entry := range q.pending {
+		if err := writeRecord(writer, record{Entry: entry}); err != nil {
+			file.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := writer.Flush(); err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write outbox: %v", err)
+	}
+	file.Close()
+	if err := os.Rename(tmp, q.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to move outbox into place: %v", err)
+	}
+
+	if q.file != nil {
+		q.file.Close()
+	}
+	q.file, err = os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open outbox: %v", err)
+	}
+	q.acked = 0
+	return nil
+}
+
+// append writes a record to the queue file and syncs it
+func (q *Queue) append(rec record) error {
+	writer := bufio.NewWriter(q.file)
+	if err := writeRecord(writer, rec); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write outbox: %v", err)
+	}
+	return q.file.Sync()
+}
+
+// writeRecord writes a record as one JSON line
+func writeRecord(writer *bufio.Writer, rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox record: %v", err)
+	}
+	writer.Write(data)
+	return writer.WriteByte('\n')
+}
+
+// Enqueue appends a report for path. When the queue is full the oldest report is dropped.
+func (q *Queue) Enqueue(kind, path string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s report: %v", kind, err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry := Entry{Seq: q.nextSeq, Kind: kind, Path: path, Body: body, QueuedAt: time.Now()}
+	if err := q.append(record{Entry: entry}); err != nil {
+		return err
+	}
+	q.nextSeq++
+	q.pending = append(q.pending, entry)
+
+	for len(q.pending) > q.maxEntries {
+		if err := q.ackLocked(q.pending[0].Seq); err != nil {
+			return err
+		}
+		q.dropped++
+	}
+	return nil
+}
+
+// Peek returns the oldest pending report
+func (q *Queue) Peek() (Entry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == 0 {
+		return Entry{}, false
+	}
+	return q.pending[0], true
+}
+
+// Ack removes a delivered, or undeliverable, report from the queue
+func (q *Queue) Ack(seq int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.ackLocked(seq)
+}
+
+// ackLocked acknowledges a pending report; q.mu must be held
+func (q *Queue) ackLocked(seq int64) error {
+	for i, entry := range q.pending {
+		if entry.Seq != seq {
+			continue
+		}
+		if err := q.append(record{Ack: seq}); err != nil {
+			return err
+		}
+		q.pending = append(q.pending[:i:i], q.pending[i+1:]...)
+		q.acked++
+		if q.acked >= compactAfter {
+			return q.compact()
+		}
+		return nil
+	}
+	return nil
+}
+
+// Drain delivers pending reports in order until the queue is empty or deliver fails,
+// acknowledging each one delivered. It returns the number delivered.
+func (q *Queue) Drain(deliver func(Entry) error) (int, error) {
+	delivered := 0
+	for {
+		entry, ok := q.Peek()
+		if !ok {
+			return delivered, nil
+		}
+		if err := deliver(entry); err != nil {
+			return delivered, err
+		}
+		if err := q.Ack(entry.Seq); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+}
+
+// Len returns the number of pending reports
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Stats returns the queue depth, the age of the oldest report and the reports dropped
+func (q *Queue) Stats() shared.OutboxStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := shared.OutboxStatus{Depth: len(q.pending), Dropped: q.dropped}
+	if len(q.pending) > 0 {
+		oldest := q.pending[0].QueuedAt
+		stats.OldestQueuedAt = &oldest
+	}
+	return stats
+}
+
+// Close closes the queue file
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Close()
+	q.file = nil
+	return err
+}
+
+// Backoff returns how long to wait before the next delivery attempt after failures
+// consecutive failed attempts: doubling from min, capped at max
+func Backoff(failures int, min, max time.Duration) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	delay := min
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
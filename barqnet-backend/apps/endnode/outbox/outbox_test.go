@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestQueueReplaysInOrder verifies reports survive a restart and are delivered in the order queued
+func TestQueueReplaysInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	q, err := Open(path, 0)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := q.Enqueue("health", "/api/endnodes-health/node-1", map[string]int{"n": i}); err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+	}
+
+	// The first report is delivered, then management goes away
+	delivered, err := q.Drain(func(entry Entry) error {
+		if string(entry.Body) != `{"n":1}` {
+			return fmt.Errorf("management unreachable")
+		}
+		return nil
+	})
+	if delivered != 1 || err == nil {
+		t.Fatalf("Expected one report delivered before the failure, got %d (%v)", delivered, err)
+	}
+	q.Close()
+
+	// Simulate a crash in the middle of a write
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	file.WriteString(`{"seq":9,"kind":"hea`)
+	file.Close()
+
+	q, err = Open(path, 0)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer q.Close()
+	if q.Len() != 2 {
+		t.Fatalf("Expected 2 reports pending after restart, got %d", q.Len())
+	}
+	if err := q.Enqueue("audit", "/api/endnodes-audit/node-1", map[string]int{"n": 4}); err != nil {
+		t.Fatalf("Enqueue after restart failed: %v", err)
+	}
+
+	var bodies []string
+	if _, err := q.Drain(func(entry Entry) error {
+		bodies = append(bodies, string(entry.Body))
+		return nil
+	}); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	if fmt.Sprint(bodies) != `[{"n":2} {"n":3} {"n":4}]` {
+		t.Errorf("Expected reports 2, 3 and 4 in order, got %v", bodies)
+	}
+	if stats := q.Stats(); stats.Depth != 0 || stats.OldestQueuedAt != nil {
+		t.Errorf("Expected an empty queue, got %+v", stats)
+	}
+}
+
+// TestQueueDropsOldest verifies a full queue drops its oldest reports and counts them
+func TestQueueDropsOldest(t *testing.T) {
+	q, err := Open(filepath.Join(t.TempDir(), "outbox.log"), 2)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer q.Close()
+
+	for i := 1; i <= 3; i++ {
+		q.Enqueue("health", "/api/endnodes-health/node-1", i)
+	}
+	entry, _ := q.Peek()
+	if stats := q.Stats(); stats.Depth != 2 || stats.Dropped != 1 || string(entry.Body) != "2" {
+		t.Errorf("Expected reports 2 and 3 kept and one dropped, got %+v starting with %s", stats, entry.Body)
+	}
+}
+
+// TestQueueCompacts verifies acknowledged reports are eventually removed from the file
+func TestQueueCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	q, err := Open(path, 0)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer q.Close()
+
+	for i := 0; i < compactAfter; i++ {
+		q.Enqueue("health", "/api/endnodes-health/node-1", i)
+	}
+	q.Enqueue("health", "/api/endnodes-health/node-1", "last")
+	for i := 0; i < compactAfter; i++ {
+		entry, _ := q.Peek()
+		q.Ack(entry.Seq)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read outbox: %v", err)
+	}
+	entry, _ := q.Peek()
+	if q.Len() != 1 || string(entry.Body) != `"last"` || len(data) > 200 {
+		t.Errorf("Expected only the last report left in a compacted file, got %d pending and %d bytes", q.Len(), len(data))
+	}
+}
+
+// TestBackoff verifies delays double from the minimum up to the maximum
+func TestBackoff(t *testing.T) {
+	for failures, want := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if got := Backoff(failures, time.Second, 10*time.Second); got != want {
+			t.Errorf("Backoff(%d) = %v, expected %v", failures, got, want)
+		}
+	}
+}
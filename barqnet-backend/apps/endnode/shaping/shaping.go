@@ -0,0 +1,224 @@
+// Package shaping caps the bandwidth of individual VPN clients with Linux traffic control.
+// Traffic to a client is shaped by an HTB class matched on its tunnel address on the tunnel
+// device's egress; traffic from it is policed on the device's ingress. Rules are generated
+// as "tc -batch" text, so they can be checked without touching the kernel.
+package shaping
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ingressHandle is the handle of the ingress qdisc that polices upload traffic
+const ingressHandle = "ffff:"
+
+// minPoliceBurst is the smallest burst, in bytes, allowed to a policed client
+const minPoliceBurst = 16000
+
+var devicePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,15}$`)
+
+// Limit is a rate limit in kilobits per second, 0 for line rate. Down is traffic to the
+// client (egress of the tunnel device), up is traffic from it (ingress).
+type Limit struct {
+	DownKbps int
+	UpKbps   int
+}
+
+// IsZero reports whether the limit leaves both directions at line rate
+func (l Limit) IsZero() bool {
+	return l.DownKbps <= 0 && l.UpKbps <= 0
+}
+
+// ValidateDevice checks a network device name before it is used in tc commands
+func ValidateDevice(device string) error {
+	if !devicePattern.MatchString(device) {
+		return fmt.Errorf("invalid device name %q", device)
+	}
+	return nil
+}
+
+// classID returns the HTB class minor number and filter priority of a tunnel address,
+// taken from its last two bytes. It is unique within a pool of up to a /16.
+func classID(addr netip.Addr) (uint16, error) {
+	if !addr.Unmap().Is4() {
+		return 0, fmt.Errorf("only IPv4 tunnel addresses can be shaped, got %s", addr)
+	}
+	b := addr.Unmap().As4()
+	id := uint16(b[2])<<8 | uint16(b[3])
+	if id == 0 {
+		return 0, fmt.Errorf("tunnel address %s cannot be shaped", addr)
+	}
+	return id, nil
+}
+
+// policeBurst returns the burst allowed to a policed client: 100ms worth of traffic
+func policeBurst(kbps int) int {
+	burst := kbps * 1000 / 8 / 10
+	if burst < minPoliceBurst {
+		return minPoliceBurst
+	}
+	return burst
+}
+
+// Rules returns the "tc -batch" commands that move a tunnel address from the previous limit
+// to the new one. A zero previous limit means the address is not shaped yet; a zero new
+// limit removes its shaping. The root HTB and ingress qdiscs are (re)created idempotently,
+// since OpenVPN recreates the tunnel device when it restarts.
+func Rules(device string, addr netip.Addr, previous, limit Limit) (string, error) {
+	if err := ValidateDevice(device); err != nil {
+		return "", err
+	}
+	id, err := classID(addr)
+	if err != nil {
+		return "", err
+	}
+	ip := addr.Unmap().String()
+
+	var b bytes.Buffer
+	if !limit.IsZero() {
+		fmt.Fprintf(&b, "qdisc replace dev %s root handle 1: htb\n", device)
+		fmt.Fprintf(&b, "qdisc replace dev %s handle %s ingress\n", device, ingressHandle)
+	}
+
+	// Filters are removed by priority, which is unique per address
+	if previous.DownKbps > 0 {
+		fmt.Fprintf(&b, "filter del dev %s parent 1: protocol ip prio %d\n", device, id)
+		if limit.DownKbps <= 0 {
+			fmt.Fprintf(&b, "class del dev %s classid 1:%x\n", device, id)
+		}
+	}
+	if previous.UpKbps > 0 {
+		fmt.Fprintf(&b, "filter del dev %s parent %s protocol ip prio %d\n", device, ingressHandle, id)
+	}
+
+	if limit.DownKbps > 0 {
+		fmt.Fprintf(&b, "class replace dev %s parent 1: classid 1:%x htb rate %dkbit ceil %dkbit\n",
+			device, id, limit.DownKbps, limit.DownKbps)
+		fmt.Fprintf(&b, "qdisc replace dev %s parent 1:%x fq_codel\n", device, id)
+		fmt.Fprintf(&b, "filter add dev %s parent 1: protocol ip prio %d u32 match ip dst %s/32 flowid 1:%x\n",
+			device, id, ip, id)
+	}
+	if limit.UpKbps > 0 {
+		fmt.Fprintf(&b, "filter add dev %s parent %s protocol ip prio %d u32 match ip src %s/32 police rate %dkbit burst %d drop flowid :1\n",
+			device, ingressHandle, id, ip, limit.UpKbps, policeBurst(limit.UpKbps))
+	}
+
+	return b.String(), nil
+}
+
+// ResetRules returns the "tc -batch" commands that remove all shaping from a device
+func ResetRules(device string) (string, error) {
+	if err := ValidateDevice(device); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("qdisc del dev %s root\nqdisc del dev %s handle %s ingress\n", device, device, ingressHandle), nil
+}
+
+// Applier runs generated tc commands. It is an interface so shaping can be tested
+// without root privileges or a tunnel device.
+type Applier interface {
+	Apply(batch string) error
+}
+
+// CommandApplier runs tc commands with "tc -batch"
+type CommandApplier struct{}
+
+// Apply runs a batch of tc commands, continuing past failed ones
+func (CommandApplier) Apply(batch string) error {
+	if batch == "" {
+		return nil
+	}
+	cmd := exec.Command("tc", "-force", "-batch", "-")
+	cmd.Stdin = strings.NewReader(batch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("tc failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Shaper tracks the limits applied to tunnel addresses on a device, so limits can be
+// changed and removed. It is safe for concurrent use.
+type Shaper struct {
+	mu      sync.Mutex
+	device  string
+	applier Applier
+	shaped  map[netip.Addr]Limit
+}
+
+// NewShaper creates a shaper for a tunnel device
+func NewShaper(device string, applier Applier) *Shaper {
+	return &Shaper{
+		device:  device,
+		applier: applier,
+		shaped:  make(map[netip.Addr]Limit),
+	}
+}
+
+// Device returns the tunnel device the shaper manages
+func (s *Shaper) Device() string {
+	return s.device
+}
+
+// Shape applies a limit to a tunnel address; a zero limit removes its shaping.
+// Nothing is run if the address already has the limit.
+func (s *Shaper) Shape(addr netip.Addr, limit Limit) error {
+	addr = addr.Unmap()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.shaped[addr]
+	if previous == limit {
+		return nil
+	}
+
+	batch, err := Rules(s.device, addr, previous, limit)
+	if err != nil {
+		return err
+	}
+	// tc runs past failed commands, so the new limit is tracked even if some failed,
+	// and the next change removes whatever it did set up
+	err = s.applier.Apply(batch)
+	if limit.IsZero() {
+		delete(s.shaped, addr)
+	} else {
+		s.shaped[addr] = limit
+	}
+	return err
+}
+
+// Unshape removes the shaping of a tunnel address
+func (s *Shaper) Unshape(addr netip.Addr) error {
+	return s.Shape(addr, Limit{})
+}
+
+// Reset removes all shaping from the device, including rules left by a previous run
+func (s *Shaper) Reset() error {
+	batch, err := ResetRules(s.device)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shaped = make(map[netip.Addr]Limit)
+	return s.applier.Apply(batch)
+}
+
+// Addresses returns the tunnel addresses the shaper currently limits
+func (s *Shaper) Addresses() []netip.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addrs := make([]netip.Addr, 0, len(s.shaped))
+	for addr := range s.shaped {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
@@ -0,0 +1,117 @@
+package shaping
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// fakeApplier records the batches it is asked to apply
+type fakeApplier struct {
+	batches []string
+	err     error
+}
+
+func (f *fakeApplier) Apply(batch string) error {
+	f.batches = append(f.batches, batch)
+	return f.err
+}
+
+func TestRules(t *testing.T) {
+	addr := netip.MustParseAddr("10.8.1.6")
+
+	batch, err := Rules("tun0", addr, Limit{}, Limit{DownKbps: 10000, UpKbps: 2000})
+	if err != nil {
+		t.Fatalf("Expected rules, got %v", err)
+	}
+	expected := `qdisc replace dev tun0 root handle 1: htb
+qdisc replace dev tun0 handle ffff: ingress
+class replace dev tun0 parent 1: classid 1:106 htb rate 10000kbit ceil 10000kbit
+qdisc replace dev tun0 parent 1:106 fq_codel
+filter add dev tun0 parent 1: protocol ip prio 262 u32 match ip dst 10.8.1.6/32 flowid 1:106
+filter add dev tun0 parent ffff: protocol ip prio 262 u32 match ip src 10.8.1.6/32 police rate 2000kbit burst 25000 drop flowid :1
+`
+	if batch != expected {
+		t.Errorf("Expected rules:\n%s\ngot:\n%s", expected, batch)
+	}
+
+	batch, err = Rules("tun0", addr, Limit{DownKbps: 10000, UpKbps: 2000}, Limit{UpKbps: 500})
+	if err != nil {
+		t.Fatalf("Expected rules, got %v", err)
+	}
+	for _, line := range []string{
+		"filter del dev tun0 parent 1: protocol ip prio 262",
+		"class del dev tun0 classid 1:106",
+		"filter del dev tun0 parent ffff: protocol ip prio 262",
+		"police rate 500kbit burst 16000 drop",
+	} {
+		if !strings.Contains(batch, line) {
+			t.Errorf("Expected %q when dropping the download limit, got:\n%s", line, batch)
+		}
+	}
+	if strings.Contains(batch, "class replace") {
+		t.Errorf("Expected no HTB class without a download limit, got:\n%s", batch)
+	}
+
+	batch, err = Rules("tun0", addr, Limit{DownKbps: 10000}, Limit{})
+	if err != nil {
+		t.Fatalf("Expected rules, got %v", err)
+	}
+	if batch != "filter del dev tun0 parent 1: protocol ip prio 262\nclass del dev tun0 classid 1:106\n" {
+		t.Errorf("Expected only removal rules, got:\n%s", batch)
+	}
+}
+
+func TestRulesRejectsInvalidInput(t *testing.T) {
+	limit := Limit{DownKbps: 1000}
+
+	if _, err := Rules("tun0; reboot", netip.MustParseAddr("10.8.0.6"), Limit{}, limit); err == nil {
+		t.Error("Expected error for an invalid device name")
+	}
+	if _, err := Rules("tun0", netip.MustParseAddr("fd00::6"), Limit{}, limit); err == nil {
+		t.Error("Expected error for an IPv6 tunnel address")
+	}
+	if _, err := Rules("tun0", netip.MustParseAddr("10.8.0.0"), Limit{}, limit); err == nil {
+		t.Error("Expected error for an address without class ID")
+	}
+}
+
+func TestShaper(t *testing.T) {
+	applier := &fakeApplier{}
+	shaper := NewShaper("tun0", applier)
+	addr := netip.MustParseAddr("10.8.0.6")
+
+	if err := shaper.Shape(addr, Limit{DownKbps: 5000}); err != nil {
+		t.Fatalf("Expected shaping to succeed, got %v", err)
+	}
+	if err := shaper.Shape(addr, Limit{DownKbps: 5000}); err != nil {
+		t.Fatalf("Expected shaping to succeed, got %v", err)
+	}
+	if len(applier.batches) != 1 {
+		t.Errorf("Expected an unchanged limit not to be applied again, got %d batches", len(applier.batches))
+	}
+
+	if err := shaper.Unshape(netip.MustParseAddr("10.8.0.7")); err != nil || len(applier.batches) != 1 {
+		t.Errorf("Expected nothing to remove for an unshaped address, got %v and %d batches", err, len(applier.batches))
+	}
+
+	if err := shaper.Unshape(addr); err != nil {
+		t.Fatalf("Expected removal to succeed, got %v", err)
+	}
+	if len(applier.batches) != 2 || !strings.Contains(applier.batches[1], "class del dev tun0 classid 1:6") {
+		t.Errorf("Expected the class to be removed, got %v", applier.batches)
+	}
+
+	applier.err = fmt.Errorf("tc failed")
+	if err := shaper.Shape(addr, Limit{UpKbps: 1000}); err == nil {
+		t.Error("Expected the applier error to be returned")
+	}
+	applier.err = nil
+	if err := shaper.Unshape(addr); err != nil {
+		t.Fatalf("Expected removal to succeed, got %v", err)
+	}
+	if last := applier.batches[len(applier.batches)-1]; !strings.Contains(last, "filter del dev tun0 parent ffff:") {
+		t.Errorf("Expected rules of a partly applied limit to be removed, got:\n%s", last)
+	}
+}
@@ -0,0 +1,307 @@
+package wireguard
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultListenPort is the WireGuard port used when the server config does not set ListenPort
+const DefaultListenPort = 51820
+
+// userComment marks the user a [Peer] section belongs to; wg-quick ignores comments
+const userComment = "# User = "
+
+// Peer represents a [Peer] section of the server configuration
+type Peer struct {
+	Name         string
+	PublicKey    Key
+	PresharedKey Key
+	AllowedIPs   []netip.Prefix
+	// Extra holds lines this package does not manage, e.g. Endpoint or PersistentKeepalive
+	Extra []string
+}
+
+// ServerConfig represents a wg-quick server configuration such as /etc/wireguard/wg0.conf.
+// The [Interface] section is kept verbatim so PostUp/PostDown rules survive a rewrite.
+type ServerConfig struct {
+	Interface []string
+	Peers     []Peer
+}
+
+// ClientConfig represents a client configuration file handed out to a user
+type ClientConfig struct {
+	Name                string
+	PrivateKey          Key
+	Address             []netip.Prefix
+	DNS                 []string
+	ServerPublicKey     Key
+	PresharedKey        Key
+	Endpoint            string
+	AllowedIPs          []string
+	PersistentKeepalive int
+}
+
+// ParseServerConfig parses a wg-quick server configuration
+func ParseServerConfig(data []byte) (*ServerConfig, error) {
+	config := &ServerConfig{}
+	var peer *Peer
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+
+		if strings.EqualFold(trimmed, "[Peer]") {
+			config.Peers = append(config.Peers, Peer{})
+			peer = &config.Peers[len(config.Peers)-1]
+			continue
+		}
+
+		if peer == nil {
+			config.Interface = append(config.Interface, line)
+			continue
+		}
+
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			return nil, fmt.Errorf("line %d: unexpected section %s after [Peer]", lineNum, trimmed)
+		}
+		if strings.HasPrefix(trimmed, userComment) {
+			peer.Name = strings.TrimSpace(strings.TrimPrefix(trimmed, userComment))
+			continue
+		}
+
+		key, value, ok := splitKeyValue(trimmed)
+		if !ok {
+			peer.Extra = append(peer.Extra, trimmed)
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "publickey":
+			k, err := ParseKey(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid PublicKey: %v", lineNum, err)
+			}
+			peer.PublicKey = k
+		case "presharedkey":
+			k, err := ParseKey(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid PresharedKey: %v", lineNum, err)
+			}
+			peer.PresharedKey = k
+		case "allowedips":
+			prefixes, err := parsePrefixList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid AllowedIPs: %v", lineNum, err)
+			}
+			peer.AllowedIPs = append(peer.AllowedIPs, prefixes...)
+		default:
+			peer.Extra = append(peer.Extra, trimmed)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	// Drop trailing blank lines so Render does not grow the file on every rewrite
+	for len(config.Interface) > 0 && strings.TrimSpace(config.Interface[len(config.Interface)-1]) == "" {
+		config.Interface = config.Interface[:len(config.Interface)-1]
+	}
+
+	for i, p := range config.Peers {
+		if p.PublicKey.IsZero() {
+			return nil, fmt.Errorf("peer %d has no PublicKey", i+1)
+		}
+	}
+
+	return config, nil
+}
+
+// Render returns the configuration in wg-quick format
+func (c *ServerConfig) Render() []byte {
+	var buf bytes.Buffer
+
+	for _, line := range c.Interface {
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+
+	for _, peer := range c.Peers {
+		buf.WriteString("\n[Peer]\n")
+		if peer.Name != "" {
+			buf.WriteString(userComment + peer.Name + "\n")
+		}
+		fmt.Fprintf(&buf, "PublicKey = %s\n", peer.PublicKey)
+		if !peer.PresharedKey.IsZero() {
+			fmt.Fprintf(&buf, "PresharedKey = %s\n", peer.PresharedKey)
+		}
+		if len(peer.AllowedIPs) > 0 {
+			fmt.Fprintf(&buf, "AllowedIPs = %s\n", joinPrefixes(peer.AllowedIPs))
+		}
+		for _, line := range peer.Extra {
+			buf.WriteString(line)
+			buf.WriteString("\n")
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// PrivateKey returns the server's private key from the [Interface] section
+func (c *ServerConfig) PrivateKey() (Key, error) {
+	value := c.interfaceValue("PrivateKey")
+	if value == "" {
+		return Key{}, fmt.Errorf("server config has no PrivateKey")
+	}
+	return ParseKey(value)
+}
+
+// ListenPort returns the server's listen port, or DefaultListenPort when unset
+func (c *ServerConfig) ListenPort() int {
+	port, err := strconv.Atoi(c.interfaceValue("ListenPort"))
+	if err != nil || port < 1 || port > 65535 {
+		return DefaultListenPort
+	}
+	return port
+}
+
+// Addresses returns the server's tunnel addresses, which also define the peer subnets
+func (c *ServerConfig) Addresses() ([]netip.Prefix, error) {
+	value := c.interfaceValue("Address")
+	if value == "" {
+		return nil, fmt.Errorf("server config has no Address")
+	}
+	return parsePrefixList(value)
+}
+
+// FindPeer returns the index of the named peer, or -1 if it does not exist
+func (c *ServerConfig) FindPeer(name string) int {
+	for i, peer := range c.Peers {
+		if peer.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// interfaceValue returns the value of a key in the [Interface] section
+func (c *ServerConfig) interfaceValue(name string) string {
+	for _, line := range c.Interface {
+		key, value, ok := splitKeyValue(strings.TrimSpace(line))
+		if ok && strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// AllocateAddress returns the first free host address in subnet.
+// The network address, the IPv4 broadcast address and addresses in used are skipped.
+func AllocateAddress(subnet netip.Prefix, used map[netip.Addr]bool) (netip.Addr, error) {
+	subnet = subnet.Masked()
+
+	var broadcast netip.Addr
+	if subnet.Addr().Is4() {
+		ip := subnet.Addr().As4()
+		hostMask := uint32(uint64(1)<<(32-subnet.Bits()) - 1)
+		binary.BigEndian.PutUint32(ip[:], binary.BigEndian.Uint32(ip[:])|hostMask)
+		broadcast = netip.AddrFrom4(ip)
+	}
+
+	for addr := subnet.Addr().Next(); addr.IsValid() && subnet.Contains(addr); addr = addr.Next() {
+		if addr == broadcast {
+			break
+		}
+		if !used[addr] {
+			return addr, nil
+		}
+	}
+
+	return netip.Addr{}, fmt.Errorf("no free addresses left in %s", subnet)
+}
+
+// Render returns the client configuration in wg-quick format
+func (c *ClientConfig) Render() []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "# BarqNet VPN Configuration (WireGuard)\n")
+	fmt.Fprintf(&buf, "# Generated for user: %s\n", c.Name)
+	fmt.Fprintf(&buf, "# Generated: %s\n\n", time.Now().Format(time.RFC3339))
+
+	buf.WriteString("[Interface]\n")
+	fmt.Fprintf(&buf, "PrivateKey = %s\n", c.PrivateKey)
+	fmt.Fprintf(&buf, "Address = %s\n", joinPrefixes(c.Address))
+	if len(c.DNS) > 0 {
+		fmt.Fprintf(&buf, "DNS = %s\n", strings.Join(c.DNS, ", "))
+	}
+
+	buf.WriteString("\n[Peer]\n")
+	fmt.Fprintf(&buf, "PublicKey = %s\n", c.ServerPublicKey)
+	if !c.PresharedKey.IsZero() {
+		fmt.Fprintf(&buf, "PresharedKey = %s\n", c.PresharedKey)
+	}
+	fmt.Fprintf(&buf, "Endpoint = %s\n", c.Endpoint)
+	fmt.Fprintf(&buf, "AllowedIPs = %s\n", strings.Join(c.AllowedIPs, ", "))
+	if c.PersistentKeepalive > 0 {
+		fmt.Fprintf(&buf, "PersistentKeepalive = %d\n", c.PersistentKeepalive)
+	}
+
+	return buf.Bytes()
+}
+
+// splitKeyValue splits a "Key = Value" line
+func splitKeyValue(line string) (string, string, bool) {
+	if strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return "", "", false
+	}
+	return strings.TrimSpace(key), strings.TrimSpace(value), true
+}
+
+// parsePrefixList parses a comma separated list of CIDR prefixes or bare addresses
+func parsePrefixList(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// joinPrefixes formats prefixes as a comma separated list
+func joinPrefixes(prefixes []netip.Prefix) string {
+	parts := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		parts[i] = prefix.String()
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,138 @@
+package wireguard
+
+import (
+	"encoding/hex"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// TestPublicKey verifies key derivation against the RFC 7748 test vector
+func TestPublicKey(t *testing.T) {
+	private, _ := hex.DecodeString("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	expected := "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a"
+
+	var key Key
+	copy(key[:], private)
+	public := key.PublicKey()
+	if hex.EncodeToString(public[:]) != expected {
+		t.Errorf("Expected public key %s, got %x", expected, public[:])
+	}
+
+	parsed, err := ParseKey(public.String())
+	if err != nil {
+		t.Fatalf("ParseKey failed: %v", err)
+	}
+	if parsed != public {
+		t.Error("Expected base64 round trip to return the same key")
+	}
+
+	if _, err := ParseKey("dG9vIHNob3J0"); err == nil {
+		t.Error("Expected short key to be rejected")
+	}
+
+	generated, err := GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("GeneratePrivateKey failed: %v", err)
+	}
+	if generated[0]&7 != 0 || generated[31]&128 != 0 || generated[31]&64 == 0 {
+		t.Errorf("Expected generated key to be clamped, got %x", generated[:])
+	}
+}
+
+// TestServerConfigRoundTrip verifies unmanaged lines survive a parse and render
+func TestServerConfigRoundTrip(t *testing.T) {
+	serverKey, _ := GeneratePrivateKey()
+	peerKey, _ := GeneratePrivateKey()
+
+	data := "[Interface]\n" +
+		"PrivateKey = " + serverKey.String() + "\n" +
+		"Address = 10.9.0.1/24, fd00:9::1/64\n" +
+		"ListenPort = 51821\n" +
+		"PostUp = iptables -A FORWARD -i %i -j ACCEPT\n" +
+		"\n" +
+		"[Peer]\n" +
+		"# User = alice\n" +
+		"PublicKey = " + peerKey.PublicKey().String() + "\n" +
+		"AllowedIPs = 10.9.0.2/32\n" +
+		"AllowedIPs = fd00:9::2/128\n" +
+		"PersistentKeepalive = 25\n"
+
+	config, err := ParseServerConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseServerConfig failed: %v", err)
+	}
+
+	if key, err := config.PrivateKey(); err != nil || key != serverKey {
+		t.Errorf("Expected server private key to parse, got error %v", err)
+	}
+	if config.ListenPort() != 51821 {
+		t.Errorf("Expected listen port 51821, got %d", config.ListenPort())
+	}
+	addresses, err := config.Addresses()
+	if err != nil || len(addresses) != 2 {
+		t.Fatalf("Expected 2 addresses, got %v (%v)", addresses, err)
+	}
+
+	if len(config.Peers) != 1 {
+		t.Fatalf("Expected 1 peer, got %d", len(config.Peers))
+	}
+	peer := config.Peers[0]
+	if peer.Name != "alice" || len(peer.AllowedIPs) != 2 || len(peer.Extra) != 1 {
+		t.Errorf("Unexpected peer: %+v", peer)
+	}
+	if config.FindPeer("alice") != 0 || config.FindPeer("bob") != -1 {
+		t.Error("FindPeer returned unexpected index")
+	}
+
+	rendered := string(config.Render())
+	for _, want := range []string{
+		"PostUp = iptables -A FORWARD -i %i -j ACCEPT\n",
+		"# User = alice\n",
+		"AllowedIPs = 10.9.0.2/32, fd00:9::2/128\n",
+		"PersistentKeepalive = 25\n",
+	} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("Expected rendered config to contain %q", want)
+		}
+	}
+
+	reparsed, err := ParseServerConfig([]byte(rendered))
+	if err != nil {
+		t.Fatalf("Failed to parse rendered config: %v", err)
+	}
+	if string(reparsed.Render()) != rendered {
+		t.Error("Expected rendering to be stable")
+	}
+
+	if _, err := ParseServerConfig([]byte("[Interface]\n[Peer]\nAllowedIPs = 10.9.0.2/32\n")); err == nil {
+		t.Error("Expected peer without PublicKey to be rejected")
+	}
+}
+
+// TestAllocateAddress verifies network, broadcast and used addresses are skipped
+func TestAllocateAddress(t *testing.T) {
+	subnet := netip.MustParsePrefix("10.9.0.1/30")
+
+	used := map[netip.Addr]bool{netip.MustParseAddr("10.9.0.1"): true}
+	addr, err := AllocateAddress(subnet, used)
+	if err != nil {
+		t.Fatalf("AllocateAddress failed: %v", err)
+	}
+	if addr.String() != "10.9.0.2" {
+		t.Errorf("Expected 10.9.0.2, got %s", addr)
+	}
+
+	used[addr] = true
+	if addr, err := AllocateAddress(subnet, used); err == nil {
+		t.Errorf("Expected exhausted subnet to fail, got %s", addr)
+	}
+
+	addr, err = AllocateAddress(netip.MustParsePrefix("fd00:9::1/64"), map[netip.Addr]bool{netip.MustParseAddr("fd00:9::1"): true})
+	if err != nil {
+		t.Fatalf("AllocateAddress failed: %v", err)
+	}
+	if addr.String() != "fd00:9::2" {
+		t.Errorf("Expected fd00:9::2, got %s", addr)
+	}
+}
@@ -0,0 +1,71 @@
+package wireguard
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// KeyLen is the length of WireGuard private, public and preshared keys
+const KeyLen = 32
+
+// Key is a Curve25519 private or public key, or a preshared key
+type Key [KeyLen]byte
+
+// GeneratePrivateKey generates a clamped Curve25519 private key, as "wg genkey" does
+func GeneratePrivateKey() (Key, error) {
+	key, err := GeneratePresharedKey()
+	if err != nil {
+		return Key{}, err
+	}
+
+	key[0] &= 248
+	key[31] &= 127
+	key[31] |= 64
+	return key, nil
+}
+
+// GeneratePresharedKey generates a random symmetric key, as "wg genpsk" does
+func GeneratePresharedKey() (Key, error) {
+	var key Key
+	if _, err := rand.Read(key[:]); err != nil {
+		return Key{}, fmt.Errorf("failed to generate key: %v", err)
+	}
+	return key, nil
+}
+
+// ParseKey parses a base64 encoded key as found in WireGuard configuration files
+func ParseKey(s string) (Key, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid key encoding: %v", err)
+	}
+	if len(data) != KeyLen {
+		return Key{}, fmt.Errorf("invalid key length %d, expected %d", len(data), KeyLen)
+	}
+
+	var key Key
+	copy(key[:], data)
+	return key, nil
+}
+
+// PublicKey derives the public key for a private key
+func (k Key) PublicKey() Key {
+	var public Key
+	// X25519 only fails for low-order points, which the base point is not
+	data, _ := curve25519.X25519(k[:], curve25519.Basepoint)
+	copy(public[:], data)
+	return public
+}
+
+// IsZero reports whether the key is unset
+func (k Key) IsZero() bool {
+	return k == Key{}
+}
+
+// String returns the base64 encoding of the key
+func (k Key) String() string {
+	return base64.StdEncoding.EncodeToString(k[:])
+}
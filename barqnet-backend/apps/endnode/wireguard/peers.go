@@ -0,0 +1,273 @@
+package wireguard
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Default locations of the WireGuard server interface
+const (
+	DefaultInterface  = "wg0"
+	DefaultConfigPath = "/etc/wireguard/wg0.conf"
+)
+
+// Applier applies peer changes to a running WireGuard interface.
+// It is an interface so configuration handling can be tested without the kernel module.
+type Applier interface {
+	AddPeer(iface string, peer Peer) error
+	RemovePeer(iface string, publicKey Key) error
+}
+
+// CommandApplier applies peer changes with the "wg" command line tool
+type CommandApplier struct{}
+
+// AddPeer adds or updates a peer on the interface with "wg set"
+func (CommandApplier) AddPeer(iface string, peer Peer) error {
+	args := []string{"set", iface, "peer", peer.PublicKey.String()}
+	if !peer.PresharedKey.IsZero() {
+		// The preshared key is read from stdin so it never appears in the process list
+		args = append(args, "preshared-key", "/dev/stdin")
+	}
+	args = append(args, "allowed-ips", strings.ReplaceAll(joinPrefixes(peer.AllowedIPs), " ", ""))
+
+	cmd := exec.Command("wg", args...)
+	if !peer.PresharedKey.IsZero() {
+		cmd.Stdin = strings.NewReader(peer.PresharedKey.String() + "\n")
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("wg set failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// RemovePeer removes a peer from the interface with "wg set ... remove"
+func (CommandApplier) RemovePeer(iface string, publicKey Key) error {
+	output, err := exec.Command("wg", "set", iface, "peer", publicKey.String(), "remove").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("wg set remove failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// ManagerConfig configures a peer Manager
+type ManagerConfig struct {
+	Interface  string
+	ConfigPath string
+	// DNS servers pushed to clients
+	DNS []string
+	// AllowedIPs routed through the tunnel by clients; defaults to all traffic
+	AllowedIPs []string
+	// PersistentKeepalive in seconds for clients behind NAT; 0 disables it
+	PersistentKeepalive int
+}
+
+// Manager provisions WireGuard peers by editing the server configuration file and
+// applying the change to the running interface. It is safe for concurrent use.
+type Manager struct {
+	mu      sync.Mutex
+	config  ManagerConfig
+	applier Applier
+}
+
+// NewManager creates a peer manager
+func NewManager(config ManagerConfig, applier Applier) *Manager {
+	if config.Interface == "" {
+		config.Interface = DefaultInterface
+	}
+	if config.ConfigPath == "" {
+		config.ConfigPath = DefaultConfigPath
+	}
+	if len(config.AllowedIPs) == 0 {
+		config.AllowedIPs = []string{"0.0.0.0/0", "::/0"}
+	}
+	return &Manager{config: config, applier: applier}
+}
+
+// AddPeer creates a peer for name and returns the client configuration.
+// endpointHost is the public address clients connect to; the port comes from the server config.
+func (m *Manager) AddPeer(name, endpointHost string) (*ClientConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if name == "" || strings.ContainsAny(name, "\r\n") {
+		return nil, fmt.Errorf("invalid peer name %q", name)
+	}
+	if endpointHost == "" {
+		return nil, fmt.Errorf("endpoint host is required")
+	}
+
+	original, server, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	if server.FindPeer(name) != -1 {
+		return nil, fmt.Errorf("peer %s already exists", name)
+	}
+
+	serverKey, err := server.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	subnets, err := server.Addresses()
+	if err != nil {
+		return nil, err
+	}
+
+	// Every address in use by the server or another peer is taken
+	used := make(map[netip.Addr]bool)
+	for _, prefix := range subnets {
+		used[prefix.Addr()] = true
+	}
+	for _, peer := range server.Peers {
+		for _, prefix := range peer.AllowedIPs {
+			used[prefix.Addr()] = true
+		}
+	}
+
+	var addresses []netip.Prefix
+	for _, subnet := range subnets {
+		addr, err := AllocateAddress(subnet, used)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	privateKey, err := GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	presharedKey, err := GeneratePresharedKey()
+	if err != nil {
+		return nil, err
+	}
+
+	peer := Peer{
+		Name:         name,
+		PublicKey:    privateKey.PublicKey(),
+		PresharedKey: presharedKey,
+		AllowedIPs:   addresses,
+	}
+	server.Peers = append(server.Peers, peer)
+
+	if err := m.save(server.Render()); err != nil {
+		return nil, err
+	}
+	if err := m.applier.AddPeer(m.config.Interface, peer); err != nil {
+		// Keep the file consistent with the running interface
+		if restoreErr := m.save(original); restoreErr != nil {
+			return nil, fmt.Errorf("failed to apply peer: %v (restoring config also failed: %v)", err, restoreErr)
+		}
+		return nil, fmt.Errorf("failed to apply peer: %v", err)
+	}
+
+	host := endpointHost
+	if addr, err := netip.ParseAddr(endpointHost); err == nil && addr.Is6() {
+		host = "[" + endpointHost + "]"
+	}
+
+	return &ClientConfig{
+		Name:                name,
+		PrivateKey:          privateKey,
+		Address:             addresses,
+		DNS:                 m.config.DNS,
+		ServerPublicKey:     serverKey.PublicKey(),
+		PresharedKey:        presharedKey,
+		Endpoint:            fmt.Sprintf("%s:%d", host, server.ListenPort()),
+		AllowedIPs:          m.config.AllowedIPs,
+		PersistentKeepalive: m.config.PersistentKeepalive,
+	}, nil
+}
+
+// RemovePeer removes the named peer from the configuration file and the running interface.
+// It returns false if the peer does not exist.
+func (m *Manager) RemovePeer(name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Nodes without WireGuard have no peers to remove
+	if _, err := os.Stat(m.config.ConfigPath); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	_, server, err := m.load()
+	if err != nil {
+		return false, err
+	}
+
+	index := server.FindPeer(name)
+	if index == -1 {
+		return false, nil
+	}
+	peer := server.Peers[index]
+	server.Peers = append(server.Peers[:index], server.Peers[index+1:]...)
+
+	if err := m.save(server.Render()); err != nil {
+		return false, err
+	}
+	if err := m.applier.RemovePeer(m.config.Interface, peer.PublicKey); err != nil {
+		return true, fmt.Errorf("peer removed from config but not from interface: %v", err)
+	}
+
+	return true, nil
+}
+
+// Peers returns the peers in the server configuration
+func (m *Manager) Peers() ([]Peer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, server, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	return server.Peers, nil
+}
+
+// load reads and parses the server configuration
+func (m *Manager) load() ([]byte, *ServerConfig, error) {
+	data, err := os.ReadFile(m.config.ConfigPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read WireGuard config %s: %v", m.config.ConfigPath, err)
+	}
+
+	server, err := ParseServerConfig(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse WireGuard config %s: %v", m.config.ConfigPath, err)
+	}
+	return data, server, nil
+}
+
+// save atomically replaces the server configuration; it holds the server's private key
+func (m *Manager) save(data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(m.config.ConfigPath), ".wg-*.conf")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary config: %v", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary config: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temporary config: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary config: %v", err)
+	}
+	if err := os.Chmod(tmpPath, 0600); err != nil {
+		return fmt.Errorf("failed to set config permissions: %v", err)
+	}
+	if err := os.Rename(tmpPath, m.config.ConfigPath); err != nil {
+		return fmt.Errorf("failed to install WireGuard config: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package wireguard
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeApplier records peer changes instead of calling "wg"
+type fakeApplier struct {
+	peers map[Key]Peer
+	err   error
+}
+
+func (f *fakeApplier) AddPeer(iface string, peer Peer) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.peers[peer.PublicKey] = peer
+	return nil
+}
+
+func (f *fakeApplier) RemovePeer(iface string, publicKey Key) error {
+	if f.err != nil {
+		return f.err
+	}
+	delete(f.peers, publicKey)
+	return nil
+}
+
+func newTestManager(t *testing.T) (*Manager, *fakeApplier, string, Key) {
+	t.Helper()
+
+	serverKey, err := GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("GeneratePrivateKey failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "wg0.conf")
+	data := "[Interface]\nPrivateKey = " + serverKey.String() + "\nAddress = 10.9.0.1/24\nListenPort = 51820\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	applier := &fakeApplier{peers: make(map[Key]Peer)}
+	manager := NewManager(ManagerConfig{ConfigPath: path, DNS: []string{"1.1.1.1"}, PersistentKeepalive: 25}, applier)
+	return manager, applier, path, serverKey
+}
+
+// TestManagerAddRemovePeer verifies peers are written to the config and applied to the interface
+func TestManagerAddRemovePeer(t *testing.T) {
+	manager, applier, path, serverKey := newTestManager(t)
+
+	alice, err := manager.AddPeer("alice", "203.0.113.10")
+	if err != nil {
+		t.Fatalf("AddPeer failed: %v", err)
+	}
+	bob, err := manager.AddPeer("bob", "2001:db8::10")
+	if err != nil {
+		t.Fatalf("AddPeer failed: %v", err)
+	}
+
+	if alice.Address[0].String() != "10.9.0.2/32" || bob.Address[0].String() != "10.9.0.3/32" {
+		t.Errorf("Expected sequential addresses, got %s and %s", alice.Address[0], bob.Address[0])
+	}
+	if alice.ServerPublicKey != serverKey.PublicKey() {
+		t.Error("Expected client config to carry the server public key")
+	}
+	if alice.Endpoint != "203.0.113.10:51820" || bob.Endpoint != "[2001:db8::10]:51820" {
+		t.Errorf("Unexpected endpoints %s and %s", alice.Endpoint, bob.Endpoint)
+	}
+	if _, ok := applier.peers[alice.PrivateKey.PublicKey()]; !ok {
+		t.Error("Expected alice to be applied to the interface")
+	}
+
+	client := string(alice.Render())
+	for _, want := range []string{
+		"PrivateKey = " + alice.PrivateKey.String(),
+		"Address = 10.9.0.2/32",
+		"DNS = 1.1.1.1",
+		"PresharedKey = " + alice.PresharedKey.String(),
+		"AllowedIPs = 0.0.0.0/0, ::/0",
+		"PersistentKeepalive = 25",
+	} {
+		if !strings.Contains(client, want) {
+			t.Errorf("Expected client config to contain %q", want)
+		}
+	}
+
+	if _, err := manager.AddPeer("alice", "203.0.113.10"); err == nil {
+		t.Error("Expected duplicate peer to be rejected")
+	}
+
+	removed, err := manager.RemovePeer("alice")
+	if err != nil || !removed {
+		t.Fatalf("Expected alice to be removed, got %v (%v)", removed, err)
+	}
+	if _, ok := applier.peers[alice.PrivateKey.PublicKey()]; ok {
+		t.Error("Expected alice to be removed from the interface")
+	}
+	if removed, _ := manager.RemovePeer("alice"); removed {
+		t.Error("Expected removing a missing peer to report false")
+	}
+
+	// The freed address is reused
+	carol, err := manager.AddPeer("carol", "203.0.113.10")
+	if err != nil {
+		t.Fatalf("AddPeer failed: %v", err)
+	}
+	if carol.Address[0].String() != "10.9.0.2/32" {
+		t.Errorf("Expected freed address to be reused, got %s", carol.Address[0])
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat config: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+// TestManagerApplyFailure verifies the config file is restored when the interface rejects a peer
+func TestManagerApplyFailure(t *testing.T) {
+	manager, applier, path, _ := newTestManager(t)
+
+	before, _ := os.ReadFile(path)
+	applier.err = errors.New("no such device")
+
+	if _, err := manager.AddPeer("alice", "203.0.113.10"); err == nil {
+		t.Fatal("Expected AddPeer to fail")
+	}
+
+	after, _ := os.ReadFile(path)
+	if string(before) != string(after) {
+		t.Error("Expected config to be restored after apply failure")
+	}
+
+	peers, err := manager.Peers()
+	if err != nil {
+		t.Fatalf("Peers failed: %v", err)
+	}
+	if len(peers) != 0 {
+		t.Errorf("Expected no peers, got %d", len(peers))
+	}
+}
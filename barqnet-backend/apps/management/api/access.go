@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// handleEndNodeAccess serves the user access list end-nodes authorize connections against
+// GET /api/endnodes-access/{serverID} - 304 Not Modified when If-None-Match carries the current version
+func (api *ManagementAPI) handleEndNodeAccess(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	serverID := strings.TrimPrefix(r.URL.Path, "/api/endnodes-access/")
+	serverID = strings.TrimSuffix(serverID, "/")
+
+	if serverID == "" {
+		http.Error(w, "Server ID required", http.StatusBadRequest)
+		return
+	}
+
+	list, err := api.manager.GetAccessList()
+	if err != nil {
+		log.Printf("❌ Failed to build access list for %s: %v", serverID, err)
+		http.Error(w, "Failed to build access list", http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf("\"%s\"", list.Version)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Access list retrieved successfully",
+		Data:      list,
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -21,21 +22,26 @@ type ManagementAPI struct {
 	httpClient  *http.Client
 	rateLimiter *shared.RateLimiter
 	auditLogger *shared.AuditLogger
+
+	// Checks the credentials end-nodes present, see nodeauth.go
+	nodeCredentials nodeCredentials
 }
 
 // NewManagementAPI creates a new management API
 func NewManagementAPI(manager *manager.ManagementManager, rateLimiter *shared.RateLimiter) *ManagementAPI {
 	return &ManagementAPI{
-		manager:     manager,
-		rateLimiter: rateLimiter,
+		manager:         manager,
+		rateLimiter:     rateLimiter,
+		nodeCredentials: manager,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: manager.NodeTransport(),
 		},
 	}
 }
 
-// Start starts the API server
-func (api *ManagementAPI) Start(port int) error {
+// Start starts the API server. While end-nodes use mutual TLS they call the API on nodePort.
+func (api *ManagementAPI) Start(port, nodePort int) error {
 	mux := http.NewServeMux()
 
 	// Initialize authentication handler
@@ -104,20 +110,82 @@ func (api *ManagementAPI) Start(port int) error {
 	mux.HandleFunc("/api/users", authHandler.JWTAuthMiddleware(api.handleUsers))
 	mux.HandleFunc("/api/users/", authHandler.JWTAuthMiddleware(api.handleUserByID))
 	mux.HandleFunc("/api/endnodes", authHandler.JWTAuthMiddleware(api.handleEndNodes))
-	mux.HandleFunc("/api/endnodes/", authHandler.JWTAuthMiddleware(api.handleEndNodeOperations))
+	endNodeOperations := authHandler.JWTAuthMiddleware(api.handleEndNodeOperations)
+	mux.HandleFunc("/api/endnodes/", func(w http.ResponseWriter, r *http.Request) {
+		// End-nodes deregister themselves with their credential rather than a JWT
+		if shared.AuthenticatedNode(r) != "" {
+			api.handleEndNodeOperations(w, r)
+			return
+		}
+		endNodeOperations(w, r)
+	})
+
+	// End-node enrollment: exchanges a single-use enrollment token for the end-node's credential
+	mux.HandleFunc("/api/endnodes/enroll", api.handleEndNodeEnroll)
+
+	// End-node endpoints below require the end-node's credential, checked in middleware
 
-	// End-node registration endpoints (API key auth handled in handler)
+	// End-node registration endpoints
 	mux.HandleFunc("/api/endnodes/register", api.handleEndNodeRegister)
 
-	// End-node health check endpoint (no auth required for health checks)
+	// End-node health check endpoint
 	mux.HandleFunc("/api/endnodes-health/", api.handleEndNodeHealthSubmission)
 
-	// End-node deletion endpoint (API key auth handled in handler)
+	// End-node CRL publish reports (same access as health submissions)
+	mux.HandleFunc("/api/endnodes-crl/", api.handleEndNodeCRLSubmission)
+
+	// End-node client certificate inventory reports
+	mux.HandleFunc("/api/endnodes-certs/", api.handleEndNodeCertSubmission)
+
+	// End-node audit events, replayed in order after management was unreachable
+	mux.HandleFunc("/api/endnodes-audit/", api.handleEndNodeAuditSubmission)
+
+	// End-node desired-state reconciliation (pull desired users, report drift)
+	mux.HandleFunc("/api/endnodes-desired/", api.handleEndNodeDesiredState)
+	mux.HandleFunc("/api/endnodes-drift/", api.handleEndNodeDriftSubmission)
+
+	// End-node OpenVPN server profile (rendered into server.conf and client profiles)
+	mux.HandleFunc("/api/endnodes-profile/", api.handleEndNodeServerProfile)
+
+	// End-node client-config-dir entries (static IPs and pushed routes per user)
+	mux.HandleFunc("/api/endnodes-ccd/", api.handleEndNodeClientConfigs)
+
+	// End-node user access list (checked by the client-connect hook)
+	mux.HandleFunc("/api/endnodes-access/", api.handleEndNodeAccess)
+
+	// End-node session usage counted by OpenVPN (authoritative bandwidth accounting)
+	mux.HandleFunc("/api/endnodes-usage/", api.handleEndNodeUsage)
+
+	// End-node session limit checks (called from the client-connect hook)
+	mux.HandleFunc("/api/endnodes-sessions/", api.handleEndNodeSessions)
+
+	// End-node deletion endpoint
 	mux.HandleFunc("/api/endnodes/delete/", api.handleEndNodeDelete)
 
-	// User sync endpoints (API key auth handled in handler)
+	// User sync endpoints
 	mux.HandleFunc("/api/users/sync", api.handleUserSync)
 
+	// Client certificate expiry across all end-nodes (protected)
+	mux.HandleFunc("/api/certs", authHandler.JWTAuthMiddleware(api.handleListCertificates))
+
+	// OpenVPN server profiles per end-node, location or global default (protected)
+	mux.HandleFunc("/api/server-profiles", authHandler.JWTAuthMiddleware(api.handleServerProfiles))
+	mux.HandleFunc("/api/server-profiles/", authHandler.JWTAuthMiddleware(api.handleServerProfileByID))
+
+	// Split-tunnel route profiles baked into client configs (JWT required, admin only for changes)
+	mux.HandleFunc("/api/route-profiles", authHandler.JWTAuthMiddleware(api.handleRouteProfiles))
+	mux.HandleFunc("/api/route-profiles/", authHandler.JWTAuthMiddleware(api.handleRouteProfileByID))
+
+	// Concurrent session limits per user and plan (JWT required, admin only for changes)
+	mux.HandleFunc("/api/session-limits", authHandler.JWTAuthMiddleware(api.handleSessionLimits))
+
+	// Bandwidth limits per user and plan, shaped on end-nodes (JWT required, admin only for changes)
+	mux.HandleFunc("/api/bandwidth-limits", authHandler.JWTAuthMiddleware(api.handleBandwidthLimits))
+
+	// Single-use end-node enrollment tokens (JWT required, admin only for changes)
+	mux.HandleFunc("/api/enrollment-tokens", authHandler.JWTAuthMiddleware(api.handleEnrollmentTokens))
+	mux.HandleFunc("/api/enrollment-tokens/", authHandler.JWTAuthMiddleware(api.handleEnrollmentTokenByID))
+
 	// Logs endpoints (protected)
 	mux.HandleFunc("/api/logs", authHandler.JWTAuthMiddleware(api.handleLogs))
 
@@ -136,9 +204,17 @@ func (api *ManagementAPI) Start(port int) error {
 	// VPN configuration endpoint (protected)
 	mux.HandleFunc("/v1/vpn/config", authHandler.JWTAuthMiddleware(api.handleVPNConfig))
 
+	handler := api.middleware(mux)
+	if api.manager.NodeTLS().Enabled() {
+		if err := api.startNodeServer(handler, nodePort); err != nil {
+			return fmt.Errorf("failed to start node API server: %v", err)
+		}
+		handler = api.middleware(refuseNodeEndpoints(mux, nodePort))
+	}
+
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
-		Handler:      api.middleware(mux),
+		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 	}
@@ -192,10 +268,10 @@ func (api *ManagementAPI) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := map[string]interface{}{
-		"status":     overallStatus,
-		"timestamp":  time.Now().Unix(),
-		"version":    "1.0.0",
-		"server_id":  serverID,
+		"status":    overallStatus,
+		"timestamp": time.Now().Unix(),
+		"version":   "1.0.0",
+		"server_id": serverID,
 		"checks": map[string]interface{}{
 			"database": map[string]interface{}{
 				"status":     dbStatus,
@@ -221,20 +297,29 @@ func (api *ManagementAPI) handleAPIRoot(w http.ResponseWriter, r *http.Request)
 		"version": "1.0.0",
 		"status":  "running",
 		"endpoints": map[string]string{
-			"health":           "/health",
-			"users":            "/api/users",
-			"endnodes":         "/api/endnodes",
-			"endnode_register": "/api/endnodes/register",
-			"endnode_delete":   "/api/endnodes/delete/",
-			"user_sync":        "/api/users/sync",
-			"logs":             "/api/logs",
-			"ovpn_download":    "/api/ovpn/{username}/{serverID}",
-			"vpn_status":       "/vpn/status (POST)",
-			"vpn_stats":        "/vpn/stats (POST)",
-			"vpn_user_stats":   "/vpn/stats/{username} (GET)",
-			"vpn_locations":    "/vpn/locations (GET)",
+			"health":               "/health",
+			"users":                "/api/users",
+			"endnodes":             "/api/endnodes",
+			"endnode_register":     "/api/endnodes/register",
+			"endnode_delete":       "/api/endnodes/delete/",
+			"endnode_enroll":       "/api/endnodes/enroll",
+			"user_sync":            "/api/users/sync",
+			"server_profiles":      "/api/server-profiles",
+			"user_ccd":             "/api/users/{username}/ccd",
+			"user_plan":            "/api/users/{username}/plan",
+			"user_quota":           "/api/users/{username}/quota",
+			"route_profiles":       "/api/route-profiles",
+			"session_limits":       "/api/session-limits",
+			"bandwidth_limits":     "/api/bandwidth-limits",
+			"enrollment_tokens":    "/api/enrollment-tokens",
+			"logs":                 "/api/logs",
+			"ovpn_download":        "/api/ovpn/{username}/{serverID}",
+			"vpn_status":           "/vpn/status (POST)",
+			"vpn_stats":            "/vpn/stats (POST)",
+			"vpn_user_stats":       "/vpn/stats/{username} (GET)",
+			"vpn_locations":        "/vpn/locations (GET)",
 			"vpn_location_servers": "/vpn/locations/{location_id}/servers (GET)",
-			"vpn_config":       "/vpn/config?username={username} (GET)",
+			"vpn_config":           "/vpn/config?username={username}&protocol={udp|tcp|wireguard} (GET)",
 		},
 	}
 
@@ -334,8 +419,8 @@ func (api *ManagementAPI) validateUserInput(username string, port int, protocol
 	}
 
 	// Validate protocol
-	if protocol != "udp" && protocol != "tcp" {
-		return fmt.Errorf("protocol must be 'udp' or 'tcp'")
+	if protocol != "udp" && protocol != "tcp" && protocol != shared.ProtocolWireGuard {
+		return fmt.Errorf("protocol must be 'udp', 'tcp' or 'wireguard'")
 	}
 
 	return nil
@@ -347,13 +432,13 @@ func (api *ManagementAPI) validateUsername(username string) error {
 	if len(username) < 3 || len(username) > 32 {
 		return fmt.Errorf("username must be 3-32 characters")
 	}
-	
+
 	// Character validation (alphanumeric and underscore only)
 	matched, _ := regexp.MatchString("^[a-zA-Z0-9_]+$", username)
 	if !matched {
 		return fmt.Errorf("username must contain only alphanumeric characters and underscores")
 	}
-	
+
 	// Reserved names
 	reserved := []string{"admin", "root", "system", "vpnmanager", "postgres", "nobody"}
 	for _, reserved := range reserved {
@@ -361,7 +446,7 @@ func (api *ManagementAPI) validateUsername(username string) error {
 			return fmt.Errorf("username '%s' is reserved", username)
 		}
 	}
-	
+
 	return nil
 }
 
@@ -374,6 +459,19 @@ func (api *ManagementAPI) handleUserByID(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if strings.HasSuffix(username, "/ccd") {
+		api.handleUserClientConfig(w, r, strings.TrimSuffix(username, "/ccd"))
+		return
+	}
+	if strings.HasSuffix(username, "/plan") {
+		api.handleUserPlan(w, r, strings.TrimSuffix(username, "/plan"))
+		return
+	}
+	if strings.HasSuffix(username, "/quota") {
+		api.handleUserQuota(w, r, strings.TrimSuffix(username, "/quota"))
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		api.handleGetUser(w, r, username)
@@ -465,10 +563,12 @@ func (api *ManagementAPI) handleEndNodeRegister(w http.ResponseWriter, r *http.R
 	}
 
 	var req struct {
-		ServerID string `json:"server_id"`
-		Host     string `json:"host"`
-		Port     int    `json:"port"`
-		Status   string `json:"status"`
+		ServerID        string            `json:"server_id"`
+		Host            string            `json:"host"`
+		PublicEndpoints []string          `json:"public_endpoints"`
+		Listeners       []shared.Listener `json:"listeners"`
+		Port            int               `json:"port"`
+		Status          string            `json:"status"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -476,8 +576,24 @@ func (api *ManagementAPI) handleEndNodeRegister(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	// An end-node may only register itself
+	if node := shared.AuthenticatedNode(r); req.ServerID != node {
+		api.rejectNodeRequest(w, r, "NODE_IDENTITY_MISMATCH", node, fmt.Errorf("end-node %s registered as %q", node, req.ServerID),
+			"Forbidden: End-nodes may only register themselves", http.StatusForbidden)
+		return
+	}
+
+	if err := shared.ValidateEndpoints(req.PublicEndpoints); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid public endpoints: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := shared.ValidateListeners(req.Listeners); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid listeners: %v", err), http.StatusBadRequest)
+		return
+	}
+
 	// Register the end-node in the database and sync existing users
-	if err := api.manager.RegisterEndNode(req.ServerID, req.Host, req.Status, req.Port); err != nil {
+	if err := api.manager.RegisterEndNode(req.ServerID, req.Host, req.Status, req.Port, req.PublicEndpoints, req.Listeners); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to register end-node: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -486,10 +602,12 @@ func (api *ManagementAPI) handleEndNodeRegister(w http.ResponseWriter, r *http.R
 		Success: true,
 		Message: "End-node registered successfully and existing users are being synced",
 		Data: map[string]interface{}{
-			"server_id": req.ServerID,
-			"host":      req.Host,
-			"port":      req.Port,
-			"status":    req.Status,
+			"server_id":        req.ServerID,
+			"host":             req.Host,
+			"public_endpoints": req.PublicEndpoints,
+			"listeners":        req.Listeners,
+			"port":             req.Port,
+			"status":           req.Status,
 		},
 		Timestamp: time.Now().Unix(),
 	}
@@ -527,6 +645,24 @@ func (api *ManagementAPI) handleEndNodeOperations(w http.ResponseWriter, r *http
 		return
 	}
 
+	if strings.HasSuffix(r.URL.Path, "/crl") {
+		serverID = strings.TrimSuffix(serverID, "/crl")
+		api.handleGetEndNodeCRL(w, r, serverID)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/drift") {
+		serverID = strings.TrimSuffix(serverID, "/drift")
+		api.handleGetEndNodeDrift(w, r, serverID)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/profile") {
+		serverID = strings.TrimSuffix(serverID, "/profile")
+		api.handleGetEndNodeProfile(w, r, serverID)
+		return
+	}
+
 	// Handle basic end-node operations
 	switch r.Method {
 	case "GET":
@@ -561,8 +697,54 @@ func (api *ManagementAPI) handleGetEndNode(w http.ResponseWriter, r *http.Reques
 }
 
 // handleEndNodeHealth handles end-node health updates
+// GET returns the latest report with its metrics, POST records a report sent by the end-node
 func (api *ManagementAPI) handleEndNodeHealth(w http.ResponseWriter, r *http.Request, serverID string) {
-	// Implementation for handling end-node health updates
+	if r.Method == "GET" {
+		health, err := api.manager.GetEndNodeHealth(serverID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "No health report from this end-node yet", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get health: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Health status retrieved successfully",
+			Data:      health,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var report shared.HealthReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if report.ServerID != "" && report.ServerID != serverID {
+		http.Error(w, "Server ID mismatch", http.StatusBadRequest)
+		return
+	}
+	report.ServerID = serverID
+
+	if err := api.manager.RecordEndNodeHealth(&report); err != nil {
+		log.Printf("❌ Failed to record health report from %s: %v", serverID, err)
+		http.Error(w, "Failed to record health report", http.StatusInternalServerError)
+		return
+	}
+
 	response := shared.APIResponse{
 		Success:   true,
 		Message:   "Health status updated successfully",
@@ -573,7 +755,7 @@ func (api *ManagementAPI) handleEndNodeHealth(w http.ResponseWriter, r *http.Req
 	json.NewEncoder(w).Encode(response)
 }
 
-// handleEndNodeHealthSubmission handles end-node health check submissions (no auth required)
+// handleEndNodeHealthSubmission handles end-node health check submissions
 func (api *ManagementAPI) handleEndNodeHealthSubmission(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -589,13 +771,131 @@ func (api *ManagementAPI) handleEndNodeHealthSubmission(w http.ResponseWriter, r
 		return
 	}
 
-	// Log the health check
-	log.Printf("Health check received from end-node: %s", serverID)
-
 	// Call the existing health handler logic
 	api.handleEndNodeHealth(w, r, serverID)
 }
 
+// handleEndNodeCRLSubmission handles CRL publish reports from end-nodes
+func (api *ManagementAPI) handleEndNodeCRLSubmission(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract server ID from URL path: /api/endnodes-crl/{serverID}
+	serverID := strings.TrimPrefix(r.URL.Path, "/api/endnodes-crl/")
+	serverID = strings.TrimSuffix(serverID, "/")
+
+	if serverID == "" {
+		http.Error(w, "Server ID required", http.StatusBadRequest)
+		return
+	}
+
+	var pub shared.CRLPublication
+	if err := json.NewDecoder(r.Body).Decode(&pub); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if pub.ServerID != "" && pub.ServerID != serverID {
+		http.Error(w, "Server ID mismatch", http.StatusBadRequest)
+		return
+	}
+	pub.ServerID = serverID
+	if pub.PublishedAt.IsZero() {
+		pub.PublishedAt = time.Now()
+	}
+
+	if err := api.manager.RecordCRLPublication(&pub); err != nil {
+		log.Printf("❌ Failed to record CRL publication from %s: %v", serverID, err)
+		http.Error(w, "Failed to record CRL publication", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("CRL #%d published by end-node %s (%d revoked, next update %s)",
+		pub.CRLNumber, serverID, pub.RevokedCount, pub.NextUpdate.Format(time.RFC3339))
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "CRL publication recorded successfully",
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleEndNodeAuditSubmission adds audit events of an end-node to the audit log
+func (api *ManagementAPI) handleEndNodeAuditSubmission(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract server ID from URL path: /api/endnodes-audit/{serverID}
+	serverID := strings.TrimPrefix(r.URL.Path, "/api/endnodes-audit/")
+	serverID = strings.TrimSuffix(serverID, "/")
+
+	if serverID == "" {
+		http.Error(w, "Server ID required", http.StatusBadRequest)
+		return
+	}
+
+	var event shared.EndNodeAuditEvent
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&event); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := event.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid audit event: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := api.manager.RecordEndNodeAuditEvent(serverID, &event); err != nil {
+		log.Printf("❌ Failed to record audit event from %s: %v", serverID, err)
+		http.Error(w, "Failed to record audit event", http.StatusInternalServerError)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Audit event recorded successfully",
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleGetEndNodeCRL returns the latest CRL publish reported by an end-node
+func (api *ManagementAPI) handleGetEndNodeCRL(w http.ResponseWriter, r *http.Request, serverID string) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pub, err := api.manager.GetLatestCRLPublication(serverID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No CRL publication recorded for this end-node", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get CRL publication: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "CRL publication retrieved successfully",
+		Data:      pub,
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // handleEndNodeDeregister handles end-node deregistration
 func (api *ManagementAPI) handleEndNodeDeregister(w http.ResponseWriter, r *http.Request, serverID string) {
 	if r.Method != "POST" && r.Method != "DELETE" {
@@ -844,6 +1144,7 @@ func (api *ManagementAPI) getEndNodeLogs() ([]shared.AuditLog, error) {
 }
 
 // handleDownloadOVPN handles OVPN file download requests
+// GET /api/ovpn/{username}/{serverID}?protocol={udp|tcp} - protocol picks the transport tried first
 func (api *ManagementAPI) handleDownloadOVPN(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -907,6 +1208,20 @@ func (api *ManagementAPI) handleDownloadOVPN(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Split-tunnel users get their route profile baked into the profile
+	content, _ := api.applyRouteProfile(username, string(ovpnContent))
+
+	// The requested transport, or the user's OpenVPN transport, is tried first
+	protocol := r.URL.Query().Get("protocol")
+	if protocol != "" && protocol != "udp" && protocol != "tcp" {
+		http.Error(w, "protocol must be 'udp' or 'tcp'", http.StatusBadRequest)
+		return
+	}
+	if protocol == "" && targetUser.Protocol != shared.ProtocolWireGuard {
+		protocol = targetUser.Protocol
+	}
+	ovpnContent = []byte(applyRemotes(targetEndNode, api.serverListeners(targetEndNode, protocol), content))
+
 	// Set headers for file download
 	filename := fmt.Sprintf("%s_%s.ovpn", username, serverID)
 	w.Header().Set("Content-Type", "application/x-openvpn-profile")
@@ -919,12 +1234,15 @@ func (api *ManagementAPI) handleDownloadOVPN(w http.ResponseWriter, r *http.Requ
 
 // downloadOVPNFromEndNode downloads OVPN file from a specific end-node
 func (api *ManagementAPI) downloadOVPNFromEndNode(endNode *shared.Server, username string) ([]byte, error) {
-	url := fmt.Sprintf("http://%s:%d/api/ovpn/%s", endNode.Host, endNode.Port, username)
+	url := api.manager.EndNodeURL(endNode.Host, endNode.Port, "/api/ovpn/"+username)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
+	if err := api.manager.AuthorizeEndNodeRequest(req, endNode.Name); err != nil {
+		return nil, err
+	}
 
 	resp, err := api.httpClient.Do(req)
 	if err != nil {
@@ -1025,6 +1343,12 @@ func (api *ManagementAPI) middleware(next http.Handler) http.Handler {
 			}
 		}
 
+		// SECURITY: End-node endpoints require the credential of the end-node they act for
+		r, ok := api.authenticateNodeRequest(w, r)
+		if !ok {
+			return
+		}
+
 		// Input validation and sanitization
 		if err := api.validateRequest(r); err != nil {
 			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
@@ -1052,9 +1376,9 @@ func (api *ManagementAPI) validateRequest(r *http.Request) error {
 	}
 
 	// Validate headers
-	if r.Header.Get("Content-Type") != "" && 
-	   !strings.Contains(r.Header.Get("Content-Type"), "application/json") &&
-	   !strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data") {
+	if r.Header.Get("Content-Type") != "" &&
+		!strings.Contains(r.Header.Get("Content-Type"), "application/json") &&
+		!strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data") {
 		return fmt.Errorf("invalid content type")
 	}
 
@@ -1064,9 +1388,9 @@ func (api *ManagementAPI) validateRequest(r *http.Request) error {
 // logSecurityEvent logs security-related events
 func (api *ManagementAPI) logSecurityEvent(r *http.Request) {
 	// Log request details for security monitoring
-	fmt.Printf("[SECURITY] %s %s from %s - User-Agent: %s\n", 
+	fmt.Printf("[SECURITY] %s %s from %s - User-Agent: %s\n",
 		r.Method, r.URL.Path, r.RemoteAddr, r.Header.Get("User-Agent"))
-	
+
 	// Log to audit system
 	api.logAudit("api_request", "", fmt.Sprintf("%s %s", r.Method, r.URL.Path), r.RemoteAddr)
 }
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// handleBandwidthLimits lists, saves and removes per-user and per-plan bandwidth limits
+// GET    /api/bandwidth-limits
+// PUT    /api/bandwidth-limits - body {"username": ...} or {"plan": ...} with down_kbps and up_kbps
+// DELETE /api/bandwidth-limits?username={username} or ?plan={plan}
+func (api *ManagementAPI) handleBandwidthLimits(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, err := api.validateJWTToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if !api.isAdminOrModerator(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		limits, err := api.manager.ListBandwidthLimits()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list bandwidth limits: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Bandwidth limits retrieved successfully",
+			Data:      limits,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "PUT", "POST":
+		if !api.isAdmin(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		var limit shared.BandwidthLimit
+		if err := json.NewDecoder(r.Body).Decode(&limit); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if limit.Username != "" {
+			if err := api.validateUsername(limit.Username); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid username: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := api.manager.SetBandwidthLimit(&limit, authenticatedUser); err != nil {
+			if strings.HasPrefix(err.Error(), "invalid bandwidth limit") {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("❌ Failed to save bandwidth limit: %v", err)
+			http.Error(w, "Failed to save bandwidth limit", http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Bandwidth limit saved, end-nodes apply it with their next access sync",
+			Data:      limit,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "DELETE":
+		if !api.isAdmin(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		username := r.URL.Query().Get("username")
+		plan := r.URL.Query().Get("plan")
+		if (username == "") == (plan == "") {
+			http.Error(w, "Exactly one of username or plan is required", http.StatusBadRequest)
+			return
+		}
+
+		err := api.manager.DeleteBandwidthLimit(username, plan, authenticatedUser)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Bandwidth limit not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete bandwidth limit: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Bandwidth limit removed, affected users get line rate",
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
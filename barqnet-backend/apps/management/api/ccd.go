@@ -0,0 +1,153 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// handleUserClientConfig manages a user's client-config-dir entries (static IP, pushed routes, iroutes)
+// GET    /api/users/{username}/ccd
+// PUT    /api/users/{username}/ccd - sets the entry for server_id in the body, or for all end-nodes
+// DELETE /api/users/{username}/ccd?server_id={serverID}
+func (api *ManagementAPI) handleUserClientConfig(w http.ResponseWriter, r *http.Request, username string) {
+	authenticatedUser, err := api.validateJWTToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !api.isAdmin(authenticatedUser) {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	if err := api.validateUsername(username); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid username: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		entries, err := api.manager.GetClientConfigs(username)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get client configs: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Client configs retrieved successfully",
+			Data:      entries,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "PUT", "POST":
+		var entry shared.ClientConfigEntry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if entry.Username != "" && entry.Username != username {
+			http.Error(w, "Username mismatch", http.StatusBadRequest)
+			return
+		}
+		entry.Username = username
+
+		if err := api.manager.SetClientConfig(&entry, authenticatedUser); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			if strings.HasPrefix(err.Error(), "invalid client config") {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("❌ Failed to set client config for %s: %v", username, err)
+			http.Error(w, "Failed to set client config", http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   fmt.Sprintf("Client config for %s saved, end-nodes apply it on their next sync", username),
+			Data:      entry,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "DELETE":
+		serverID := r.URL.Query().Get("server_id")
+		if err := api.manager.DeleteClientConfig(username, serverID, authenticatedUser); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Client config not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to delete client config: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   fmt.Sprintf("Client config for %s deleted", username),
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleEndNodeClientConfigs serves the client-config-dir entries an end-node should hold
+// GET /api/endnodes-ccd/{serverID} - 304 Not Modified when If-None-Match carries the current version
+func (api *ManagementAPI) handleEndNodeClientConfigs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	serverID := strings.TrimPrefix(r.URL.Path, "/api/endnodes-ccd/")
+	serverID = strings.TrimSuffix(serverID, "/")
+
+	if serverID == "" {
+		http.Error(w, "Server ID required", http.StatusBadRequest)
+		return
+	}
+
+	set, err := api.manager.GetDesiredClientConfigs(serverID)
+	if err != nil {
+		log.Printf("❌ Failed to build client configs for %s: %v", serverID, err)
+		http.Error(w, "Failed to build client configs", http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf("\"%s\"", set.Version)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Client configs retrieved successfully",
+		Data:      set,
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// handleListCertificates returns client certificates across all end-nodes
+// GET /api/certs?expiring_within=30d
+func (api *ManagementAPI) handleListCertificates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	authenticatedUser, err := api.validateJWTToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !api.isAdminOrModerator(authenticatedUser) {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	window, err := shared.ParseExpiryWindow(r.URL.Query().Get("expiring_within"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	certs, err := api.manager.ListCertificates(window)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list certificates: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Aggregate per end-node so operators can see which nodes need attention
+	type serverSummary struct {
+		Total   int `json:"total"`
+		Valid   int `json:"valid"`
+		Expired int `json:"expired"`
+		Revoked int `json:"revoked"`
+	}
+	summary := serverSummary{}
+	byServer := make(map[string]*serverSummary)
+	for _, cert := range certs {
+		server, ok := byServer[cert.ServerID]
+		if !ok {
+			server = &serverSummary{}
+			byServer[cert.ServerID] = server
+		}
+
+		for _, s := range []*serverSummary{&summary, server} {
+			s.Total++
+			switch cert.Status {
+			case shared.CertStatusValid:
+				s.Valid++
+			case shared.CertStatusExpired:
+				s.Expired++
+			case shared.CertStatusRevoked:
+				s.Revoked++
+			}
+		}
+	}
+
+	response := shared.APIResponse{
+		Success: true,
+		Message: "Certificates retrieved successfully",
+		Data: map[string]interface{}{
+			"expiring_within": r.URL.Query().Get("expiring_within"),
+			"summary":         summary,
+			"by_server":       byServer,
+			"certificates":    certs,
+		},
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleEndNodeCertSubmission handles client certificate inventory reports from end-nodes
+// POST /api/endnodes-certs/{serverID}
+func (api *ManagementAPI) handleEndNodeCertSubmission(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	serverID := strings.TrimPrefix(r.URL.Path, "/api/endnodes-certs/")
+	serverID = strings.TrimSuffix(serverID, "/")
+
+	if serverID == "" {
+		http.Error(w, "Server ID required", http.StatusBadRequest)
+		return
+	}
+
+	var report shared.CertificateReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if report.ServerID != "" && report.ServerID != serverID {
+		http.Error(w, "Server ID mismatch", http.StatusBadRequest)
+		return
+	}
+	report.ServerID = serverID
+
+	for _, cert := range report.Certificates {
+		if err := api.validateUsername(cert.Username); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid username in report: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := api.manager.RecordCertificateReport(&report); err != nil {
+		log.Printf("❌ Failed to record certificate report from %s: %v", serverID, err)
+		http.Error(w, "Failed to record certificate report", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Certificate report received from end-node %s (%d certificates, %d renewed)",
+		serverID, len(report.Certificates), len(report.Renewed))
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Certificate report recorded successfully",
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -13,7 +13,9 @@ import (
 )
 
 // handleVPNConfig handles VPN configuration requests
-// GET /vpn/config?username={username}
+// GET /vpn/config?username={username}&protocol={protocol}
+// The protocol parameter lets a device choose WireGuard or the OpenVPN transport tried first;
+// it defaults to the user's protocol.
 func (api *ManagementAPI) handleVPNConfig(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -63,13 +65,46 @@ func (api *ManagementAPI) handleVPNConfig(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get OVPN file content
-	ovpnContent, err := api.getOVPNContent(user.Username, bestServer.Name)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve OVPN configuration: %v", err), http.StatusInternalServerError)
+	protocol := r.URL.Query().Get("protocol")
+	if protocol == "" {
+		protocol = user.Protocol
+	}
+	if protocol != "udp" && protocol != "tcp" && protocol != shared.ProtocolWireGuard {
+		http.Error(w, "protocol must be 'udp', 'tcp' or 'wireguard'", http.StatusBadRequest)
 		return
 	}
 
+	var ovpnContent, wireGuardContent string
+	var routeProfile *shared.RouteProfile
+	var transports []shared.Listener
+	serverPort := bestServer.Port
+	if protocol == shared.ProtocolWireGuard {
+		// Get WireGuard client config, provisioning the peer on first use
+		wireGuardContent, err = api.getWireGuardContent(user.Username, bestServer)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to retrieve WireGuard configuration: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Split-tunnel users get their route profile baked into AllowedIPs
+		wireGuardContent, routeProfile = api.applyWireGuardRouteProfile(user.Username, wireGuardContent)
+	} else {
+		// Get OVPN file content
+		ovpnContent, err = api.getOVPNContent(user.Username, bestServer.Name)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to retrieve OVPN configuration: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Split-tunnel users get their route profile baked into the profile
+		ovpnContent, routeProfile = api.applyRouteProfile(user.Username, ovpnContent)
+
+		// Remotes on the requested transport first, the end-node's other listeners as fallbacks
+		transports = api.serverListeners(bestServer, protocol)
+		ovpnContent = applyRemotes(bestServer, transports, ovpnContent)
+		serverPort, protocol = transports[0].Port, transports[0].Protocol
+	}
+
 	// Get server recommendations
 	recommendations, err := api.getServerRecommendations(user.Username, bestServer.Name)
 	if err != nil {
@@ -82,18 +117,28 @@ func (api *ManagementAPI) handleVPNConfig(w http.ResponseWriter, r *http.Request
 	config := shared.VPNConfigResponse{
 		Username:           user.Username,
 		ServerID:           bestServer.Name,
-		ServerHost:         bestServer.Host,
-		ServerPort:         bestServer.Port,
-		Protocol:           user.Protocol,
+		ServerHost:         bestServer.PublicEndpoint(),
+		ServerPort:         serverPort,
+		Protocol:           protocol,
 		OVPNContent:        ovpnContent,
+		WireGuardContent:   wireGuardContent,
+		RouteProfile:       routeProfile,
+		Transports:         transports,
 		RecommendedServers: recommendations,
 	}
 
+	// The current profile (e.g. after a certificate renewal) has now been delivered
+	if !user.Synced {
+		if err := api.manager.MarkUserSynced(user.Username); err != nil {
+			fmt.Printf("Failed to mark user %s synced: %v\n", user.Username, err)
+		}
+	}
+
 	// Log the access
 	api.logAudit(
 		"VPN_CONFIG_ACCESSED",
 		user.Username,
-		fmt.Sprintf("VPN configuration accessed - server: %s", bestServer.Name),
+		fmt.Sprintf("VPN configuration accessed - server: %s, protocol: %s", bestServer.Name, protocol),
 		r.RemoteAddr,
 	)
 
@@ -247,6 +292,16 @@ func (api *ManagementAPI) selectBestServer(preferredServerID string) (*shared.Se
 			userCount, _ := api.getServerUserCount(server.Name)
 			loadPercent := float64(userCount) / float64(50) * 100 // Assume max 50 users per server
 
+			// Prefer the metrics the end-node reports; skip it when it reports itself unhealthy
+			if health, err := api.getServerHealth(server.Name); err == nil {
+				if load, ok := api.serverLoad(*health); ok {
+					loadPercent = load
+					if health.Status == shared.HealthStatusUnhealthy {
+						loadPercent = 100
+					}
+				}
+			}
+
 			if loadPercent < 80 {
 				// Server is healthy and not overloaded
 				return server, nil
@@ -254,17 +309,25 @@ func (api *ManagementAPI) selectBestServer(preferredServerID string) (*shared.Se
 		}
 	}
 
-	// If preferred server is not available or overloaded, find the best alternative
+	// If preferred server is not available or overloaded, find the best alternative:
+	// healthy end-nodes with recent metrics first, ordered by their connected clients,
+	// then the rest by assigned users
 	query := `
 		SELECT s.id, s.name, s.host, s.port, s.enabled,
-		       s.last_sync, s.server_type, s.created_at,
+		       s.last_sync, s.server_type, s.created_at, s.public_endpoints, s.listeners,
 		       COUNT(u.id) as user_count
 		FROM servers s
 		LEFT JOIN users u ON s.name = u.server_id AND u.active = true
+		LEFT JOIN LATERAL (
+			SELECT status, connected_clients FROM server_health
+			WHERE server_id = s.name AND last_check > NOW() - INTERVAL '2 minutes'
+			ORDER BY last_check DESC LIMIT 1
+		) h ON true
 		WHERE s.enabled = true
 		GROUP BY s.id, s.name, s.host, s.port, s.enabled,
-		         s.last_sync, s.server_type, s.created_at
-		ORDER BY user_count ASC, s.created_at DESC
+		         s.last_sync, s.server_type, s.created_at, s.public_endpoints, s.listeners, h.status, h.connected_clients
+		ORDER BY h.status = 'unhealthy' NULLS FIRST, h.connected_clients IS NULL,
+		         h.connected_clients ASC, user_count ASC, s.created_at DESC
 		LIMIT 1
 	`
 
@@ -282,6 +345,8 @@ func (api *ManagementAPI) selectBestServer(preferredServerID string) (*shared.Se
 		&lastSync,
 		&serverType,
 		&server.CreatedAt,
+		&server.PublicEndpoints,
+		&server.Listeners,
 		&userCount,
 	)
 
@@ -306,7 +371,7 @@ func (api *ManagementAPI) getServerByID(serverID string) (*shared.Server, error)
 
 	query := `
 		SELECT id, name, host, port, enabled,
-		       last_sync, server_type, created_at
+		       last_sync, server_type, created_at, public_endpoints, listeners
 		FROM servers
 		WHERE name = $1
 	`
@@ -324,6 +389,8 @@ func (api *ManagementAPI) getServerByID(serverID string) (*shared.Server, error)
 		&lastSync,
 		&serverType,
 		&server.CreatedAt,
+		&server.PublicEndpoints,
+		&server.Listeners,
 	)
 
 	if err != nil {
@@ -349,16 +416,20 @@ func (api *ManagementAPI) getOVPNContent(username, serverID string) (string, err
 	}
 
 	// Try to download OVPN file from the end-node
-	url := fmt.Sprintf("http://%s:%d/api/ovpn/%s", server.Host, server.Port, username)
+	url := api.manager.EndNodeURL(server.Host, server.Port, "/api/ovpn/"+username)
 
 	req, err := http.NewRequest("GET", url, nil)
+	if err == nil {
+		err = api.manager.AuthorizeEndNodeRequest(req, server.Name)
+	}
 	if err != nil {
 		// Fall back to template
 		return api.generateOVPNTemplate(username, server), nil
 	}
 
 	client := &http.Client{
-		Timeout: 10 * time.Second,
+		Timeout:   10 * time.Second,
+		Transport: api.manager.NodeTransport(),
 	}
 
 	resp, err := client.Do(req)
@@ -378,7 +449,10 @@ func (api *ManagementAPI) getOVPNContent(username, serverID string) (string, err
 			return api.generateOVPNTemplate(username, server), nil
 		}
 
-		// Retry fetching the OVPN file after creation
+		// Retry fetching the OVPN file after creation, signed anew as signatures are single-use
+		if err := api.manager.AuthorizeEndNodeRequest(req, server.Name); err != nil {
+			return api.generateOVPNTemplate(username, server), nil
+		}
 		resp2, err := client.Do(req)
 		if err != nil || resp2.StatusCode != http.StatusOK {
 			fmt.Printf("[VPN] Failed to fetch OVPN after creation, falling back to template\n")
@@ -416,12 +490,13 @@ func (api *ManagementAPI) getOVPNContent(username, serverID string) (string, err
 func (api *ManagementAPI) createOVPNFileOnEndNode(username string, server *shared.Server) error {
 	// Prepare the request payload for OVPN creation with all required fields
 	// End-node will generate certificates automatically if cert_data is empty
+	listener := api.serverListeners(server, "")[0]
 	payload := map[string]interface{}{
 		"username":  username,
-		"port":      1194,        // Default OpenVPN port
-		"protocol":  "udp",       // Default protocol
+		"port":      listener.Port,
+		"protocol":  listener.Protocol,
 		"server_id": server.Name,
-		"server_ip": server.Host, // Use server host as IP
+		"server_ip": server.PublicEndpoint(),
 		"cert_data": map[string]string{
 			"ca":   "", // Empty - end-node will generate
 			"cert": "",
@@ -436,7 +511,7 @@ func (api *ManagementAPI) createOVPNFileOnEndNode(username string, server *share
 	}
 
 	// Call the endnode's /api/ovpn/create endpoint
-	url := fmt.Sprintf("http://%s:%d/api/ovpn/create", server.Host, server.Port)
+	url := api.manager.EndNodeURL(server.Host, server.Port, "/api/ovpn/create")
 
 	req, err := http.NewRequest("POST", url, strings.NewReader(string(payloadBytes)))
 	if err != nil {
@@ -444,9 +519,13 @@ func (api *ManagementAPI) createOVPNFileOnEndNode(username string, server *share
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	if err := api.manager.AuthorizeEndNodeRequest(req, server.Name); err != nil {
+		return err
+	}
 
 	client := &http.Client{
-		Timeout: 30 * time.Second, // Longer timeout for file creation
+		Timeout:   30 * time.Second, // Longer timeout for file creation
+		Transport: api.manager.NodeTransport(),
 	}
 
 	resp, err := client.Do(req)
@@ -463,42 +542,156 @@ func (api *ManagementAPI) createOVPNFileOnEndNode(username string, server *share
 	return nil
 }
 
-// generateOVPNTemplate creates a basic OVPN configuration template
+// getWireGuardContent retrieves the WireGuard client config for a user from the end-node.
+// The peer is created on the end-node if it does not exist yet. Unlike OpenVPN there is no
+// template fallback: a WireGuard config without the server's keys is unusable.
+func (api *ManagementAPI) getWireGuardContent(username string, server *shared.Server) (string, error) {
+	url := api.manager.EndNodeURL(server.Host, server.Port, "/api/wireguard/"+username)
+
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: api.manager.NodeTransport(),
+	}
+
+	fetch := func() (*http.Response, error) {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := api.manager.AuthorizeEndNodeRequest(req, server.Name); err != nil {
+			return nil, err
+		}
+		return client.Do(req)
+	}
+
+	resp, err := fetch()
+	if err != nil {
+		return "", fmt.Errorf("end-node not reachable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		fmt.Printf("[VPN] WireGuard peer not found for %s, creating it now...\n", username)
+
+		if err := api.createWireGuardPeerOnEndNode(username, server); err != nil {
+			return "", fmt.Errorf("failed to create WireGuard peer: %v", err)
+		}
+
+		resp, err = fetch()
+		if err != nil {
+			return "", fmt.Errorf("end-node not reachable: %v", err)
+		}
+		defer resp.Body.Close()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("endnode returned error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read WireGuard config: %v", err)
+	}
+
+	return string(body), nil
+}
+
+// createWireGuardPeerOnEndNode provisions a WireGuard peer for a user on the specified end-node
+func (api *ManagementAPI) createWireGuardPeerOnEndNode(username string, server *shared.Server) error {
+	payload := map[string]interface{}{
+		"username":  username,
+		"server_id": server.Name,
+		"server_ip": server.PublicEndpoint(),
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %v", err)
+	}
+
+	url := api.manager.EndNodeURL(server.Host, server.Port, "/api/wireguard/create")
+
+	req, err := http.NewRequest("POST", url, strings.NewReader(string(payloadBytes)))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if err := api.manager.AuthorizeEndNodeRequest(req, server.Name); err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: api.manager.NodeTransport(),
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call endnode: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// A concurrent request may already have created the peer
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusConflict {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("endnode returned error %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// applyRemotes points the remote lines of an OpenVPN client config at the public endpoints
+// the end-node advertised when it registered, on each of the given listeners in order.
+// Configs of end-nodes that advertise no endpoints keep their hosts.
+func applyRemotes(server *shared.Server, listeners []shared.Listener, content string) string {
+	return shared.SetRemoteListeners(content, server.PublicEndpoints, listeners)
+}
+
+// serverListeners returns the OpenVPN listeners of an end-node with those of the preferred
+// protocol first. End-nodes that declared none listen on the port and protocol of their
+// server profile.
+func (api *ManagementAPI) serverListeners(server *shared.Server, protocol string) []shared.Listener {
+	listeners := []shared.Listener(server.Listeners)
+	if len(listeners) == 0 {
+		profile, err := api.manager.ResolveServerProfile(server.Name)
+		if err != nil {
+			profile = shared.DefaultServerProfile()
+		}
+		listeners = []shared.Listener{profile.Listener()}
+	}
+	return shared.OrderListeners(listeners, protocol)
+}
+
+// generateOVPNTemplate creates an OVPN configuration template from the end-node's server
+// profile, so its settings match the server even though the certificates are missing
 func (api *ManagementAPI) generateOVPNTemplate(username string, server *shared.Server) string {
-	return fmt.Sprintf(`# BarqNet VPN Configuration
-# Generated for user: %s
-# Server: %s (%s:%d)
-
-client
-dev tun
-proto udp
-remote %s %d
-resolv-retry infinite
-nobind
-persist-key
-persist-tun
-
-# Security settings
-cipher AES-256-GCM
-auth SHA256
-key-direction 1
-tls-version-min 1.2
-
-# Note: This is a template configuration
-# Full certificates will be provided by the VPN server
-
-<ca>
-# CA certificate will be inserted here
-</ca>
-
-<cert>
-# Client certificate for %s will be inserted here
-</cert>
-
-<key>
-# Client private key will be inserted here
-</key>
-`, username, server.Name, server.Host, server.Port, server.Host, server.Port, username)
+	profile, err := api.manager.ResolveServerProfile(server.Name)
+	if err != nil {
+		fmt.Printf("[VPN] Failed to resolve server profile for %s, using default: %v\n", server.Name, err)
+		profile = shared.DefaultServerProfile()
+	}
+
+	content, err := shared.RenderClientConfig(profile, shared.OpenVPNClientParams{
+		Username:    username,
+		ServerID:    server.Name,
+		Hosts:       server.RemoteHosts(),
+		Listeners:   server.Listeners,
+		CA:          "# CA certificate will be inserted here",
+		Cert:        fmt.Sprintf("# Client certificate for %s will be inserted here", username),
+		Key:         "# Client private key will be inserted here",
+		TLSCryptKey: "# TLS-crypt key will be inserted here",
+	})
+	if err != nil {
+		fmt.Printf("[VPN] Failed to render OVPN template for %s: %v\n", username, err)
+		return ""
+	}
+
+	return "# BarqNet VPN Configuration\n" +
+		"# Note: This is a template configuration\n" +
+		"# Full certificates will be provided by the VPN server\n" +
+		string(content)
 }
 
 // getServerRecommendations returns a list of recommended servers based on load and location
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// handleEnrollmentTokens lists and mints single-use end-node enrollment tokens
+// GET  /api/enrollment-tokens
+// POST /api/enrollment-tokens - body {"server_id": ..., "location_id": ..., "ttl_minutes": ...}, all optional
+func (api *ManagementAPI) handleEnrollmentTokens(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, err := api.validateJWTToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if !api.isAdminOrModerator(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		tokens, err := api.manager.ListEnrollmentTokens()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list enrollment tokens: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Enrollment tokens retrieved successfully",
+			Data:      tokens,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "POST":
+		if !api.isAdmin(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		var req struct {
+			ServerID   string `json:"server_id"`
+			LocationID int    `json:"location_id"`
+			TTLMinutes int    `json:"ttl_minutes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		ttl := shared.DefaultEnrollmentTTL
+		if req.TTLMinutes != 0 {
+			ttl = time.Duration(req.TTLMinutes) * time.Minute
+		}
+
+		enrollment := shared.EnrollmentToken{ServerID: req.ServerID, LocationID: req.LocationID}
+		token, err := api.manager.CreateEnrollmentToken(&enrollment, ttl, authenticatedUser)
+		if err != nil {
+			if strings.HasPrefix(err.Error(), "invalid enrollment token") {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("❌ Failed to create enrollment token: %v", err)
+			http.Error(w, "Failed to create enrollment token", http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success: true,
+			Message: "Enrollment token created, it is shown only once",
+			Data: map[string]interface{}{
+				"token":      token,
+				"enrollment": enrollment,
+			},
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleEnrollmentTokenByID revokes an enrollment token that was not used yet
+// DELETE /api/enrollment-tokens/{id}
+func (api *ManagementAPI) handleEnrollmentTokenByID(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, err := api.validateJWTToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !api.isAdmin(authenticatedUser) {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/enrollment-tokens/"), "/"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid enrollment token ID", http.StatusBadRequest)
+		return
+	}
+
+	err = api.manager.RevokeEnrollmentToken(id, authenticatedUser)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Enrollment token not found or already used or revoked", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to revoke enrollment token: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Enrollment token revoked",
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleEndNodeEnroll exchanges an enrollment token for the end-node's own credential. The
+// token is its only authentication.
+// POST /api/endnodes/enroll - body {"token": ..., "server_id": ...}
+func (api *ManagementAPI) handleEndNodeEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token"`
+		ServerID string `json:"server_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		http.Error(w, "Enrollment token required", http.StatusBadRequest)
+		return
+	}
+	if err := shared.ValidateServerID(req.ServerID); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid server ID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	secret, err := api.manager.EnrollEndNode(req.Token, req.ServerID, r.RemoteAddr)
+	switch {
+	case err == shared.ErrEnrollmentRejected:
+		log.Printf("SECURITY: Rejected enrollment of %s from %s: %v", req.ServerID, r.RemoteAddr, err)
+		http.Error(w, "Unauthorized: Invalid, used, revoked or expired enrollment token", http.StatusUnauthorized)
+		return
+	case err == shared.ErrServerIDEnrolled:
+		log.Printf("SECURITY: Rejected enrollment of %s from %s: %v", req.ServerID, r.RemoteAddr, err)
+		http.Error(w, fmt.Sprintf("Conflict: %v", err), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("❌ Failed to enroll end-node %s: %v", req.ServerID, err)
+		http.Error(w, "Failed to enroll end-node", http.StatusInternalServerError)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success: true,
+		Message: "End-node enrolled, keep the credential as its NODE_SECRET",
+		Data: map[string]interface{}{
+			"server_id":   req.ServerID,
+			"node_secret": secret,
+		},
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
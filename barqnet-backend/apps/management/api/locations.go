@@ -188,20 +188,25 @@ func (api *ManagementAPI) enrichLocationMetadata(loc *shared.ServerLocationWithM
 		return err
 	}
 
-	// Calculate average load (simplified - based on user count)
-	loadQuery := `
-		SELECT COUNT(DISTINCT u.username) as user_count
-		FROM users u
-		JOIN servers s ON u.server_id = s.name
-		WHERE s.location_id = $1 AND u.active = true
-	`
-
-	var userCount int
-	if err := conn.QueryRow(loadQuery, loc.ID).Scan(&userCount); err == nil {
-		// Assume max 100 users per location as capacity
-		loc.LoadPercentage = float64(userCount) / float64(100) * 100
-		if loc.LoadPercentage > 100 {
-			loc.LoadPercentage = 100
+	// Average load reported by the location's end-nodes; without recent reports
+	// it is estimated from the user count
+	if load, ok := api.locationLoad(loc.ID); ok {
+		loc.LoadPercentage = load
+	} else {
+		loadQuery := `
+			SELECT COUNT(DISTINCT u.username) as user_count
+			FROM users u
+			JOIN servers s ON u.server_id = s.name
+			WHERE s.location_id = $1 AND u.active = true
+		`
+
+		var userCount int
+		if err := conn.QueryRow(loadQuery, loc.ID).Scan(&userCount); err == nil {
+			// Assume max 100 users per location as capacity
+			loc.LoadPercentage = float64(userCount) / float64(100) * 100
+			if loc.LoadPercentage > 100 {
+				loc.LoadPercentage = 100
+			}
 		}
 	}
 
@@ -220,7 +225,7 @@ func (api *ManagementAPI) getServersForLocation(locationID int) ([]shared.Server
 	// Get servers for the location
 	query := `
 		SELECT s.id, s.name, s.host, s.port, s.enabled,
-		       s.last_sync, s.server_type, s.created_at
+		       s.last_sync, s.server_type, s.created_at, s.public_endpoints, s.listeners
 		FROM servers s
 		WHERE s.location_id = $1 AND s.enabled = true
 		ORDER BY s.name
@@ -247,6 +252,8 @@ func (api *ManagementAPI) getServersForLocation(locationID int) ([]shared.Server
 			&lastSync,
 			&serverType,
 			&srv.CreatedAt,
+			&srv.PublicEndpoints,
+			&srv.Listeners,
 		)
 
 		if err != nil {
@@ -286,6 +293,11 @@ func (api *ManagementAPI) getServersForLocation(locationID int) ([]shared.Server
 			}
 		}
 
+		// Prefer the load the end-node reported itself
+		if load, ok := api.serverLoad(srv.Health); ok {
+			srv.LoadPercent = load
+		}
+
 		servers = append(servers, srv)
 	}
 
@@ -294,38 +306,68 @@ func (api *ManagementAPI) getServersForLocation(locationID int) ([]shared.Server
 
 // getServerHealth retrieves health status for a server
 func (api *ManagementAPI) getServerHealth(serverID string) (*shared.ServerHealth, error) {
-	db := api.manager.GetDB()
-	conn := db.GetConnection()
+	return api.manager.GetEndNodeHealth(serverID)
+}
 
-	query := `
-		SELECT id, server_id, status, last_check, response_time_ms, error_message
-		FROM server_health
-		WHERE server_id = $1
-		ORDER BY last_check DESC
-		LIMIT 1
-	`
+// healthReportMaxAge is how old a health report may be before its metrics are ignored.
+// End-nodes report every 30 seconds.
+const healthReportMaxAge = 2 * time.Minute
 
-	var health shared.ServerHealth
-	var errorMsg sql.NullString
+// serverLoad returns the load of a server from its health report: connected clients against
+// the max_clients of its server profile. ok is false when there is no recent report with metrics.
+func (api *ManagementAPI) serverLoad(health shared.ServerHealth) (float64, bool) {
+	if health.Metrics == nil || time.Since(health.LastCheck) > healthReportMaxAge {
+		return 0, false
+	}
 
-	err := conn.QueryRow(query, serverID).Scan(
-		&health.ID,
-		&health.ServerID,
-		&health.Status,
-		&health.LastCheck,
-		&health.ResponseTime,
-		&errorMsg,
-	)
+	maxClients := shared.DefaultServerProfile().MaxClients
+	if profile, err := api.manager.ResolveServerProfile(health.ServerID); err == nil {
+		maxClients = profile.MaxClients
+	}
 
+	load := float64(health.Metrics.ConnectedClients) / float64(maxClients) * 100
+	if load > 100 {
+		load = 100
+	}
+	return load, true
+}
+
+// locationLoad returns the average load reported by the enabled end-nodes of a location.
+// ok is false when none of them reported recently.
+func (api *ManagementAPI) locationLoad(locationID int) (float64, bool) {
+	conn := api.manager.GetDB().GetConnection()
+
+	rows, err := conn.Query(`SELECT name FROM servers WHERE location_id = $1 AND enabled = true`, locationID)
 	if err != nil {
-		return nil, err
+		return 0, false
 	}
+	defer rows.Close()
 
-	if errorMsg.Valid {
-		health.ErrorMessage = errorMsg.String
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			names = append(names, name)
+		}
 	}
 
-	return &health, nil
+	var total float64
+	var reported int
+	for _, name := range names {
+		health, err := api.getServerHealth(name)
+		if err != nil {
+			continue
+		}
+		if load, ok := api.serverLoad(*health); ok {
+			total += load
+			reported++
+		}
+	}
+
+	if reported == 0 {
+		return 0, false
+	}
+	return total / float64(reported), true
 }
 
 // getServerUserCount returns the number of active users on a server
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// End-node endpoints only accept requests made with the credential of an end-node: signed
+// with its node credential or, over mutual TLS, made with its node certificate while the
+// end-node still holds a credential. A request about a server ID is only accepted from the
+// end-node enrolled under that ID.
+
+// nodeCredentials looks up the credentials of end-nodes; implemented by the management manager
+type nodeCredentials interface {
+	VerifyEndNodeRequest(r *http.Request) (string, error)
+	HasNodeCredential(serverID string) (bool, error)
+}
+
+// authenticateNodeRequest authenticates a request for an end-node endpoint and records the
+// end-node in the request context. Other requests pass unchanged. Rejected requests are
+// audit-logged; it writes the error response and returns false for them.
+func (api *ManagementAPI) authenticateNodeRequest(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if !isNodeEndpoint(r.URL.Path) {
+		return r, true
+	}
+
+	serverID, err := api.nodeIdentity(r)
+	if err != nil {
+		api.rejectNodeRequest(w, r, "NODE_AUTH_REJECTED", r.Header.Get(shared.HeaderNodeID), err,
+			"Unauthorized: Invalid or missing end-node credential", http.StatusUnauthorized)
+		return r, false
+	}
+	if target := nodeEndpointServerID(r.URL.Path); target != "" && target != serverID {
+		api.rejectNodeRequest(w, r, "NODE_IDENTITY_MISMATCH", serverID, fmt.Errorf("end-node %s acted for %s", serverID, target),
+			"Forbidden: End-nodes may only act for themselves", http.StatusForbidden)
+		return r, false
+	}
+	return r.WithContext(shared.WithAuthenticatedNode(r.Context(), serverID)), true
+}
+
+// nodeIdentity returns the end-node whose credential a request was made with
+func (api *ManagementAPI) nodeIdentity(r *http.Request) (string, error) {
+	peer := shared.PeerNodeName(r)
+	if peer == shared.ManagementNodeName {
+		return "", fmt.Errorf("the management certificate does not identify an end-node")
+	}
+
+	if shared.IsSignedRequest(r) {
+		serverID, err := api.nodeCredentials.VerifyEndNodeRequest(r)
+		if err != nil {
+			return "", err
+		}
+		// Over mutual TLS the credential must belong to the end-node the certificate was issued to
+		if peer != "" && peer != serverID {
+			return "", fmt.Errorf("request is signed for end-node %s but made with the certificate of %s", serverID, peer)
+		}
+		return serverID, nil
+	}
+	if peer != "" {
+		// A certificate alone only counts while the end-node still holds a credential
+		enrolled, err := api.nodeCredentials.HasNodeCredential(peer)
+		if err != nil {
+			return "", err
+		}
+		if !enrolled {
+			return "", fmt.Errorf("end-node %s has a node certificate but no credential", peer)
+		}
+		return peer, nil
+	}
+	return "", fmt.Errorf("no end-node credential")
+}
+
+// rejectNodeRequest audit-logs a refused end-node request and answers it with status
+func (api *ManagementAPI) rejectNodeRequest(w http.ResponseWriter, r *http.Request, action, serverID string, err error, message string, status int) {
+	log.Printf("SECURITY: Rejected end-node request from %s for %s %s: %v", r.RemoteAddr, r.Method, r.URL.Path, err)
+	api.logAuditEvent(action, serverID, fmt.Sprintf("%s %s: %v", r.Method, r.URL.Path, err), r.RemoteAddr)
+	http.Error(w, message, status)
+}
+
+// nodeEndpointServerID returns the server ID an end-node endpoint path acts for, or "" for
+// endpoints that name it in the body or not at all
+func nodeEndpointServerID(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/api/endnodes-"):
+		rest := strings.TrimPrefix(path, "/api/endnodes-")
+		if i := strings.Index(rest, "/"); i >= 0 {
+			return strings.TrimSuffix(rest[i+1:], "/")
+		}
+	case strings.HasPrefix(path, "/api/endnodes/delete/"):
+		return strings.TrimSuffix(strings.TrimPrefix(path, "/api/endnodes/delete/"), "/")
+	case strings.HasPrefix(path, "/api/endnodes/") && strings.HasSuffix(path, "/deregister"):
+		return strings.TrimSuffix(strings.TrimPrefix(path, "/api/endnodes/"), "/deregister")
+	}
+	return ""
+}
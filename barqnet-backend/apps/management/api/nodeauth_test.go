@@ -0,0 +1,138 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// fakeNodeCredentials verifies signatures against fixed end-node credentials
+type fakeNodeCredentials struct {
+	secrets  map[string]string
+	verifier *shared.RequestVerifier
+}
+
+func newFakeNodeCredentials(secrets map[string]string) *fakeNodeCredentials {
+	return &fakeNodeCredentials{secrets: secrets, verifier: shared.NewRequestVerifier()}
+}
+
+func (f *fakeNodeCredentials) VerifyEndNodeRequest(r *http.Request) (string, error) {
+	return f.verifier.Verify(r, shared.SignedByNode, func(serverID string) (string, error) {
+		return f.secrets[serverID], nil
+	})
+}
+
+func (f *fakeNodeCredentials) HasNodeCredential(serverID string) (bool, error) {
+	return f.secrets[serverID] != "", nil
+}
+
+// withPeerCertificate makes a request look like it came over mutual TLS with a node
+// certificate issued to commonName
+func withPeerCertificate(r *http.Request, commonName string) *http.Request {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return r
+}
+
+// TestAuthenticateNodeRequest verifies end-node endpoints only accept an end-node's own credential
+func TestAuthenticateNodeRequest(t *testing.T) {
+	secret1, _ := shared.GenerateNodeSecret()
+	secret2, _ := shared.GenerateNodeSecret()
+	api := &ManagementAPI{nodeCredentials: newFakeNodeCredentials(map[string]string{
+		"node-1": secret1,
+		"node-2": secret2,
+	})}
+
+	signed := func(path, serverID, secret string) *http.Request {
+		r := httptest.NewRequest("POST", path, strings.NewReader(`{"status":"healthy"}`))
+		if err := shared.SignRequest(r, serverID, secret, shared.SignedByNode); err != nil {
+			t.Fatalf("SignRequest failed: %v", err)
+		}
+		return r
+	}
+	unsigned := func(path string) *http.Request {
+		return httptest.NewRequest("POST", path, strings.NewReader(`{"status":"healthy"}`))
+	}
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+		wantNode   string
+	}{
+		{"unsigned", unsigned("/api/endnodes-health/node-1"), http.StatusUnauthorized, ""},
+		{"api key only", func() *http.Request {
+			r := unsigned("/api/endnodes/register")
+			r.Header.Set("Authorization", "Bearer some-api-key")
+			return r
+		}(), http.StatusUnauthorized, ""},
+		{"signed", signed("/api/endnodes-health/node-1", "node-1", secret1), http.StatusOK, "node-1"},
+		{"signed register", signed("/api/endnodes/register", "node-1", secret1), http.StatusOK, "node-1"},
+		{"wrong secret", signed("/api/endnodes-health/node-1", "node-1", secret2), http.StatusUnauthorized, ""},
+		{"other server ID", signed("/api/endnodes-health/node-2", "node-1", secret1), http.StatusForbidden, ""},
+		{"other deregister", signed("/api/endnodes/node-2/deregister", "node-1", secret1), http.StatusForbidden, ""},
+		{"node certificate", withPeerCertificate(unsigned("/api/endnodes-health/node-1"), "node-1"), http.StatusOK, "node-1"},
+		{"node certificate without credential", withPeerCertificate(unsigned("/api/endnodes-health/node-3"), "node-3"), http.StatusUnauthorized, ""},
+		{"certificate of another node", withPeerCertificate(signed("/api/endnodes-health/node-1", "node-1", secret1), "node-2"), http.StatusUnauthorized, ""},
+		{"management certificate", withPeerCertificate(unsigned("/api/endnodes-health/node-1"), shared.ManagementNodeName), http.StatusUnauthorized, ""},
+		{"signed with management certificate", withPeerCertificate(signed("/api/endnodes-health/node-1", "node-1", secret1), shared.ManagementNodeName), http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r, ok := api.authenticateNodeRequest(w, tt.req)
+			if tt.wantStatus == http.StatusOK {
+				if !ok {
+					t.Fatalf("request rejected with %d: %s", w.Code, w.Body.String())
+				}
+				if got := shared.AuthenticatedNode(r); got != tt.wantNode {
+					t.Errorf("authenticated node = %q, want %q", got, tt.wantNode)
+				}
+				return
+			}
+			if ok {
+				t.Fatalf("request accepted, want status %d", tt.wantStatus)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	// Other endpoints pass unchanged, without an authenticated end-node
+	w := httptest.NewRecorder()
+	r, ok := api.authenticateNodeRequest(w, unsigned("/api/users"))
+	if !ok || shared.AuthenticatedNode(r) != "" {
+		t.Errorf("non end-node request was not passed unchanged")
+	}
+}
+
+// TestNodeEndpointServerID verifies the server ID an end-node endpoint acts for is parsed from its path
+func TestNodeEndpointServerID(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/endnodes-health/node-1", "node-1"},
+		{"/api/endnodes-health/node-1/", "node-1"},
+		{"/api/endnodes-usage/node.eu-2", "node.eu-2"},
+		{"/api/endnodes-health/", ""},
+		{"/api/endnodes-health", ""},
+		{"/api/endnodes/delete/node-1", "node-1"},
+		{"/api/endnodes/delete/node-1/", "node-1"},
+		{"/api/endnodes/node-1/deregister", "node-1"},
+		{"/api/endnodes/register", ""},
+		{"/api/users/sync", ""},
+	}
+	for _, tt := range tests {
+		if got := nodeEndpointServerID(tt.path); got != tt.want {
+			t.Errorf("nodeEndpointServerID(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// isNodeEndpoint reports whether a path is called by end-nodes rather than by users or admins
+func isNodeEndpoint(path string) bool {
+	switch {
+	case strings.HasPrefix(path, "/api/endnodes-"):
+		return true
+	case path == "/api/endnodes/register", strings.HasPrefix(path, "/api/endnodes/delete/"):
+		return true
+	case strings.HasPrefix(path, "/api/endnodes/") && strings.HasSuffix(path, "/deregister"):
+		return true
+	case path == "/api/users/sync":
+		return true
+	}
+	return false
+}
+
+// refuseNodeEndpoints keeps end-node endpoints off the public port while end-nodes must
+// use mutual TLS, so nothing reaches them without a node certificate
+func refuseNodeEndpoints(next http.Handler, nodePort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isNodeEndpoint(r.URL.Path) {
+			log.Printf("SECURITY: Refused end-node request for %s from %s without mutual TLS", r.URL.Path, r.RemoteAddr)
+			http.Error(w, fmt.Sprintf("End-node endpoints require mutual TLS on port %d", nodePort), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startNodeServer serves the API on the node port over mutual TLS: clients must present a
+// certificate issued by the node CA that is not revoked
+func (api *ManagementAPI) startNodeServer(handler http.Handler, nodePort int) error {
+	tlsConfig, err := api.manager.NodeTLS().ServerTLSConfig("", api.manager.VerifyNodeCertificate)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%d", nodePort),
+		Handler:      handler,
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+	}
+	go func() {
+		if err := server.ListenAndServeTLS("", ""); err != nil {
+			log.Fatalf("Failed to start node API server: %v", err)
+		}
+	}()
+	log.Printf("[TLS] ✅ Node API running on port %d with mutual TLS", nodePort)
+	return nil
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// handleServerProfiles lists and saves OpenVPN server profiles
+// GET  /api/server-profiles
+// POST /api/server-profiles - saves the profile for the scope in the body (server_id,
+// location_id or neither for the global default); fields left out take their default values
+func (api *ManagementAPI) handleServerProfiles(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, err := api.validateJWTToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if !api.isAdminOrModerator(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		profiles, err := api.manager.ListServerProfiles()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list server profiles: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success: true,
+			Message: "Server profiles retrieved successfully",
+			Data: map[string]interface{}{
+				"profiles": profiles,
+				"default":  shared.DefaultServerProfile(),
+			},
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "POST":
+		if !api.isAdmin(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		profile := shared.DefaultServerProfile()
+		if err := json.NewDecoder(r.Body).Decode(profile); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if err := api.manager.SaveServerProfile(profile, authenticatedUser); err != nil {
+			if strings.HasPrefix(err.Error(), "invalid server profile") {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("❌ Failed to save server profile %q: %v", profile.Name, err)
+			http.Error(w, "Failed to save server profile", http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   fmt.Sprintf("Server profile %s saved, end-nodes apply it on their next sync", profile.Name),
+			Data:      profile,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleServerProfileByID gets or deletes a stored OpenVPN server profile
+// GET    /api/server-profiles/{id}
+// DELETE /api/server-profiles/{id}
+func (api *ManagementAPI) handleServerProfileByID(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, err := api.validateJWTToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/server-profiles/"), "/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid profile ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if !api.isAdminOrModerator(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		profile, err := api.manager.GetServerProfile(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Server profile not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get server profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Server profile retrieved successfully",
+			Data:      profile,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "DELETE":
+		if !api.isAdmin(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		if err := api.manager.DeleteServerProfile(id, authenticatedUser); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Server profile not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to delete server profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Server profile deleted, affected end-nodes fall back to the next broader profile",
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleEndNodeServerProfile serves the OpenVPN server profile an end-node should run and
+// takes the end-node's report once it applied it
+// GET  /api/endnodes-profile/{serverID} - 304 Not Modified when If-None-Match carries the current version
+// POST /api/endnodes-profile/{serverID}
+func (api *ManagementAPI) handleEndNodeServerProfile(w http.ResponseWriter, r *http.Request) {
+	serverID := strings.TrimPrefix(r.URL.Path, "/api/endnodes-profile/")
+	serverID = strings.TrimSuffix(serverID, "/")
+
+	if serverID == "" {
+		http.Error(w, "Server ID required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		api.handleEndNodeProfileFetch(w, r, serverID)
+	case "POST":
+		api.handleEndNodeProfileReport(w, r, serverID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleEndNodeProfileFetch returns the resolved server profile with its version as ETag
+func (api *ManagementAPI) handleEndNodeProfileFetch(w http.ResponseWriter, r *http.Request, serverID string) {
+	profile, err := api.manager.ResolveServerProfile(serverID)
+	if err != nil {
+		log.Printf("❌ Failed to resolve server profile for %s: %v", serverID, err)
+		http.Error(w, "Failed to resolve server profile", http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf("\"%s\"", profile.Version)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Server profile retrieved successfully",
+		Data:      profile,
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleEndNodeProfileReport records whether an end-node applied its server profile
+func (api *ManagementAPI) handleEndNodeProfileReport(w http.ResponseWriter, r *http.Request, serverID string) {
+	var report shared.ServerProfileReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if report.ServerID != "" && report.ServerID != serverID {
+		http.Error(w, "Server ID mismatch", http.StatusBadRequest)
+		return
+	}
+	report.ServerID = serverID
+	if report.AppliedAt.IsZero() {
+		report.AppliedAt = time.Now()
+	}
+
+	for _, username := range report.Rerendered {
+		if err := api.validateUsername(username); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid username in report: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	api.manager.RecordServerProfileReport(&report)
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Server profile report recorded successfully",
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleGetEndNodeProfile returns the OpenVPN server profile resolved for an end-node
+func (api *ManagementAPI) handleGetEndNodeProfile(w http.ResponseWriter, r *http.Request, serverID string) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profile, err := api.manager.ResolveServerProfile(serverID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to resolve server profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Server profile retrieved successfully",
+		Data:      profile,
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
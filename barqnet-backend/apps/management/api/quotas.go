@@ -0,0 +1,132 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// handleUserQuota gets, sets and removes the data quota of a user
+// GET    /api/users/{username}/quota - the quota with its usage in the current period
+// PUT    /api/users/{username}/quota - body {"limit_bytes": ..., "period": "monthly"|"rolling", "rolling_days": ...}
+// DELETE /api/users/{username}/quota
+func (api *ManagementAPI) handleUserQuota(w http.ResponseWriter, r *http.Request, username string) {
+	authenticatedUser, err := api.validateJWTToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := api.validateUsername(username); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid username: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if !api.isAdminOrModerator(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		quota, err := api.manager.GetDataQuota(username)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Data quota not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get data quota: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		status, err := api.manager.GetDataQuotaStatus(username)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get data quota usage: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success: true,
+			Message: "Data quota retrieved successfully",
+			Data: map[string]interface{}{
+				"quota":  quota,
+				"status": status,
+			},
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "PUT", "POST":
+		if !api.isAdmin(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		var quota shared.DataQuota
+		if err := json.NewDecoder(r.Body).Decode(&quota); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		quota.Username = username
+
+		if err := api.manager.SetDataQuota(&quota, authenticatedUser); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			if strings.HasPrefix(err.Error(), "invalid data quota") {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("❌ Failed to save data quota of %s: %v", username, err)
+			http.Error(w, "Failed to save data quota", http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   fmt.Sprintf("Data quota of %s saved", username),
+			Data:      quota,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "DELETE":
+		if !api.isAdmin(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		err := api.manager.DeleteDataQuota(username, authenticatedUser)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Data quota not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete data quota: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   fmt.Sprintf("Data quota removed from %s", username),
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// handleEndNodeDesiredState returns the versioned user set an end-node should hold
+// GET /api/endnodes-desired/{serverID}
+// Responds 304 Not Modified when If-None-Match carries the current version.
+func (api *ManagementAPI) handleEndNodeDesiredState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	serverID := strings.TrimPrefix(r.URL.Path, "/api/endnodes-desired/")
+	serverID = strings.TrimSuffix(serverID, "/")
+
+	if serverID == "" {
+		http.Error(w, "Server ID required", http.StatusBadRequest)
+		return
+	}
+
+	state, err := api.manager.GetDesiredState()
+	if err != nil {
+		log.Printf("❌ Failed to build desired state for %s: %v", serverID, err)
+		http.Error(w, "Failed to build desired state", http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf("\"%s\"", state.Version)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Desired state retrieved successfully",
+		Data:      state,
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleEndNodeDriftSubmission handles reconciliation reports from end-nodes
+// POST /api/endnodes-drift/{serverID}
+func (api *ManagementAPI) handleEndNodeDriftSubmission(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	serverID := strings.TrimPrefix(r.URL.Path, "/api/endnodes-drift/")
+	serverID = strings.TrimSuffix(serverID, "/")
+
+	if serverID == "" {
+		http.Error(w, "Server ID required", http.StatusBadRequest)
+		return
+	}
+
+	var report shared.DriftReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if report.ServerID != "" && report.ServerID != serverID {
+		http.Error(w, "Server ID mismatch", http.StatusBadRequest)
+		return
+	}
+	report.ServerID = serverID
+	if report.ReconciledAt.IsZero() {
+		report.ReconciledAt = time.Now()
+	}
+
+	for _, username := range report.Created {
+		if err := api.validateUsername(username); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid username in report: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := api.manager.RecordDriftReport(&report); err != nil {
+		log.Printf("❌ Failed to record drift report from %s: %v", serverID, err)
+		http.Error(w, "Failed to record drift report", http.StatusInternalServerError)
+		return
+	}
+
+	if report.HasDrift() {
+		log.Printf("End-node %s reconciled to version %s (missing=%d unexpected=%d created=%d revoked=%d failed=%d)",
+			serverID, report.Version, len(report.Missing), len(report.Unexpected),
+			len(report.Created), len(report.Revoked), len(report.Failed))
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Drift report recorded successfully",
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleGetEndNodeDrift returns the latest reconciliation reported by an end-node
+func (api *ManagementAPI) handleGetEndNodeDrift(w http.ResponseWriter, r *http.Request, serverID string) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := api.manager.GetLatestReconciliation(serverID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No reconciliation recorded for this end-node", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get reconciliation: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Reconciliation retrieved successfully",
+		Data:      report,
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,332 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// handleRouteProfiles lists and saves split-tunnel route profiles
+// GET  /api/route-profiles
+// POST /api/route-profiles - saves the profile, replacing the one with the same name
+func (api *ManagementAPI) handleRouteProfiles(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, err := api.validateJWTToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if !api.isAdminOrModerator(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		profiles, err := api.manager.ListRouteProfiles()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list route profiles: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Route profiles retrieved successfully",
+			Data:      profiles,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "POST":
+		if !api.isAdmin(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		var rp shared.RouteProfile
+		if err := json.NewDecoder(r.Body).Decode(&rp); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if err := api.manager.SaveRouteProfile(&rp, authenticatedUser); err != nil {
+			if strings.HasPrefix(err.Error(), "invalid route profile") {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("❌ Failed to save route profile %q: %v", rp.Name, err)
+			http.Error(w, "Failed to save route profile", http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   fmt.Sprintf("Route profile %s saved", rp.Name),
+			Data:      rp,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRouteProfileByID gets, deletes and assigns a route profile
+// GET    /api/route-profiles/{id}
+// DELETE /api/route-profiles/{id}
+// PUT    /api/route-profiles/{id}/assignments - body {"username": ...} or {"plan": ...}
+// DELETE /api/route-profiles/{id}/assignments?username={username} or ?plan={plan}
+func (api *ManagementAPI) handleRouteProfileByID(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, err := api.validateJWTToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/route-profiles/"), "/")
+	if strings.HasSuffix(path, "/assignments") {
+		id, err := strconv.Atoi(strings.TrimSuffix(path, "/assignments"))
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid profile ID", http.StatusBadRequest)
+			return
+		}
+		api.handleRouteProfileAssignments(w, r, id, authenticatedUser)
+		return
+	}
+
+	id, err := strconv.Atoi(path)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid profile ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if !api.isAdminOrModerator(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		rp, err := api.manager.GetRouteProfile(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Route profile not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get route profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Route profile retrieved successfully",
+			Data:      rp,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "DELETE":
+		if !api.isAdmin(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		if err := api.manager.DeleteRouteProfile(id, authenticatedUser); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Route profile not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to delete route profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Route profile deleted, its users fall back to the full tunnel",
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRouteProfileAssignments assigns a route profile to a user or plan, or removes an assignment
+func (api *ManagementAPI) handleRouteProfileAssignments(w http.ResponseWriter, r *http.Request, id int, authenticatedUser string) {
+	if !api.isAdmin(authenticatedUser) {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	var target struct {
+		Username string `json:"username"`
+		Plan     string `json:"plan"`
+	}
+
+	switch r.Method {
+	case "PUT", "POST":
+		if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	case "DELETE":
+		target.Username = r.URL.Query().Get("username")
+		target.Plan = r.URL.Query().Get("plan")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if (target.Username == "") == (target.Plan == "") {
+		http.Error(w, "Exactly one of username or plan is required", http.StatusBadRequest)
+		return
+	}
+	if target.Username != "" {
+		if err := api.validateUsername(target.Username); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid username: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var message string
+	if r.Method == "DELETE" {
+		err := api.manager.UnassignRouteProfile(target.Username, target.Plan, authenticatedUser)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Assignment not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to remove assignment: %v", err), http.StatusInternalServerError)
+			return
+		}
+		message = "Route profile assignment removed"
+	} else {
+		err := api.manager.AssignRouteProfile(id, target.Username, target.Plan, authenticatedUser)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Route profile not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			if strings.HasPrefix(err.Error(), "invalid assignment") {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to assign route profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+		message = "Route profile assigned, affected users get it with their next config"
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   message,
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleUserPlan sets the plan of a user
+// PUT /api/users/{username}/plan - body {"plan": ...}; an empty plan clears it
+func (api *ManagementAPI) handleUserPlan(w http.ResponseWriter, r *http.Request, username string) {
+	if r.Method != "PUT" && r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	authenticatedUser, err := api.validateJWTToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !api.isAdmin(authenticatedUser) {
+		http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+		return
+	}
+
+	if err := api.validateUsername(username); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid username: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Plan string `json:"plan"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := api.manager.SetUserPlan(username, req.Plan, authenticatedUser); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if strings.HasPrefix(err.Error(), "invalid plan") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to set plan: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("Plan of %s updated", username),
+		Data:      map[string]string{"username": username, "plan": req.Plan},
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// applyRouteProfile bakes the user's route profile into an OpenVPN client config.
+// The config is returned unchanged if the profile cannot be resolved.
+func (api *ManagementAPI) applyRouteProfile(username, content string) (string, *shared.RouteProfile) {
+	return api.bakeRouteProfile(username, content, shared.ApplyRouteProfile)
+}
+
+// applyWireGuardRouteProfile bakes the user's route profile into a WireGuard client config.
+// The config is returned unchanged if the profile cannot be resolved.
+func (api *ManagementAPI) applyWireGuardRouteProfile(username, content string) (string, *shared.RouteProfile) {
+	return api.bakeRouteProfile(username, content, shared.ApplyWireGuardRouteProfile)
+}
+
+// bakeRouteProfile resolves the user's route profile and applies it to a client config
+func (api *ManagementAPI) bakeRouteProfile(username, content string, apply func([]byte, *shared.RouteProfile) ([]byte, error)) (string, *shared.RouteProfile) {
+	rp, err := api.manager.ResolveRouteProfile(username)
+	if err != nil {
+		log.Printf("⚠️  Failed to resolve route profile for %s, serving the full tunnel: %v", username, err)
+		return content, nil
+	}
+	if rp == nil {
+		return content, nil
+	}
+
+	applied, err := apply([]byte(content), rp)
+	if err != nil {
+		log.Printf("⚠️  Failed to apply route profile %q for %s: %v", rp.Name, username, err)
+		return content, nil
+	}
+
+	return string(applied), rp
+}
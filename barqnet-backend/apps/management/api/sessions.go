@@ -0,0 +1,167 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// handleEndNodeSessions checks a connecting user against its concurrent session limit across end-nodes
+// POST /api/endnodes-sessions/{serverID}
+func (api *ManagementAPI) handleEndNodeSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	serverID := strings.TrimPrefix(r.URL.Path, "/api/endnodes-sessions/")
+	serverID = strings.TrimSuffix(serverID, "/")
+
+	if serverID == "" {
+		http.Error(w, "Server ID required", http.StatusBadRequest)
+		return
+	}
+
+	var req shared.ConnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := api.validateUsername(req.Username); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid username: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	decision, err := api.manager.AuthorizeSession(serverID, &req)
+	if err != nil {
+		log.Printf("❌ Failed to check session limit of %s on %s: %v", req.Username, serverID, err)
+		http.Error(w, "Failed to check session limit", http.StatusInternalServerError)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success:   true,
+		Message:   "Session checked",
+		Data:      decision,
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleSessionLimits lists, saves and removes per-user and per-plan concurrent session limits
+// GET    /api/session-limits
+// PUT    /api/session-limits - body {"username": ...} or {"plan": ...} with max_concurrent_sessions and policy
+// DELETE /api/session-limits?username={username} or ?plan={plan}
+func (api *ManagementAPI) handleSessionLimits(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, err := api.validateJWTToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if !api.isAdminOrModerator(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		limits, err := api.manager.ListSessionLimits()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list session limits: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Session limits retrieved successfully",
+			Data:      limits,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "PUT", "POST":
+		if !api.isAdmin(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		var limit shared.SessionLimit
+		if err := json.NewDecoder(r.Body).Decode(&limit); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if limit.Username != "" {
+			if err := api.validateUsername(limit.Username); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid username: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := api.manager.SetSessionLimit(&limit, authenticatedUser); err != nil {
+			if strings.HasPrefix(err.Error(), "invalid session limit") {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("❌ Failed to save session limit: %v", err)
+			http.Error(w, "Failed to save session limit", http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Session limit saved, end-nodes apply it with their next access sync",
+			Data:      limit,
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case "DELETE":
+		if !api.isAdmin(authenticatedUser) {
+			http.Error(w, "Forbidden - admin access required", http.StatusForbidden)
+			return
+		}
+
+		username := r.URL.Query().Get("username")
+		plan := r.URL.Query().Get("plan")
+		if (username == "") == (plan == "") {
+			http.Error(w, "Exactly one of username or plan is required", http.StatusBadRequest)
+			return
+		}
+
+		err := api.manager.DeleteSessionLimit(username, plan, authenticatedUser)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Session limit not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete session limit: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := shared.APIResponse{
+			Success:   true,
+			Message:   "Session limit removed, the default limit applies",
+			Timestamp: time.Now().Unix(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strings"
@@ -112,6 +113,11 @@ func (api *ManagementAPI) handleVPNStats(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Client reports count sessions still in progress against the data quota
+	if _, err := api.manager.EnforceDataQuota(username); err != nil {
+		log.Printf("[QUOTA] Warning: Failed to check data quota of %s: %v", username, err)
+	}
+
 	// Log the statistics update
 	api.logAudit(
 		"VPN_STATS_UPLOADED",
@@ -172,6 +178,13 @@ func (api *ManagementAPI) handleGetUserStats(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Get data quota usage in the current period (nil without a quota)
+	quota, err := api.manager.GetDataQuotaStatus(username)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve data quota: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	// Log the access
 	api.logAudit(
 		"VPN_STATS_ACCESSED",
@@ -184,6 +197,9 @@ func (api *ManagementAPI) handleGetUserStats(w http.ResponseWriter, r *http.Requ
 		"summary":     stats,
 		"connections": connections,
 	}
+	if quota != nil {
+		responseData["quota"] = quota
+	}
 
 	response := shared.APIResponse{
 		Success:   true,
@@ -236,20 +252,37 @@ func (api *ManagementAPI) storeVPNStatistics(username, serverID string, bytesIn,
 	db := api.manager.GetDB()
 	conn := db.GetConnection()
 
+	// ended_at places the report in a data quota period
 	query := `
-		INSERT INTO vpn_statistics (username, server_id, bytes_in, bytes_out, duration_seconds, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO vpn_statistics (username, server_id, bytes_in, bytes_out, duration_seconds, source, started_at, ended_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 
-	_, err := conn.Exec(query, username, serverID, bytesIn, bytesOut, duration, time.Now())
+	now := time.Now()
+	_, err := conn.Exec(query, username, serverID, bytesIn, bytesOut, duration, shared.UsageSourceClient,
+		now.Add(-time.Duration(duration)*time.Second), now)
 	return err
 }
 
-// getUserStatistics retrieves aggregated statistics for a user
+// getUserStatistics retrieves aggregated statistics for a user.
+// Sessions counted by end-nodes are authoritative; client reports are only used
+// for users no end-node has reported sessions for yet.
 func (api *ManagementAPI) getUserStatistics(username string) (*shared.UserStatisticsSummary, error) {
 	db := api.manager.GetDB()
 	conn := db.GetConnection()
 
+	var stats shared.UserStatisticsSummary
+	stats.Username = username
+
+	sourceQuery := `
+		SELECT CASE WHEN EXISTS (
+			SELECT 1 FROM vpn_statistics WHERE username = $1 AND source = $2
+		) THEN $2 ELSE $3 END
+	`
+	if err := conn.QueryRow(sourceQuery, username, shared.UsageSourceServer, shared.UsageSourceClient).Scan(&stats.Source); err != nil {
+		return nil, err
+	}
+
 	query := `
 		SELECT
 			COALESCE(SUM(bytes_in), 0) as total_bytes_in,
@@ -257,13 +290,10 @@ func (api *ManagementAPI) getUserStatistics(username string) (*shared.UserStatis
 			COALESCE(SUM(duration_seconds), 0) as total_duration,
 			COUNT(*) as connection_count
 		FROM vpn_statistics
-		WHERE username = $1
+		WHERE username = $1 AND source = $2
 	`
 
-	var stats shared.UserStatisticsSummary
-	stats.Username = username
-
-	err := conn.QueryRow(query, username).Scan(
+	err := conn.QueryRow(query, username, stats.Source).Scan(
 		&stats.TotalBytesIn,
 		&stats.TotalBytesOut,
 		&stats.TotalDuration,
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// maxUsageBody caps the size of a session usage report from an end-node
+const maxUsageBody = 4 << 20
+
+// handleEndNodeUsage stores server-counted session usage shipped by an end-node
+// POST /api/endnodes-usage/{serverID}
+func (api *ManagementAPI) handleEndNodeUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	serverID := strings.TrimPrefix(r.URL.Path, "/api/endnodes-usage/")
+	serverID = strings.TrimSuffix(serverID, "/")
+
+	if serverID == "" {
+		http.Error(w, "Server ID required", http.StatusBadRequest)
+		return
+	}
+
+	var batch shared.SessionUsageBatch
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUsageBody)).Decode(&batch); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if batch.ServerID != "" && batch.ServerID != serverID {
+		http.Error(w, "Server ID mismatch", http.StatusBadRequest)
+		return
+	}
+	if err := batch.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid usage report: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	stored, err := api.manager.RecordSessionUsage(serverID, batch.Records)
+	if err != nil {
+		log.Printf("❌ Failed to record session usage from %s: %v", serverID, err)
+		http.Error(w, "Failed to record session usage", http.StatusInternalServerError)
+		return
+	}
+
+	response := shared.APIResponse{
+		Success: true,
+		Message: "Session usage recorded successfully",
+		Data: map[string]interface{}{
+			"received": len(batch.Records),
+			"recorded": stored,
+		},
+		Timestamp: time.Now().Unix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -6,6 +6,9 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"github.com/joho/godotenv"
@@ -17,9 +20,16 @@ import (
 
 func main() {
 	var (
-		configFile = flag.String("config", "management-config.json", "Configuration file path")
-		serverID = flag.String("server-id", "management-server", "Server ID for management server")
-		help     = flag.Bool("help", false, "Show help")
+		configFile  = flag.String("config", "management-config.json", "Configuration file path, JSON or YAML")
+		serverID    = flag.String("server-id", "management-server", "Server ID for management server")
+		port        = flag.Int("port", 8080, "API server port")
+		checkConfig = flag.Bool("check-config", false, "Print the effective configuration with secrets masked and exit")
+		issueNode   = flag.String("issue-node-cert", "", "Issue a mutual TLS certificate for the end-node with this server ID and exit")
+		nodeHosts   = flag.String("node-hosts", "", "Comma separated hosts the management server reaches the end-node API on, for -issue-node-cert")
+		outDir      = flag.String("out", ".", "Directory -issue-node-cert writes the certificate, key and node CA to")
+		issueCred   = flag.String("issue-node-credential", "", "Issue a request signing credential for the end-node with this server ID, print it and exit")
+		revokeNode  = flag.String("revoke-node-cert", "", "Revoke every mutual TLS certificate of the end-node with this server ID and exit")
+		help        = flag.Bool("help", false, "Show help")
 	)
 	flag.Parse()
 
@@ -28,6 +38,10 @@ func main() {
 		return
 	}
 
+	// Flags only override the config file and environment when given
+	flagsSet := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { flagsSet[f.Name] = true })
+
 	// Load .env file if it exists
 	log.Println("========================================")
 	log.Println("BarqNet Management Server - Starting...")
@@ -39,6 +53,43 @@ func main() {
 		log.Printf("[ENV] ✅ Loaded configuration from .env file")
 	}
 
+	// Load configuration: config file, then environment, then flags
+	config, err := loadConfig(*configFile, flagsSet["config"])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if flagsSet["server-id"] {
+		config.ServerID = *serverID
+	}
+	if flagsSet["port"] {
+		config.Port = *port
+	}
+	if err := validateConfig(config); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	exportConfigEnv(config)
+
+	if *issueNode != "" {
+		if err := issueNodeCertificate(config, *issueNode, *nodeHosts, *outDir); err != nil {
+			log.Fatalf("Failed to issue end-node certificate: %v", err)
+		}
+		return
+	}
+	if *revokeNode != "" {
+		if err := revokeNodeCertificates(config, *revokeNode); err != nil {
+			log.Fatalf("Failed to revoke end-node certificates: %v", err)
+		}
+		return
+	}
+
+	if *checkConfig {
+		masked, err := shared.MaskedConfig(config)
+		if err != nil {
+			log.Fatalf("Failed to render configuration: %v", err)
+		}
+		fmt.Println(string(masked))
+	}
+
 	// Validate environment variables before proceeding
 	if _, err := shared.ValidateEnvironment(); err != nil {
 		log.Fatalf("❌ Environment validation failed: %v", err)
@@ -49,10 +100,9 @@ func main() {
 		log.Fatalf("[STARTUP] ❌ Production validation failed: %v", err)
 	}
 
-	// Load configuration
-	config, err := loadConfig(*configFile)
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+	if *checkConfig {
+		log.Println("✅ Configuration is valid")
+		return
 	}
 
 	// Connect to database
@@ -70,6 +120,13 @@ func main() {
 	}
 	log.Println("[DB] ✅ Database migrations completed successfully")
 
+	if *issueCred != "" {
+		if err := issueNodeCredential(db, config.ServerID, *issueCred); err != nil {
+			log.Fatalf("Failed to issue end-node credential: %v", err)
+		}
+		return
+	}
+
 	// Initialize rate limiter
 	rateLimiter, err := shared.NewRateLimiter()
 	if err != nil {
@@ -86,31 +143,47 @@ func main() {
 	userManager := shared.NewUserManager(db)
 	serverManager := shared.NewServerManager(db)
 	auditManager := shared.NewAuditManager(db)
+	certManager := shared.NewCertificateManager(db)
+	profileManager := shared.NewServerProfileManager(db)
+	clientConfigManager := shared.NewClientConfigManager(db)
+	routeProfileManager := shared.NewRouteProfileManager(db)
+	usageManager := shared.NewUsageManager(db)
+	sessionLimitManager := shared.NewSessionLimitManager(db)
+	quotaManager := shared.NewQuotaManager(db)
+	bandwidthLimitManager := shared.NewBandwidthLimitManager(db)
+	nodeCredentialManager := shared.NewNodeCredentialManager(db)
+	enrollmentTokenManager := shared.NewEnrollmentTokenManager(db)
 
 	// Create management server manager
 	managementManager := manager.NewManagementManager(
-		*serverID,
+		config.ServerID,
 		config,
 		userManager,
 		serverManager,
 		auditManager,
+		certManager,
+		profileManager,
+		clientConfigManager,
+		routeProfileManager,
+		usageManager,
+		sessionLimitManager,
+		quotaManager,
+		bandwidthLimitManager,
+		nodeCredentialManager,
+		enrollmentTokenManager,
 	)
 
+	// Calls to end-nodes and the node API use mutual TLS when a node CA is configured
+	if err := managementManager.EnableNodeTLS(); err != nil {
+		log.Fatalf("Failed to set up mutual TLS with end-nodes: %v", err)
+	}
+
 	// Start API server with rate limiter
 	apiServer := api.NewManagementAPI(managementManager, rateLimiter)
-	
-	// Get port from environment variable or use default
-	port := 8080
-	if portStr := os.Getenv("MANAGEMENT_PORT"); portStr != "" {
-		if p, err := fmt.Sscanf(portStr, "%d", &port); err != nil || p != 1 {
-			log.Printf("[WARN] Invalid MANAGEMENT_PORT '%s', using default 8080", portStr)
-			port = 8080
-		}
-	}
-	
+
 	// Start the API server in a goroutine
 	go func() {
-		if err := apiServer.Start(port); err != nil {
+		if err := apiServer.Start(config.Port, config.NodeAPIPort); err != nil {
 			log.Fatalf("Failed to start API server: %v", err)
 		}
 	}()
@@ -121,8 +194,11 @@ func main() {
 	// Start user sync coordination
 	go managementManager.StartUserSyncCoordination()
 
-	log.Printf("Management server started with ID: %s", *serverID)
-	log.Printf("API server running on port %d", port)
+	// Start data quota enforcement
+	go managementManager.StartQuotaEnforcement()
+
+	log.Printf("Management server started with ID: %s", config.ServerID)
+	log.Printf("API server running on port %d", config.Port)
 	log.Printf("Database: %s:%d/%s", config.Database.Host, config.Database.Port, config.Database.DBName)
 
 	// Wait for shutdown signal
@@ -133,21 +209,186 @@ func main() {
 	log.Println("Shutting down management server...")
 }
 
-func loadConfig(configFile string) (*shared.ManagementConfig, error) {
-	// For now, return a default config
-	// In production, this would load from JSON file
-	return &shared.ManagementConfig{
-		ServerID: "management-server",
-		APIKey:   os.Getenv("API_KEY"),
+// loadConfig loads the configuration file over the defaults, then applies environment
+// variables. The file may only be missing when its path was not given explicitly.
+func loadConfig(configFile string, required bool) (*shared.ManagementConfig, error) {
+	config := &shared.ManagementConfig{
+		ServerID:           "management-server",
+		Port:               8080,
+		SessionLimitPolicy: shared.SessionPolicyReject,
+		QuotaWarnPercents:  []int{80, 90},
+		NodeAPIPort:        8443,
 		Database: shared.DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     5432,
-			User:     getEnv("DB_USER", "barqnet"),
-			Password: getEnv("DB_PASSWORD", ""),
-			DBName:   getEnv("DB_NAME", "barqnet"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			// Host, port, user, password and name have no defaults; see ValidateEnvironment
+			SSLMode: "disable",
 		},
-	}, nil
+	}
+
+	if err := shared.LoadConfigFile(configFile, config); err != nil {
+		if !os.IsNotExist(err) || required {
+			return nil, err
+		}
+	} else {
+		log.Printf("[CONFIG] ✅ Loaded configuration from %s", configFile)
+	}
+
+	shared.EnvString("API_KEY", &config.APIKey)
+	shared.EnvString("DB_HOST", &config.Database.Host)
+	shared.EnvString("DB_USER", &config.Database.User)
+	shared.EnvString("DB_PASSWORD", &config.Database.Password)
+	shared.EnvString("DB_NAME", &config.Database.DBName)
+	shared.EnvString("DB_SSLMODE", &config.Database.SSLMode)
+	shared.EnvString("SESSION_LIMIT_POLICY", &config.SessionLimitPolicy)
+	shared.EnvString("NODE_CA_DIR", &config.NodeCADir)
+	for key, value := range map[string]*int{
+		"DB_PORT":               &config.Database.Port,
+		"MANAGEMENT_PORT":       &config.Port,
+		"MAX_SESSIONS_PER_USER": &config.MaxSessionsPerUser,
+		"NODE_API_PORT":         &config.NodeAPIPort,
+	} {
+		if err := shared.EnvInt(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if value := os.Getenv("DATA_QUOTA_WARN_PERCENT"); value != "" {
+		quotaWarnings, err := shared.ParseQuotaWarnings(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DATA_QUOTA_WARN_PERCENT: %v", err)
+		}
+		config.QuotaWarnPercents = quotaWarnings
+	}
+	if value := os.Getenv("NODE_TLS_HOSTS"); value != "" {
+		config.NodeTLSHosts = splitList(value)
+	}
+
+	return config, nil
+}
+
+// validateConfig checks the effective configuration, whichever layer a setting came from
+func validateConfig(config *shared.ManagementConfig) error {
+	if config.ServerID == "" {
+		return fmt.Errorf("server_id must not be empty")
+	}
+	if config.Port < 1 || config.Port > 65535 {
+		return fmt.Errorf("port %d must be between 1 and 65535", config.Port)
+	}
+	// The database port has no default, so it must come from database.port or DB_PORT
+	if config.Database.Port < 1 || config.Database.Port > 65535 {
+		return fmt.Errorf("database port %d must be between 1 and 65535, set database.port or DB_PORT", config.Database.Port)
+	}
+	if config.MaxSessionsPerUser < 0 {
+		return fmt.Errorf("max_sessions_per_user must not be negative")
+	}
+	if err := shared.ValidateSessionPolicy(config.SessionLimitPolicy); err != nil {
+		return fmt.Errorf("invalid session_limit_policy: %v", err)
+	}
+	if err := shared.ValidateQuotaWarnings(config.QuotaWarnPercents); err != nil {
+		return fmt.Errorf("invalid quota_warn_percents: %v", err)
+	}
+	sort.Ints(config.QuotaWarnPercents)
+
+	// "none" disables mutual TLS with end-nodes
+	if config.NodeCADir == "none" {
+		config.NodeCADir = ""
+	}
+	if config.NodeCADir != "" {
+		if len(config.NodeTLSHosts) == 0 {
+			return fmt.Errorf("node_tls_hosts must name the hosts end-nodes reach the node API on")
+		}
+		if config.NodeAPIPort < 1 || config.NodeAPIPort > 65535 || config.NodeAPIPort == config.Port {
+			return fmt.Errorf("node_api_port %d must be between 1 and 65535 and differ from port", config.NodeAPIPort)
+		}
+	}
+	return nil
+}
+
+// issueNodeCertificate issues a mutual TLS certificate for an end-node from the node CA
+func issueNodeCertificate(config *shared.ManagementConfig, serverID, hosts, outDir string) error {
+	if config.NodeCADir == "" {
+		return fmt.Errorf("no node CA configured, set NODE_CA_DIR or node_ca_dir")
+	}
+	if len(splitList(hosts)) == 0 {
+		return fmt.Errorf("-node-hosts must name the hosts the end-node API is reached on")
+	}
+
+	paths, err := manager.IssueNodeCertificate(config.NodeCADir, serverID, splitList(hosts), outDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Issued end-node certificate for %s. Copy these files to the end-node and point\n", serverID)
+	fmt.Println("NODE_TLS_CA_FILE, NODE_TLS_CERT_FILE and NODE_TLS_KEY_FILE at them:")
+	for _, path := range paths {
+		fmt.Printf("  %s\n", path)
+	}
+	return nil
+}
+
+// revokeNodeCertificates revokes the mutual TLS certificates of an end-node in the node CA
+func revokeNodeCertificates(config *shared.ManagementConfig, serverID string) error {
+	if config.NodeCADir == "" {
+		return fmt.Errorf("no node CA configured, set NODE_CA_DIR or node_ca_dir")
+	}
+
+	revoked, err := manager.RevokeNodeCertificates(config.NodeCADir, serverID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Revoked %d certificate(s) of end-node %s; the node API refuses them from now on:\n", len(revoked), serverID)
+	for _, serial := range revoked {
+		fmt.Printf("  serial %X\n", serial)
+	}
+	return nil
+}
+
+// issueNodeCredential issues a new request signing credential for an end-node, replacing
+// its previous one, and prints it for the end-node's NODE_SECRET
+func issueNodeCredential(db *shared.DB, managementID, serverID string) error {
+	secret, err := shared.NewNodeCredentialManager(db).IssueCredential(serverID)
+	if err != nil {
+		return err
+	}
+	shared.NewAuditManager(db).LogAction(
+		"NODE_CREDENTIAL_ISSUED",
+		serverID,
+		fmt.Sprintf("request signing credential issued for end-node '%s'", serverID),
+		"",
+		managementID,
+	)
+
+	fmt.Printf("Issued credential for end-node %s. Set it as NODE_SECRET (node_secret) on the\n", serverID)
+	fmt.Println("end-node; a previous credential of the end-node no longer works:")
+	fmt.Printf("  %s\n", secret)
+	return nil
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// exportConfigEnv sets the environment variables that are still read directly, and checked
+// by ValidateEnvironment, to the effective settings
+func exportConfigEnv(config *shared.ManagementConfig) {
+	vars := map[string]string{
+		"API_KEY":     config.APIKey,
+		"DB_HOST":     config.Database.Host,
+		"DB_USER":     config.Database.User,
+		"DB_PASSWORD": config.Database.Password,
+		"DB_PORT":     strconv.Itoa(config.Database.Port),
+		"DB_NAME":     config.Database.DBName,
+		"DB_SSLMODE":  config.Database.SSLMode,
+	}
+	for key, value := range vars {
+		if value != "" {
+			os.Setenv(key, value)
+		}
+	}
 }
 
 func getEnv(key, defaultValue string) string {
@@ -166,19 +407,62 @@ func showHelp() {
 	fmt.Println("")
 	fmt.Println("Options:")
 	fmt.Println("  -config string")
-	fmt.Println("        Configuration file path (default: management-config.json)")
+	fmt.Println("        Configuration file path, JSON or YAML by extension (.yaml, .yml) (default: management-config.json)")
 	fmt.Println("  -server-id string")
 	fmt.Println("        Server ID for management server (default: management-server)")
+	fmt.Println("  -port int")
+	fmt.Println("        API server port (default: 8080)")
+	fmt.Println("  -check-config")
+	fmt.Println("        Print the effective configuration with secrets masked and exit")
+	fmt.Println("  -issue-node-cert string")
+	fmt.Println("        Issue a mutual TLS certificate for the end-node with this server ID from the node CA and exit")
+	fmt.Println("  -node-hosts string")
+	fmt.Println("        Comma separated hosts the management server reaches the end-node API on, for -issue-node-cert")
+	fmt.Println("  -out string")
+	fmt.Println("        Directory -issue-node-cert writes the certificate, key and node CA to (default: .)")
+	fmt.Println("  -issue-node-credential string")
+	fmt.Println("        Issue a request signing credential for the end-node with this server ID, replacing its previous one, print it and exit")
+	fmt.Println("  -revoke-node-cert string")
+	fmt.Println("        Revoke every mutual TLS certificate the node CA issued to the end-node with this server ID and exit")
 	fmt.Println("  -help")
 	fmt.Println("        Show this help message")
 	fmt.Println("")
+	fmt.Println("Configuration:")
+	fmt.Println("  Settings are read from the JSON or YAML config file, then from environment variables,")
+	fmt.Println("  then from command line flags; each overrides the one before. Unknown keys in")
+	fmt.Println("  the config file are rejected. The config file may be missing unless -config is given.")
+	fmt.Println("")
 	fmt.Println("Environment Variables:")
 	fmt.Println("  API_KEY              API key for authentication")
-	fmt.Println("  DB_HOST              Database host (default: localhost)")
-	fmt.Println("  DB_USER              Database user (default: barqnet)")
+	fmt.Println("  MANAGEMENT_PORT      API server port (default: 8080)")
+	fmt.Println("  DB_HOST              Database host")
+	fmt.Println("  DB_PORT              Database port")
+	fmt.Println("  DB_USER              Database user")
 	fmt.Println("  DB_PASSWORD          Database password")
-	fmt.Println("  DB_NAME              Database name (default: barqnet)")
+	fmt.Println("  DB_NAME              Database name")
 	fmt.Println("  DB_SSLMODE           Database SSL mode (default: disable)")
+	fmt.Println("  MAX_SESSIONS_PER_USER  Concurrent VPN sessions per user across end-nodes, unless set per user or plan (default: 0, no limit)")
+	fmt.Println("  SESSION_LIMIT_POLICY   When a user at the limit connects: reject or kick-oldest (default: reject)")
+	fmt.Println("  DATA_QUOTA_WARN_PERCENT  Data quota usage in percent at which users are warned (default: 80,90)")
+	fmt.Println("")
+	fmt.Println("Mutual TLS with end-nodes:")
+	fmt.Println("  NODE_CA_DIR          Internal CA end-node certificates are issued from, created on first use (default: none, plain HTTP)")
+	fmt.Println("  NODE_TLS_HOSTS       Comma separated hosts end-nodes reach the node API on, put in the management certificate")
+	fmt.Println("  NODE_API_PORT        Port end-nodes call over mutual TLS; the API port then refuses end-node endpoints (default: 8443)")
+	fmt.Println("  The node API only accepts node certificates the node CA holds as valid; revoke them with")
+	fmt.Println("  -revoke-node-cert. A certificate alone identifies an end-node only while it also holds")
+	fmt.Println("  a credential (-issue-node-credential or enrollment), even if it does not sign with it.")
+	fmt.Println("")
+	fmt.Println("Request signing:")
+	fmt.Println("  Calls to and from an end-node issued a credential with -issue-node-credential are signed")
+	fmt.Println("  with it (HMAC over method, path, body hash, timestamp and nonce) instead of carrying")
+	fmt.Println("  API_KEY; replays and requests more than 5 minutes off are rejected. End-node endpoints")
+	fmt.Println("  only accept requests signed with a credential or made with a node certificate, and only")
+	fmt.Println("  for the end-node's own server ID; rejected attempts are audit-logged.")
+	fmt.Println("  New end-nodes can instead enroll with a single-use token minted by an admin with")
+	fmt.Println("  POST /api/enrollment-tokens, optionally pinned to a server ID and location; they")
+	fmt.Println("  exchange it at first boot for their credential. Tokens are listed with GET and revoked")
+	fmt.Println("  with DELETE /api/enrollment-tokens/{id}.")
 	fmt.Println("")
 	fmt.Println("Rate Limiting:")
 	fmt.Println("  RATE_LIMIT_ENABLED   Enable rate limiting (default: true)")
@@ -190,4 +474,6 @@ func showHelp() {
 	fmt.Println("Examples:")
 	fmt.Println("  vpnmanager-management")
 	fmt.Println("  vpnmanager-management -server-id main-management")
+	fmt.Println("  vpnmanager-management -config /etc/vpnmanager/management-config.json -check-config")
+	fmt.Println("  vpnmanager-management -issue-node-cert server-1 -node-hosts vpn1.example.com,10.0.0.5 -out ./server-1")
 }
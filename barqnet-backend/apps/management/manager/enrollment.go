@@ -0,0 +1,79 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// CreateEnrollmentToken mints a single-use enrollment token valid for ttl. The returned token
+// is only available now; management keeps a hash of it.
+func (mm *ManagementManager) CreateEnrollmentToken(t *shared.EnrollmentToken, ttl time.Duration, actor string) (string, error) {
+	t.CreatedBy = actor
+	token, err := mm.enrollmentTokenManager.CreateToken(t, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	target := "any new server ID"
+	if t.ServerID != "" {
+		target = "server ID " + t.ServerID
+	}
+	if t.LocationID > 0 {
+		target += fmt.Sprintf(" in location %d", t.LocationID)
+	}
+	mm.auditManager.LogAction(
+		"ENROLLMENT_TOKEN_CREATED",
+		actor,
+		fmt.Sprintf("enrollment token %d created for %s - expires=%s", t.ID, target, t.ExpiresAt.Format(time.RFC3339)),
+		"",
+		mm.serverID,
+	)
+	return token, nil
+}
+
+// ListEnrollmentTokens returns all enrollment tokens, newest first
+func (mm *ManagementManager) ListEnrollmentTokens() ([]shared.EnrollmentToken, error) {
+	return mm.enrollmentTokenManager.ListTokens()
+}
+
+// RevokeEnrollmentToken revokes an enrollment token that was not used yet
+func (mm *ManagementManager) RevokeEnrollmentToken(id int, actor string) error {
+	if err := mm.enrollmentTokenManager.RevokeToken(id); err != nil {
+		return err
+	}
+	mm.auditManager.LogAction(
+		"ENROLLMENT_TOKEN_REVOKED",
+		actor,
+		fmt.Sprintf("enrollment token %d revoked", id),
+		"",
+		mm.serverID,
+	)
+	return nil
+}
+
+// EnrollEndNode exchanges an enrollment token for the credential of the end-node serverID.
+// Every attempt is audit-logged.
+func (mm *ManagementManager) EnrollEndNode(token, serverID, ipAddress string) (string, error) {
+	secret, t, err := mm.enrollmentTokenManager.Enroll(token, serverID)
+	if err != nil {
+		mm.auditManager.LogAction(
+			"ENDNODE_ENROLLMENT_REJECTED",
+			serverID,
+			fmt.Sprintf("end-node enrollment as '%s' rejected: %v", serverID, err),
+			ipAddress,
+			mm.serverID,
+		)
+		return "", err
+	}
+
+	mm.auditManager.LogAction(
+		"ENDNODE_ENROLLED",
+		serverID,
+		fmt.Sprintf("end-node '%s' enrolled with enrollment token %d created by %s", serverID, t.ID, t.CreatedBy),
+		ipAddress,
+		mm.serverID,
+	)
+	return secret, nil
+}
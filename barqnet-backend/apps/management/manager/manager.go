@@ -2,13 +2,17 @@ package manager
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"strings"
+	"sync"
 	"time"
 
+	"barqnet-backend/pkg/pki"
 	"barqnet-backend/pkg/shared"
 )
 
@@ -19,7 +23,29 @@ type ManagementManager struct {
 	userManager   *shared.UserManager
 	serverManager *shared.ServerManager
 	auditManager  *shared.AuditManager
+	certManager   *shared.CertificateManager
+	profileManager *shared.ServerProfileManager
+	clientConfigManager *shared.ClientConfigManager
+	routeProfileManager *shared.RouteProfileManager
+	usageManager  *shared.UsageManager
+	sessionLimitManager *shared.SessionLimitManager
+	quotaManager  *shared.QuotaManager
+	bandwidthLimitManager *shared.BandwidthLimitManager
+	nodeCredentialManager *shared.NodeCredentialManager
+	enrollmentTokenManager *shared.EnrollmentTokenManager
 	httpClient    *http.Client
+
+	// Nonces of signed requests from end-nodes, see signing.go
+	requestVerifier *shared.RequestVerifier
+
+	// Mutual TLS with end-nodes, see EnableNodeTLS
+	nodeTLS       shared.NodeTLSConfig
+	nodeTransport http.RoundTripper
+	nodeCA        *pki.PKI
+
+	// Last health status reported by each end-node, to log changes only
+	healthMu     sync.Mutex
+	healthStatus map[string]string
 }
 
 // NewManagementManager creates a new management manager
@@ -29,6 +55,16 @@ func NewManagementManager(
 	userManager *shared.UserManager,
 	serverManager *shared.ServerManager,
 	auditManager *shared.AuditManager,
+	certManager *shared.CertificateManager,
+	profileManager *shared.ServerProfileManager,
+	clientConfigManager *shared.ClientConfigManager,
+	routeProfileManager *shared.RouteProfileManager,
+	usageManager *shared.UsageManager,
+	sessionLimitManager *shared.SessionLimitManager,
+	quotaManager *shared.QuotaManager,
+	bandwidthLimitManager *shared.BandwidthLimitManager,
+	nodeCredentialManager *shared.NodeCredentialManager,
+	enrollmentTokenManager *shared.EnrollmentTokenManager,
 ) *ManagementManager {
 	return &ManagementManager{
 		serverID:      serverID,
@@ -36,9 +72,21 @@ func NewManagementManager(
 		userManager:   userManager,
 		serverManager: serverManager,
 		auditManager:  auditManager,
+		certManager:   certManager,
+		profileManager: profileManager,
+		clientConfigManager: clientConfigManager,
+		routeProfileManager: routeProfileManager,
+		usageManager:  usageManager,
+		sessionLimitManager: sessionLimitManager,
+		quotaManager:  quotaManager,
+		bandwidthLimitManager: bandwidthLimitManager,
+		nodeCredentialManager: nodeCredentialManager,
+		enrollmentTokenManager: enrollmentTokenManager,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		healthStatus: make(map[string]string),
+		requestVerifier: shared.NewRequestVerifier(),
 	}
 }
 
@@ -47,11 +95,70 @@ func (mm *ManagementManager) StartEndNodeMonitoring() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		if err := mm.checkEndNodeHealth(); err != nil {
-			log.Printf("End-node health check failed: %v", err)
+	pruneTicker := time.NewTicker(24 * time.Hour)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := mm.checkEndNodeHealth(); err != nil {
+				log.Printf("End-node health check failed: %v", err)
+			}
+		case <-pruneTicker.C:
+			// End-nodes report every 30 seconds; a week of history is plenty for dashboards
+			if pruned, err := mm.serverManager.PruneHealth(7); err != nil {
+				log.Printf("Warning: Failed to prune health reports: %v", err)
+			} else if pruned > 0 {
+				log.Printf("Pruned %d health reports older than 7 days", pruned)
+			}
+		}
+	}
+}
+
+// RecordEndNodeHealth stores a health report with the resource metrics of an end-node.
+// Status changes are logged and audited; reports without metrics come from older end-nodes.
+func (mm *ManagementManager) RecordEndNodeHealth(report *shared.HealthReport) error {
+	if report.Status == "" {
+		report.Status = shared.HealthStatusHealthy
+		if report.Metrics != nil {
+			report.Status, report.Error = report.Metrics.HealthStatus()
 		}
 	}
+
+	if err := mm.serverManager.RecordHealth(report); err != nil {
+		return err
+	}
+
+	mm.healthMu.Lock()
+	previous, known := mm.healthStatus[report.ServerID]
+	mm.healthStatus[report.ServerID] = report.Status
+	mm.healthMu.Unlock()
+
+	if known && previous == report.Status {
+		return nil
+	}
+
+	if report.Status == shared.HealthStatusHealthy {
+		log.Printf("✅ End-node %s is healthy", report.ServerID)
+	} else {
+		log.Printf("⚠️  End-node %s is %s: %s", report.ServerID, report.Status, report.Error)
+	}
+	if known {
+		mm.auditManager.LogAction(
+			"ENDNODE_HEALTH_CHANGED",
+			report.ServerID,
+			strings.TrimSuffix(fmt.Sprintf("end-node status changed from %s to %s - %s", previous, report.Status, report.Error), " - "),
+			"",
+			mm.serverID,
+		)
+	}
+
+	return nil
+}
+
+// GetEndNodeHealth returns the latest health report of an end-node
+func (mm *ManagementManager) GetEndNodeHealth(serverID string) (*shared.ServerHealth, error) {
+	return mm.serverManager.GetLatestHealth(serverID)
 }
 
 // checkEndNodeHealth checks the health of all end-node servers
@@ -72,7 +179,7 @@ func (mm *ManagementManager) checkEndNodeHealth() error {
 
 // checkSingleEndNode checks the health of a single end-node
 func (mm *ManagementManager) checkSingleEndNode(endNode shared.Server) error {
-	url := fmt.Sprintf("http://%s:%d/health", endNode.Host, endNode.Port)
+	url := mm.EndNodeURL(endNode.Host, endNode.Port, "/health")
 
 	start := time.Now()
 	resp, err := mm.httpClient.Get(url)
@@ -101,7 +208,9 @@ func (mm *ManagementManager) checkSingleEndNode(endNode shared.Server) error {
 	return nil
 }
 
-// StartUserSyncCoordination starts coordinating user sync across end-nodes
+// StartUserSyncCoordination starts watching end-node reconciliation.
+// End-nodes pull the desired user set and converge on their own; management only
+// flags nodes that have stopped reporting.
 func (mm *ManagementManager) StartUserSyncCoordination() {
 	ticker := time.NewTicker(60 * time.Second)
 	defer ticker.Stop()
@@ -113,50 +222,36 @@ func (mm *ManagementManager) StartUserSyncCoordination() {
 	}
 }
 
-// coordinateUserSync coordinates user synchronization across all end-nodes
+// coordinateUserSync logs end-nodes whose last reconciliation is missing or stale
 func (mm *ManagementManager) coordinateUserSync() error {
-	// Get all users from all end-nodes
-	allUsers, err := mm.userManager.ListUsers()
-	if err != nil {
-		return fmt.Errorf("failed to list all users: %v", err)
-	}
-
-	// Get all end-nodes
 	endNodes, err := mm.serverManager.ListEndNodes()
 	if err != nil {
 		return fmt.Errorf("failed to list end-nodes: %v", err)
 	}
 
-	// Sync users to each end-node
 	for _, endNode := range endNodes {
-		if err := mm.syncUsersToEndNode(endNode, allUsers); err != nil {
-			log.Printf("Failed to sync users to end-node %s: %v", endNode.Name, err)
+		report, err := mm.serverManager.GetLatestReconciliation(endNode.Name)
+		if err == sql.ErrNoRows {
+			log.Printf("End-node %s has not reported a reconciliation yet", endNode.Name)
+			continue
 		}
-	}
-
-	return nil
-}
-
-// syncUsersToEndNode syncs users to a specific end-node
-func (mm *ManagementManager) syncUsersToEndNode(endNode shared.Server, users []shared.User) error {
-	// Filter users that belong to this end-node or need to be synced
-	var usersToSync []shared.User
-	for _, user := range users {
-		if user.ServerID == endNode.Name || !user.Synced {
-			usersToSync = append(usersToSync, user)
+		if err != nil {
+			log.Printf("Failed to get reconciliation for end-node %s: %v", endNode.Name, err)
+			continue
 		}
-	}
-
-	// Send sync request to end-node
-	for _, user := range usersToSync {
-		if err := mm.syncUserToEndNode(endNode, user); err != nil {
-			log.Printf("Failed to sync user %s to end-node %s: %v", user.Username, endNode.Name, err)
+		if time.Since(report.ReconciledAt) > reconciliationStaleAfter {
+			log.Printf("Warning: End-node %s last reconciled %s ago (version %s)",
+				endNode.Name, time.Since(report.ReconciledAt).Round(time.Minute), report.Version)
 		}
 	}
 
 	return nil
 }
 
+// reconciliationStaleAfter is how long an end-node may go without reporting a
+// reconciliation; end-nodes report at least hourly even without drift
+const reconciliationStaleAfter = 2 * time.Hour
+
 // createOVPNOnEndNode creates an OVPN file on a specific end-node
 // The endnode generates real certificates using EasyRSA - we only send metadata
 func (mm *ManagementManager) createOVPNOnEndNode(endNode shared.Server, user shared.User) error {
@@ -166,7 +261,7 @@ func (mm *ManagementManager) createOVPNOnEndNode(endNode shared.Server, user sha
 		"port":               user.Port,
 		"protocol":           user.Protocol,
 		"server_id":          endNode.Name,
-		"server_ip":          endNode.Host,
+		"server_ip":          endNode.PublicEndpoint(),
 		"generate_certs":     true, // Signal endnode to generate real certs
 	}
 
@@ -175,18 +270,15 @@ func (mm *ManagementManager) createOVPNOnEndNode(endNode shared.Server, user sha
 		return fmt.Errorf("failed to marshal request data: %v", err)
 	}
 
-	url := fmt.Sprintf("http://%s:%d/api/ovpn/create", endNode.Host, endNode.Port)
+	url := mm.EndNodeURL(endNode.Host, endNode.Port, "/api/ovpn/create")
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	
-	// SECURITY: Add API key authentication for endnode communication
-	apiKey := os.Getenv("API_KEY")
-	if apiKey != "" {
-		req.Header.Set("X-API-Key", apiKey)
+	if err := mm.AuthorizeEndNodeRequest(req, endNode.Name); err != nil {
+		return err
 	}
 
 	resp, err := mm.httpClient.Do(req)
@@ -208,56 +300,6 @@ func (mm *ManagementManager) createOVPNOnEndNode(endNode shared.Server, user sha
 }
 
 
-// syncUserToEndNode syncs a single user to an end-node
-func (mm *ManagementManager) syncUserToEndNode(endNode shared.Server, user shared.User) error {
-	// Only sync to the target end-node
-	if user.ServerID != endNode.Name {
-		return nil // Skip if user doesn't belong to this end-node
-	}
-
-	userData := map[string]interface{}{
-		"username":   user.Username,
-		"ovpn_path":  fmt.Sprintf("/var/lib/vpnmanager/clients/%s.ovpn", user.Username),
-		"checksum":   user.Checksum,
-		"port":       user.Port,
-		"protocol":   user.Protocol,
-		"server_id":  user.ServerID,
-		"created_by": user.CreatedBy,
-	}
-
-	jsonData, err := json.Marshal(userData)
-	if err != nil {
-		return fmt.Errorf("failed to marshal user data: %v", err)
-	}
-
-	url := fmt.Sprintf("http://%s:%d/api/users", endNode.Host, endNode.Port)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	
-	// SECURITY: Add API key authentication for endnode communication
-	apiKey := os.Getenv("API_KEY")
-	if apiKey != "" {
-		req.Header.Set("X-API-Key", apiKey)
-	}
-
-	resp, err := mm.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to create user on end-node: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("user creation on end-node failed with status: %d", resp.StatusCode)
-	}
-
-	log.Printf("✅ User %s created successfully on end-node %s", user.Username, endNode.Name)
-	return nil
-}
-
 // CreateUser creates a new user and syncs to all end-nodes
 func (mm *ManagementManager) CreateUser(username, ovpnPath, checksum, targetServerID string, port int, protocol string) error {
 	// Add user to database
@@ -317,23 +359,43 @@ func (mm *ManagementManager) ListEndNodes() ([]shared.Server, error) {
 }
 
 // RegisterEndNode registers a new end-node server and syncs existing users
-func (mm *ManagementManager) RegisterEndNode(serverID, host, status string, port int) error {
+func (mm *ManagementManager) RegisterEndNode(serverID, host, status string, port int, publicEndpoints []string, listeners []shared.Listener) error {
 	// Add the end-node to the database
 	if err := mm.serverManager.AddServer(serverID, host, port, "", "", "endnode", ""); err != nil {
 		return fmt.Errorf("failed to add end-node to database: %v", err)
 	}
+	if err := mm.serverManager.SetPublicEndpoints(serverID, publicEndpoints); err != nil {
+		return fmt.Errorf("failed to store public endpoints: %v", err)
+	}
+	if err := mm.serverManager.SetListeners(serverID, listeners); err != nil {
+		return fmt.Errorf("failed to store listeners: %v", err)
+	}
+	// End-nodes enrolled with a token pinned to a location are placed in it
+	if locationID, err := mm.nodeCredentialManager.PinnedLocation(serverID); err != nil {
+		return fmt.Errorf("failed to look up enrolled location: %v", err)
+	} else if locationID > 0 {
+		if err := mm.serverManager.SetLocation(serverID, locationID); err != nil {
+			return fmt.Errorf("failed to store location: %v", err)
+		}
+	}
+
+	transports := make([]string, 0, len(listeners))
+	for _, listener := range listeners {
+		transports = append(transports, listener.String())
+	}
 
 	// Log the registration
 	mm.auditManager.LogAction(
 		"ENDNODE_REGISTERED",
 		serverID,
-		fmt.Sprintf("end-node registered - host=%s port=%d status=%s", host, port, status),
+		fmt.Sprintf("end-node registered - host=%s port=%d status=%s public_endpoints=%s listeners=%s", host, port, status,
+			strings.Join(publicEndpoints, ","), strings.Join(transports, ",")),
 		"",
 		mm.serverID,
 	)
 
 	// Sync all existing users to the new end-node
-	if err := mm.syncAllUsersToNewEndNode(serverID, host, port); err != nil {
+	if err := mm.syncAllUsersToNewEndNode(serverID, host, port, publicEndpoints, listeners); err != nil {
 		log.Printf("Warning: Failed to sync existing users to new end-node %s: %v", serverID, err)
 	}
 
@@ -341,7 +403,7 @@ func (mm *ManagementManager) RegisterEndNode(serverID, host, status string, port
 }
 
 // syncAllUsersToNewEndNode syncs all existing users to a newly registered end-node
-func (mm *ManagementManager) syncAllUsersToNewEndNode(serverID, host string, port int) error {
+func (mm *ManagementManager) syncAllUsersToNewEndNode(serverID, host string, port int, publicEndpoints []string, listeners []shared.Listener) error {
 	log.Printf("Syncing all existing users to new end-node %s (%s:%d)", serverID, host, port)
 	
 	// Get all existing users from the database
@@ -359,9 +421,11 @@ func (mm *ManagementManager) syncAllUsersToNewEndNode(serverID, host string, por
 	
 	// Create a temporary end-node object for the new end-node
 	newEndNode := shared.Server{
-		Name: serverID,
-		Host: host,
-		Port: port,
+		Name:            serverID,
+		Host:            host,
+		Port:            port,
+		PublicEndpoints: publicEndpoints,
+		Listeners:       listeners,
 	}
 	
 	// Sync each user to the new end-node
@@ -416,18 +480,15 @@ func (mm *ManagementManager) syncUserDeletionToAllEndNodes(username string) erro
 
 // syncUserDeletionToEndNode syncs user deletion to a specific end-node
 func (mm *ManagementManager) syncUserDeletionToEndNode(endNode shared.Server, username string) error {
-	url := fmt.Sprintf("http://%s:%d/api/users/%s", endNode.Host, endNode.Port, username)
+	url := mm.EndNodeURL(endNode.Host, endNode.Port, "/api/users/"+username)
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	
-	// SECURITY: Add API key authentication for endnode communication
-	apiKey := os.Getenv("API_KEY")
-	if apiKey != "" {
-		req.Header.Set("X-API-Key", apiKey)
+	if err := mm.AuthorizeEndNodeRequest(req, endNode.Name); err != nil {
+		return err
 	}
 
 	resp, err := mm.httpClient.Do(req)
@@ -478,6 +539,909 @@ func (mm *ManagementManager) RemoveEndNode(serverID string) error {
 	return nil
 }
 
+// RecordCRLPublication stores a CRL publish reported by an end-node
+func (mm *ManagementManager) RecordCRLPublication(pub *shared.CRLPublication) error {
+	if err := mm.serverManager.RecordCRLPublication(pub); err != nil {
+		return fmt.Errorf("failed to record CRL publication: %v", err)
+	}
+
+	mm.auditManager.LogAction(
+		"CRL_PUBLISHED",
+		pub.ServerID,
+		fmt.Sprintf("CRL #%d published - revoked=%d next_update=%s kicked=%d",
+			pub.CRLNumber, pub.RevokedCount, pub.NextUpdate.Format(time.RFC3339), pub.KickedSessions),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// RecordEndNodeAuditEvent adds a validated audit event shipped by an end-node to the audit log.
+// Events an end-node queued while management was unreachable keep the time they happened.
+func (mm *ManagementManager) RecordEndNodeAuditEvent(serverID string, event *shared.EndNodeAuditEvent) error {
+	details := map[string]string{"message": event.Details}
+	if !event.OccurredAt.IsZero() {
+		details["occurred_at"] = event.OccurredAt.UTC().Format(time.RFC3339)
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit details: %v", err)
+	}
+
+	return mm.auditManager.LogAction(strings.ToUpper(event.Action), event.Username, string(data), event.IPAddress, serverID)
+}
+
+// GetLatestCRLPublication returns the most recent CRL publish for an end-node
+func (mm *ManagementManager) GetLatestCRLPublication(serverID string) (*shared.CRLPublication, error) {
+	return mm.serverManager.GetLatestCRLPublication(serverID)
+}
+
+// GetDesiredState returns the versioned user set every end-node should hold
+func (mm *ManagementManager) GetDesiredState() (*shared.DesiredState, error) {
+	users, err := mm.userManager.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %v", err)
+	}
+	return shared.NewDesiredState(users, time.Now()), nil
+}
+
+// GetAccessList returns the user access end-nodes check when a client connects
+func (mm *ManagementManager) GetAccessList() (*shared.AccessList, error) {
+	users, err := mm.userManager.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %v", err)
+	}
+
+	resolved, err := mm.sessionLimitManager.ResolveLimits()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve session limits: %v", err)
+	}
+	overrides := shared.AccessOverrides{
+		MaxSessions:        make(map[string]int, len(resolved)),
+		DefaultMaxSessions: mm.config.MaxSessionsPerUser,
+	}
+	for username, limit := range resolved {
+		overrides.MaxSessions[username] = limit.MaxSessions
+	}
+
+	exceeded, err := mm.quotaManager.ExceededUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users over their data quota: %v", err)
+	}
+	overrides.Blocked = make(map[string]string, len(exceeded))
+	for username := range exceeded {
+		overrides.Blocked[username] = quotaExceededReason
+	}
+
+	overrides.Bandwidth, err = mm.bandwidthLimitManager.ResolveLimits()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve bandwidth limits: %v", err)
+	}
+
+	return shared.NewAccessList(users, overrides, time.Now()), nil
+}
+
+// RecordDriftReport stores a reconciliation pass reported by an end-node.
+// Users whose profile was recreated are marked unsynced so apps fetch the new profile.
+func (mm *ManagementManager) RecordDriftReport(report *shared.DriftReport) error {
+	if err := mm.serverManager.RecordReconciliation(report); err != nil {
+		return fmt.Errorf("failed to record drift report: %v", err)
+	}
+
+	for _, username := range report.Created {
+		if err := mm.userManager.MarkUserUnsynced(username); err != nil {
+			log.Printf("Warning: Failed to mark user %s unsynced after reconciliation: %v", username, err)
+		}
+	}
+
+	if report.HasDrift() {
+		mm.auditManager.LogAction(
+			"USER_DRIFT",
+			report.ServerID,
+			fmt.Sprintf("end-node drift against version %s - missing=%d unexpected=%d created=%d revoked=%d failed=%d",
+				report.Version, len(report.Missing), len(report.Unexpected), len(report.Created), len(report.Revoked), len(report.Failed)),
+			"",
+			mm.serverID,
+		)
+	}
+
+	return nil
+}
+
+// GetLatestReconciliation returns the most recent drift report for an end-node
+func (mm *ManagementManager) GetLatestReconciliation(serverID string) (*shared.DriftReport, error) {
+	return mm.serverManager.GetLatestReconciliation(serverID)
+}
+
+// RecordCertificateReport stores the client certificate inventory reported by an end-node.
+// Users whose certificate was renewed are marked unsynced so apps fetch the new profile.
+func (mm *ManagementManager) RecordCertificateReport(report *shared.CertificateReport) error {
+	if err := mm.certManager.ReplaceCertificates(report.ServerID, report.Certificates); err != nil {
+		return fmt.Errorf("failed to store certificate report: %v", err)
+	}
+
+	for _, username := range report.Renewed {
+		if err := mm.userManager.MarkUserUnsynced(username); err != nil {
+			log.Printf("Warning: Failed to mark user %s unsynced after renewal: %v", username, err)
+			continue
+		}
+
+		mm.auditManager.LogAction(
+			"CERT_RENEWED",
+			username,
+			fmt.Sprintf("client certificate renewed on end-node %s", report.ServerID),
+			"",
+			mm.serverID,
+		)
+	}
+
+	return nil
+}
+
+// RecordSessionUsage stores server-counted session usage reported by an end-node.
+// It returns the number of sessions stored; retried and unknown-user sessions are skipped.
+func (mm *ManagementManager) RecordSessionUsage(serverID string, records []shared.SessionUsage) (int, error) {
+	stored, err := mm.usageManager.RecordServerUsage(serverID, records)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record session usage: %v", err)
+	}
+
+	if skipped := len(records) - stored; skipped > 0 {
+		log.Printf("[USAGE] Stored %d sessions from end-node %s, skipped %d already stored or of unknown users", stored, serverID, skipped)
+	}
+
+	// Finished sessions no longer count against session limits, but do against data quotas
+	users := make(map[string]bool)
+	for _, record := range records {
+		if err := mm.sessionLimitManager.RecordSessionEnd(record.Username, serverID, record.DisconnectedAt); err != nil {
+			log.Printf("[SESSIONS] Warning: Failed to mark %s disconnected from %s: %v", record.Username, serverID, err)
+		}
+		users[record.Username] = true
+	}
+	for username := range users {
+		if _, err := mm.EnforceDataQuota(username); err != nil {
+			log.Printf("[QUOTA] Warning: Failed to check data quota of %s: %v", username, err)
+		}
+	}
+
+	return stored, nil
+}
+
+// ListCertificates returns client certificates across all end-nodes
+func (mm *ManagementManager) ListCertificates(expiringWithin time.Duration) ([]shared.ClientCertificate, error) {
+	return mm.certManager.ListCertificates(expiringWithin)
+}
+
+// ListServerProfiles returns the stored OpenVPN server profiles
+func (mm *ManagementManager) ListServerProfiles() ([]shared.ServerProfile, error) {
+	return mm.profileManager.ListProfiles()
+}
+
+// GetServerProfile returns a stored OpenVPN server profile
+func (mm *ManagementManager) GetServerProfile(id int) (*shared.ServerProfile, error) {
+	return mm.profileManager.GetProfile(id)
+}
+
+// ResolveServerProfile returns the OpenVPN server profile an end-node should run
+func (mm *ManagementManager) ResolveServerProfile(serverID string) (*shared.ServerProfile, error) {
+	return mm.profileManager.ResolveProfile(serverID)
+}
+
+// SaveServerProfile validates and stores an OpenVPN server profile.
+// End-nodes pick up the change on their next sync.
+func (mm *ManagementManager) SaveServerProfile(profile *shared.ServerProfile, actor string) error {
+	if err := mm.profileManager.SaveProfile(profile); err != nil {
+		return err
+	}
+
+	scope := "all end-nodes"
+	if profile.ServerID != "" {
+		scope = "end-node " + profile.ServerID
+	} else if profile.LocationID != 0 {
+		scope = fmt.Sprintf("location %d", profile.LocationID)
+	}
+
+	mm.auditManager.LogAction(
+		"SERVER_PROFILE_UPDATED",
+		actor,
+		fmt.Sprintf("server profile %q (version %s) saved for %s - %s/%d ciphers=%v",
+			profile.Name, profile.Version, scope, profile.Protocol, profile.Port, profile.DataCiphers),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// DeleteServerProfile removes a stored OpenVPN server profile
+func (mm *ManagementManager) DeleteServerProfile(id int, actor string) error {
+	profile, err := mm.profileManager.GetProfile(id)
+	if err != nil {
+		return err
+	}
+	if err := mm.profileManager.DeleteProfile(id); err != nil {
+		return err
+	}
+
+	mm.auditManager.LogAction(
+		"SERVER_PROFILE_DELETED",
+		actor,
+		fmt.Sprintf("server profile %q (id %d) deleted", profile.Name, id),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// RecordServerProfileReport records the outcome of an end-node applying its server profile.
+// Users whose client profile was re-rendered are marked unsynced so apps fetch the new profile.
+func (mm *ManagementManager) RecordServerProfileReport(report *shared.ServerProfileReport) {
+	if !report.Applied {
+		log.Printf("❌ End-node %s failed to apply server profile %s: %s", report.ServerID, report.Version, report.Error)
+		mm.auditManager.LogAction(
+			"SERVER_PROFILE_FAILED",
+			report.ServerID,
+			fmt.Sprintf("end-node could not apply server profile %s: %s", report.Version, report.Error),
+			"",
+			mm.serverID,
+		)
+		return
+	}
+
+	for _, username := range report.Rerendered {
+		if err := mm.userManager.MarkUserUnsynced(username); err != nil {
+			log.Printf("Warning: Failed to mark user %s unsynced after profile change: %v", username, err)
+		}
+	}
+
+	mm.auditManager.LogAction(
+		"SERVER_PROFILE_APPLIED",
+		report.ServerID,
+		fmt.Sprintf("end-node applied server profile %s - restarted=%v rerendered=%d",
+			report.Version, report.Restarted, len(report.Rerendered)),
+		"",
+		mm.serverID,
+	)
+}
+
+// GetClientConfigs returns a user's client-config-dir entries
+func (mm *ManagementManager) GetClientConfigs(username string) ([]shared.ClientConfigEntry, error) {
+	return mm.clientConfigManager.GetEntries(username)
+}
+
+// GetDesiredClientConfigs returns the versioned client-config-dir entries an end-node should hold
+func (mm *ManagementManager) GetDesiredClientConfigs(serverID string) (*shared.ClientConfigSet, error) {
+	return mm.clientConfigManager.DesiredForServer(serverID, time.Now())
+}
+
+// SetClientConfig stores a user's client-config-dir entry after checking it renders against the
+// server profile of every end-node it applies to. End-nodes pick up the change on their next sync.
+func (mm *ManagementManager) SetClientConfig(entry *shared.ClientConfigEntry, actor string) error {
+	if exists, err := mm.userManager.UserExists(entry.Username); err != nil {
+		return err
+	} else if !exists {
+		return sql.ErrNoRows
+	}
+
+	serverIDs := []string{entry.ServerID}
+	if entry.ServerID == "" {
+		endNodes, err := mm.serverManager.ListEndNodes()
+		if err != nil {
+			return fmt.Errorf("failed to list end-nodes: %v", err)
+		}
+		serverIDs = serverIDs[:0]
+		for _, endNode := range endNodes {
+			serverIDs = append(serverIDs, endNode.Name)
+		}
+	} else if exists, err := mm.serverManager.ServerExists(entry.ServerID); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("invalid client config: unknown end-node %s", entry.ServerID)
+	}
+
+	for _, serverID := range serverIDs {
+		profile, err := mm.profileManager.ResolveProfile(serverID)
+		if err != nil {
+			return fmt.Errorf("failed to resolve server profile for %s: %v", serverID, err)
+		}
+		if _, err := shared.RenderCCD(profile, entry); err != nil {
+			return fmt.Errorf("invalid client config for end-node %s: %v", serverID, err)
+		}
+	}
+
+	if err := mm.clientConfigManager.SetEntry(entry); err != nil {
+		return err
+	}
+
+	scope := "all end-nodes"
+	if entry.ServerID != "" {
+		scope = "end-node " + entry.ServerID
+	}
+	mm.auditManager.LogAction(
+		"CCD_UPDATED",
+		actor,
+		fmt.Sprintf("client config for %s set on %s - static_ip=%q routes=%v iroutes=%v",
+			entry.Username, scope, entry.StaticIP, entry.Routes, entry.IRoutes),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// DeleteClientConfig removes a user's client-config-dir entry for an end-node, or for all end-nodes
+func (mm *ManagementManager) DeleteClientConfig(username, serverID, actor string) error {
+	if err := mm.clientConfigManager.DeleteEntry(username, serverID); err != nil {
+		return err
+	}
+
+	scope := "all end-nodes"
+	if serverID != "" {
+		scope = "end-node " + serverID
+	}
+	mm.auditManager.LogAction(
+		"CCD_DELETED",
+		actor,
+		fmt.Sprintf("client config for %s removed from %s", username, scope),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// ListRouteProfiles returns the split-tunnel route profiles with their assignments
+func (mm *ManagementManager) ListRouteProfiles() ([]shared.RouteProfile, error) {
+	return mm.routeProfileManager.ListProfiles()
+}
+
+// GetRouteProfile returns a split-tunnel route profile
+func (mm *ManagementManager) GetRouteProfile(id int) (*shared.RouteProfile, error) {
+	return mm.routeProfileManager.GetProfile(id)
+}
+
+// ResolveRouteProfile returns the route profile baked into a user's client config, nil for the full tunnel
+func (mm *ManagementManager) ResolveRouteProfile(username string) (*shared.RouteProfile, error) {
+	return mm.routeProfileManager.ResolveForUser(username)
+}
+
+// SaveRouteProfile validates and stores a route profile; assigned users get it with their next config
+func (mm *ManagementManager) SaveRouteProfile(rp *shared.RouteProfile, actor string) error {
+	if err := mm.routeProfileManager.SaveProfile(rp); err != nil {
+		return err
+	}
+
+	mm.auditManager.LogAction(
+		"ROUTE_PROFILE_UPDATED",
+		actor,
+		fmt.Sprintf("route profile %q saved - include=%v exclude=%v route_nopull=%v dns=%v",
+			rp.Name, rp.Include, rp.Exclude, rp.RouteNoPull, rp.DNS),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// DeleteRouteProfile removes a route profile; its users fall back to the full tunnel
+func (mm *ManagementManager) DeleteRouteProfile(id int, actor string) error {
+	rp, err := mm.routeProfileManager.GetProfile(id)
+	if err != nil {
+		return err
+	}
+	if err := mm.routeProfileManager.DeleteProfile(id); err != nil {
+		return err
+	}
+
+	mm.auditManager.LogAction(
+		"ROUTE_PROFILE_DELETED",
+		actor,
+		fmt.Sprintf("route profile %q (id %d) deleted", rp.Name, id),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// AssignRouteProfile assigns a route profile to a user or, when username is empty, to a plan
+func (mm *ManagementManager) AssignRouteProfile(id int, username, plan, actor string) error {
+	rp, err := mm.routeProfileManager.GetProfile(id)
+	if err != nil {
+		return err
+	}
+	if username != "" {
+		if exists, err := mm.userManager.UserExists(username); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("invalid assignment: user %s not found", username)
+		}
+	}
+	if err := mm.routeProfileManager.AssignProfile(id, username, plan); err != nil {
+		return err
+	}
+
+	target := "user " + username
+	if plan != "" {
+		target = "plan " + plan
+	}
+	mm.auditManager.LogAction(
+		"ROUTE_PROFILE_ASSIGNED",
+		actor,
+		fmt.Sprintf("route profile %q assigned to %s", rp.Name, target),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// UnassignRouteProfile removes the route profile of a user or, when username is empty, of a plan
+func (mm *ManagementManager) UnassignRouteProfile(username, plan, actor string) error {
+	if err := mm.routeProfileManager.UnassignProfile(username, plan); err != nil {
+		return err
+	}
+
+	target := "user " + username
+	if plan != "" {
+		target = "plan " + plan
+	}
+	mm.auditManager.LogAction(
+		"ROUTE_PROFILE_UNASSIGNED",
+		actor,
+		fmt.Sprintf("route profile removed from %s", target),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// SetUserPlan sets the plan of a user; an empty plan clears it
+func (mm *ManagementManager) SetUserPlan(username, plan, actor string) error {
+	if err := mm.routeProfileManager.SetUserPlan(username, plan); err != nil {
+		return err
+	}
+
+	mm.auditManager.LogAction(
+		"USER_PLAN_UPDATED",
+		actor,
+		fmt.Sprintf("plan of %s set to %q", username, plan),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// liveSessionMaxAge is how long an end-node may go without a health report before
+// the sessions it holds stop counting against session limits
+const liveSessionMaxAge = 2 * time.Minute
+
+// AuthorizeSession checks a connecting user against its concurrent session limit across
+// end-nodes. Under the kick-oldest policy the oldest sessions on other end-nodes are
+// disconnected to make room; otherwise the connection is rejected.
+func (mm *ManagementManager) AuthorizeSession(serverID string, req *shared.ConnectRequest) (*shared.ConnectDecision, error) {
+	maxSessions := mm.config.MaxSessionsPerUser
+	policy := mm.config.SessionLimitPolicy
+
+	limit, err := mm.sessionLimitManager.ResolveForUser(req.Username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve session limit: %v", err)
+	}
+	if limit != nil {
+		maxSessions = limit.MaxSessions
+		if limit.Policy != "" {
+			policy = limit.Policy
+		}
+	}
+
+	now := time.Now()
+	if maxSessions > 0 {
+		sessions, err := mm.sessionLimitManager.LiveSessions(req.Username, serverID, now.Add(-liveSessionMaxAge))
+		if err != nil {
+			return nil, fmt.Errorf("failed to count live sessions: %v", err)
+		}
+
+		if len(sessions) >= maxSessions {
+			if policy != shared.SessionPolicyKickOldest {
+				reason := fmt.Sprintf("session limit of %d reached", maxSessions)
+				mm.auditManager.LogAction(
+					"SESSION_LIMIT_REJECTED",
+					req.Username,
+					fmt.Sprintf("connection on end-node %s rejected - %s", serverID, reason),
+					"",
+					mm.serverID,
+				)
+				return &shared.ConnectDecision{Allowed: false, Reason: reason}, nil
+			}
+
+			for _, session := range shared.SessionsToKick(sessions, maxSessions) {
+				if err := mm.kickSession(session); err != nil {
+					log.Printf("[SESSIONS] ⚠️  Failed to disconnect %s from %s: %v", session.Username, session.ServerID, err)
+					continue
+				}
+				mm.auditManager.LogAction(
+					"SESSION_KICKED",
+					session.Username,
+					fmt.Sprintf("session on end-node %s disconnected for a new session on %s - limit %d", session.ServerID, serverID, maxSessions),
+					"",
+					mm.serverID,
+				)
+			}
+		}
+	}
+
+	if err := mm.sessionLimitManager.RecordSessionStart(req.Username, serverID, req.RealAddress, now); err != nil {
+		log.Printf("[SESSIONS] Warning: Failed to record session of %s on %s: %v", req.Username, serverID, err)
+	}
+
+	return &shared.ConnectDecision{Allowed: true}, nil
+}
+
+// kickSession disconnects a user's session on an end-node and stops counting it.
+// The connecting client waits on it, so an unresponsive end-node is given up on quickly.
+func (mm *ManagementManager) kickSession(session shared.LiveSession) error {
+	endNode, err := mm.serverManager.GetServer(session.ServerID)
+	if err != nil {
+		return fmt.Errorf("failed to find end-node: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	url := mm.EndNodeURL(endNode.Host, endNode.Port, "/api/users/"+session.Username+"/disconnect")
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	if err := mm.AuthorizeEndNodeRequest(req, endNode.Name); err != nil {
+		return err
+	}
+
+	resp, err := mm.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach end-node: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("disconnect on end-node failed with status: %d", resp.StatusCode)
+	}
+
+	return mm.sessionLimitManager.RecordSessionEnd(session.Username, session.ServerID, time.Now())
+}
+
+// ListSessionLimits returns the per-user and per-plan session limits
+func (mm *ManagementManager) ListSessionLimits() ([]shared.SessionLimit, error) {
+	return mm.sessionLimitManager.ListLimits()
+}
+
+// SetSessionLimit saves the session limit of a user or plan; end-nodes pick it up with the access list
+func (mm *ManagementManager) SetSessionLimit(limit *shared.SessionLimit, actor string) error {
+	if limit.Username != "" {
+		if exists, err := mm.userManager.UserExists(limit.Username); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("invalid session limit: user %s not found", limit.Username)
+		}
+	}
+	if err := mm.sessionLimitManager.SetLimit(limit); err != nil {
+		return err
+	}
+
+	target := "user " + limit.Username
+	if limit.Plan != "" {
+		target = "plan " + limit.Plan
+	}
+	mm.auditManager.LogAction(
+		"SESSION_LIMIT_UPDATED",
+		actor,
+		fmt.Sprintf("session limit of %s set to %d - policy=%q", target, limit.MaxSessions, limit.Policy),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// DeleteSessionLimit removes the session limit of a user or, when username is empty, of a plan
+func (mm *ManagementManager) DeleteSessionLimit(username, plan, actor string) error {
+	if err := mm.sessionLimitManager.DeleteLimit(username, plan); err != nil {
+		return err
+	}
+
+	target := "user " + username
+	if plan != "" {
+		target = "plan " + plan
+	}
+	mm.auditManager.LogAction(
+		"SESSION_LIMIT_DELETED",
+		actor,
+		fmt.Sprintf("session limit removed from %s", target),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// ListBandwidthLimits returns the per-user and per-plan bandwidth limits
+func (mm *ManagementManager) ListBandwidthLimits() ([]shared.BandwidthLimit, error) {
+	return mm.bandwidthLimitManager.ListLimits()
+}
+
+// SetBandwidthLimit saves the bandwidth limit of a user or plan; end-nodes pick it up with the
+// access list and reshape connected sessions
+func (mm *ManagementManager) SetBandwidthLimit(limit *shared.BandwidthLimit, actor string) error {
+	if limit.Username != "" {
+		if exists, err := mm.userManager.UserExists(limit.Username); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("invalid bandwidth limit: user %s not found", limit.Username)
+		}
+	}
+	if err := mm.bandwidthLimitManager.SetLimit(limit); err != nil {
+		return err
+	}
+
+	target := "user " + limit.Username
+	if limit.Plan != "" {
+		target = "plan " + limit.Plan
+	}
+	mm.auditManager.LogAction(
+		"BANDWIDTH_LIMIT_UPDATED",
+		actor,
+		fmt.Sprintf("bandwidth limit of %s set - down=%dkbps up=%dkbps", target, limit.DownKbps, limit.UpKbps),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// DeleteBandwidthLimit removes the bandwidth limit of a user or, when username is empty, of a plan
+func (mm *ManagementManager) DeleteBandwidthLimit(username, plan, actor string) error {
+	if err := mm.bandwidthLimitManager.DeleteLimit(username, plan); err != nil {
+		return err
+	}
+
+	target := "user " + username
+	if plan != "" {
+		target = "plan " + plan
+	}
+	mm.auditManager.LogAction(
+		"BANDWIDTH_LIMIT_DELETED",
+		actor,
+		fmt.Sprintf("bandwidth limit removed from %s", target),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// quotaExceededReason is why end-nodes reject users over their data quota
+const quotaExceededReason = "data quota exceeded"
+
+// StartQuotaEnforcement re-checks all data quotas every 5 minutes, so users are unblocked
+// when a new month starts or old traffic leaves their rolling window
+func (mm *ManagementManager) StartQuotaEnforcement() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		quotas, err := mm.quotaManager.ListQuotas()
+		if err != nil {
+			log.Printf("[QUOTA] Warning: Failed to list data quotas: %v", err)
+			continue
+		}
+		for i := range quotas {
+			if _, err := mm.enforceQuota(&quotas[i]); err != nil {
+				log.Printf("[QUOTA] Warning: Failed to check data quota of %s: %v", quotas[i].Username, err)
+			}
+		}
+	}
+}
+
+// EnforceDataQuota checks a user's usage against its data quota: it warns at the configured
+// thresholds, and blocks the user on every end-node once the quota is used up.
+// It returns nil if the user has no quota.
+func (mm *ManagementManager) EnforceDataQuota(username string) (*shared.QuotaStatus, error) {
+	quota, err := mm.quotaManager.GetQuota(username)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mm.enforceQuota(quota)
+}
+
+// enforceQuota checks a data quota and applies warnings, blocks and unblocks
+func (mm *ManagementManager) enforceQuota(quota *shared.DataQuota) (*shared.QuotaStatus, error) {
+	now := time.Now()
+	status, err := mm.quotaStatus(quota, now)
+	if err != nil {
+		return nil, err
+	}
+
+	warned := quota.WarnedPercent
+	if quota.WarnedAt == nil || quota.WarnedAt.Before(status.PeriodStart) {
+		warned = 0
+	}
+	if due := shared.QuotaWarningDue(mm.config.QuotaWarnPercents, warned, status.PercentUsed); due > 0 && !status.Exceeded {
+		if err := mm.quotaManager.MarkWarned(quota.Username, due, now); err != nil {
+			return nil, fmt.Errorf("failed to record quota warning: %v", err)
+		}
+		log.Printf("[QUOTA] ⚠️  %s used %.1f%% of the %s data quota", quota.Username, status.PercentUsed, quota.Period)
+		mm.auditManager.LogAction(
+			"DATA_QUOTA_WARNING",
+			quota.Username,
+			fmt.Sprintf("%d%% of the %s data quota reached - used=%d limit=%d", due, quota.Period, status.UsedBytes, status.LimitBytes),
+			"",
+			mm.serverID,
+		)
+	}
+
+	switch {
+	case status.Exceeded && quota.ExceededAt == nil:
+		if err := mm.quotaManager.SetExceeded(quota.Username, &now); err != nil {
+			return nil, fmt.Errorf("failed to block user: %v", err)
+		}
+		log.Printf("[QUOTA] ❌ %s exceeded the %s data quota, blocking on all end-nodes", quota.Username, quota.Period)
+		mm.auditManager.LogAction(
+			"DATA_QUOTA_EXCEEDED",
+			quota.Username,
+			fmt.Sprintf("%s data quota exceeded, user blocked - used=%d limit=%d", quota.Period, status.UsedBytes, status.LimitBytes),
+			"",
+			mm.serverID,
+		)
+		go mm.blockOnAllEndNodes(quota.Username, quotaExceededReason)
+
+	case !status.Exceeded && quota.ExceededAt != nil:
+		if err := mm.quotaManager.SetExceeded(quota.Username, nil); err != nil {
+			return nil, fmt.Errorf("failed to unblock user: %v", err)
+		}
+		log.Printf("[QUOTA] ✅ %s is within the %s data quota again, unblocked", quota.Username, quota.Period)
+		mm.auditManager.LogAction(
+			"DATA_QUOTA_RESET",
+			quota.Username,
+			fmt.Sprintf("usage back within the %s data quota, user unblocked - used=%d limit=%d", quota.Period, status.UsedBytes, status.LimitBytes),
+			"",
+			mm.serverID,
+		)
+	}
+
+	return status, nil
+}
+
+// quotaStatus sums a user's usage in the quota's current period
+func (mm *ManagementManager) quotaStatus(quota *shared.DataQuota, now time.Time) (*shared.QuotaStatus, error) {
+	start, _ := quota.Window(now)
+	used, err := mm.quotaManager.UsageSince(quota.Username, start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum usage: %v", err)
+	}
+	return shared.NewQuotaStatus(quota, used, now), nil
+}
+
+// GetDataQuotaStatus returns a user's data quota usage in the current period, nil if it has no quota
+func (mm *ManagementManager) GetDataQuotaStatus(username string) (*shared.QuotaStatus, error) {
+	quota, err := mm.quotaManager.GetQuota(username)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mm.quotaStatus(quota, time.Now())
+}
+
+// blockOnAllEndNodes disconnects a user on every end-node and blocks it there right away.
+// End-nodes that cannot be reached pick the block up with their next access list sync.
+func (mm *ManagementManager) blockOnAllEndNodes(username, reason string) {
+	endNodes, err := mm.serverManager.ListEndNodes()
+	if err != nil {
+		log.Printf("[QUOTA] Warning: Failed to list end-nodes to block %s: %v", username, err)
+		return
+	}
+
+	for _, endNode := range endNodes {
+		if err := mm.blockOnEndNode(endNode, username, reason); err != nil {
+			log.Printf("Failed to block user %s on end-node %s: %v", username, endNode.Name, err)
+		}
+	}
+}
+
+// blockOnEndNode blocks a user on a specific end-node
+func (mm *ManagementManager) blockOnEndNode(endNode shared.Server, username, reason string) error {
+	payload, err := json.Marshal(map[string]string{"reason": reason})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	url := mm.EndNodeURL(endNode.Host, endNode.Port, "/api/users/"+username+"/block")
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if err := mm.AuthorizeEndNodeRequest(req, endNode.Name); err != nil {
+		return err
+	}
+
+	resp, err := mm.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach end-node: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("block on end-node failed with status: %d", resp.StatusCode)
+	}
+
+	log.Printf("✅ User %s blocked on end-node %s", username, endNode.Name)
+	return nil
+}
+
+// GetDataQuota returns the data quota of a user, or sql.ErrNoRows if it has none
+func (mm *ManagementManager) GetDataQuota(username string) (*shared.DataQuota, error) {
+	return mm.quotaManager.GetQuota(username)
+}
+
+// SetDataQuota saves the data quota of a user and applies it right away
+func (mm *ManagementManager) SetDataQuota(quota *shared.DataQuota, actor string) error {
+	if exists, err := mm.userManager.UserExists(quota.Username); err != nil {
+		return err
+	} else if !exists {
+		return sql.ErrNoRows
+	}
+	if err := mm.quotaManager.SetQuota(quota); err != nil {
+		return err
+	}
+
+	mm.auditManager.LogAction(
+		"DATA_QUOTA_UPDATED",
+		actor,
+		fmt.Sprintf("data quota of %s set to %d bytes per %s period", quota.Username, quota.LimitBytes, quota.Period),
+		"",
+		mm.serverID,
+	)
+
+	if _, err := mm.EnforceDataQuota(quota.Username); err != nil {
+		log.Printf("[QUOTA] Warning: Failed to check data quota of %s: %v", quota.Username, err)
+	}
+	return nil
+}
+
+// DeleteDataQuota removes the data quota of a user; a block it caused is lifted with the next access sync
+func (mm *ManagementManager) DeleteDataQuota(username, actor string) error {
+	if err := mm.quotaManager.DeleteQuota(username); err != nil {
+		return err
+	}
+
+	mm.auditManager.LogAction(
+		"DATA_QUOTA_DELETED",
+		actor,
+		fmt.Sprintf("data quota removed from %s", username),
+		"",
+		mm.serverID,
+	)
+
+	return nil
+}
+
+// MarkUserSynced marks a user's current profile as delivered
+func (mm *ManagementManager) MarkUserSynced(username string) error {
+	return mm.userManager.MarkUserSynced(username)
+}
+
 // GetDB returns the database connection for use by API handlers
 func (mm *ManagementManager) GetDB() *shared.DB {
 	return mm.userManager.GetDB()
@@ -0,0 +1,181 @@
+package manager
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"barqnet-backend/pkg/pki"
+	"barqnet-backend/pkg/shared"
+)
+
+// The management certificate is re-issued this long before it expires
+const nodeCertRenewBefore = 30 * 24 * time.Hour
+
+// openNodeCA opens the internal CA end-node certificates are issued from, creating it on first use
+func openNodeCA(dir string) (*pki.PKI, error) {
+	if _, err := os.Stat(filepath.Join(dir, "ca.crt")); os.IsNotExist(err) {
+		ca, err := pki.Init(dir, "BarqNet Node CA", pki.KeyTypeECDSA, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create node CA: %v", err)
+		}
+		log.Printf("[TLS] ✅ Created node CA in %s", dir)
+		return ca, nil
+	}
+	return pki.Open(dir)
+}
+
+// nodeTLSConfig returns where the node CA keeps the management certificate
+func nodeTLSConfig(dir string) shared.NodeTLSConfig {
+	return shared.NodeTLSConfig{
+		CAFile:   filepath.Join(dir, "ca.crt"),
+		CertFile: filepath.Join(dir, "issued", shared.ManagementNodeName+".crt"),
+		KeyFile:  filepath.Join(dir, "private", shared.ManagementNodeName+".key"),
+	}
+}
+
+// managementCertCurrent reports whether the management certificate exists, is valid for
+// every host and does not expire soon
+func managementCertCurrent(path string, hosts []string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil || time.Until(cert.NotAfter) < nodeCertRenewBefore {
+		return false
+	}
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// EnableNodeTLS switches the link to end-nodes to mutual TLS when a node CA is configured:
+// the management certificate is issued from the node CA if needed, and calls to end-nodes
+// present it and only trust end-node certificates of the same CA
+func (mm *ManagementManager) EnableNodeTLS() error {
+	if mm.config.NodeCADir == "" {
+		return nil
+	}
+
+	ca, err := openNodeCA(mm.config.NodeCADir)
+	if err != nil {
+		return err
+	}
+	tlsConfig := nodeTLSConfig(mm.config.NodeCADir)
+	if !managementCertCurrent(tlsConfig.CertFile, mm.config.NodeTLSHosts) {
+		if _, err := ca.IssueNode(shared.ManagementNodeName, mm.config.NodeTLSHosts, pki.IssueOptions{}); err != nil {
+			return fmt.Errorf("failed to issue management certificate: %v", err)
+		}
+		log.Printf("[TLS] ✅ Issued management certificate for %v", mm.config.NodeTLSHosts)
+	}
+
+	transport, err := shared.NewNodeTransport(tlsConfig)
+	if err != nil {
+		return err
+	}
+	mm.nodeTLS = tlsConfig
+	mm.nodeTransport = transport
+	mm.nodeCA = ca
+	mm.httpClient.Transport = transport
+	return nil
+}
+
+// NodeTLS returns the mutual TLS settings of the link to end-nodes, empty when disabled
+func (mm *ManagementManager) NodeTLS() shared.NodeTLSConfig {
+	return mm.nodeTLS
+}
+
+// VerifyNodeCertificate refuses a client certificate of the node CA unless the CA index still
+// holds it as valid, so revoked and superseded node certificates stop working
+func (mm *ManagementManager) VerifyNodeCertificate(cert *x509.Certificate) error {
+	if mm.nodeCA == nil {
+		return fmt.Errorf("mutual TLS with end-nodes is not enabled")
+	}
+	return mm.nodeCA.CheckValid(cert.SerialNumber)
+}
+
+// NodeTransport returns the HTTP transport for calls to end-nodes, nil for the default one
+func (mm *ManagementManager) NodeTransport() http.RoundTripper {
+	return mm.nodeTransport
+}
+
+// EndNodeURL returns the URL of path on the API of the end-node at host and port
+func (mm *ManagementManager) EndNodeURL(host string, port int, path string) string {
+	return mm.nodeTLS.URL(host, port, path)
+}
+
+// IssueNodeCertificate issues a certificate for an end-node from the node CA in caDir, valid
+// for the hosts management reaches the end-node API on. The certificate, its key and the CA
+// certificate are written to outDir and their paths returned.
+func IssueNodeCertificate(caDir, serverID string, hosts []string, outDir string) ([]string, error) {
+	if serverID == shared.ManagementNodeName {
+		return nil, fmt.Errorf("%q is reserved for the management server", serverID)
+	}
+
+	ca, err := openNodeCA(caDir)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := ca.IssueNode(serverID, hosts, pki.IssueOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(outDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", outDir, err)
+	}
+	files := []struct {
+		name string
+		data []byte
+		mode os.FileMode
+	}{
+		{"ca.crt", ca.CACertPEM(), 0644},
+		{serverID + ".crt", cert.CertPEM, 0644},
+		{serverID + ".key", cert.KeyPEM, 0600},
+	}
+	var paths []string
+	for _, f := range files {
+		path := filepath.Join(outDir, f.name)
+		if err := os.WriteFile(path, f.data, f.mode); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// RevokeNodeCertificates revokes every certificate the node CA in caDir issued to an end-node,
+// refreshes the node CA's CRL and returns the revoked serials. The end-node can no longer call
+// management over mutual TLS, nor management call it.
+func RevokeNodeCertificates(caDir, serverID string) ([]*big.Int, error) {
+	if serverID == shared.ManagementNodeName {
+		return nil, fmt.Errorf("%q is reserved for the management server", serverID)
+	}
+
+	ca, err := pki.Open(caDir)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := ca.RevokeCommonName(serverID, pki.ReasonCessationOfOperation)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ca.GenerateCRL(0); err != nil {
+		return revoked, fmt.Errorf("failed to refresh node CRL: %v", err)
+	}
+	return revoked, nil
+}
@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"barqnet-backend/pkg/shared"
+)
+
+// AuthorizeEndNodeRequest authenticates a request to an end-node: signed with the end-node's
+// credential when one was issued, otherwise with the shared API key
+func (mm *ManagementManager) AuthorizeEndNodeRequest(req *http.Request, serverID string) error {
+	secret, err := mm.nodeCredentialManager.GetSecret(serverID)
+	if err != nil {
+		return err
+	}
+	if secret != "" {
+		return shared.SignRequest(req, serverID, secret, shared.SignedByManagement)
+	}
+
+	// SECURITY: Add API key authentication for endnode communication
+	if apiKey := os.Getenv("API_KEY"); apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	return nil
+}
+
+// VerifyEndNodeRequest checks that a request was signed by an end-node with its credential and
+// is not a replay, and returns the end-node's server ID
+func (mm *ManagementManager) VerifyEndNodeRequest(r *http.Request) (string, error) {
+	serverID, err := mm.requestVerifier.Verify(r, shared.SignedByNode, mm.nodeCredentialManager.GetSecret)
+	if err != nil {
+		return "", err
+	}
+	if err := mm.nodeCredentialManager.MarkUsed(serverID); err != nil {
+		log.Printf("[AUTH] ⚠️  Failed to record use of the credential of %s: %v", serverID, err)
+	}
+	return serverID, nil
+}
+
+// HasNodeCredential reports whether an end-node holds a credential. End-nodes without one,
+// e.g. revoked ones, are refused even with a valid node certificate.
+func (mm *ManagementManager) HasNodeCredential(serverID string) (bool, error) {
+	secret, err := mm.nodeCredentialManager.GetSecret(serverID)
+	return secret != "", err
+}
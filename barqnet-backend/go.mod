@@ -9,6 +9,7 @@ require (
 	github.com/lib/pq v1.10.9
 	github.com/resend/resend-go/v3 v3.0.0
 	golang.org/x/crypto v0.18.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,35 @@
+-- =====================================================
+-- Migration: 010_add_crl_publications
+-- Description: Track CRL publishes reported by end-nodes
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+-- Each row is one CRL written by an end-node to its crl-verify path
+CREATE TABLE IF NOT EXISTS crl_publications (
+    id SERIAL PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL,
+    crl_number BIGINT NOT NULL,
+    revoked_count INTEGER NOT NULL DEFAULT 0,
+    this_update TIMESTAMP NOT NULL,
+    next_update TIMESTAMP NOT NULL,
+    kicked_sessions INTEGER NOT NULL DEFAULT 0,
+    published_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_crl_publications_server_date ON crl_publications(server_id, published_at DESC);
+CREATE INDEX IF NOT EXISTS idx_crl_publications_next_update ON crl_publications(next_update);
+
+COMMENT ON TABLE crl_publications IS 'CRL publishes reported by end-nodes (hot-reloaded by OpenVPN crl-verify)';
+COMMENT ON COLUMN crl_publications.kicked_sessions IS 'Sessions of revoked clients disconnected after the publish';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+DROP TABLE IF EXISTS crl_publications CASCADE;
+
+*/
@@ -0,0 +1,34 @@
+-- =====================================================
+-- Migration: 011_add_client_certificates
+-- Description: Track client certificate expiry per user and end-node
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+-- Latest client certificate of each user on each end-node, as reported by the end-node
+CREATE TABLE IF NOT EXISTS client_certificates (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    server_id VARCHAR(255) NOT NULL,
+    serial VARCHAR(64) NOT NULL,
+    not_after TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'valid', -- 'valid', 'expired', 'revoked'
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_client_certificates_user_server UNIQUE (username, server_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_client_certificates_not_after ON client_certificates(not_after);
+CREATE INDEX IF NOT EXISTS idx_client_certificates_server_id ON client_certificates(server_id);
+
+COMMENT ON TABLE client_certificates IS 'Client certificate expiry reported by end-nodes for renewal tracking';
+COMMENT ON COLUMN client_certificates.serial IS 'Certificate serial number in upper-case hex as in index.txt';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+DROP TABLE IF EXISTS client_certificates CASCADE;
+
+*/
@@ -0,0 +1,39 @@
+-- =====================================================
+-- Migration: 012_add_node_reconciliations
+-- Description: Track desired-state reconciliation and drift reported by end-nodes
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+-- Each row is one reconciliation pass of an end-node against the desired user set
+CREATE TABLE IF NOT EXISTS node_reconciliations (
+    id SERIAL PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL,
+    version VARCHAR(64) NOT NULL,
+    desired_count INTEGER NOT NULL DEFAULT 0,
+    actual_count INTEGER NOT NULL DEFAULT 0,
+    missing_count INTEGER NOT NULL DEFAULT 0,
+    unexpected_count INTEGER NOT NULL DEFAULT 0,
+    created_count INTEGER NOT NULL DEFAULT 0,
+    revoked_count INTEGER NOT NULL DEFAULT 0,
+    failed_count INTEGER NOT NULL DEFAULT 0,
+    details JSONB NOT NULL DEFAULT '{}',
+    reconciled_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_reconciliations_server_date ON node_reconciliations(server_id, reconciled_at DESC);
+
+COMMENT ON TABLE node_reconciliations IS 'Desired-state reconciliation passes and drift reported by end-nodes';
+COMMENT ON COLUMN node_reconciliations.version IS 'Version of the desired user set the end-node converged on';
+COMMENT ON COLUMN node_reconciliations.details IS 'Full drift report including usernames';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+DROP TABLE IF EXISTS node_reconciliations CASCADE;
+
+*/
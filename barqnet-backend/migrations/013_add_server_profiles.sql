@@ -0,0 +1,39 @@
+-- =====================================================
+-- Migration: 013_add_server_profiles
+-- Description: Centrally managed OpenVPN server profiles per end-node or location
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+-- A profile applies to one end-node, every end-node of a location, or (neither set) all end-nodes
+CREATE TABLE IF NOT EXISTS server_profiles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    server_id VARCHAR(255),
+    location_id INTEGER REFERENCES server_locations(location_id) ON DELETE CASCADE,
+    settings JSONB NOT NULL,
+    version VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_server_profiles_scope CHECK (server_id IS NULL OR location_id IS NULL)
+);
+
+-- At most one profile per scope
+CREATE UNIQUE INDEX IF NOT EXISTS idx_server_profiles_server ON server_profiles(server_id) WHERE server_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_server_profiles_location ON server_profiles(location_id) WHERE location_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_server_profiles_default ON server_profiles((server_id IS NULL AND location_id IS NULL))
+    WHERE server_id IS NULL AND location_id IS NULL;
+
+COMMENT ON TABLE server_profiles IS 'OpenVPN server profiles rendered into server.conf and client profiles by end-nodes';
+COMMENT ON COLUMN server_profiles.settings IS 'Ports, protocol, ciphers, tls-crypt, topology, subnet and pushed DNS';
+COMMENT ON COLUMN server_profiles.version IS 'Hash of the settings, used by end-nodes to detect changes';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+DROP TABLE IF EXISTS server_profiles CASCADE;
+
+*/
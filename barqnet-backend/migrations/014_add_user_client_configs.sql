@@ -0,0 +1,37 @@
+-- =====================================================
+-- Migration: 014_add_user_client_configs
+-- Description: Per-user OpenVPN client-config-dir entries (static IPs, pushed routes, iroutes)
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+-- server_id '' applies the entry to all end-nodes; an entry for a specific end-node overrides it there
+CREATE TABLE IF NOT EXISTS user_client_configs (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    server_id VARCHAR(255) NOT NULL DEFAULT '',
+    static_ip VARCHAR(15),
+    routes JSONB NOT NULL DEFAULT '[]',
+    iroutes JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_user_client_configs_scope UNIQUE (username, server_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_client_configs_server_id ON user_client_configs(server_id);
+CREATE INDEX IF NOT EXISTS idx_user_client_configs_static_ip ON user_client_configs(static_ip) WHERE static_ip IS NOT NULL;
+
+COMMENT ON TABLE user_client_configs IS 'Per-user CCD entries written to ccd/<username> on the end-nodes';
+COMMENT ON COLUMN user_client_configs.static_ip IS 'Fixed tunnel address (ifconfig-push), from the static range of the server profile';
+COMMENT ON COLUMN user_client_configs.routes IS 'IPv4 networks pushed to the client';
+COMMENT ON COLUMN user_client_configs.iroutes IS 'IPv4 networks behind a site-to-site client';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+DROP TABLE IF EXISTS user_client_configs CASCADE;
+
+*/
@@ -0,0 +1,51 @@
+-- =====================================================
+-- Migration: 015_add_route_profiles
+-- Description: Split-tunnel route profiles assigned per user or per plan
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+-- Plan a user is on; route profiles (and later policies) can be assigned per plan
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS plan VARCHAR(50);
+
+CREATE INDEX IF NOT EXISTS idx_users_plan ON users(plan) WHERE plan IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS route_profiles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    settings JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A profile is assigned to a user or to a plan; a user's own assignment wins over its plan's
+CREATE TABLE IF NOT EXISTS route_profile_assignments (
+    id SERIAL PRIMARY KEY,
+    profile_id INTEGER NOT NULL REFERENCES route_profiles(id) ON DELETE CASCADE,
+    username VARCHAR(255) REFERENCES users(username) ON DELETE CASCADE,
+    plan VARCHAR(50),
+    assigned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_route_profile_assignments_target CHECK ((username IS NULL) <> (plan IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_route_profile_assignments_username ON route_profile_assignments(username) WHERE username IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_route_profile_assignments_plan ON route_profile_assignments(plan) WHERE plan IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_route_profile_assignments_profile ON route_profile_assignments(profile_id);
+
+COMMENT ON TABLE route_profiles IS 'Split-tunnel policies baked into generated client configs';
+COMMENT ON COLUMN route_profiles.settings IS 'Include/exclude networks, route-nopull and DNS overrides';
+COMMENT ON TABLE route_profile_assignments IS 'Route profile of a user or of every user on a plan';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+DROP TABLE IF EXISTS route_profile_assignments CASCADE;
+DROP TABLE IF EXISTS route_profiles CASCADE;
+DROP INDEX IF EXISTS idx_users_plan;
+ALTER TABLE users DROP COLUMN IF EXISTS plan;
+
+*/
@@ -0,0 +1,49 @@
+-- =====================================================
+-- Migration: 016_add_node_metrics
+-- Description: Store resource metrics reported by end-node health checks
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+-- server_health is normally created at startup; create it here too for databases set up by migrations only
+CREATE TABLE IF NOT EXISTS server_health (
+    id SERIAL PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    last_check TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    response_time_ms INTEGER,
+    error_message TEXT
+);
+
+-- Headline numbers as columns for load balancing and dashboards, the full sample as JSON
+ALTER TABLE server_health
+ADD COLUMN IF NOT EXISTS cpu_percent REAL,
+ADD COLUMN IF NOT EXISTS memory_percent REAL,
+ADD COLUMN IF NOT EXISTS load_avg_1 REAL,
+ADD COLUMN IF NOT EXISTS disk_percent REAL,
+ADD COLUMN IF NOT EXISTS connected_clients INTEGER,
+ADD COLUMN IF NOT EXISTS openvpn_running BOOLEAN,
+ADD COLUMN IF NOT EXISTS metrics JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_server_health_server_last_check ON server_health(server_id, last_check DESC);
+
+COMMENT ON COLUMN server_health.metrics IS 'Full metrics sample: CPU, load, memory, interface throughput, clients, OpenVPN liveness, disk';
+COMMENT ON COLUMN server_health.connected_clients IS 'Clients connected according to the OpenVPN management interface';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+DROP INDEX IF EXISTS idx_server_health_server_last_check;
+ALTER TABLE server_health
+DROP COLUMN IF EXISTS cpu_percent,
+DROP COLUMN IF EXISTS memory_percent,
+DROP COLUMN IF EXISTS load_avg_1,
+DROP COLUMN IF EXISTS disk_percent,
+DROP COLUMN IF EXISTS connected_clients,
+DROP COLUMN IF EXISTS openvpn_running,
+DROP COLUMN IF EXISTS metrics;
+
+*/
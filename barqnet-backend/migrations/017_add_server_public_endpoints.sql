@@ -0,0 +1,22 @@
+-- =====================================================
+-- Migration: 017_add_server_public_endpoints
+-- Description: Store the public VPN endpoints end-nodes advertise, separate from their API address
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+ALTER TABLE servers
+ADD COLUMN IF NOT EXISTS public_endpoints JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+COMMENT ON COLUMN servers.host IS 'Address the management server reaches the end-node API on';
+COMMENT ON COLUMN servers.public_endpoints IS 'Hosts or IPs (IPv4/IPv6) VPN clients connect to, in order of preference; empty means host';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+ALTER TABLE servers DROP COLUMN IF EXISTS public_endpoints;
+
+*/
@@ -0,0 +1,33 @@
+-- =====================================================
+-- Migration: 018_add_server_usage_accounting
+-- Description: Store session usage counted by end-nodes from OpenVPN client-disconnect events
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+ALTER TABLE vpn_statistics
+ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'client',
+ADD COLUMN IF NOT EXISTS session_id VARCHAR(64);
+
+-- End-nodes retry batches whose response was lost; a session is stored once
+CREATE UNIQUE INDEX IF NOT EXISTS idx_vpn_stats_server_session
+ON vpn_statistics(server_id, session_id)
+WHERE session_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_vpn_stats_username_source ON vpn_statistics(username, source);
+
+COMMENT ON COLUMN vpn_statistics.source IS 'client: reported by the app via /vpn/stats; server: counted by OpenVPN on the end-node';
+COMMENT ON COLUMN vpn_statistics.session_id IS 'End-node session identifier for server-counted rows, NULL for client reports';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+DROP INDEX IF EXISTS idx_vpn_stats_username_source;
+DROP INDEX IF EXISTS idx_vpn_stats_server_session;
+ALTER TABLE vpn_statistics DROP COLUMN IF EXISTS session_id;
+ALTER TABLE vpn_statistics DROP COLUMN IF EXISTS source;
+
+*/
@@ -0,0 +1,51 @@
+-- =====================================================
+-- Migration: 019_add_session_limits
+-- Description: Per-user and per-plan concurrent session limits enforced at connect time
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+-- A limit is set for a user or for a plan; a user's own limit wins over its plan's
+CREATE TABLE IF NOT EXISTS session_limits (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(255) REFERENCES users(username) ON DELETE CASCADE,
+    plan VARCHAR(50),
+    max_sessions INTEGER NOT NULL CHECK (max_sessions >= 0),
+    policy VARCHAR(20) CHECK (policy IN ('reject', 'kick-oldest')),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_session_limits_target CHECK ((username IS NULL) <> (plan IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_session_limits_username ON session_limits(username) WHERE username IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_session_limits_plan ON session_limits(plan) WHERE plan IS NOT NULL;
+
+-- vpn_connections holds one row per user and end-node, upserted by /vpn/status and by
+-- end-nodes on connect; add the columns and the key those upserts rely on
+ALTER TABLE vpn_connections
+ADD COLUMN IF NOT EXISTS ip_address INET,
+ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+DELETE FROM vpn_connections a
+USING vpn_connections b
+WHERE a.username = b.username AND a.server_id = b.server_id AND a.id < b.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_vpn_conn_username_server ON vpn_connections(username, server_id);
+
+COMMENT ON TABLE session_limits IS 'Concurrent VPN session limit of a user or of every user on a plan';
+COMMENT ON COLUMN session_limits.max_sessions IS 'Concurrent sessions across all end-nodes, 0 for no limit';
+COMMENT ON COLUMN session_limits.policy IS 'reject or kick-oldest; NULL uses SESSION_LIMIT_POLICY';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+DROP INDEX IF EXISTS idx_vpn_conn_username_server;
+ALTER TABLE vpn_connections DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE vpn_connections DROP COLUMN IF EXISTS created_at;
+ALTER TABLE vpn_connections DROP COLUMN IF EXISTS ip_address;
+DROP TABLE IF EXISTS session_limits CASCADE;
+
+*/
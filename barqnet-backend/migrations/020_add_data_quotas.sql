@@ -0,0 +1,39 @@
+-- =====================================================
+-- Migration: 020_add_data_quotas
+-- Description: Per-user monthly or rolling data quotas with warnings and blocking
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+CREATE TABLE IF NOT EXISTS data_quotas (
+    username VARCHAR(255) PRIMARY KEY REFERENCES users(username) ON DELETE CASCADE,
+    limit_bytes BIGINT NOT NULL CHECK (limit_bytes > 0),
+    period VARCHAR(16) NOT NULL DEFAULT 'monthly' CHECK (period IN ('monthly', 'rolling')),
+    rolling_days INTEGER NOT NULL DEFAULT 0 CHECK (rolling_days BETWEEN 0 AND 365),
+    exceeded_at TIMESTAMP,
+    warned_percent INTEGER NOT NULL DEFAULT 0,
+    warned_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_quotas_exceeded ON data_quotas(exceeded_at) WHERE exceeded_at IS NOT NULL;
+
+-- Quota usage sums a user's sessions by the time they ended
+CREATE INDEX IF NOT EXISTS idx_vpn_stats_user_ended ON vpn_statistics(username, ended_at);
+
+COMMENT ON TABLE data_quotas IS 'VPN traffic allowed per user and period, summed from vpn_statistics';
+COMMENT ON COLUMN data_quotas.period IS 'monthly (calendar month in UTC) or rolling (the last rolling_days days)';
+COMMENT ON COLUMN data_quotas.exceeded_at IS 'Set while the user is blocked for exceeding the quota';
+COMMENT ON COLUMN data_quotas.warned_percent IS 'Highest warning threshold reached in the current period';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+DROP INDEX IF EXISTS idx_vpn_stats_user_ended;
+DROP TABLE IF EXISTS data_quotas CASCADE;
+
+*/
@@ -0,0 +1,34 @@
+-- =====================================================
+-- Migration: 021_add_bandwidth_limits
+-- Description: Per-user and per-plan bandwidth limits shaped on end-nodes
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+-- A limit is set for a user or for a plan; a user's own limit wins over its plan's
+CREATE TABLE IF NOT EXISTS bandwidth_limits (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(255) REFERENCES users(username) ON DELETE CASCADE,
+    plan VARCHAR(50),
+    down_kbps INTEGER NOT NULL DEFAULT 0 CHECK (down_kbps >= 0),
+    up_kbps INTEGER NOT NULL DEFAULT 0 CHECK (up_kbps >= 0),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_bandwidth_limits_target CHECK ((username IS NULL) <> (plan IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bandwidth_limits_username ON bandwidth_limits(username) WHERE username IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bandwidth_limits_plan ON bandwidth_limits(plan) WHERE plan IS NOT NULL;
+
+COMMENT ON TABLE bandwidth_limits IS 'Rate limit of a user or of every user on a plan, applied to tunnel addresses on end-nodes';
+COMMENT ON COLUMN bandwidth_limits.down_kbps IS 'Kilobits per second to the client, 0 for line rate';
+COMMENT ON COLUMN bandwidth_limits.up_kbps IS 'Kilobits per second from the client, 0 for line rate';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+DROP TABLE IF EXISTS bandwidth_limits CASCADE;
+
+*/
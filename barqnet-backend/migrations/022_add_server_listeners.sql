@@ -0,0 +1,21 @@
+-- =====================================================
+-- Migration: 022_add_server_listeners
+-- Description: Store the OpenVPN listeners (protocol and port) end-nodes declare at registration
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+ALTER TABLE servers
+ADD COLUMN IF NOT EXISTS listeners JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+COMMENT ON COLUMN servers.listeners IS 'OpenVPN listeners as [{"protocol": "udp", "port": 1194}, ...] in order of preference; empty means the server profile port and protocol';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+ALTER TABLE servers DROP COLUMN IF EXISTS listeners;
+
+*/
@@ -0,0 +1,28 @@
+-- =====================================================
+-- Migration: 023_add_node_credentials
+-- Description: Per-node credentials requests between management and end-nodes are signed with
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+-- The secret is an HMAC key both sides sign with, so it is kept as issued rather than hashed
+CREATE TABLE IF NOT EXISTS node_credentials (
+    server_id VARCHAR(255) PRIMARY KEY,
+    secret VARCHAR(128) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+COMMENT ON TABLE node_credentials IS 'Credential of each end-node, issued by management and used to sign requests in both directions';
+COMMENT ON COLUMN node_credentials.secret IS 'HMAC-SHA256 key shared with the end-node only; re-issuing it rotates the credential';
+COMMENT ON COLUMN node_credentials.last_used_at IS 'Last time a request signed with the credential was accepted';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+DROP TABLE IF EXISTS node_credentials CASCADE;
+
+*/
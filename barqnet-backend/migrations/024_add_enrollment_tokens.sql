@@ -0,0 +1,44 @@
+-- =====================================================
+-- Migration: 024_add_enrollment_tokens
+-- Description: Single-use enrollment tokens end-nodes exchange at first boot for their node credential
+-- Created: 2026-10-16
+-- =====================================================
+
+-- ============== MIGRATION UP ==============
+
+-- Only a hash of each token is kept; the token itself is shown once, when it is created
+CREATE TABLE IF NOT EXISTS enrollment_tokens (
+    id SERIAL PRIMARY KEY,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    server_id VARCHAR(255),
+    location_id INTEGER REFERENCES server_locations(location_id) ON DELETE CASCADE,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    used_by VARCHAR(255),
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_enrollment_tokens_created_at ON enrollment_tokens(created_at);
+
+-- Location an end-node enrolled with a pinned token is placed in when it registers
+ALTER TABLE node_credentials
+ADD COLUMN IF NOT EXISTS location_id INTEGER REFERENCES server_locations(location_id) ON DELETE SET NULL;
+
+COMMENT ON TABLE enrollment_tokens IS 'Short-lived, single-use tokens an end-node exchanges for its node credential';
+COMMENT ON COLUMN enrollment_tokens.token_hash IS 'SHA-256 of the token, hex encoded';
+COMMENT ON COLUMN enrollment_tokens.server_id IS 'Server ID the token is pinned to; NULL lets the end-node choose an unused one';
+COMMENT ON COLUMN enrollment_tokens.location_id IS 'Location the enrolled end-node is placed in, NULL for none';
+COMMENT ON COLUMN enrollment_tokens.used_by IS 'Server ID of the end-node that exchanged the token';
+COMMENT ON COLUMN node_credentials.location_id IS 'Location pinned by the enrollment token, applied at registration';
+
+-- ============== ROLLBACK DOWN ==============
+
+/*
+-- To rollback this migration, run the following SQL:
+
+ALTER TABLE node_credentials DROP COLUMN IF EXISTS location_id;
+DROP TABLE IF EXISTS enrollment_tokens CASCADE;
+
+*/
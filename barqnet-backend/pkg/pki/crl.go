@@ -0,0 +1,102 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// CRLInfo describes a generated Certificate Revocation List
+type CRLInfo struct {
+	Number       *big.Int  `json:"number"`
+	ThisUpdate   time.Time `json:"this_update"`
+	NextUpdate   time.Time `json:"next_update"`
+	RevokedCount int       `json:"revoked_count"`
+	PEM          []byte    `json:"-"`
+}
+
+// GenerateCRL signs a CRL listing every revoked certificate in the index and writes it to crl.pem.
+// The CRL number is taken from the crlnumber file and incremented, like "easyrsa gen-crl".
+func (p *PKI) GenerateCRL(lifetime time.Duration) (*CRLInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if lifetime <= 0 {
+		lifetime = DefaultCRLLifetime
+	}
+
+	entries, err := readIndex(p.path("index.txt"))
+	if err != nil {
+		return nil, err
+	}
+
+	number, err := p.readCRLNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	revoked := []x509.RevocationListEntry{}
+	for _, entry := range entries {
+		if entry.Status != StatusRevoked {
+			continue
+		}
+		revoked = append(revoked, x509.RevocationListEntry{
+			SerialNumber:   entry.Serial,
+			RevocationTime: entry.RevokedAt,
+			ReasonCode:     entry.Reason,
+		})
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	template := &x509.RevocationList{
+		Number:                    number,
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(lifetime),
+		RevokedCertificateEntries: revoked,
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, p.caCert, p.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign CRL: %v", err)
+	}
+	crlPEM := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+
+	if err := writeFileAtomic(p.path("crl.pem"), crlPEM, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write CRL: %v", err)
+	}
+
+	next := new(big.Int).Add(number, big.NewInt(1))
+	if err := writeFileAtomic(p.path("crlnumber"), []byte(formatSerial(next)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to update crlnumber: %v", err)
+	}
+
+	return &CRLInfo{
+		Number:       number,
+		ThisUpdate:   template.ThisUpdate,
+		NextUpdate:   template.NextUpdate,
+		RevokedCount: len(revoked),
+		PEM:          crlPEM,
+	}, nil
+}
+
+// readCRLNumber reads the next CRL number; a missing file starts at 1
+func (p *PKI) readCRLNumber() (*big.Int, error) {
+	data, err := os.ReadFile(p.path("crlnumber"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return big.NewInt(1), nil
+		}
+		return nil, fmt.Errorf("failed to read crlnumber: %v", err)
+	}
+
+	number, ok := new(big.Int).SetString(strings.TrimSpace(string(data)), 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid crlnumber %q", strings.TrimSpace(string(data)))
+	}
+	return number, nil
+}
@@ -0,0 +1,203 @@
+package pki
+
+import (
+	"bufio"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Certificate status flags as used in the OpenSSL/EasyRSA index.txt database
+const (
+	StatusValid   = "V"
+	StatusRevoked = "R"
+	StatusExpired = "E"
+)
+
+// Revocation reason codes (RFC 5280 section 5.3.1)
+const (
+	ReasonUnspecified          = 0
+	ReasonKeyCompromise        = 1
+	ReasonCACompromise         = 2
+	ReasonAffiliationChanged   = 3
+	ReasonSuperseded           = 4
+	ReasonCessationOfOperation = 5
+	ReasonCertificateHold      = 6
+)
+
+var reasonNames = map[int]string{
+	ReasonUnspecified:          "unspecified",
+	ReasonKeyCompromise:        "keyCompromise",
+	ReasonCACompromise:         "CACompromise",
+	ReasonAffiliationChanged:   "affiliationChanged",
+	ReasonSuperseded:           "superseded",
+	ReasonCessationOfOperation: "cessationOfOperation",
+	ReasonCertificateHold:      "certificateHold",
+}
+
+// IndexEntry is a single line of index.txt
+type IndexEntry struct {
+	Status    string
+	Expiry    time.Time
+	RevokedAt time.Time
+	Reason    int
+	Serial    *big.Int
+	Subject   string
+}
+
+// CommonName returns the CN component of the entry's subject
+func (e IndexEntry) CommonName() string {
+	for _, part := range strings.Split(e.Subject, "/") {
+		if strings.HasPrefix(part, "CN=") {
+			return strings.TrimPrefix(part, "CN=")
+		}
+	}
+	return ""
+}
+
+// IsValid reports whether the certificate is neither revoked nor expired at the given time
+func (e IndexEntry) IsValid(now time.Time) bool {
+	return e.Status == StatusValid && now.Before(e.Expiry)
+}
+
+// SerialHex returns the serial number in the upper-case hex form used by OpenSSL
+func (e IndexEntry) SerialHex() string {
+	return formatSerial(e.Serial)
+}
+
+// String formats the entry as an index.txt line
+func (e IndexEntry) String() string {
+	revoked := ""
+	if e.Status == StatusRevoked {
+		revoked = formatIndexTime(e.RevokedAt)
+		if e.Reason != ReasonUnspecified {
+			if name, ok := reasonNames[e.Reason]; ok {
+				revoked += "," + name
+			}
+		}
+	}
+	return strings.Join([]string{
+		e.Status,
+		formatIndexTime(e.Expiry),
+		revoked,
+		formatSerial(e.Serial),
+		"unknown",
+		e.Subject,
+	}, "\t")
+}
+
+// parseIndexLine parses a single index.txt line
+func parseIndexLine(line string) (IndexEntry, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 6 {
+		return IndexEntry{}, fmt.Errorf("expected 6 fields, got %d", len(fields))
+	}
+
+	entry := IndexEntry{
+		Status:  fields[0],
+		Subject: fields[5],
+	}
+
+	var err error
+	if entry.Expiry, err = parseIndexTime(fields[1]); err != nil {
+		return IndexEntry{}, fmt.Errorf("invalid expiry date: %v", err)
+	}
+
+	if fields[2] != "" {
+		revokedAt, reason, _ := strings.Cut(fields[2], ",")
+		if entry.RevokedAt, err = parseIndexTime(revokedAt); err != nil {
+			return IndexEntry{}, fmt.Errorf("invalid revocation date: %v", err)
+		}
+		for code, name := range reasonNames {
+			if name == reason {
+				entry.Reason = code
+			}
+		}
+	}
+
+	serial, ok := new(big.Int).SetString(fields[3], 16)
+	if !ok {
+		return IndexEntry{}, fmt.Errorf("invalid serial %q", fields[3])
+	}
+	entry.Serial = serial
+
+	return entry, nil
+}
+
+// readIndex reads index.txt; a missing file is treated as an empty database
+func readIndex(path string) ([]IndexEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []IndexEntry{}, nil
+		}
+		return nil, fmt.Errorf("failed to open index: %v", err)
+	}
+	defer file.Close()
+
+	entries := []IndexEntry{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		entry, err := parseIndexLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid index line %d: %v", lineNumber, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read index: %v", err)
+	}
+
+	return entries, nil
+}
+
+// writeIndex rewrites index.txt, keeping the previous version as index.txt.old like OpenSSL does
+func writeIndex(path string, entries []IndexEntry) error {
+	var b strings.Builder
+	for _, entry := range entries {
+		b.WriteString(entry.String())
+		b.WriteString("\n")
+	}
+
+	if current, err := os.ReadFile(path); err == nil {
+		if err := os.WriteFile(path+".old", current, 0600); err != nil {
+			return fmt.Errorf("failed to back up index: %v", err)
+		}
+	}
+
+	return writeFileAtomic(path, []byte(b.String()), 0600)
+}
+
+// formatIndexTime formats a time as ASN.1 UTCTime, or GeneralizedTime from 2050 on
+func formatIndexTime(t time.Time) string {
+	t = t.UTC()
+	if t.Year() >= 2050 {
+		return t.Format("20060102150405Z")
+	}
+	return t.Format("060102150405Z")
+}
+
+// parseIndexTime parses an ASN.1 UTCTime or GeneralizedTime value
+func parseIndexTime(value string) (time.Time, error) {
+	if len(value) == len("20060102150405Z") {
+		return time.Parse("20060102150405Z", value)
+	}
+	return time.Parse("060102150405Z", value)
+}
+
+// formatSerial formats a serial as even-length upper-case hex
+func formatSerial(serial *big.Int) string {
+	hex := strings.ToUpper(serial.Text(16))
+	if len(hex)%2 == 1 {
+		hex = "0" + hex
+	}
+	return hex
+}
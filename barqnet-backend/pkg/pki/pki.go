@@ -0,0 +1,673 @@
+// Package pki implements a certificate authority on top of crypto/x509.
+// It reads and writes the EasyRSA 3 pki/ directory layout (ca.crt, private/,
+// issued/, reqs/, index.txt, serial, crlnumber, crl.pem) so existing
+// deployments can switch from the easyrsa script without migrating files.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// KeyType selects the key algorithm for newly generated keys
+type KeyType string
+
+const (
+	KeyTypeECDSA   KeyType = "ecdsa"
+	KeyTypeEd25519 KeyType = "ed25519"
+	KeyTypeRSA     KeyType = "rsa"
+)
+
+// Defaults matching EasyRSA's vars
+const (
+	DefaultCertLifetime = 825 * 24 * time.Hour
+	DefaultCALifetime   = 3650 * 24 * time.Hour
+	DefaultCRLLifetime  = 180 * 24 * time.Hour
+	DefaultRSABits      = 2048
+)
+
+// IssueOptions controls how a certificate is issued
+type IssueOptions struct {
+	KeyType  KeyType
+	RSABits  int
+	Lifetime time.Duration
+	// DNS names and IP addresses the certificate is valid for as a TLS server;
+	// set by IssueNode only
+	Hosts []string
+}
+
+// Certificate is a freshly issued certificate together with its private key
+type Certificate struct {
+	CommonName string    `json:"common_name"`
+	Serial     *big.Int  `json:"serial"`
+	NotBefore  time.Time `json:"not_before"`
+	NotAfter   time.Time `json:"not_after"`
+	CertPEM    []byte    `json:"-"`
+	KeyPEM     []byte    `json:"-"`
+}
+
+// PKI is a certificate authority backed by an EasyRSA-compatible directory
+type PKI struct {
+	dir    string
+	mu     sync.Mutex
+	caCert *x509.Certificate
+	caPEM  []byte
+	caKey  crypto.Signer
+}
+
+// Open loads an existing PKI directory (the "pki" folder inside the EasyRSA directory)
+func Open(dir string) (*PKI, error) {
+	p := &PKI{dir: dir}
+
+	caPEM, err := os.ReadFile(p.path("ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+	}
+	block, _ := pem.Decode(caPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("CA certificate %s is not PEM encoded", p.path("ca.crt"))
+	}
+	caCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+
+	keyPEM, err := os.ReadFile(p.path("private", "ca.key"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %v", err)
+	}
+	caKey, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA key: %v", err)
+	}
+
+	p.caCert = caCert
+	p.caPEM = caPEM
+	p.caKey = caKey
+	return p, nil
+}
+
+// Init creates a new PKI directory with a self-signed CA.
+// It refuses to overwrite an existing CA.
+func Init(dir, commonName string, keyType KeyType, lifetime time.Duration) (*PKI, error) {
+	p := &PKI{dir: dir}
+
+	if _, err := os.Stat(p.path("ca.crt")); err == nil {
+		return nil, fmt.Errorf("CA already exists at %s", p.path("ca.crt"))
+	}
+
+	for _, sub := range []string{"private", "issued", "reqs", "certs_by_serial", "revoked"} {
+		if err := os.MkdirAll(p.path(sub), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %v", sub, err)
+		}
+	}
+
+	if lifetime <= 0 {
+		lifetime = DefaultCALifetime
+	}
+
+	key, err := generateKey(keyType, DefaultRSABits)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	skid, err := subjectKeyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(lifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          skid,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+
+	keyPEM, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	if err := writeFileAtomic(p.path("private", "ca.key"), keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write CA key: %v", err)
+	}
+	if err := writeFileAtomic(p.path("ca.crt"), caPEM, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write CA certificate: %v", err)
+	}
+	if err := writeFileAtomic(p.path("index.txt"), nil, 0600); err != nil {
+		return nil, fmt.Errorf("failed to create index: %v", err)
+	}
+	if err := writeFileAtomic(p.path("index.txt.attr"), []byte("unique_subject = no\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to create index attributes: %v", err)
+	}
+	if err := writeFileAtomic(p.path("crlnumber"), []byte("01\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to create crlnumber: %v", err)
+	}
+
+	p.caCert = caCert
+	p.caPEM = caPEM
+	p.caKey = key
+	return p, nil
+}
+
+// Dir returns the PKI directory
+func (p *PKI) Dir() string {
+	return p.dir
+}
+
+// CACertificate returns the parsed CA certificate
+func (p *PKI) CACertificate() *x509.Certificate {
+	return p.caCert
+}
+
+// CACertPEM returns the PEM encoded CA certificate
+func (p *PKI) CACertPEM() []byte {
+	return p.caPEM
+}
+
+// Index returns all entries of the certificate database
+func (p *PKI) Index() ([]IndexEntry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return readIndex(p.path("index.txt"))
+}
+
+// FindByCommonName returns the index entries issued to a common name, oldest first
+func (p *PKI) FindByCommonName(commonName string) ([]IndexEntry, error) {
+	entries, err := p.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []IndexEntry
+	for _, entry := range entries {
+		if entry.CommonName() == commonName {
+			matches = append(matches, entry)
+		}
+	}
+	return matches, nil
+}
+
+// CheckValid returns an error unless the certificate with the given serial was issued by this
+// CA and is neither revoked nor expired. The index is read on every call, so revocations
+// apply immediately.
+func (p *PKI) CheckValid(serial *big.Int) error {
+	entries, err := p.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Serial.Cmp(serial) != 0 {
+			continue
+		}
+		if entry.Status == StatusRevoked {
+			return fmt.Errorf("certificate %s of %s is revoked", entry.SerialHex(), entry.CommonName())
+		}
+		if !entry.IsValid(time.Now()) {
+			return fmt.Errorf("certificate %s of %s is expired", entry.SerialHex(), entry.CommonName())
+		}
+		return nil
+	}
+	return fmt.Errorf("certificate with serial %s not found", formatSerial(serial))
+}
+
+// IssueClient generates a key pair and signs a TLS client certificate for the common name.
+// The certificate, key and request are written to issued/, private/ and reqs/ like
+// "easyrsa build-client-full <name> nopass" would.
+func (p *PKI) IssueClient(commonName string, opts IssueOptions) (*Certificate, error) {
+	return p.issueClient(commonName, opts, false)
+}
+
+// RenewClient issues a replacement certificate for a common name that may still hold a valid one.
+// The previous certificate is left valid until it expires so clients that have not yet
+// fetched the new profile keep working.
+func (p *PKI) RenewClient(commonName string, opts IssueOptions) (*Certificate, error) {
+	return p.issueClient(commonName, opts, true)
+}
+
+// IssueNode signs a certificate a management server or end-node presents on the link between
+// them, both as TLS server for hosts and as TLS client. A node holding a certificate already
+// gets a new one alongside it, like RenewClient.
+func (p *PKI) IssueNode(commonName string, hosts []string, opts IssueOptions) (*Certificate, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("a node certificate needs at least one host")
+	}
+	opts.Hosts = hosts
+	return p.issueClient(commonName, opts, true)
+}
+
+// issueClient signs a new client certificate, optionally alongside an existing valid one
+func (p *PKI) issueClient(commonName string, opts IssueOptions, renew bool) (*Certificate, error) {
+	if err := validateCommonName(commonName); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entries, err := readIndex(p.path("index.txt"))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Truncate(time.Second)
+	for _, entry := range entries {
+		if !renew && entry.CommonName() == commonName && entry.IsValid(now) {
+			return nil, fmt.Errorf("a valid certificate for %s already exists (serial %s)", commonName, entry.SerialHex())
+		}
+	}
+
+	if opts.Lifetime <= 0 {
+		opts.Lifetime = DefaultCertLifetime
+	}
+	if opts.KeyType == "" {
+		opts.KeyType = KeyTypeECDSA
+	}
+
+	key, err := generateKey(opts.KeyType, opts.RSABits)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := p.uniqueSerial(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	skid, err := subjectKeyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	notAfter := now.Add(opts.Lifetime).Truncate(time.Second)
+	if notAfter.After(p.caCert.NotAfter) {
+		notAfter = p.caCert.NotAfter
+	}
+
+	subject := pkix.Name{CommonName: commonName}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		SubjectKeyId:          skid,
+	}
+	if len(opts.Hosts) > 0 {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+		for _, host := range opts.Hosts {
+			if ip := net.ParseIP(host); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			} else {
+				template.DNSNames = append(template.DNSNames, host)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, p.caCert, key.Public(), p.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate: %v", err)
+	}
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: subject}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %v", err)
+	}
+
+	keyPEM, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+
+	for _, sub := range []string{"private", "issued", "reqs", "certs_by_serial"} {
+		if err := os.MkdirAll(p.path(sub), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %v", sub, err)
+		}
+	}
+
+	files := []struct {
+		path string
+		data []byte
+		mode os.FileMode
+	}{
+		{p.path("private", commonName+".key"), keyPEM, 0600},
+		{p.path("reqs", commonName+".req"), csrPEM, 0600},
+		{p.path("issued", commonName+".crt"), certPEM, 0644},
+		{p.path("certs_by_serial", formatSerial(serial)+".pem"), certPEM, 0644},
+	}
+	for _, f := range files {
+		if err := writeFileAtomic(f.path, f.data, f.mode); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", f.path, err)
+		}
+	}
+
+	entries = append(entries, IndexEntry{
+		Status:  StatusValid,
+		Expiry:  notAfter,
+		Serial:  serial,
+		Subject: "/CN=" + commonName,
+	})
+	if err := writeIndex(p.path("index.txt"), entries); err != nil {
+		return nil, err
+	}
+
+	next := new(big.Int).Add(serial, big.NewInt(1))
+	if err := writeFileAtomic(p.path("serial"), []byte(formatSerial(next)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to update serial: %v", err)
+	}
+
+	return &Certificate{
+		CommonName: commonName,
+		Serial:     serial,
+		NotBefore:  template.NotBefore,
+		NotAfter:   notAfter,
+		CertPEM:    certPEM,
+		KeyPEM:     keyPEM,
+	}, nil
+}
+
+// Revoke marks the certificate with the given serial as revoked.
+// Its issued files are moved under revoked/ so the common name can be issued again,
+// matching "easyrsa revoke".
+func (p *PKI) Revoke(serial *big.Int, reason int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entries, err := readIndex(p.path("index.txt"))
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range entries {
+		if entry.Serial.Cmp(serial) != 0 {
+			continue
+		}
+		if entry.Status == StatusRevoked {
+			return fmt.Errorf("certificate %s is already revoked", entry.SerialHex())
+		}
+
+		entries[i].Status = StatusRevoked
+		entries[i].RevokedAt = time.Now()
+		entries[i].Reason = reason
+		if err := writeIndex(p.path("index.txt"), entries); err != nil {
+			return err
+		}
+
+		p.archiveRevoked(entries[i])
+		return nil
+	}
+
+	return fmt.Errorf("certificate with serial %s not found", formatSerial(serial))
+}
+
+// RevokeCommonName revokes every unrevoked certificate issued to the common name
+// and returns the revoked serials
+func (p *PKI) RevokeCommonName(commonName string, reason int) ([]*big.Int, error) {
+	entries, err := p.FindByCommonName(commonName)
+	if err != nil {
+		return nil, err
+	}
+
+	var revoked []*big.Int
+	for _, entry := range entries {
+		if entry.Status == StatusRevoked {
+			continue
+		}
+		if err := p.Revoke(entry.Serial, reason); err != nil {
+			return revoked, err
+		}
+		revoked = append(revoked, entry.Serial)
+	}
+
+	if len(revoked) == 0 {
+		return nil, fmt.Errorf("no unrevoked certificate found for %s", commonName)
+	}
+	return revoked, nil
+}
+
+// archiveRevoked moves the issued files of a revoked certificate to revoked/*_by_serial/.
+// Files are only moved when the issued certificate still has the revoked serial.
+func (p *PKI) archiveRevoked(entry IndexEntry) {
+	commonName := entry.CommonName()
+	if validateCommonName(commonName) != nil {
+		return
+	}
+
+	issuedPath := p.path("issued", commonName+".crt")
+	data, err := os.ReadFile(issuedPath)
+	if err != nil {
+		return
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		if cert, err := x509.ParseCertificate(block.Bytes); err != nil || cert.SerialNumber.Cmp(entry.Serial) != 0 {
+			return
+		}
+	}
+
+	serial := entry.SerialHex()
+	moves := []struct{ from, to string }{
+		{issuedPath, p.path("revoked", "certs_by_serial", serial+".crt")},
+		{p.path("private", commonName+".key"), p.path("revoked", "private_by_serial", serial+".key")},
+		{p.path("reqs", commonName+".req"), p.path("revoked", "reqs_by_serial", serial+".req")},
+	}
+	for _, m := range moves {
+		if err := os.MkdirAll(filepath.Dir(m.to), 0700); err != nil {
+			continue
+		}
+		os.Rename(m.from, m.to)
+	}
+}
+
+// uniqueSerial picks a random serial that is not yet present in the index
+func (p *PKI) uniqueSerial(entries []IndexEntry) (*big.Int, error) {
+	for attempt := 0; attempt < 10; attempt++ {
+		serial, err := randomSerial()
+		if err != nil {
+			return nil, err
+		}
+		duplicate := false
+		for _, entry := range entries {
+			if entry.Serial.Cmp(serial) == 0 {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			return serial, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to allocate a unique serial")
+}
+
+// path joins elements onto the PKI directory
+func (p *PKI) path(elem ...string) string {
+	return filepath.Join(append([]string{p.dir}, elem...)...)
+}
+
+// validateCommonName rejects names that could escape the PKI directory or break index.txt
+func validateCommonName(commonName string) error {
+	if commonName == "" || len(commonName) > 64 {
+		return fmt.Errorf("common name must be between 1 and 64 characters")
+	}
+	for _, c := range commonName {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '_' || c == '-' || c == '.' || c == '@') {
+			return fmt.Errorf("common name contains invalid character %q", c)
+		}
+	}
+	if commonName == "." || commonName == ".." {
+		return fmt.Errorf("invalid common name %q", commonName)
+	}
+	return nil
+}
+
+// generateKey creates a private key of the requested type
+func generateKey(keyType KeyType, rsaBits int) (crypto.Signer, error) {
+	switch keyType {
+	case KeyTypeECDSA, "":
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ECDSA key: %v", err)
+		}
+		return key, nil
+	case KeyTypeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Ed25519 key: %v", err)
+		}
+		return key, nil
+	case KeyTypeRSA:
+		if rsaBits == 0 {
+			rsaBits = DefaultRSABits
+		}
+		if rsaBits < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		key, err := rsa.GenerateKey(rand.Reader, rsaBits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate RSA key: %v", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+}
+
+// encodePrivateKey encodes a key as unencrypted PKCS#8 PEM, the format EasyRSA writes for nopass keys
+func encodePrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// parsePrivateKey decodes a PKCS#8, PKCS#1 or SEC 1 PEM private key
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		return nil, fmt.Errorf("encrypted CA keys are not supported, rebuild the CA with nopass")
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key of type %T cannot sign", key)
+	}
+	return signer, nil
+}
+
+// randomSerial returns a random positive 128-bit serial number
+func randomSerial() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 127)
+	serial, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial: %v", err)
+	}
+	return serial.Add(serial, big.NewInt(1)), nil
+}
+
+// subjectKeyID computes the RFC 5280 method 1 key identifier
+func subjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %v", err)
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %v", err)
+	}
+	sum := sha1.Sum(spki.PublicKey.Bytes)
+	return sum[:], nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and renames it into place
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, mode); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
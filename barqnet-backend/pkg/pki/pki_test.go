@@ -0,0 +1,328 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestPKI(t *testing.T) *PKI {
+	t.Helper()
+
+	p, err := Init(filepath.Join(t.TempDir(), "pki"), "Test CA", KeyTypeECDSA, 0)
+	if err != nil {
+		t.Fatalf("Failed to init PKI: %v", err)
+	}
+	return p
+}
+
+func parseCertPEM(t *testing.T, data []byte) *x509.Certificate {
+	t.Helper()
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatal("Expected PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return cert
+}
+
+// TestIssueClientKeyTypes verifies issued certificates chain to the CA for each key type
+func TestIssueClientKeyTypes(t *testing.T) {
+	p := newTestPKI(t)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(p.CACertificate())
+
+	tests := []struct {
+		name    string
+		keyType KeyType
+		check   func(interface{}) bool
+	}{
+		{"ecdsa-user", KeyTypeECDSA, func(k interface{}) bool { _, ok := k.(*ecdsa.PublicKey); return ok }},
+		{"ed25519-user", KeyTypeEd25519, func(k interface{}) bool { _, ok := k.(ed25519.PublicKey); return ok }},
+		{"rsa-user", KeyTypeRSA, func(k interface{}) bool { _, ok := k.(*rsa.PublicKey); return ok }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issued, err := p.IssueClient(tt.name, IssueOptions{KeyType: tt.keyType, Lifetime: 30 * 24 * time.Hour})
+			if err != nil {
+				t.Fatalf("IssueClient failed: %v", err)
+			}
+
+			cert := parseCertPEM(t, issued.CertPEM)
+			if cert.Subject.CommonName != tt.name {
+				t.Errorf("Expected CN %s, got %s", tt.name, cert.Subject.CommonName)
+			}
+			if !tt.check(cert.PublicKey) {
+				t.Errorf("Unexpected public key type %T", cert.PublicKey)
+			}
+			if cert.NotAfter.Sub(cert.NotBefore) > 31*24*time.Hour {
+				t.Errorf("Expected ~30 day lifetime, got %v", cert.NotAfter.Sub(cert.NotBefore))
+			}
+
+			if _, err := cert.Verify(x509.VerifyOptions{
+				Roots:     roots,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			}); err != nil {
+				t.Errorf("Certificate does not verify against CA: %v", err)
+			}
+
+			for _, path := range []string{
+				filepath.Join(p.Dir(), "issued", tt.name+".crt"),
+				filepath.Join(p.Dir(), "private", tt.name+".key"),
+				filepath.Join(p.Dir(), "reqs", tt.name+".req"),
+				filepath.Join(p.Dir(), "certs_by_serial", formatSerial(issued.Serial)+".pem"),
+			} {
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("Expected %s to exist: %v", path, err)
+				}
+			}
+
+			if _, err := parsePrivateKey(issued.KeyPEM); err != nil {
+				t.Errorf("Issued key does not parse: %v", err)
+			}
+		})
+	}
+
+	if _, err := p.IssueClient("ecdsa-user", IssueOptions{}); err == nil {
+		t.Error("Expected duplicate issue for a valid certificate to fail")
+	}
+	if _, err := p.IssueClient("../escape", IssueOptions{}); err == nil {
+		t.Error("Expected path traversal common name to be rejected")
+	}
+}
+
+// TestRevokeAndCRL verifies revocation updates the index and appears in a signed CRL
+func TestRevokeAndCRL(t *testing.T) {
+	p := newTestPKI(t)
+
+	alice, err := p.IssueClient("alice", IssueOptions{})
+	if err != nil {
+		t.Fatalf("IssueClient failed: %v", err)
+	}
+	if _, err := p.IssueClient("bob", IssueOptions{}); err != nil {
+		t.Fatalf("IssueClient failed: %v", err)
+	}
+
+	revoked, err := p.RevokeCommonName("alice", ReasonCessationOfOperation)
+	if err != nil {
+		t.Fatalf("RevokeCommonName failed: %v", err)
+	}
+	if len(revoked) != 1 || revoked[0].Cmp(alice.Serial) != 0 {
+		t.Fatalf("Expected alice's serial to be revoked, got %v", revoked)
+	}
+
+	if err := p.Revoke(alice.Serial, ReasonUnspecified); err == nil {
+		t.Error("Expected revoking twice to fail")
+	}
+
+	// Revoked files are archived so the name can be issued again
+	if _, err := os.Stat(filepath.Join(p.Dir(), "issued", "alice.crt")); !os.IsNotExist(err) {
+		t.Error("Expected issued/alice.crt to be moved after revocation")
+	}
+	if _, err := os.Stat(filepath.Join(p.Dir(), "revoked", "certs_by_serial", formatSerial(alice.Serial)+".crt")); err != nil {
+		t.Errorf("Expected revoked certificate archive: %v", err)
+	}
+	if _, err := p.IssueClient("alice", IssueOptions{}); err != nil {
+		t.Errorf("Expected re-issue after revocation to succeed: %v", err)
+	}
+
+	info, err := p.GenerateCRL(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateCRL failed: %v", err)
+	}
+	if info.Number.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("Expected CRL number 1, got %v", info.Number)
+	}
+	if info.RevokedCount != 1 {
+		t.Errorf("Expected 1 revoked certificate, got %d", info.RevokedCount)
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.Dir(), "crl.pem"))
+	if err != nil {
+		t.Fatalf("Failed to read crl.pem: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatal("Expected X509 CRL PEM block")
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse CRL: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(p.CACertificate()); err != nil {
+		t.Errorf("CRL signature invalid: %v", err)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 || crl.RevokedCertificateEntries[0].SerialNumber.Cmp(alice.Serial) != 0 {
+		t.Errorf("Expected CRL to list alice's serial")
+	}
+	if crl.RevokedCertificateEntries[0].ReasonCode != ReasonCessationOfOperation {
+		t.Errorf("Expected reason %d, got %d", ReasonCessationOfOperation, crl.RevokedCertificateEntries[0].ReasonCode)
+	}
+
+	next, err := p.GenerateCRL(0)
+	if err != nil {
+		t.Fatalf("GenerateCRL failed: %v", err)
+	}
+	if next.Number.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("Expected CRL number 2, got %v", next.Number)
+	}
+}
+
+// TestOpenEasyRSALayout verifies an EasyRSA-style directory can be reopened and its index parsed
+func TestOpenEasyRSALayout(t *testing.T) {
+	p := newTestPKI(t)
+
+	// Lines as written by "easyrsa sign-req" and "easyrsa revoke"
+	index := "V\t270407120000Z\t\t0A1B2C\tunknown\t/CN=server\n" +
+		"R\t270407120000Z\t250101000000Z,keyCompromise\t0A1B2D\tunknown\t/CN=legacy\n"
+	if err := os.WriteFile(filepath.Join(p.Dir(), "index.txt"), []byte(index), 0600); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+
+	reopened, err := Open(p.Dir())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	entries, err := reopened.Index()
+	if err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].CommonName() != "server" || entries[0].SerialHex() != "0A1B2C" {
+		t.Errorf("Unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Status != StatusRevoked || entries[1].Reason != ReasonKeyCompromise {
+		t.Errorf("Unexpected revoked entry: %+v", entries[1])
+	}
+
+	for i, line := range strings.Split(strings.TrimSpace(index), "\n") {
+		if entries[i].String() != line {
+			t.Errorf("Expected round trip %q, got %q", line, entries[i].String())
+		}
+	}
+
+	if _, err := reopened.IssueClient("newuser", IssueOptions{}); err != nil {
+		t.Fatalf("IssueClient on reopened PKI failed: %v", err)
+	}
+	entries, _ = reopened.Index()
+	if len(entries) != 3 || entries[2].CommonName() != "newuser" {
+		t.Errorf("Expected existing entries to be preserved, got %d entries", len(entries))
+	}
+}
+
+// TestRenewClient verifies a replacement certificate is issued while the old one stays valid
+func TestRenewClient(t *testing.T) {
+	p := newTestPKI(t)
+
+	original, err := p.IssueClient("carol", IssueOptions{Lifetime: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("IssueClient failed: %v", err)
+	}
+
+	renewed, err := p.RenewClient("carol", IssueOptions{Lifetime: 90 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("RenewClient failed: %v", err)
+	}
+	if renewed.Serial.Cmp(original.Serial) == 0 {
+		t.Error("Expected renewal to use a new serial")
+	}
+	if !renewed.NotAfter.After(original.NotAfter) {
+		t.Errorf("Expected renewed expiry %v after original %v", renewed.NotAfter, original.NotAfter)
+	}
+
+	entries, err := p.FindByCommonName("carol")
+	if err != nil {
+		t.Fatalf("FindByCommonName failed: %v", err)
+	}
+	if len(entries) != 2 || !entries[0].IsValid(time.Now()) || !entries[1].IsValid(time.Now()) {
+		t.Errorf("Expected both certificates to be valid, got %+v", entries)
+	}
+
+	issued, err := os.ReadFile(filepath.Join(p.Dir(), "issued", "carol.crt"))
+	if err != nil {
+		t.Fatalf("Failed to read issued certificate: %v", err)
+	}
+	if parseCertPEM(t, issued).SerialNumber.Cmp(renewed.Serial) != 0 {
+		t.Error("Expected issued/carol.crt to hold the renewed certificate")
+	}
+
+	revoked, err := p.RevokeCommonName("carol", ReasonUnspecified)
+	if err != nil {
+		t.Fatalf("RevokeCommonName failed: %v", err)
+	}
+	if len(revoked) != 2 {
+		t.Errorf("Expected both certificates to be revoked, got %d", len(revoked))
+	}
+}
+
+// TestIssueNode verifies node certificates authenticate TLS servers for their hosts and TLS clients
+func TestIssueNode(t *testing.T) {
+	p := newTestPKI(t)
+
+	if _, err := p.IssueNode("node-1", nil, IssueOptions{}); err == nil {
+		t.Error("Expected a node certificate without hosts to be rejected")
+	}
+
+	issued, err := p.IssueNode("node-1", []string{"vpn1.example.com", "10.0.0.5"}, IssueOptions{})
+	if err != nil {
+		t.Fatalf("IssueNode failed: %v", err)
+	}
+	cert := parseCertPEM(t, issued.CertPEM)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(p.CACertificate())
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{usage}}); err != nil {
+			t.Errorf("Expected the certificate to verify for usage %v: %v", usage, err)
+		}
+	}
+	for _, host := range []string{"vpn1.example.com", "10.0.0.5"} {
+		if err := cert.VerifyHostname(host); err != nil {
+			t.Errorf("Expected the certificate to be valid for %s: %v", host, err)
+		}
+	}
+	if err := cert.VerifyHostname("vpn2.example.com"); err == nil {
+		t.Error("Expected the certificate to be invalid for another host")
+	}
+
+	// Re-issuing keeps the previous certificate valid, like a renewal
+	reissued, err := p.IssueNode("node-1", []string{"vpn1.example.com"}, IssueOptions{})
+	if err != nil {
+		t.Fatalf("Expected a node certificate to be re-issued: %v", err)
+	}
+	for _, serial := range []*big.Int{issued.Serial, reissued.Serial} {
+		if err := p.CheckValid(serial); err != nil {
+			t.Errorf("Expected certificate %s to be valid: %v", formatSerial(serial), err)
+		}
+	}
+
+	// Revoking the node refuses every certificate it was issued
+	if _, err := p.RevokeCommonName("node-1", ReasonCessationOfOperation); err != nil {
+		t.Fatalf("RevokeCommonName failed: %v", err)
+	}
+	for _, serial := range []*big.Int{issued.Serial, reissued.Serial} {
+		if err := p.CheckValid(serial); err == nil {
+			t.Errorf("Expected revoked certificate %s to be refused", formatSerial(serial))
+		}
+	}
+	if err := p.CheckValid(big.NewInt(12345)); err == nil {
+		t.Error("Expected a certificate missing from the index to be refused")
+	}
+}
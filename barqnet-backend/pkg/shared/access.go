@@ -0,0 +1,99 @@
+package shared
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// AccessOverrides holds the per-user settings merged into an access list
+type AccessOverrides struct {
+	// Session limits of users with a limit of their own or of their plan; others get DefaultMaxSessions
+	MaxSessions        map[string]int
+	DefaultMaxSessions int
+	// Why users are blocked, such as an exhausted data quota
+	Blocked map[string]string
+	// Rate limits of users with a limit of their own or of their plan
+	Bandwidth map[string]Bandwidth
+}
+
+// NewAccessList builds the access list end-nodes authorize connections against from the
+// management user list. Unlike the desired state it keeps inactive and expired users, so
+// end-nodes can tell them apart from users they never heard of.
+func NewAccessList(users []User, overrides AccessOverrides, now time.Time) *AccessList {
+	list := &AccessList{
+		Users:       make([]UserAccess, 0, len(users)),
+		GeneratedAt: now,
+	}
+
+	for _, user := range users {
+		maxSessions, ok := overrides.MaxSessions[user.Username]
+		if !ok {
+			maxSessions = overrides.DefaultMaxSessions
+		}
+		access := UserAccess{
+			Username:    user.Username,
+			Active:      user.Active,
+			ExpiresAt:   user.ExpiresAt,
+			MaxSessions: maxSessions,
+			Blocked:     overrides.Blocked[user.Username],
+		}
+		if bw, ok := overrides.Bandwidth[user.Username]; ok {
+			access.Bandwidth = &bw
+		}
+		list.Users = append(list.Users, access)
+	}
+
+	sort.Slice(list.Users, func(i, j int) bool {
+		return list.Users[i].Username < list.Users[j].Username
+	})
+
+	hash := sha256.New()
+	for _, user := range list.Users {
+		var expires int64
+		if !user.ExpiresAt.IsZero() {
+			expires = user.ExpiresAt.Unix()
+		}
+		var bw Bandwidth
+		if user.Bandwidth != nil {
+			bw = *user.Bandwidth
+		}
+		fmt.Fprintf(hash, "%s:%v:%d:%d:%s:%d:%d\n", user.Username, user.Active, expires, user.MaxSessions,
+			user.Blocked, bw.DownKbps, bw.UpKbps)
+	}
+	list.Version = hex.EncodeToString(hash.Sum(nil))[:16]
+
+	return list
+}
+
+// Authorize decides whether the account may connect. It returns an empty reason when the
+// connection is allowed. Session limits span end-nodes and are checked by management.
+func (u *UserAccess) Authorize(now time.Time) string {
+	if !u.Active {
+		return "account is deactivated"
+	}
+	if !u.ExpiresAt.IsZero() && !now.Before(u.ExpiresAt) {
+		return fmt.Sprintf("account expired at %s", u.ExpiresAt.Format(time.RFC3339))
+	}
+	if u.Blocked != "" {
+		return u.Blocked
+	}
+	return ""
+}
+
+// RenderClientConnectConfig renders the per-user config the client-connect hook hands back
+// to OpenVPN. Sessions of expiring accounts end when the account expires.
+func RenderClientConnectConfig(u *UserAccess, now time.Time) string {
+	var b bytes.Buffer
+
+	if !u.ExpiresAt.IsZero() {
+		if remaining := int(u.ExpiresAt.Sub(now).Seconds()); remaining > 0 {
+			fmt.Fprintf(&b, "session-timeout %d\n", remaining)
+		}
+	}
+
+	return b.String()
+}
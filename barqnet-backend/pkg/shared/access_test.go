@@ -0,0 +1,90 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+// TestNewAccessList verifies inactive users are kept and the version follows access changes
+func TestNewAccessList(t *testing.T) {
+	now := time.Now()
+	users := []User{
+		{Username: "bob", Active: true},
+		{Username: "alice", Active: false},
+	}
+
+	list := NewAccessList(users, AccessOverrides{MaxSessions: map[string]int{"alice": 1}, DefaultMaxSessions: 2}, now)
+	if len(list.Users) != 2 || list.Users[0].Username != "alice" || list.Users[0].Active {
+		t.Fatalf("Expected both users sorted by name, got %+v", list.Users)
+	}
+	if list.Users[0].MaxSessions != 1 || list.Users[1].MaxSessions != 2 {
+		t.Errorf("Expected session limits 1 and the default 2, got %d and %d", list.Users[0].MaxSessions, list.Users[1].MaxSessions)
+	}
+
+	if again := NewAccessList([]User{users[1], users[0]}, AccessOverrides{MaxSessions: map[string]int{"alice": 1}, DefaultMaxSessions: 2}, now.Add(time.Minute)); again.Version != list.Version {
+		t.Errorf("Expected version %s regardless of order, got %s", list.Version, again.Version)
+	}
+
+	users[0].Active = false
+	if changed := NewAccessList(users, AccessOverrides{MaxSessions: map[string]int{"alice": 1}, DefaultMaxSessions: 2}, now); changed.Version == list.Version {
+		t.Error("Expected version to change when a user is deactivated")
+	}
+	users[0].Active = true
+	users[0].ExpiresAt = now.Add(time.Hour)
+	if changed := NewAccessList(users, AccessOverrides{MaxSessions: map[string]int{"alice": 1}, DefaultMaxSessions: 2}, now); changed.Version == list.Version {
+		t.Error("Expected version to change when a user's expiry changes")
+	}
+	users[0].ExpiresAt = time.Time{}
+	if changed := NewAccessList(users, AccessOverrides{MaxSessions: map[string]int{"alice": 1, "bob": 3}, DefaultMaxSessions: 2}, now); changed.Version == list.Version {
+		t.Error("Expected version to change when a user's session limit changes")
+	}
+	if changed := NewAccessList(users, AccessOverrides{MaxSessions: map[string]int{"alice": 1}, DefaultMaxSessions: 2, Blocked: map[string]string{"bob": "data quota exceeded"}}, now); changed.Version == list.Version {
+		t.Error("Expected version to change when a user is blocked")
+	}
+
+	limited := NewAccessList(users, AccessOverrides{Bandwidth: map[string]Bandwidth{"bob": {DownKbps: 10000, UpKbps: 2000}}}, now)
+	if limited.Users[1].Bandwidth == nil || limited.Users[1].Bandwidth.DownKbps != 10000 || limited.Users[0].Bandwidth != nil {
+		t.Errorf("Expected a bandwidth limit for bob only, got %+v", limited.Users)
+	}
+	if slower := NewAccessList(users, AccessOverrides{Bandwidth: map[string]Bandwidth{"bob": {DownKbps: 5000, UpKbps: 2000}}}, now); slower.Version == limited.Version {
+		t.Error("Expected version to change when a user's bandwidth limit changes")
+	}
+}
+
+// TestUserAccessAuthorize verifies deactivated, expired and blocked users are rejected
+func TestUserAccessAuthorize(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		access  UserAccess
+		allowed bool
+	}{
+		{"active", UserAccess{Active: true}, true},
+		{"deactivated", UserAccess{Active: false}, false},
+		{"expired", UserAccess{Active: true, ExpiresAt: now.Add(-time.Second)}, false},
+		{"not yet expired", UserAccess{Active: true, ExpiresAt: now.Add(time.Hour)}, true},
+		{"blocked", UserAccess{Active: true, Blocked: "data quota exceeded"}, false},
+	}
+
+	for _, tt := range tests {
+		reason := tt.access.Authorize(now)
+		if (reason == "") != tt.allowed {
+			t.Errorf("%s: expected allowed=%v, got reason %q", tt.name, tt.allowed, reason)
+		}
+	}
+}
+
+// TestRenderClientConnectConfig verifies sessions of expiring accounts get a session timeout
+func TestRenderClientConnectConfig(t *testing.T) {
+	now := time.Now()
+
+	if config := RenderClientConnectConfig(&UserAccess{Active: true}, now); config != "" {
+		t.Errorf("Expected no config for an account without expiry, got %q", config)
+	}
+
+	config := RenderClientConnectConfig(&UserAccess{Active: true, ExpiresAt: now.Add(time.Hour)}, now)
+	if config != "session-timeout 3600\n" {
+		t.Errorf("Expected session-timeout 3600, got %q", config)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net"
+	"net/netip"
+	"regexp"
 	"strings"
 )
 
@@ -193,3 +196,26 @@ func (am *AuditManager) ListAuditLogByUser(username string, limit int) ([]AuditL
 
 	return logs, rows.Err()
 }
+
+// endNodeAuditAction matches the audit actions end-nodes log, such as user_kicked
+var endNodeAuditAction = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Validate checks an audit event shipped by an end-node
+func (e *EndNodeAuditEvent) Validate() error {
+	if !endNodeAuditAction.MatchString(e.Action) {
+		return fmt.Errorf("invalid action %q", e.Action)
+	}
+	if len(e.Username) > 255 || len(e.Details) > 4096 {
+		return fmt.Errorf("username or details too long")
+	}
+	if e.IPAddress != "" {
+		host := e.IPAddress
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if _, err := netip.ParseAddr(host); err != nil {
+			return fmt.Errorf("invalid ip_address %q", e.IPAddress)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package shared
+
+import "testing"
+
+// TestEndNodeAuditEventValidate verifies end-node audit events are checked before they reach the audit log
+func TestEndNodeAuditEventValidate(t *testing.T) {
+	for _, event := range []EndNodeAuditEvent{
+		{Action: "user_kicked", Username: "alice", IPAddress: "198.51.100.7:51234"},
+		{Action: "ovpn_created", IPAddress: "[2001:db8::1]:8081"},
+		{Action: "wireguard_deleted"},
+	} {
+		if err := event.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", event, err)
+		}
+	}
+
+	for _, event := range []EndNodeAuditEvent{
+		{Action: ""},
+		{Action: "USER_KICKED"},
+		{Action: "user kicked"},
+		{Action: "user_kicked", IPAddress: "not-an-address"},
+	} {
+		if err := event.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", event)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package shared
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// maxBandwidthKbps bounds a configured rate limit (10 Gbit/s)
+const maxBandwidthKbps = 10000000
+
+// Validate checks a bandwidth limit
+func (l *BandwidthLimit) Validate() error {
+	if (l.Username == "") == (l.Plan == "") {
+		return fmt.Errorf("exactly one of username or plan is required")
+	}
+	if l.Plan != "" {
+		if err := ValidatePlan(l.Plan); err != nil {
+			return err
+		}
+	}
+	if l.DownKbps < 0 || l.DownKbps > maxBandwidthKbps || l.UpKbps < 0 || l.UpKbps > maxBandwidthKbps {
+		return fmt.Errorf("down_kbps and up_kbps must be between 0 and %d", maxBandwidthKbps)
+	}
+	if l.DownKbps == 0 && l.UpKbps == 0 {
+		return fmt.Errorf("at least one of down_kbps or up_kbps is required")
+	}
+	return nil
+}
+
+// BandwidthLimitManager stores per-user and per-plan bandwidth limits
+type BandwidthLimitManager struct {
+	db *DB
+}
+
+// NewBandwidthLimitManager creates a new bandwidth limit manager
+func NewBandwidthLimitManager(db *DB) *BandwidthLimitManager {
+	return &BandwidthLimitManager{db: db}
+}
+
+// ListLimits returns all per-user and per-plan bandwidth limits
+func (bm *BandwidthLimitManager) ListLimits() ([]BandwidthLimit, error) {
+	rows, err := bm.db.conn.Query(`
+		SELECT COALESCE(username, ''), COALESCE(plan, ''), down_kbps, up_kbps, updated_at
+		FROM bandwidth_limits ORDER BY plan NULLS FIRST, username
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := []BandwidthLimit{}
+	for rows.Next() {
+		var l BandwidthLimit
+		if err := rows.Scan(&l.Username, &l.Plan, &l.DownKbps, &l.UpKbps, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		limits = append(limits, l)
+	}
+	return limits, rows.Err()
+}
+
+// SetLimit saves the bandwidth limit of a user or plan, replacing a previous one
+func (bm *BandwidthLimitManager) SetLimit(l *BandwidthLimit) error {
+	if err := l.Validate(); err != nil {
+		return fmt.Errorf("invalid bandwidth limit: %v", err)
+	}
+
+	conflict := "(username) WHERE username IS NOT NULL"
+	if l.Plan != "" {
+		conflict = "(plan) WHERE plan IS NOT NULL"
+	}
+
+	return bm.db.conn.QueryRow(`
+		INSERT INTO bandwidth_limits (username, plan, down_kbps, up_kbps, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT `+conflict+` DO UPDATE SET
+			down_kbps = EXCLUDED.down_kbps,
+			up_kbps = EXCLUDED.up_kbps,
+			updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`, sql.NullString{String: l.Username, Valid: l.Username != ""}, sql.NullString{String: l.Plan, Valid: l.Plan != ""},
+		l.DownKbps, l.UpKbps).Scan(&l.UpdatedAt)
+}
+
+// DeleteLimit removes the bandwidth limit of a user or, when username is empty, a plan
+func (bm *BandwidthLimitManager) DeleteLimit(username, plan string) error {
+	result, err := bm.db.conn.Exec(`
+		DELETE FROM bandwidth_limits
+		WHERE username IS NOT DISTINCT FROM $1 AND plan IS NOT DISTINCT FROM $2
+	`, sql.NullString{String: username, Valid: username != ""}, sql.NullString{String: plan, Valid: plan != ""})
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ResolveLimits returns the bandwidth that applies to each user with a limit of their
+// own or of their plan. Users without one are left out.
+func (bm *BandwidthLimitManager) ResolveLimits() (map[string]Bandwidth, error) {
+	rows, err := bm.db.conn.Query(`
+		SELECT DISTINCT ON (u.username) u.username, l.down_kbps, l.up_kbps
+		FROM users u
+		JOIN bandwidth_limits l ON l.username = u.username OR (l.plan IS NOT NULL AND l.plan = u.plan)
+		ORDER BY u.username, l.username NULLS LAST
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := make(map[string]Bandwidth)
+	for rows.Next() {
+		var username string
+		var bw Bandwidth
+		if err := rows.Scan(&username, &bw.DownKbps, &bw.UpKbps); err != nil {
+			return nil, err
+		}
+		limits[username] = bw
+	}
+	return limits, rows.Err()
+}
@@ -0,0 +1,124 @@
+package shared
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Certificate status values
+const (
+	CertStatusValid   = "valid"
+	CertStatusExpired = "expired"
+	CertStatusRevoked = "revoked"
+	CertStatusNone    = "none" // no certificate issued, e.g. WireGuard-only users
+)
+
+// CertificateManager tracks client certificates reported by end-nodes
+type CertificateManager struct {
+	db *DB
+}
+
+// NewCertificateManager creates a new certificate manager
+func NewCertificateManager(db *DB) *CertificateManager {
+	return &CertificateManager{db: db}
+}
+
+// ReplaceCertificates replaces the certificate inventory of an end-node with the reported one
+func (cm *CertificateManager) ReplaceCertificates(serverID string, certs []ClientCertificate) error {
+	tx, err := cm.db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM client_certificates WHERE server_id = $1`, serverID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO client_certificates (username, server_id, serial, not_after, status, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	now := time.Now()
+	for _, cert := range certs {
+		if _, err := tx.Exec(query, cert.Username, serverID, cert.Serial, cert.NotAfter, cert.Status, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListCertificates returns certificates across all end-nodes ordered by expiry.
+// When expiringWithin is positive only unrevoked certificates expiring before now+expiringWithin are returned.
+func (cm *CertificateManager) ListCertificates(expiringWithin time.Duration) ([]ClientCertificate, error) {
+	query := `
+		SELECT username, server_id, serial, not_after, status, updated_at
+		FROM client_certificates
+	`
+	args := []interface{}{}
+	if expiringWithin > 0 {
+		query += ` WHERE status <> 'revoked' AND not_after <= $1`
+		args = append(args, time.Now().Add(expiringWithin))
+	}
+	query += ` ORDER BY not_after, server_id, username`
+
+	rows, err := cm.db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	certs := []ClientCertificate{}
+	for rows.Next() {
+		var cert ClientCertificate
+		if err := rows.Scan(&cert.Username, &cert.ServerID, &cert.Serial, &cert.NotAfter, &cert.Status, &cert.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		// Status is as last reported; expiry may have passed since
+		if cert.Status == CertStatusValid && now.After(cert.NotAfter) {
+			cert.Status = CertStatusExpired
+		}
+		cert.DaysRemaining = DaysUntil(cert.NotAfter, now)
+
+		certs = append(certs, cert)
+	}
+
+	return certs, rows.Err()
+}
+
+// DaysUntil returns the whole days from now until t, negative once t has passed
+func DaysUntil(t, now time.Time) int {
+	return int(math.Floor(t.Sub(now).Hours() / 24))
+}
+
+// ParseExpiryWindow parses an expiring_within value such as "30d", "720h" or "30" (days)
+func ParseExpiryWindow(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	days := strings.TrimSuffix(value, "d")
+	if n, err := strconv.Atoi(days); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("expiry window must not be negative")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expiry window %q, use days (30d) or a duration (720h)", value)
+	}
+	if window < 0 {
+		return 0, fmt.Errorf("expiry window must not be negative")
+	}
+	return window, nil
+}
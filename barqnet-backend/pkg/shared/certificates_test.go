@@ -0,0 +1,28 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDaysUntil verifies partial days round down, also once the time has passed
+func TestDaysUntil(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		days float64
+		want int
+	}{
+		{-1.0, -1},
+		{-0.5, -1},
+		{0, 0},
+		{0.5, 0},
+		{1.0, 1},
+		{30.9, 30},
+	}
+	for _, tt := range tests {
+		expiry := now.Add(time.Duration(tt.days * 24 * float64(time.Hour)))
+		if got := DaysUntil(expiry, now); got != tt.want {
+			t.Errorf("DaysUntil(%v days) = %d, want %d", tt.days, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package shared
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// CCDHeader is the first line of every client-config-dir file written by an end-node.
+// Files without it were created by hand and are never touched.
+const CCDHeader = "# Managed by the BarqNet end-node"
+
+// maxClientRoutes caps the routes and iroutes of one CCD entry
+const maxClientRoutes = 64
+
+var ccdUsernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,32}$`)
+
+// Validate checks the entry on its own; RenderCCD checks it against the server profile
+func (e *ClientConfigEntry) Validate() error {
+	if !ccdUsernamePattern.MatchString(e.Username) {
+		return fmt.Errorf("username must be 3-32 alphanumeric characters or underscores")
+	}
+	if len(e.ServerID) > 255 {
+		return fmt.Errorf("server_id is too long")
+	}
+
+	if e.StaticIP != "" {
+		addr, err := netip.ParseAddr(e.StaticIP)
+		if err != nil || !addr.Is4() {
+			return fmt.Errorf("static_ip must be an IPv4 address")
+		}
+	}
+
+	if e.StaticIP == "" && len(e.Routes) == 0 && len(e.IRoutes) == 0 {
+		return fmt.Errorf("entry must set static_ip, routes or iroutes")
+	}
+
+	for name, networks := range map[string][]string{"routes": e.Routes, "iroutes": e.IRoutes} {
+		if len(networks) > maxClientRoutes {
+			return fmt.Errorf("at most %d %s are allowed", maxClientRoutes, name)
+		}
+		seen := make(map[netip.Prefix]bool)
+		for _, network := range networks {
+			prefix, err := parseIPv4Network(network)
+			if err != nil {
+				return fmt.Errorf("invalid %s entry: %v", name, err)
+			}
+			if seen[prefix] {
+				return fmt.Errorf("duplicate %s entry %s", name, network)
+			}
+			seen[prefix] = true
+		}
+	}
+
+	return nil
+}
+
+// parseIPv4Network parses an IPv4 network in CIDR notation; host bits must be zero
+func parseIPv4Network(network string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(network)
+	if err != nil || !prefix.Addr().Is4() {
+		return netip.Prefix{}, fmt.Errorf("%q is not an IPv4 network such as 192.168.10.0/24", network)
+	}
+	if prefix.Masked() != prefix {
+		return netip.Prefix{}, fmt.Errorf("%q is not a network address, use %s", network, prefix.Masked())
+	}
+	return prefix, nil
+}
+
+// RenderCCD renders the client-config-dir file for an entry. The static IP must lie in the
+// addresses the profile reserves for it, and networks behind the client must not overlap the VPN subnet.
+func RenderCCD(profile *ServerProfile, entry *ClientConfigEntry) ([]byte, error) {
+	if err := entry.Validate(); err != nil {
+		return nil, err
+	}
+	subnet, err := netip.ParsePrefix(profile.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server profile subnet %q", profile.Subnet)
+	}
+	mask := net.IP(net.CIDRMask(subnet.Bits(), 32))
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s: local changes are overwritten on the next sync\n", CCDHeader)
+	fmt.Fprintf(&b, "# Client config for %s\n", entry.Username)
+
+	if entry.StaticIP != "" {
+		addr, _ := netip.ParseAddr(entry.StaticIP)
+		first, last, ok := profile.StaticRange()
+		if !ok {
+			return nil, fmt.Errorf("server profile %q reserves no static addresses", profile.Name)
+		}
+		if addr.Less(first) || last.Less(addr) {
+			return nil, fmt.Errorf("static_ip %s is outside the reserved range %s-%s", addr, first, last)
+		}
+		fmt.Fprintf(&b, "ifconfig-push %s %s\n", addr, mask)
+	}
+
+	for _, network := range entry.Routes {
+		prefix, _ := parseIPv4Network(network)
+		fmt.Fprintf(&b, "push \"route %s %s\"\n", prefix.Addr(), net.IP(net.CIDRMask(prefix.Bits(), 32)))
+	}
+
+	for _, network := range entry.IRoutes {
+		prefix, _ := parseIPv4Network(network)
+		if prefix.Overlaps(subnet) {
+			return nil, fmt.Errorf("iroute %s overlaps the VPN subnet %s", network, profile.Subnet)
+		}
+		fmt.Fprintf(&b, "iroute %s %s\n", prefix.Addr(), net.IP(net.CIDRMask(prefix.Bits(), 32)))
+	}
+
+	return b.Bytes(), nil
+}
+
+// ClientConfigManager stores per-user CCD entries on the management server
+type ClientConfigManager struct {
+	db *DB
+}
+
+// NewClientConfigManager creates a new client config manager
+func NewClientConfigManager(db *DB) *ClientConfigManager {
+	return &ClientConfigManager{db: db}
+}
+
+// SetEntry validates and stores an entry, replacing the user's entry for the same end-node.
+// A static IP already held by another user on an overlapping scope is rejected.
+func (cm *ClientConfigManager) SetEntry(entry *ClientConfigEntry) error {
+	if err := entry.Validate(); err != nil {
+		return fmt.Errorf("invalid client config: %v", err)
+	}
+	if entry.Routes == nil {
+		entry.Routes = []string{}
+	}
+	if entry.IRoutes == nil {
+		entry.IRoutes = []string{}
+	}
+
+	routes, _ := json.Marshal(entry.Routes)
+	iroutes, _ := json.Marshal(entry.IRoutes)
+	staticIP := sql.NullString{String: entry.StaticIP, Valid: entry.StaticIP != ""}
+
+	tx, err := cm.db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serialize static IP assignment so two users cannot claim the same address concurrently
+	if _, err := tx.Exec(`LOCK TABLE user_client_configs IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+
+	if entry.StaticIP != "" {
+		var holder string
+		err := tx.QueryRow(`
+			SELECT username FROM user_client_configs
+			WHERE static_ip = $1 AND username <> $2
+			  AND (server_id = '' OR $3 = '' OR server_id = $3)
+			LIMIT 1
+		`, entry.StaticIP, entry.Username, entry.ServerID).Scan(&holder)
+		if err == nil {
+			return fmt.Errorf("invalid client config: static_ip %s is already assigned to %s", entry.StaticIP, holder)
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	entry.UpdatedAt = time.Now()
+	_, err = tx.Exec(`
+		INSERT INTO user_client_configs (username, server_id, static_ip, routes, iroutes, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (username, server_id) DO UPDATE
+		SET static_ip = EXCLUDED.static_ip, routes = EXCLUDED.routes,
+		    iroutes = EXCLUDED.iroutes, updated_at = EXCLUDED.updated_at
+	`, entry.Username, entry.ServerID, staticIP, routes, iroutes, entry.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetEntries returns a user's entries, the entry for all end-nodes first
+func (cm *ClientConfigManager) GetEntries(username string) ([]ClientConfigEntry, error) {
+	rows, err := cm.db.conn.Query(`
+		SELECT username, server_id, static_ip, routes, iroutes, updated_at
+		FROM user_client_configs WHERE username = $1
+		ORDER BY server_id
+	`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanClientConfigs(rows)
+}
+
+// DeleteEntry removes a user's entry for an end-node, or for all end-nodes when serverID is empty
+func (cm *ClientConfigManager) DeleteEntry(username, serverID string) error {
+	result, err := cm.db.conn.Exec(`
+		DELETE FROM user_client_configs WHERE username = $1 AND server_id = $2
+	`, username, serverID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DesiredForServer returns the versioned CCD entries an end-node should hold. Entries of
+// inactive users are left out, and an entry for the end-node replaces the user's entry for all end-nodes.
+func (cm *ClientConfigManager) DesiredForServer(serverID string, now time.Time) (*ClientConfigSet, error) {
+	rows, err := cm.db.conn.Query(`
+		SELECT DISTINCT ON (c.username) c.username, c.server_id, c.static_ip, c.routes, c.iroutes, c.updated_at
+		FROM user_client_configs c
+		JOIN users u ON u.username = c.username
+		WHERE u.active = true AND (u.expires_at IS NULL OR u.expires_at > $2)
+		  AND (c.server_id = '' OR c.server_id = $1)
+		ORDER BY c.username, c.server_id DESC
+	`, serverID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries, err := scanClientConfigs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClientConfigSet(entries, now), nil
+}
+
+// NewClientConfigSet builds a client config set. The version is a hash of the rendered
+// settings, so it only changes when a CCD file would.
+func NewClientConfigSet(entries []ClientConfigEntry, now time.Time) *ClientConfigSet {
+	set := &ClientConfigSet{
+		Entries:     append([]ClientConfigEntry{}, entries...),
+		GeneratedAt: now,
+	}
+	sort.Slice(set.Entries, func(i, j int) bool {
+		return set.Entries[i].Username < set.Entries[j].Username
+	})
+
+	hash := sha256.New()
+	for _, entry := range set.Entries {
+		fmt.Fprintf(hash, "%s|%s|%v|%v\n", entry.Username, entry.StaticIP, entry.Routes, entry.IRoutes)
+	}
+	set.Version = hex.EncodeToString(hash.Sum(nil))[:16]
+
+	return set
+}
+
+// scanClientConfigs reads user_client_configs rows
+func scanClientConfigs(rows *sql.Rows) ([]ClientConfigEntry, error) {
+	entries := []ClientConfigEntry{}
+	for rows.Next() {
+		var (
+			entry           ClientConfigEntry
+			staticIP        sql.NullString
+			routes, iroutes []byte
+		)
+		if err := rows.Scan(&entry.Username, &entry.ServerID, &staticIP, &routes, &iroutes, &entry.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(routes, &entry.Routes); err != nil {
+			return nil, fmt.Errorf("failed to parse routes of %s: %v", entry.Username, err)
+		}
+		if err := json.Unmarshal(iroutes, &entry.IRoutes); err != nil {
+			return nil, fmt.Errorf("failed to parse iroutes of %s: %v", entry.Username, err)
+		}
+		entry.StaticIP = staticIP.String
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,118 @@
+package shared
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStaticRange verifies the reserved block sits at the top of the subnet and the pool stops below it
+func TestStaticRange(t *testing.T) {
+	profile := DefaultServerProfile()
+	if _, _, ok := profile.StaticRange(); ok {
+		t.Error("Expected default profile to reserve no static addresses")
+	}
+
+	profile.StaticAddresses = 50
+	if err := profile.Validate(); err != nil {
+		t.Fatalf("Expected profile with static addresses to be valid, got %v", err)
+	}
+
+	first, last, ok := profile.StaticRange()
+	if !ok || first.String() != "10.8.0.205" || last.String() != "10.8.0.254" {
+		t.Errorf("Expected 10.8.0.205-10.8.0.254, got %s-%s", first, last)
+	}
+
+	config, err := RenderServerConfig(profile, OpenVPNServerPaths{
+		CA: "/etc/openvpn/ca.crt", Cert: "/etc/openvpn/server.crt", Key: "/etc/openvpn/server.key",
+		TLSCryptKey: "/etc/openvpn/tls-crypt.key", CRL: "/etc/openvpn/crl.pem",
+		ClientConfigDir: "/etc/openvpn/ccd", ClientNetworks: []string{"192.168.50.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to render server config: %v", err)
+	}
+	for _, line := range []string{
+		"server 10.8.0.0 255.255.255.0 nopool",
+		"ifconfig-pool 10.8.0.2 10.8.0.204 255.255.255.0",
+		"client-config-dir /etc/openvpn/ccd",
+		"route 192.168.50.0 255.255.255.0",
+	} {
+		if !strings.Contains(string(config), line+"\n") {
+			t.Errorf("Expected server config to contain %q", line)
+		}
+	}
+
+	profile.StaticAddresses = 253
+	if err := profile.Validate(); err == nil {
+		t.Error("Expected a reservation leaving no dynamic pool to be rejected")
+	}
+}
+
+// TestRenderCCD verifies CCD rendering and its checks against the server profile
+func TestRenderCCD(t *testing.T) {
+	profile := DefaultServerProfile()
+	profile.StaticAddresses = 50
+
+	entry := &ClientConfigEntry{
+		Username: "site_office",
+		StaticIP: "10.8.0.210",
+		Routes:   []string{"172.16.0.0/16"},
+		IRoutes:  []string{"192.168.50.0/24"},
+	}
+
+	ccd, err := RenderCCD(profile, entry)
+	if err != nil {
+		t.Fatalf("Failed to render CCD: %v", err)
+	}
+	if !strings.HasPrefix(string(ccd), CCDHeader) {
+		t.Error("Expected CCD to start with the managed header")
+	}
+	for _, line := range []string{
+		"ifconfig-push 10.8.0.210 255.255.255.0",
+		"push \"route 172.16.0.0 255.255.0.0\"",
+		"iroute 192.168.50.0 255.255.255.0",
+	} {
+		if !strings.Contains(string(ccd), line+"\n") {
+			t.Errorf("Expected CCD to contain %q", line)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(e *ClientConfigEntry)
+	}{
+		{"dynamic pool address", func(e *ClientConfigEntry) { e.StaticIP = "10.8.0.20" }},
+		{"outside subnet", func(e *ClientConfigEntry) { e.StaticIP = "10.9.0.210" }},
+		{"host route", func(e *ClientConfigEntry) { e.Routes = []string{"172.16.0.1/16"} }},
+		{"duplicate route", func(e *ClientConfigEntry) { e.Routes = []string{"172.16.0.0/16", "172.16.0.0/16"} }},
+		{"iroute in vpn subnet", func(e *ClientConfigEntry) { e.IRoutes = []string{"10.8.0.0/25"} }},
+		{"username", func(e *ClientConfigEntry) { e.Username = "site\nroute" }},
+		{"empty", func(e *ClientConfigEntry) { e.StaticIP = ""; e.Routes = nil; e.IRoutes = nil }},
+	}
+
+	for _, tt := range tests {
+		bad := *entry
+		tt.modify(&bad)
+		if _, err := RenderCCD(profile, &bad); err == nil {
+			t.Errorf("Expected %s to be rejected", tt.name)
+		}
+	}
+}
+
+// TestClientConfigSetVersion verifies the version ignores order and timestamps
+func TestClientConfigSetVersion(t *testing.T) {
+	a := ClientConfigEntry{Username: "alice", StaticIP: "10.8.0.210"}
+	b := ClientConfigEntry{Username: "bob", Routes: []string{"172.16.0.0/16"}}
+
+	first := NewClientConfigSet([]ClientConfigEntry{a, b}, time.Now())
+	b.UpdatedAt = time.Now()
+	second := NewClientConfigSet([]ClientConfigEntry{b, a}, time.Now())
+	if first.Version != second.Version {
+		t.Error("Expected version to ignore entry order and timestamps")
+	}
+
+	a.StaticIP = "10.8.0.211"
+	if NewClientConfigSet([]ClientConfigEntry{a, b}, time.Now()).Version == first.Version {
+		t.Error("Expected version to change with a static IP")
+	}
+}
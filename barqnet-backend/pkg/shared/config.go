@@ -0,0 +1,137 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration of both daemons is layered: built-in defaults, then the config file,
+// then environment variables, then command line flags. Each layer only overrides the
+// settings it names.
+
+// LoadConfigFile decodes the config file at path over config, which holds the defaults.
+// Files ending in .yaml or .yml are YAML, others JSON; both use the same keys.
+// Keys that do not match a setting are rejected so typos do not silently fall back to a default.
+func LoadConfigFile(path string, config interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if data, err = yamlToJSON(data); err != nil {
+			return fmt.Errorf("invalid config file %s: %v", path, err)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return fmt.Errorf("invalid config file %s: unexpected data after the config object", path)
+	}
+	return nil
+}
+
+// yamlToJSON converts a YAML config file to JSON, so it is decoded with the same keys and checks
+func yamlToJSON(data []byte) ([]byte, error) {
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	if tree == nil {
+		tree = map[string]interface{}{}
+	}
+	return json.Marshal(tree)
+}
+
+// EnvString overrides a setting with an environment variable when it is set
+func EnvString(key string, value *string) {
+	if env := os.Getenv(key); env != "" {
+		*value = env
+	}
+}
+
+// EnvInt overrides a numeric setting with an environment variable when it is set
+func EnvInt(key string, value *int) error {
+	env := os.Getenv(key)
+	if env == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(env)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: must be an integer", key, env)
+	}
+	*value = n
+	return nil
+}
+
+// EnvBool overrides a boolean setting with an environment variable when it is set
+func EnvBool(key string, value *bool) error {
+	env := os.Getenv(key)
+	if env == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(env)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: must be true or false", key, env)
+	}
+	*value = b
+	return nil
+}
+
+// MaskedConfig renders a config as indented JSON with passwords, keys, secrets and tokens
+// masked, for printing the effective configuration
+func MaskedConfig(config interface{}) ([]byte, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(maskConfigTree(tree), "", "  ")
+}
+
+// maskConfigTree masks the non-empty string settings whose key names a secret
+func maskConfigTree(node interface{}) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && s != "" && isSensitiveConfigKey(key) {
+				v[key] = maskSensitiveValue(s)
+				continue
+			}
+			v[key] = maskConfigTree(value)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = maskConfigTree(v[i])
+		}
+	}
+	return node
+}
+
+// isSensitiveConfigKey reports whether a config key, such as api_key or
+// openvpn_management_password, holds a secret. Only the last word counts, so
+// cert_key_type is not masked.
+func isSensitiveConfigKey(key string) bool {
+	words := strings.Split(strings.ToLower(key), "_")
+	switch words[len(words)-1] {
+	case "password", "secret", "key", "token":
+		return true
+	}
+	return false
+}
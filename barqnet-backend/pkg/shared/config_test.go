@@ -0,0 +1,134 @@
+package shared
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLoadConfigFile verifies the file overrides only the settings it names and unknown keys are rejected
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	os.WriteFile(path, []byte(`{"server_id": "main", "database": {"host": "db.internal", "port": 6432}}`), 0600)
+
+	config := &ManagementConfig{Port: 8080, Database: DatabaseConfig{Host: "localhost", SSLMode: "disable"}}
+	if err := LoadConfigFile(path, config); err != nil {
+		t.Fatalf("LoadConfigFile failed: %v", err)
+	}
+	if config.ServerID != "main" || config.Database.Host != "db.internal" || config.Database.Port != 6432 {
+		t.Errorf("Expected the file's settings to be loaded, got %+v", config)
+	}
+	if config.Port != 8080 || config.Database.SSLMode != "disable" {
+		t.Errorf("Expected defaults the file does not name to be kept, got %+v", config)
+	}
+
+	for name, content := range map[string]string{
+		"unknown key":        `{"server_id": "main", "sever_port": 8080}`,
+		"unknown nested key": `{"database": {"hostname": "db"}}`,
+		"wrong type":         `{"port": "8080"}`,
+		"trailing data":      `{"port": 8080} {"port": 9090}`,
+	} {
+		path := filepath.Join(dir, "bad.json")
+		os.WriteFile(path, []byte(content), 0600)
+		if err := LoadConfigFile(path, &ManagementConfig{}); err == nil {
+			t.Errorf("Expected a config file with %s to be rejected", name)
+		}
+	}
+
+	if err := LoadConfigFile(filepath.Join(dir, "missing.json"), &ManagementConfig{}); !os.IsNotExist(err) {
+		t.Errorf("Expected a not-exist error for a missing file, got %v", err)
+	}
+}
+
+// TestLoadConfigFileYAML verifies YAML config files use the same keys and checks as JSON
+func TestLoadConfigFileYAML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	os.WriteFile(path, []byte("server_id: main\ndatabase:\n  host: db.internal\n  port: 6432\nquota_warn_percents: [80, 95]\n"), 0600)
+
+	config := &ManagementConfig{Port: 8080, Database: DatabaseConfig{SSLMode: "disable"}}
+	if err := LoadConfigFile(path, config); err != nil {
+		t.Fatalf("LoadConfigFile failed: %v", err)
+	}
+	if config.ServerID != "main" || config.Database.Host != "db.internal" || config.Database.Port != 6432 || len(config.QuotaWarnPercents) != 2 {
+		t.Errorf("Expected the file's settings to be loaded, got %+v", config)
+	}
+	if config.Port != 8080 || config.Database.SSLMode != "disable" {
+		t.Errorf("Expected defaults the file does not name to be kept, got %+v", config)
+	}
+
+	for name, content := range map[string]string{
+		"unknown key":        "server_id: main\nsever_port: 8080\n",
+		"unknown nested key": "database:\n  hostname: db\n",
+		"wrong type":         "port: \"8080\"\n",
+		"invalid yaml":       "port: [8080\n",
+	} {
+		path := filepath.Join(dir, "bad.yml")
+		os.WriteFile(path, []byte(content), 0600)
+		if err := LoadConfigFile(path, &ManagementConfig{}); err == nil {
+			t.Errorf("Expected a YAML config file with %s to be rejected", name)
+		}
+	}
+
+	// An empty file changes nothing
+	os.WriteFile(path, nil, 0600)
+	if err := LoadConfigFile(path, config); err != nil || config.ServerID != "main" {
+		t.Errorf("Expected an empty YAML file to keep the settings, got %v", err)
+	}
+}
+
+// TestEnvOverrides verifies environment variables override settings only when set
+func TestEnvOverrides(t *testing.T) {
+	t.Setenv("TEST_CONFIG_HOST", "db.env")
+	t.Setenv("TEST_CONFIG_PORT", "7000")
+	t.Setenv("TEST_CONFIG_BAD_PORT", "seven")
+
+	host, unset := "db.file", "kept"
+	EnvString("TEST_CONFIG_HOST", &host)
+	EnvString("TEST_CONFIG_UNSET", &unset)
+	if host != "db.env" || unset != "kept" {
+		t.Errorf("Expected db.env and kept, got %s and %s", host, unset)
+	}
+
+	port := 5432
+	if err := EnvInt("TEST_CONFIG_PORT", &port); err != nil || port != 7000 {
+		t.Errorf("Expected port 7000, got %d (%v)", port, err)
+	}
+	if err := EnvInt("TEST_CONFIG_BAD_PORT", &port); err == nil || port != 7000 {
+		t.Errorf("Expected an invalid port to be rejected and the setting kept, got %d (%v)", port, err)
+	}
+}
+
+// TestMaskedConfig verifies secrets are masked and other settings printed as they are
+func TestMaskedConfig(t *testing.T) {
+	config := &EndNodeConfig{
+		ServerID:                  "node-1",
+		APIKey:                    "0123456789abcdef",
+		OpenVPNManagementPassword: "hunter22",
+		CertKeyType:               "ecdsa",
+		Database:                  DatabaseConfig{Password: "database-password"},
+	}
+	data, err := MaskedConfig(config)
+	if err != nil {
+		t.Fatalf("MaskedConfig failed: %v", err)
+	}
+	for _, secret := range []string{"0123456789abcdef", "hunter22", "database-password"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Expected %q to be masked in %s", secret, data)
+		}
+	}
+
+	var masked map[string]interface{}
+	if err := json.Unmarshal(data, &masked); err != nil {
+		t.Fatalf("Expected JSON output, got %v", err)
+	}
+	if masked["api_key"] != "01************ef" || masked["server_id"] != "node-1" || masked["cert_key_type"] != "ecdsa" {
+		t.Errorf("Unexpected masked config %s", data)
+	}
+	if masked["openvpn_management_password"] != "hu****22" {
+		t.Errorf("Expected the management password masked, got %v", masked["openvpn_management_password"])
+	}
+}
@@ -15,12 +15,12 @@ import (
 
 // DatabaseConfig holds PostgreSQL connection configuration
 type DatabaseConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	DBName   string `json:"dbname"`
+	SSLMode  string `json:"sslmode"`
 }
 
 // DB represents the PostgreSQL database connection
@@ -125,7 +125,14 @@ func (db *DB) initSchema() error {
 		status VARCHAR(50) NOT NULL,
 		last_check TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		response_time_ms INTEGER,
-		error_message TEXT
+		error_message TEXT,
+		cpu_percent REAL,
+		memory_percent REAL,
+		load_avg_1 REAL,
+		disk_percent REAL,
+		connected_clients INTEGER,
+		openvpn_running BOOLEAN,
+		metrics JSONB
 	);
 
 	-- Authentication users table
@@ -179,6 +186,21 @@ func (db *DB) initSchema() error {
 	-- Link servers to locations
 	ALTER TABLE servers ADD COLUMN IF NOT EXISTS location_id INTEGER REFERENCES server_locations(id);
 
+	-- Hosts VPN clients connect to, separate from the API address in host
+	ALTER TABLE servers ADD COLUMN IF NOT EXISTS public_endpoints JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+	-- OpenVPN listeners declared by end-nodes, empty for the server profile's port and protocol
+	ALTER TABLE servers ADD COLUMN IF NOT EXISTS listeners JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+	-- Session usage counted by end-nodes, alongside what clients report
+	ALTER TABLE vpn_statistics ADD COLUMN IF NOT EXISTS started_at TIMESTAMP;
+	ALTER TABLE vpn_statistics ADD COLUMN IF NOT EXISTS ended_at TIMESTAMP;
+	ALTER TABLE vpn_statistics ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'client';
+	ALTER TABLE vpn_statistics ADD COLUMN IF NOT EXISTS session_id VARCHAR(64);
+
+	-- One row per user and end-node, upserted on status updates and connects
+	ALTER TABLE vpn_connections ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
 	-- Create indexes
 	CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
 	CREATE INDEX IF NOT EXISTS idx_users_active ON users(active);
@@ -198,6 +220,9 @@ func (db *DB) initSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_vpn_statistics_username ON vpn_statistics(username);
 	CREATE INDEX IF NOT EXISTS idx_vpn_statistics_server_id ON vpn_statistics(server_id);
 	CREATE INDEX IF NOT EXISTS idx_vpn_statistics_created_at ON vpn_statistics(created_at);
+	CREATE INDEX IF NOT EXISTS idx_vpn_statistics_username_source ON vpn_statistics(username, source);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_vpn_statistics_server_session ON vpn_statistics(server_id, session_id) WHERE session_id IS NOT NULL;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_vpn_connections_username_server ON vpn_connections(username, server_id);
 	CREATE INDEX IF NOT EXISTS idx_server_locations_enabled ON server_locations(enabled);
 	CREATE INDEX IF NOT EXISTS idx_auth_users_phone_number ON auth_users(phone_number);
 	CREATE INDEX IF NOT EXISTS idx_auth_users_active ON auth_users(active);
@@ -0,0 +1,158 @@
+package shared
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// maxPublicEndpoints caps the addresses an end-node may advertise
+const maxPublicEndpoints = 8
+
+var hostnameLabelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// ValidateEndpoint checks that a host is an IPv4 address, an IPv6 address or a DNS name
+// clients can connect to. Ports and brackets are not part of the host.
+func ValidateEndpoint(host string) error {
+	if host == "" {
+		return fmt.Errorf("endpoint must not be empty")
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if addr.Zone() != "" {
+			return fmt.Errorf("endpoint %q must not carry an IPv6 zone", host)
+		}
+		if addr.IsUnspecified() {
+			return fmt.Errorf("endpoint %q is not an address clients can connect to", host)
+		}
+		return nil
+	}
+
+	name := strings.TrimSuffix(host, ".")
+	if len(name) > 253 {
+		return fmt.Errorf("endpoint %q is too long", host)
+	}
+	labels := strings.Split(name, ".")
+	for _, label := range labels {
+		if !hostnameLabelPattern.MatchString(label) {
+			return fmt.Errorf("endpoint %q is not an IP address or hostname", host)
+		}
+	}
+	// A numeric top-level label means a malformed IPv4 address, not a hostname
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return fmt.Errorf("endpoint %q is not an IP address or hostname", host)
+	}
+
+	return nil
+}
+
+// ValidateEndpoints checks a list of advertised endpoints
+func ValidateEndpoints(endpoints []string) error {
+	if len(endpoints) > maxPublicEndpoints {
+		return fmt.Errorf("at most %d public endpoints are allowed", maxPublicEndpoints)
+	}
+
+	seen := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		if err := ValidateEndpoint(endpoint); err != nil {
+			return err
+		}
+		key := strings.ToLower(endpoint)
+		if seen[key] {
+			return fmt.Errorf("duplicate endpoint %q", endpoint)
+		}
+		seen[key] = true
+	}
+
+	return nil
+}
+
+// ParseEndpoints parses a comma separated list of endpoints, e.g. from an environment variable
+func ParseEndpoints(value string) ([]string, error) {
+	var endpoints []string
+	for _, endpoint := range strings.Split(value, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	if err := ValidateEndpoints(endpoints); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// Endpoints is a list of advertised hosts stored as a JSONB array
+type Endpoints []string
+
+// Scan implements sql.Scanner
+func (e *Endpoints) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*e = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into endpoints", src)
+	}
+
+	return json.Unmarshal(data, (*[]string)(e))
+}
+
+// Value implements driver.Valuer
+func (e Endpoints) Value() (driver.Value, error) {
+	if e == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]string(e))
+}
+
+// RemoteHosts returns the hosts clients connect to, in order of preference: the public
+// endpoints the end-node advertises, or its API host for end-nodes that advertise none
+func (s *Server) RemoteHosts() []string {
+	if len(s.PublicEndpoints) > 0 {
+		return append([]string{}, s.PublicEndpoints...)
+	}
+	return []string{s.Host}
+}
+
+// PublicEndpoint returns the preferred host clients connect to
+func (s *Server) PublicEndpoint() string {
+	return s.RemoteHosts()[0]
+}
+
+// SetRemotes replaces the remote lines of an OpenVPN client config with one line per host,
+// in order. Port and protocol are taken from the first existing remote line; the config is
+// returned unchanged if it has none.
+func SetRemotes(content string, hosts []string) string {
+	lines := strings.Split(content, "\n")
+
+	var out []string
+	replaced := false
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "remote" {
+			out = append(out, line)
+			continue
+		}
+		if replaced {
+			continue
+		}
+		replaced = true
+		for _, host := range hosts {
+			out = append(out, strings.Join(append([]string{"remote", host}, fields[2:]...), " "))
+		}
+	}
+
+	if !replaced || len(hosts) == 0 {
+		return content
+	}
+	return strings.Join(out, "\n")
+}
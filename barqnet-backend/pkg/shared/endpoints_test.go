@@ -0,0 +1,63 @@
+package shared
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestValidateEndpoint verifies IPv4, IPv6 and DNS names are accepted and everything else rejected
+func TestValidateEndpoint(t *testing.T) {
+	for _, host := range []string{"203.0.113.10", "2001:db8::10", "vpn.example.com", "vpn-1.eu.example.com.", "localhost"} {
+		if err := ValidateEndpoint(host); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", host, err)
+		}
+	}
+
+	for _, host := range []string{"", "0.0.0.0", "::", "fe80::1%eth0", "[2001:db8::10]", "vpn.example.com:1194", "256.1.1.1", "-vpn.example.com", "vpn example.com"} {
+		if err := ValidateEndpoint(host); err == nil {
+			t.Errorf("Expected %q to be rejected", host)
+		}
+	}
+}
+
+// TestParseEndpoints verifies comma separated lists are trimmed, ordered and deduplicated
+func TestParseEndpoints(t *testing.T) {
+	endpoints, err := ParseEndpoints(" vpn.example.com, 203.0.113.10 ,,2001:db8::10")
+	if err != nil {
+		t.Fatalf("ParseEndpoints failed: %v", err)
+	}
+	if strings.Join(endpoints, ",") != "vpn.example.com,203.0.113.10,2001:db8::10" {
+		t.Errorf("Expected endpoints in configured order, got %v", endpoints)
+	}
+
+	if endpoints, err := ParseEndpoints(""); err != nil || len(endpoints) != 0 {
+		t.Errorf("Expected no endpoints for an empty value, got %v (%v)", endpoints, err)
+	}
+	if _, err := ParseEndpoints("vpn.example.com,VPN.example.com"); err == nil {
+		t.Error("Expected duplicate endpoints to be rejected")
+	}
+}
+
+// TestSetRemotes verifies remote lines are replaced in place, keeping port and protocol
+func TestSetRemotes(t *testing.T) {
+	content := "client\nremote 10.0.0.5 1194 udp\nremote 10.0.0.6 1194 udp\nnobind\n"
+
+	got := SetRemotes(content, []string{"vpn.example.com", "2001:db8::10"})
+	want := "client\nremote vpn.example.com 1194 udp\nremote 2001:db8::10 1194 udp\nnobind\n"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	if got := SetRemotes("client\nnobind\n", []string{"vpn.example.com"}); got != "client\nnobind\n" {
+		t.Errorf("Expected config without remote lines to be unchanged, got %q", got)
+	}
+
+	server := &Server{Host: "10.0.0.5"}
+	if server.PublicEndpoint() != "10.0.0.5" {
+		t.Errorf("Expected API host without public endpoints, got %s", server.PublicEndpoint())
+	}
+	server.PublicEndpoints = Endpoints{"vpn.example.com"}
+	if server.PublicEndpoint() != "vpn.example.com" {
+		t.Errorf("Expected public endpoint, got %s", server.PublicEndpoint())
+	}
+}
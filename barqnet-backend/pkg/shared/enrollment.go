@@ -0,0 +1,209 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Enrollment token lifetimes
+const (
+	DefaultEnrollmentTTL = time.Hour
+	MaxEnrollmentTTL     = 7 * 24 * time.Hour
+)
+
+// ErrEnrollmentRejected is returned for tokens that are unknown, used, revoked, expired or
+// pinned to another server ID. Which one is not told, so tokens cannot be probed.
+var ErrEnrollmentRejected = errors.New("invalid, used, revoked or expired enrollment token")
+
+// ErrServerIDEnrolled is returned when a token that is not pinned to a server ID is used to
+// enroll as an end-node that is already known
+var ErrServerIDEnrolled = errors.New("server ID is already enrolled, re-enrolling it needs a token pinned to it")
+
+// Server IDs appear in API paths, file names and certificate names
+var serverIDRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ValidateServerID checks that an end-node server ID is safe to use in paths and names
+func ValidateServerID(serverID string) error {
+	if !serverIDRegex.MatchString(serverID) {
+		return fmt.Errorf("server ID %q must be 1 to 64 letters, digits, dots, dashes or underscores", serverID)
+	}
+	if serverID == ManagementNodeName {
+		return fmt.Errorf("%q is reserved for the management server", serverID)
+	}
+	return nil
+}
+
+// hashEnrollmentToken returns the stored form of an enrollment token
+func hashEnrollmentToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// EnrollmentTokenManager stores single-use enrollment tokens and exchanges them for node credentials
+type EnrollmentTokenManager struct {
+	db *DB
+}
+
+// NewEnrollmentTokenManager creates a new enrollment token manager
+func NewEnrollmentTokenManager(db *DB) *EnrollmentTokenManager {
+	return &EnrollmentTokenManager{db: db}
+}
+
+// CreateToken mints an enrollment token valid for ttl, optionally pinned to t.ServerID and
+// t.LocationID, and fills in t. The returned token is not stored and cannot be shown again.
+func (em *EnrollmentTokenManager) CreateToken(t *EnrollmentToken, ttl time.Duration) (string, error) {
+	if ttl <= 0 || ttl > MaxEnrollmentTTL {
+		return "", fmt.Errorf("invalid enrollment token: lifetime must be between 1 second and %s", MaxEnrollmentTTL)
+	}
+	if t.ServerID != "" {
+		if err := ValidateServerID(t.ServerID); err != nil {
+			return "", fmt.Errorf("invalid enrollment token: %v", err)
+		}
+	}
+	if t.LocationID < 0 {
+		return "", fmt.Errorf("invalid enrollment token: location_id must be positive")
+	}
+	if t.LocationID > 0 {
+		var exists bool
+		if err := em.db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM server_locations WHERE location_id = $1)`, t.LocationID).Scan(&exists); err != nil {
+			return "", err
+		}
+		if !exists {
+			return "", fmt.Errorf("invalid enrollment token: location %d not found", t.LocationID)
+		}
+	}
+
+	token, err := GenerateNodeSecret()
+	if err != nil {
+		return "", err
+	}
+	err = em.db.conn.QueryRow(`
+		INSERT INTO enrollment_tokens (token_hash, server_id, location_id, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP + $5 * INTERVAL '1 second')
+		RETURNING id, created_at, expires_at
+	`, hashEnrollmentToken(token), sql.NullString{String: t.ServerID, Valid: t.ServerID != ""},
+		sql.NullInt64{Int64: int64(t.LocationID), Valid: t.LocationID > 0}, t.CreatedBy, int64(ttl.Seconds()),
+	).Scan(&t.ID, &t.CreatedAt, &t.ExpiresAt)
+	if err != nil {
+		return "", err
+	}
+	t.Status = EnrollmentPending
+	return token, nil
+}
+
+// ListTokens returns all enrollment tokens, newest first
+func (em *EnrollmentTokenManager) ListTokens() ([]EnrollmentToken, error) {
+	rows, err := em.db.conn.Query(`
+		SELECT id, COALESCE(server_id, ''), COALESCE(location_id, 0), COALESCE(created_by, ''),
+			created_at, expires_at, used_at, COALESCE(used_by, ''), revoked_at, expires_at <= CURRENT_TIMESTAMP
+		FROM enrollment_tokens ORDER BY created_at DESC, id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []EnrollmentToken{}
+	for rows.Next() {
+		var t EnrollmentToken
+		var usedAt, revokedAt sql.NullTime
+		var expired bool
+		if err := rows.Scan(&t.ID, &t.ServerID, &t.LocationID, &t.CreatedBy, &t.CreatedAt, &t.ExpiresAt,
+			&usedAt, &t.UsedBy, &revokedAt, &expired); err != nil {
+			return nil, err
+		}
+
+		t.Status = EnrollmentPending
+		switch {
+		case usedAt.Valid:
+			t.UsedAt = &usedAt.Time
+			t.Status = EnrollmentUsed
+		case revokedAt.Valid:
+			t.RevokedAt = &revokedAt.Time
+			t.Status = EnrollmentRevoked
+		case expired:
+			t.Status = EnrollmentExpired
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeToken revokes an enrollment token that was not used yet, or returns sql.ErrNoRows
+func (em *EnrollmentTokenManager) RevokeToken(id int) error {
+	result, err := em.db.conn.Exec(`
+		UPDATE enrollment_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Enroll exchanges an enrollment token for a new credential of the end-node serverID and
+// returns the credential with the token it used up. A token that is not pinned to a server
+// ID cannot take over the ID of an end-node that is already known.
+func (em *EnrollmentTokenManager) Enroll(token, serverID string) (string, *EnrollmentToken, error) {
+	if err := ValidateServerID(serverID); err != nil {
+		return "", nil, err
+	}
+
+	tx, err := em.db.conn.Begin()
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	t := EnrollmentToken{UsedBy: serverID, Status: EnrollmentUsed}
+	var pinned sql.NullString
+	var usedAt time.Time
+	err = tx.QueryRow(`
+		UPDATE enrollment_tokens SET used_at = CURRENT_TIMESTAMP, used_by = $2
+		WHERE token_hash = $1 AND used_at IS NULL AND revoked_at IS NULL
+			AND expires_at > CURRENT_TIMESTAMP AND (server_id IS NULL OR server_id = $2)
+		RETURNING id, server_id, COALESCE(location_id, 0), COALESCE(created_by, ''), created_at, expires_at, used_at
+	`, hashEnrollmentToken(token), serverID).Scan(&t.ID, &pinned, &t.LocationID, &t.CreatedBy, &t.CreatedAt, &t.ExpiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return "", nil, ErrEnrollmentRejected
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	t.ServerID = pinned.String
+	t.UsedAt = &usedAt
+
+	if !pinned.Valid {
+		var known bool
+		err := tx.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM node_credentials WHERE server_id = $1)
+				OR EXISTS(SELECT 1 FROM servers WHERE name = $1)
+		`, serverID).Scan(&known)
+		if err != nil {
+			return "", nil, err
+		}
+		if known {
+			return "", nil, ErrServerIDEnrolled
+		}
+	}
+
+	secret, err := GenerateNodeSecret()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := storeNodeCredential(tx, serverID, secret, t.LocationID); err != nil {
+		return "", nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", nil, err
+	}
+	return secret, &t, nil
+}
@@ -0,0 +1,38 @@
+package shared
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestValidateServerID verifies server IDs are restricted to names safe in paths and files
+func TestValidateServerID(t *testing.T) {
+	valid := []string{"server-1", "eu.fra_2", "A", strings.Repeat("n", 64)}
+	for _, id := range valid {
+		if err := ValidateServerID(id); err != nil {
+			t.Errorf("ValidateServerID(%q) = %v, want nil", id, err)
+		}
+	}
+
+	invalid := []string{"", "-server", ".hidden", "a/b", "../etc", "node 1", "node%2F1", strings.Repeat("n", 65), ManagementNodeName}
+	for _, id := range invalid {
+		if err := ValidateServerID(id); err == nil {
+			t.Errorf("ValidateServerID(%q) = nil, want an error", id)
+		}
+	}
+}
+
+// TestHashEnrollmentToken verifies tokens are stored as a fixed-length hash
+func TestHashEnrollmentToken(t *testing.T) {
+	token, err := GenerateNodeSecret()
+	if err != nil {
+		t.Fatalf("GenerateNodeSecret failed: %v", err)
+	}
+	hash := hashEnrollmentToken(token)
+	if len(hash) != 64 || strings.Contains(hash, token) {
+		t.Errorf("hashEnrollmentToken = %q, want 64 hex characters not containing the token", hash)
+	}
+	if hashEnrollmentToken(token) != hash {
+		t.Error("hashEnrollmentToken is not deterministic")
+	}
+}
@@ -0,0 +1,135 @@
+package shared
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Thresholds above which an end-node reports itself degraded
+const (
+	healthCPUPercent    = 95
+	healthMemoryPercent = 95
+	healthDiskPercent   = 90
+)
+
+// HealthStatus derives an end-node's status from its metrics: unhealthy when OpenVPN is down,
+// degraded when it runs short of CPU, memory or disk. The reason lists what is wrong.
+func (m *NodeMetrics) HealthStatus() (string, string) {
+	if !m.OpenVPNRunning {
+		return HealthStatusUnhealthy, "OpenVPN is not running"
+	}
+
+	var reasons []string
+	if m.CPUPercent >= healthCPUPercent {
+		reasons = append(reasons, fmt.Sprintf("CPU at %.1f%%", m.CPUPercent))
+	}
+	if m.CPUCount > 0 && m.LoadAvg5 > float64(2*m.CPUCount) {
+		reasons = append(reasons, fmt.Sprintf("load average %.2f on %d CPUs", m.LoadAvg5, m.CPUCount))
+	}
+	if m.MemoryPercent >= healthMemoryPercent {
+		reasons = append(reasons, fmt.Sprintf("memory at %.1f%%", m.MemoryPercent))
+	}
+	if m.DiskPercent >= healthDiskPercent {
+		reasons = append(reasons, fmt.Sprintf("disk %s at %.1f%%", m.DiskPath, m.DiskPercent))
+	}
+
+	if len(reasons) > 0 {
+		return HealthStatusDegraded, strings.Join(reasons, "; ")
+	}
+	return HealthStatusHealthy, ""
+}
+
+// RecordHealth stores a health report sent by an end-node
+func (sm *ServerManager) RecordHealth(report *HealthReport) error {
+	var (
+		metrics                                       []byte
+		cpuPercent, memoryPercent, load1, diskPercent sql.NullFloat64
+		clients                                       sql.NullInt64
+		openvpnRunning                                sql.NullBool
+	)
+
+	if m := report.Metrics; m != nil {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("failed to marshal node metrics: %v", err)
+		}
+		metrics = data
+		cpuPercent = sql.NullFloat64{Float64: m.CPUPercent, Valid: true}
+		memoryPercent = sql.NullFloat64{Float64: m.MemoryPercent, Valid: true}
+		load1 = sql.NullFloat64{Float64: m.LoadAvg1, Valid: true}
+		diskPercent = sql.NullFloat64{Float64: m.DiskPercent, Valid: true}
+		clients = sql.NullInt64{Int64: int64(m.ConnectedClients), Valid: true}
+		openvpnRunning = sql.NullBool{Bool: m.OpenVPNRunning, Valid: true}
+	}
+
+	// Reports an end-node queued while management was unreachable keep the time they were taken
+	var checkedAt sql.NullInt64
+	if report.Timestamp > 0 && report.Timestamp < time.Now().Unix() {
+		checkedAt = sql.NullInt64{Int64: report.Timestamp, Valid: true}
+	}
+
+	query := `
+		INSERT INTO server_health (server_id, status, response_time_ms, error_message,
+			cpu_percent, memory_percent, load_avg_1, disk_percent, connected_clients, openvpn_running, metrics, last_check)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11,
+			COALESCE(to_timestamp($12::bigint)::timestamp, CURRENT_TIMESTAMP))
+	`
+
+	_, err := sm.db.conn.Exec(query,
+		report.ServerID, report.Status, report.ResponseTime, sql.NullString{String: report.Error, Valid: report.Error != ""},
+		cpuPercent, memoryPercent, load1, diskPercent, clients, openvpnRunning, metrics, checkedAt,
+	)
+	return err
+}
+
+// GetLatestHealth returns the most recent health report of a server
+func (sm *ServerManager) GetLatestHealth(serverID string) (*ServerHealth, error) {
+	query := `
+		SELECT id, server_id, status, last_check, response_time_ms, error_message, metrics
+		FROM server_health
+		WHERE server_id = $1
+		ORDER BY last_check DESC
+		LIMIT 1
+	`
+
+	var (
+		health       ServerHealth
+		responseTime sql.NullInt64
+		errorMsg     sql.NullString
+		metrics      []byte
+	)
+
+	err := sm.db.conn.QueryRow(query, serverID).Scan(
+		&health.ID, &health.ServerID, &health.Status, &health.LastCheck,
+		&responseTime, &errorMsg, &metrics,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	health.ResponseTime = int(responseTime.Int64)
+	health.ErrorMessage = errorMsg.String
+	if metrics != nil {
+		var m NodeMetrics
+		if err := json.Unmarshal(metrics, &m); err != nil {
+			return nil, fmt.Errorf("failed to parse node metrics: %v", err)
+		}
+		health.Metrics = &m
+	}
+
+	return &health, nil
+}
+
+// PruneHealth removes health reports older than the given number of days
+func (sm *ServerManager) PruneHealth(days int) (int64, error) {
+	result, err := sm.db.conn.Exec(`
+		DELETE FROM server_health WHERE last_check < NOW() - make_interval(days => $1)
+	`, days)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,26 @@
+package shared
+
+import "testing"
+
+// TestHealthStatus verifies the status derived from node metrics
+func TestHealthStatus(t *testing.T) {
+	m := &NodeMetrics{OpenVPNRunning: true, CPUCount: 2, CPUPercent: 30, LoadAvg5: 1.5, MemoryPercent: 60, DiskPercent: 40}
+	if status, reason := m.HealthStatus(); status != HealthStatusHealthy || reason != "" {
+		t.Errorf("Expected healthy, got %s (%s)", status, reason)
+	}
+
+	m.DiskPercent = 92
+	if status, _ := m.HealthStatus(); status != HealthStatusDegraded {
+		t.Errorf("Expected degraded with a full disk, got %s", status)
+	}
+
+	m.LoadAvg5 = 5
+	if _, reason := m.HealthStatus(); reason == "" {
+		t.Error("Expected a reason for the degraded status")
+	}
+
+	m.OpenVPNRunning = false
+	if status, _ := m.HealthStatus(); status != HealthStatusUnhealthy {
+		t.Errorf("Expected unhealthy without OpenVPN, got %s", status)
+	}
+}
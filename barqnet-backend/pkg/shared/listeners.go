@@ -0,0 +1,177 @@
+package shared
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxListeners caps the OpenVPN listeners an end-node may declare
+const maxListeners = 8
+
+// Listener is a transport an end-node's OpenVPN server accepts clients on, e.g. udp/1194
+type Listener struct {
+	Protocol string `json:"protocol"` // udp or tcp
+	Port     int    `json:"port"`
+}
+
+// String returns the listener as protocol/port
+func (l Listener) String() string {
+	return fmt.Sprintf("%s/%d", l.Protocol, l.Port)
+}
+
+// Validate checks a listener
+func (l Listener) Validate() error {
+	if l.Protocol != "udp" && l.Protocol != "tcp" {
+		return fmt.Errorf("listener %s: protocol must be udp or tcp", l)
+	}
+	if l.Port < 1 || l.Port > 65535 {
+		return fmt.Errorf("listener %s: port must be between 1 and 65535", l)
+	}
+	return nil
+}
+
+// ValidateListeners checks a list of declared listeners
+func ValidateListeners(listeners []Listener) error {
+	if len(listeners) > maxListeners {
+		return fmt.Errorf("at most %d listeners are allowed", maxListeners)
+	}
+
+	seen := make(map[Listener]bool)
+	for _, listener := range listeners {
+		if err := listener.Validate(); err != nil {
+			return err
+		}
+		if seen[listener] {
+			return fmt.Errorf("duplicate listener %s", listener)
+		}
+		seen[listener] = true
+	}
+
+	return nil
+}
+
+// ParseListeners parses a comma separated list of protocol/port listeners, e.g. "udp/1194,tcp/443"
+func ParseListeners(value string) ([]Listener, error) {
+	var listeners []Listener
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		protocol, portStr, ok := strings.Cut(item, "/")
+		if !ok {
+			return nil, fmt.Errorf("listener %q must be protocol/port", item)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return nil, fmt.Errorf("listener %q has an invalid port", item)
+		}
+		listeners = append(listeners, Listener{Protocol: strings.ToLower(protocol), Port: port})
+	}
+
+	if err := ValidateListeners(listeners); err != nil {
+		return nil, err
+	}
+	return listeners, nil
+}
+
+// OrderListeners returns the listeners with those of the preferred protocol first,
+// keeping the declared order otherwise. An empty protocol keeps the declared order.
+func OrderListeners(listeners []Listener, protocol string) []Listener {
+	ordered := append([]Listener{}, listeners...)
+	if protocol == "" {
+		return ordered
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Protocol == protocol && ordered[j].Protocol != protocol
+	})
+	return ordered
+}
+
+// Listeners is a list of declared listeners stored as a JSONB array
+type Listeners []Listener
+
+// Scan implements sql.Scanner
+func (l *Listeners) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into listeners", src)
+	}
+
+	return json.Unmarshal(data, (*[]Listener)(l))
+}
+
+// Value implements driver.Valuer
+func (l Listeners) Value() (driver.Value, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]Listener(l))
+}
+
+// SetRemoteListeners replaces the remote lines of an OpenVPN client config with one line per
+// listener and host: every host on the first listener, then every host on the next, so clients
+// fall back to the next transport only when no host answers. The proto line follows the first
+// listener. Without hosts those of the existing remote lines are kept; without listeners only
+// the hosts are replaced, as SetRemotes does.
+func SetRemoteListeners(content string, hosts []string, listeners []Listener) string {
+	if len(listeners) == 0 {
+		return SetRemotes(content, hosts)
+	}
+
+	lines := strings.Split(content, "\n")
+	if len(hosts) == 0 {
+		seen := make(map[string]bool)
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] == "remote" && !seen[fields[1]] {
+				seen[fields[1]] = true
+				hosts = append(hosts, fields[1])
+			}
+		}
+		if len(hosts) == 0 {
+			return content
+		}
+	}
+
+	var out []string
+	replaced := false
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 2 && fields[0] == "proto":
+			out = append(out, "proto "+listeners[0].Protocol)
+		case len(fields) >= 2 && fields[0] == "remote":
+			if replaced {
+				continue
+			}
+			replaced = true
+			for _, listener := range listeners {
+				for _, host := range hosts {
+					out = append(out, fmt.Sprintf("remote %s %d %s", host, listener.Port, listener.Protocol))
+				}
+			}
+		default:
+			out = append(out, line)
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// Listener returns the port and protocol of a server profile as a listener, used for
+// end-nodes that declare no listeners of their own
+func (p *ServerProfile) Listener() Listener {
+	return Listener{Protocol: p.Protocol, Port: p.Port}
+}
@@ -0,0 +1,131 @@
+package shared
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseListeners verifies listeners are parsed in order and invalid ones rejected
+func TestParseListeners(t *testing.T) {
+	listeners, err := ParseListeners(" udp/1194, TCP/443 ,,udp/53")
+	if err != nil {
+		t.Fatalf("ParseListeners failed: %v", err)
+	}
+	want := []Listener{{"udp", 1194}, {"tcp", 443}, {"udp", 53}}
+	if len(listeners) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, listeners)
+	}
+	for i := range want {
+		if listeners[i] != want[i] {
+			t.Errorf("Expected listener %d to be %s, got %s", i, want[i], listeners[i])
+		}
+	}
+
+	if listeners, err := ParseListeners(""); err != nil || len(listeners) != 0 {
+		t.Errorf("Expected no listeners for an empty value, got %v (%v)", listeners, err)
+	}
+	for _, value := range []string{"udp", "udp/http", "sctp/1194", "udp/0", "tcp/70000", "udp/1194,udp/1194"} {
+		if _, err := ParseListeners(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+// TestOrderListeners verifies the preferred protocol goes first without reordering the rest
+func TestOrderListeners(t *testing.T) {
+	listeners := []Listener{{"udp", 1194}, {"tcp", 443}, {"udp", 53}, {"tcp", 1194}}
+
+	ordered := OrderListeners(listeners, "tcp")
+	if got := joinListeners(ordered); got != "tcp/443,tcp/1194,udp/1194,udp/53" {
+		t.Errorf("Expected tcp listeners first in declared order, got %s", got)
+	}
+	if got := joinListeners(OrderListeners(listeners, "")); got != "udp/1194,tcp/443,udp/53,tcp/1194" {
+		t.Errorf("Expected declared order without a preference, got %s", got)
+	}
+	if listeners[0].Protocol != "udp" {
+		t.Error("Expected the declared listeners to be left untouched")
+	}
+}
+
+// TestSetRemoteListeners verifies remote lines cover every host on every listener, in order
+func TestSetRemoteListeners(t *testing.T) {
+	content := "client\nproto udp\nremote 10.0.0.5 1194\nnobind\n"
+	listeners := []Listener{{"tcp", 443}, {"udp", 1194}}
+
+	got := SetRemoteListeners(content, []string{"vpn.example.com", "2001:db8::10"}, listeners)
+	want := "client\nproto tcp\n" +
+		"remote vpn.example.com 443 tcp\nremote 2001:db8::10 443 tcp\n" +
+		"remote vpn.example.com 1194 udp\nremote 2001:db8::10 1194 udp\nnobind\n"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	// Without advertised endpoints the hosts of the config are kept
+	got = SetRemoteListeners(content, nil, listeners)
+	if !strings.Contains(got, "remote 10.0.0.5 443 tcp\nremote 10.0.0.5 1194 udp\n") {
+		t.Errorf("Expected existing host on both listeners, got %q", got)
+	}
+
+	if got := SetRemoteListeners(content, []string{"vpn.example.com"}, nil); got != SetRemotes(content, []string{"vpn.example.com"}) {
+		t.Errorf("Expected only hosts to be replaced without listeners, got %q", got)
+	}
+}
+
+// TestRenderMultipleListeners verifies several listeners are bound by one server and tried in order by clients
+func TestRenderMultipleListeners(t *testing.T) {
+	profile := DefaultServerProfile()
+	profile.TLSCrypt = false
+	listeners := []Listener{{"udp", 1194}, {"tcp", 443}}
+
+	server, err := RenderServerConfig(profile, OpenVPNServerPaths{
+		Listeners: listeners,
+		CA:        "/etc/openvpn/ca.crt",
+		Cert:      "/etc/openvpn/server.crt",
+		Key:       "/etc/openvpn/server.key",
+		CRL:       "/etc/openvpn/crl.pem",
+	})
+	if err != nil {
+		t.Fatalf("RenderServerConfig failed: %v", err)
+	}
+	if !strings.Contains(string(server), "local * 1194 udp\nlocal * 443 tcp\n") {
+		t.Errorf("Expected a local line per listener, got:\n%s", server)
+	}
+	if findDirective(string(server), "port") != "" || findDirective(string(server), "proto") != "" {
+		t.Error("Expected no port or proto lines with several listeners")
+	}
+	if strings.Contains(string(server), "explicit-exit-notify") {
+		t.Error("Expected no explicit-exit-notify with a tcp listener")
+	}
+
+	client, err := RenderClientConfig(profile, OpenVPNClientParams{
+		Username:  "alice",
+		ServerID:  "server-1",
+		Hosts:     []string{"203.0.113.10"},
+		Listeners: OrderListeners(listeners, "tcp"),
+	})
+	if err != nil {
+		t.Fatalf("RenderClientConfig failed: %v", err)
+	}
+	if !strings.Contains(string(client), "proto tcp\nremote 203.0.113.10 443 tcp\nremote 203.0.113.10 1194 udp\n") {
+		t.Errorf("Expected tcp remote before the udp fallback, got:\n%s", client)
+	}
+
+	if _, err := RenderServerConfig(profile, OpenVPNServerPaths{
+		Listeners: []Listener{{"udp", 1194}, {"udp", 1194}},
+		CA:        "/etc/openvpn/ca.crt",
+		Cert:      "/etc/openvpn/server.crt",
+		Key:       "/etc/openvpn/server.key",
+		CRL:       "/etc/openvpn/crl.pem",
+	}); err == nil {
+		t.Error("Expected duplicate listeners to be rejected")
+	}
+}
+
+// joinListeners formats listeners as a comma separated list
+func joinListeners(listeners []Listener) string {
+	parts := make([]string, 0, len(listeners))
+	for _, listener := range listeners {
+		parts = append(parts, listener.String())
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,97 @@
+package shared
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// NodeCredentialManager stores the credential of each end-node requests between management
+// and the end-node are signed with
+type NodeCredentialManager struct {
+	db *DB
+}
+
+// NewNodeCredentialManager creates a new node credential manager
+func NewNodeCredentialManager(db *DB) *NodeCredentialManager {
+	return &NodeCredentialManager{db: db}
+}
+
+// IssueCredential generates a new credential for an end-node, replacing a previous one.
+// The end-node must be configured with the returned secret.
+func (nm *NodeCredentialManager) IssueCredential(serverID string) (string, error) {
+	if err := ValidateServerID(serverID); err != nil {
+		return "", err
+	}
+	secret, err := GenerateNodeSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := storeNodeCredential(nm.db.conn, serverID, secret, 0); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// sqlExecer is a database connection or transaction
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// storeNodeCredential saves the credential of an end-node, replacing a previous one. A
+// location of 0 keeps the location pinned before.
+func storeNodeCredential(db sqlExecer, serverID, secret string, locationID int) error {
+	_, err := db.Exec(`
+		INSERT INTO node_credentials (server_id, secret, location_id, created_at, last_used_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP, NULL)
+		ON CONFLICT (server_id) DO UPDATE SET
+			secret = EXCLUDED.secret,
+			location_id = COALESCE(EXCLUDED.location_id, node_credentials.location_id),
+			created_at = EXCLUDED.created_at,
+			last_used_at = NULL
+	`, serverID, secret, sql.NullInt64{Int64: int64(locationID), Valid: locationID > 0})
+	if err != nil {
+		return fmt.Errorf("failed to store credential of %s: %v", serverID, err)
+	}
+	return nil
+}
+
+// GetSecret returns the credential of an end-node, or "" if none was issued
+func (nm *NodeCredentialManager) GetSecret(serverID string) (string, error) {
+	var secret string
+	err := nm.db.conn.QueryRow(`SELECT secret FROM node_credentials WHERE server_id = $1`, serverID).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up credential of %s: %v", serverID, err)
+	}
+	return secret, nil
+}
+
+// PinnedLocation returns the location an end-node was enrolled into, or 0 for none
+func (nm *NodeCredentialManager) PinnedLocation(serverID string) (int, error) {
+	var locationID sql.NullInt64
+	err := nm.db.conn.QueryRow(`SELECT location_id FROM node_credentials WHERE server_id = $1`, serverID).Scan(&locationID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	return int(locationID.Int64), nil
+}
+
+// MarkUsed records that a request signed with the credential of an end-node was accepted
+func (nm *NodeCredentialManager) MarkUsed(serverID string) error {
+	_, err := nm.db.conn.Exec(`UPDATE node_credentials SET last_used_at = CURRENT_TIMESTAMP WHERE server_id = $1`, serverID)
+	return err
+}
+
+// RevokeCredential removes the credential of an end-node; requests signed with it are refused
+func (nm *NodeCredentialManager) RevokeCredential(serverID string) error {
+	result, err := nm.db.conn.Exec(`DELETE FROM node_credentials WHERE server_id = $1`, serverID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package shared
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// ManagementNodeName is the common name of the certificate the management server presents
+// to end-nodes. End-nodes only accept API requests made with it, so it is never issued to
+// an end-node.
+const ManagementNodeName = "management"
+
+// NodeTLSConfig holds the mutual TLS settings of the link between the management server and
+// end-nodes. Both sides present a certificate issued by the internal node CA and trust no
+// other CA, so neither talks to a peer the management server did not issue a certificate to.
+type NodeTLSConfig struct {
+	CAFile   string `json:"ca_file"`   // internal node CA certificate
+	CertFile string `json:"cert_file"` // this side's certificate
+	KeyFile  string `json:"key_file"`  // this side's private key
+}
+
+// Enabled reports whether the link uses mutual TLS
+func (c NodeTLSConfig) Enabled() bool {
+	return c.CAFile != "" || c.CertFile != "" || c.KeyFile != ""
+}
+
+// Validate checks that mutual TLS is either configured completely or not at all
+func (c NodeTLSConfig) Validate() error {
+	if c.Enabled() && (c.CAFile == "" || c.CertFile == "" || c.KeyFile == "") {
+		return fmt.Errorf("mutual TLS needs a CA file, a certificate file and a key file")
+	}
+	return nil
+}
+
+// Scheme returns the URL scheme of the API on the other side of the link
+func (c NodeTLSConfig) Scheme() string {
+	if c.Enabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// URL returns the URL of path on the API of the other side at host and port
+func (c NodeTLSConfig) URL(host string, port int, path string) string {
+	return c.Scheme() + "://" + net.JoinHostPort(host, strconv.Itoa(port)) + path
+}
+
+// load reads the node CA and this side's key pair
+func (c NodeTLSConfig) load() (*x509.CertPool, tls.Certificate, error) {
+	if err := c.Validate(); err != nil {
+		return nil, tls.Certificate{}, err
+	}
+
+	caPEM, err := os.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, tls.Certificate{}, fmt.Errorf("failed to read node CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, tls.Certificate{}, fmt.Errorf("node CA %s holds no PEM certificate", c.CAFile)
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, tls.Certificate{}, fmt.Errorf("failed to load node certificate: %v", err)
+	}
+	return pool, cert, nil
+}
+
+// ServerTLSConfig returns the TLS config of an API only the other side may call: clients
+// must present a certificate issued by the node CA. When peer is set, only the certificate
+// issued to that common name is accepted. When check is set, it is called with every client
+// certificate the node CA verified and refuses it by returning an error, e.g. once revoked.
+func (c NodeTLSConfig) ServerTLSConfig(peer string, check func(*x509.Certificate) error) (*tls.Config, error) {
+	pool, cert, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	config.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+		if len(chains) == 0 || len(chains[0]) == 0 {
+			return fmt.Errorf("client certificate is not issued by the node CA")
+		}
+		client := chains[0][0]
+		if peer != "" && client.Subject.CommonName != peer {
+			return fmt.Errorf("client certificate is not issued to %s", peer)
+		}
+		if check != nil {
+			return check(client)
+		}
+		return nil
+	}
+	return config, nil
+}
+
+// NewNodeTransport returns the HTTP transport for calls to the other side of the link:
+// pinned to the node CA and authenticated with this side's certificate. Without mutual TLS
+// it returns nil, the default transport.
+func NewNodeTransport(c NodeTLSConfig) (http.RoundTripper, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+	pool, cert, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{cert},
+	}
+	return transport, nil
+}
+
+// PeerNodeName returns the common name of the verified node certificate a request was made
+// with, or "" for requests without one
+func PeerNodeName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
@@ -0,0 +1,156 @@
+package shared
+
+import (
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barqnet-backend/pkg/pki"
+)
+
+// issueNodeTLS issues a node certificate from ca and returns the settings pointing at it
+func issueNodeTLS(t *testing.T, ca *pki.PKI, name string) NodeTLSConfig {
+	t.Helper()
+
+	cert, err := ca.IssueNode(name, []string{"127.0.0.1"}, pki.IssueOptions{})
+	if err != nil {
+		t.Fatalf("IssueNode failed: %v", err)
+	}
+	dir := t.TempDir()
+	config := NodeTLSConfig{
+		CAFile:   filepath.Join(dir, "ca.crt"),
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	os.WriteFile(config.CAFile, ca.CACertPEM(), 0644)
+	os.WriteFile(config.CertFile, cert.CertPEM, 0644)
+	os.WriteFile(config.KeyFile, cert.KeyPEM, 0600)
+	return config
+}
+
+// TestNodeTLS verifies an end-node API only answers the management certificate of its own node CA
+func TestNodeTLS(t *testing.T) {
+	ca, err := pki.Init(filepath.Join(t.TempDir(), "pki"), "Node CA", pki.KeyTypeECDSA, 0)
+	if err != nil {
+		t.Fatalf("Failed to init node CA: %v", err)
+	}
+	other, err := pki.Init(filepath.Join(t.TempDir(), "pki"), "Other CA", pki.KeyTypeECDSA, 0)
+	if err != nil {
+		t.Fatalf("Failed to init other CA: %v", err)
+	}
+	endNode := issueNodeTLS(t, ca, "node-1")
+	management := issueNodeTLS(t, ca, ManagementNodeName)
+	otherNode := issueNodeTLS(t, ca, "node-2")
+	impostor := issueNodeTLS(t, other, ManagementNodeName)
+
+	serverTLS, err := endNode.ServerTLSConfig(ManagementNodeName, nil)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig failed: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, PeerNodeName(r))
+	}))
+	server.TLS = serverTLS
+	server.StartTLS()
+	defer server.Close()
+
+	call := func(config NodeTLSConfig) (string, error) {
+		transport, err := NewNodeTransport(config)
+		if err != nil {
+			t.Fatalf("NewNodeTransport failed: %v", err)
+		}
+		client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), nil
+	}
+
+	if peer, err := call(management); err != nil || peer != ManagementNodeName {
+		t.Errorf("Expected the management certificate to be accepted, got %q (%v)", peer, err)
+	}
+	if _, err := call(otherNode); err == nil {
+		t.Error("Expected another end-node's certificate to be rejected")
+	}
+	if _, err := call(impostor); err == nil {
+		t.Error("Expected a certificate of another CA to be rejected, and its CA not to trust the end-node")
+	}
+
+	// Without a client certificate the handshake fails
+	noCert, _ := NewNodeTransport(management)
+	noCert.(*http.Transport).TLSClientConfig.Certificates = nil
+	if _, err := (&http.Client{Transport: noCert, Timeout: 5 * time.Second}).Get(server.URL); err == nil {
+		t.Error("Expected a request without a client certificate to be rejected")
+	}
+}
+
+// TestNodeTLSRevoked verifies the node API refuses certificates the check rejects, e.g. revoked ones
+func TestNodeTLSRevoked(t *testing.T) {
+	ca, err := pki.Init(filepath.Join(t.TempDir(), "pki"), "Node CA", pki.KeyTypeECDSA, 0)
+	if err != nil {
+		t.Fatalf("Failed to init node CA: %v", err)
+	}
+	management := issueNodeTLS(t, ca, ManagementNodeName)
+	endNode := issueNodeTLS(t, ca, "node-1")
+
+	serverTLS, err := management.ServerTLSConfig("", func(cert *x509.Certificate) error {
+		return ca.CheckValid(cert.SerialNumber)
+	})
+	if err != nil {
+		t.Fatalf("ServerTLSConfig failed: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = serverTLS
+	server.StartTLS()
+	defer server.Close()
+
+	call := func() error {
+		transport, err := NewNodeTransport(endNode)
+		if err != nil {
+			t.Fatalf("NewNodeTransport failed: %v", err)
+		}
+		resp, err := (&http.Client{Transport: transport, Timeout: 5 * time.Second}).Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := call(); err != nil {
+		t.Fatalf("Expected the end-node certificate to be accepted: %v", err)
+	}
+	if _, err := ca.RevokeCommonName("node-1", pki.ReasonCessationOfOperation); err != nil {
+		t.Fatalf("RevokeCommonName failed: %v", err)
+	}
+	if err := call(); err == nil {
+		t.Error("Expected the revoked end-node certificate to be rejected")
+	}
+}
+
+// TestNodeTLSConfig verifies partial settings are rejected and the scheme follows the settings
+func TestNodeTLSConfig(t *testing.T) {
+	var plain NodeTLSConfig
+	if plain.Enabled() || plain.Validate() != nil || plain.URL("10.0.0.5", 8081, "/health") != "http://10.0.0.5:8081/health" {
+		t.Errorf("Expected plain HTTP without settings")
+	}
+	if transport, err := NewNodeTransport(plain); transport != nil || err != nil {
+		t.Errorf("Expected the default transport without settings, got %v (%v)", transport, err)
+	}
+
+	partial := NodeTLSConfig{CAFile: "ca.crt", CertFile: "node.crt"}
+	if partial.Validate() == nil {
+		t.Error("Expected settings without a key file to be rejected")
+	}
+	full := NodeTLSConfig{CAFile: "ca.crt", CertFile: "node.crt", KeyFile: "node.key"}
+	if got := full.URL("2001:db8::10", 8081, "/health"); got != "https://[2001:db8::10]:8081/health" {
+		t.Errorf("Unexpected URL %s", got)
+	}
+}
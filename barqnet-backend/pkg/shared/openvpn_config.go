@@ -0,0 +1,326 @@
+package shared
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// OpenVPNServerPaths are the node-local files and settings referenced by a rendered server.conf
+type OpenVPNServerPaths struct {
+	// Listeners the node declared; empty listens on the profile's port and protocol.
+	// Several listeners are bound by one server with "local" lines (OpenVPN 2.7 or later).
+	Listeners []Listener
+
+	CA          string
+	Cert        string
+	Key         string
+	DH          string // empty renders "dh none", ECDHE key exchange only
+	TLSCryptKey string // required when the profile enables tls-crypt
+	CRL         string
+
+	// tls-crypt-v2 server key, required when the profile enables tls-crypt-v2. With built-in
+	// hooks the keys of revoked users are rejected by the tls-crypt-v2-verify hook.
+	TLSCryptV2Key string
+
+	// Management interface: unix socket path or host:port, optionally password protected
+	Management             string
+	ManagementPasswordFile string
+
+	// Optional client lifecycle hooks
+	ClientConnect    string
+	ClientDisconnect string
+
+	// Built-in hooks: the end-node binary, run as "<HookBinary> <hook> -api <HookAPI>" for
+	// each hook without a script of its own. HookAPI is the end-node API on loopback.
+	// HookFailOpen lets clients in when the hooks cannot reach it; they are rejected otherwise.
+	HookBinary   string
+	HookAPI      string
+	HookFailOpen bool
+
+	StatusFile string
+
+	// Per-user client-config-dir and the networks behind site-to-site clients (iroute);
+	// each network also needs a kernel route into the tunnel
+	ClientConfigDir string
+	ClientNetworks  []string
+}
+
+// OpenVPNClientParams are the per-user values of a rendered client profile
+type OpenVPNClientParams struct {
+	Username string
+	ServerID string
+	Hosts    []string // public addresses clients connect to, tried in order
+
+	// Listeners tried in order, each on every host; empty uses the profile's port and protocol
+	Listeners []Listener
+
+	// PEM material embedded inline; empty blocks are rendered for templates.
+	// TLSCryptKey is the user's own client key when the profile enables tls-crypt-v2.
+	CA          string
+	Cert        string
+	Key         string
+	TLSCryptKey string
+
+	// Optional split-tunnel policy; nil renders the full tunnel pushed by the server
+	Routes *RouteProfile
+}
+
+// RenderServerConfig renders an OpenVPN server.conf from a server profile
+func RenderServerConfig(profile *ServerProfile, paths OpenVPNServerPaths) ([]byte, error) {
+	if err := profile.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid server profile: %v", err)
+	}
+	for _, path := range []string{paths.CA, paths.Cert, paths.Key, paths.CRL} {
+		if path == "" {
+			return nil, fmt.Errorf("ca, cert, key and crl paths are required")
+		}
+	}
+	if profile.TLSCrypt && paths.TLSCryptKey == "" {
+		return nil, fmt.Errorf("profile enables tls-crypt but no key path is configured")
+	}
+	if profile.TLSCryptV2 && paths.TLSCryptV2Key == "" {
+		return nil, fmt.Errorf("profile enables tls-crypt-v2 but no server key path is configured")
+	}
+	for _, path := range []string{paths.CA, paths.Cert, paths.Key, paths.DH, paths.TLSCryptKey, paths.TLSCryptV2Key, paths.CRL,
+		paths.Management, paths.ManagementPasswordFile, paths.ClientConnect, paths.ClientDisconnect, paths.StatusFile,
+		paths.ClientConfigDir, paths.HookBinary, paths.HookAPI} {
+		if strings.ContainsAny(path, " \t\r\n\"'") {
+			return nil, fmt.Errorf("path %q must not contain whitespace or quotes", path)
+		}
+	}
+
+	listeners := paths.Listeners
+	if len(listeners) == 0 {
+		listeners = []Listener{profile.Listener()}
+	}
+	if err := ValidateListeners(listeners); err != nil {
+		return nil, fmt.Errorf("invalid listeners: %v", err)
+	}
+
+	subnet, _ := netip.ParsePrefix(profile.Subnet)
+	mask := net.CIDRMask(subnet.Bits(), 32)
+
+	clientNetworks := make([]netip.Prefix, 0, len(paths.ClientNetworks))
+	for _, network := range paths.ClientNetworks {
+		prefix, err := parseIPv4Network(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client network: %v", err)
+		}
+		if prefix.Overlaps(subnet) {
+			return nil, fmt.Errorf("client network %s overlaps the VPN subnet %s", network, profile.Subnet)
+		}
+		clientNetworks = append(clientNetworks, prefix)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# OpenVPN server configuration rendered from server profile %q (version %s)\n", profile.Name, profile.Version)
+	fmt.Fprintf(&b, "# Managed by the BarqNet end-node: local changes are overwritten on the next profile sync\n\n")
+
+	udpOnly := true
+	if len(listeners) == 1 {
+		fmt.Fprintf(&b, "port %d\n", listeners[0].Port)
+		fmt.Fprintf(&b, "proto %s\n", listeners[0].Protocol)
+		udpOnly = listeners[0].Protocol == "udp"
+	} else {
+		for _, listener := range listeners {
+			fmt.Fprintf(&b, "local * %d %s\n", listener.Port, listener.Protocol)
+			udpOnly = udpOnly && listener.Protocol == "udp"
+		}
+	}
+	fmt.Fprintf(&b, "dev tun\n")
+	fmt.Fprintf(&b, "topology %s\n", profile.Topology)
+	if first, _, ok := profile.StaticRange(); ok {
+		// Keep the dynamic pool below the addresses reserved for ifconfig-push
+		pool := subnet.Addr().Next().Next()
+		fmt.Fprintf(&b, "server %s %s nopool\n", subnet.Addr(), net.IP(mask))
+		fmt.Fprintf(&b, "ifconfig-pool %s %s %s\n", pool, first.Prev(), net.IP(mask))
+	} else {
+		fmt.Fprintf(&b, "server %s %s\n", subnet.Addr(), net.IP(mask))
+	}
+	fmt.Fprintf(&b, "max-clients %d\n\n", profile.MaxClients)
+
+	fmt.Fprintf(&b, "ca %s\n", paths.CA)
+	fmt.Fprintf(&b, "cert %s\n", paths.Cert)
+	fmt.Fprintf(&b, "key %s\n", paths.Key)
+	if paths.DH != "" {
+		fmt.Fprintf(&b, "dh %s\n", paths.DH)
+	} else {
+		fmt.Fprintf(&b, "dh none\n")
+	}
+	if profile.TLSCrypt {
+		fmt.Fprintf(&b, "tls-crypt %s\n", paths.TLSCryptKey)
+	}
+	if profile.TLSCryptV2 {
+		fmt.Fprintf(&b, "tls-crypt-v2 %s\n", paths.TLSCryptV2Key)
+	}
+	fmt.Fprintf(&b, "crl-verify %s\n", paths.CRL)
+	fmt.Fprintf(&b, "remote-cert-tls client\n\n")
+
+	writeCryptoSettings(&b, profile)
+	b.WriteString("\n")
+
+	if profile.RedirectGateway {
+		fmt.Fprintf(&b, "push \"redirect-gateway def1 bypass-dhcp\"\n")
+	}
+	for _, dns := range profile.DNS {
+		fmt.Fprintf(&b, "push \"dhcp-option DNS %s\"\n", dns)
+	}
+	fmt.Fprintf(&b, "keepalive %d %d\n", profile.KeepaliveInterval, profile.KeepaliveTimeout)
+	fmt.Fprintf(&b, "persist-key\n")
+	fmt.Fprintf(&b, "persist-tun\n")
+	if udpOnly {
+		fmt.Fprintf(&b, "explicit-exit-notify 1\n")
+	}
+	b.WriteString("\n")
+
+	if paths.ClientConfigDir != "" {
+		fmt.Fprintf(&b, "client-config-dir %s\n", paths.ClientConfigDir)
+		for _, network := range clientNetworks {
+			fmt.Fprintf(&b, "route %s %s\n", network.Addr(), net.IP(net.CIDRMask(network.Bits(), 32)))
+		}
+		b.WriteString("\n")
+	}
+
+	if paths.Management != "" {
+		management := paths.Management + " unix"
+		if !strings.HasPrefix(paths.Management, "/") {
+			host, port, err := net.SplitHostPort(paths.Management)
+			if err != nil {
+				return nil, fmt.Errorf("invalid management address %q: %v", paths.Management, err)
+			}
+			management = host + " " + port
+		}
+		if paths.ManagementPasswordFile != "" {
+			management += " " + paths.ManagementPasswordFile
+		}
+		fmt.Fprintf(&b, "management %s\n", management)
+	}
+	if paths.HookBinary != "" && paths.HookAPI == "" {
+		return nil, fmt.Errorf("built-in hooks need the end-node API address")
+	}
+	clientConnect, clientDisconnect := paths.ClientConnect, paths.ClientDisconnect
+	tlsCryptV2Verify := ""
+	if paths.HookBinary != "" {
+		failOpen := ""
+		if paths.HookFailOpen {
+			failOpen = " -fail-open"
+		}
+		if profile.TLSCryptV2 {
+			tlsCryptV2Verify = fmt.Sprintf("\"%s tls-crypt-v2-verify -api %s%s\"", paths.HookBinary, paths.HookAPI, failOpen)
+		}
+		if clientConnect == "" {
+			clientConnect = fmt.Sprintf("\"%s client-connect -api %s%s\"", paths.HookBinary, paths.HookAPI, failOpen)
+		}
+		if clientDisconnect == "" {
+			clientDisconnect = fmt.Sprintf("\"%s client-disconnect -api %s\"", paths.HookBinary, paths.HookAPI)
+		}
+	}
+	if clientConnect != "" || clientDisconnect != "" || tlsCryptV2Verify != "" {
+		fmt.Fprintf(&b, "script-security 2\n")
+		if tlsCryptV2Verify != "" {
+			fmt.Fprintf(&b, "tls-crypt-v2-verify %s\n", tlsCryptV2Verify)
+		}
+		if clientConnect != "" {
+			fmt.Fprintf(&b, "client-connect %s\n", clientConnect)
+		}
+		if clientDisconnect != "" {
+			fmt.Fprintf(&b, "client-disconnect %s\n", clientDisconnect)
+		}
+	}
+	if paths.StatusFile != "" {
+		fmt.Fprintf(&b, "status %s\n", paths.StatusFile)
+	}
+	fmt.Fprintf(&b, "verb 3\n")
+
+	return b.Bytes(), nil
+}
+
+// RenderClientConfig renders a client .ovpn profile from the same server profile the
+// end-node's server.conf is rendered from. Pushed settings (DNS, routes, keepalive) are
+// left to the server.
+func RenderClientConfig(profile *ServerProfile, params OpenVPNClientParams) ([]byte, error) {
+	if err := profile.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid server profile: %v", err)
+	}
+	if len(params.Hosts) == 0 {
+		return nil, fmt.Errorf("at least one server host is required")
+	}
+	for _, host := range params.Hosts {
+		if err := ValidateEndpoint(host); err != nil {
+			return nil, fmt.Errorf("invalid server host: %v", err)
+		}
+	}
+	listeners := params.Listeners
+	if len(listeners) == 0 {
+		listeners = []Listener{profile.Listener()}
+	}
+	if err := ValidateListeners(listeners); err != nil {
+		return nil, fmt.Errorf("invalid listeners: %v", err)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# OpenVPN Configuration for %s on %s\n", params.Username, params.ServerID)
+	fmt.Fprintf(&b, "# Generated by VPN Manager End-Node\n")
+	fmt.Fprintf(&b, "# Server: %s (%s:%d)\n", params.ServerID, params.Hosts[0], listeners[0].Port)
+	fmt.Fprintf(&b, "# Server profile: %s (version %s)\n\n", profile.Name, profile.Version)
+
+	fmt.Fprintf(&b, "client\n")
+	fmt.Fprintf(&b, "dev tun\n")
+	fmt.Fprintf(&b, "proto %s\n", listeners[0].Protocol)
+	if len(listeners) == 1 {
+		for _, host := range params.Hosts {
+			fmt.Fprintf(&b, "remote %s %d\n", host, listeners[0].Port)
+		}
+	} else {
+		// Every host on the preferred transport before falling back to the next
+		for _, listener := range listeners {
+			for _, host := range params.Hosts {
+				fmt.Fprintf(&b, "remote %s %d %s\n", host, listener.Port, listener.Protocol)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "resolv-retry infinite\n")
+	fmt.Fprintf(&b, "nobind\n")
+	fmt.Fprintf(&b, "persist-key\n")
+	fmt.Fprintf(&b, "persist-tun\n")
+	fmt.Fprintf(&b, "remote-cert-tls server\n\n")
+
+	writeCryptoSettings(&b, profile)
+	fmt.Fprintf(&b, "verb 3\n\n")
+
+	if params.Routes != nil {
+		if err := params.Routes.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid route profile: %v", err)
+		}
+		writeRouteSettings(&b, params.Routes)
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "<ca>\n%s\n</ca>\n\n", params.CA)
+	fmt.Fprintf(&b, "<cert>\n%s\n</cert>\n\n", params.Cert)
+	fmt.Fprintf(&b, "<key>\n%s\n</key>\n", params.Key)
+	if profile.TLSCrypt {
+		fmt.Fprintf(&b, "\n<tls-crypt>\n%s\n</tls-crypt>\n", params.TLSCryptKey)
+	}
+	if profile.TLSCryptV2 {
+		fmt.Fprintf(&b, "\n<tls-crypt-v2>\n%s\n</tls-crypt-v2>\n", strings.TrimSpace(params.TLSCryptKey))
+	}
+
+	return b.Bytes(), nil
+}
+
+// writeCryptoSettings writes the cipher settings shared by server and client configs
+func writeCryptoSettings(b *bytes.Buffer, profile *ServerProfile) {
+	fmt.Fprintf(b, "data-ciphers %s\n", strings.Join(profile.DataCiphers, ":"))
+	if profile.DataCiphersFallback != "" {
+		fmt.Fprintf(b, "data-ciphers-fallback %s\n", profile.DataCiphersFallback)
+	}
+	fmt.Fprintf(b, "auth %s\n", profile.Auth)
+	fmt.Fprintf(b, "tls-version-min %s\n", profile.TLSVersionMin)
+	if len(profile.TLSCiphers) > 0 {
+		fmt.Fprintf(b, "tls-cipher %s\n", strings.Join(profile.TLSCiphers, ":"))
+	}
+}
@@ -0,0 +1,259 @@
+package shared
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultRollingDays is the window of a rolling quota without one set
+	defaultRollingDays = 30
+	// maxRollingDays bounds the window of a rolling quota
+	maxRollingDays = 365
+)
+
+// Validate checks a data quota, filling in the default period and rolling window
+func (q *DataQuota) Validate() error {
+	if q.Username == "" {
+		return fmt.Errorf("username is required")
+	}
+	if q.LimitBytes <= 0 {
+		return fmt.Errorf("limit_bytes must be positive")
+	}
+
+	switch q.Period {
+	case "":
+		q.Period = QuotaPeriodMonthly
+	case QuotaPeriodMonthly, QuotaPeriodRolling:
+	default:
+		return fmt.Errorf("period must be %q or %q", QuotaPeriodMonthly, QuotaPeriodRolling)
+	}
+
+	if q.Period == QuotaPeriodMonthly {
+		q.RollingDays = 0
+		return nil
+	}
+	if q.RollingDays == 0 {
+		q.RollingDays = defaultRollingDays
+	}
+	if q.RollingDays < 0 || q.RollingDays > maxRollingDays {
+		return fmt.Errorf("rolling_days must be between 1 and %d", maxRollingDays)
+	}
+	return nil
+}
+
+// Window returns the start of the quota's current period and, for monthly quotas, when it resets
+func (q *DataQuota) Window(now time.Time) (time.Time, *time.Time) {
+	if q.Period == QuotaPeriodRolling {
+		days := q.RollingDays
+		if days <= 0 {
+			days = defaultRollingDays
+		}
+		return now.AddDate(0, 0, -days), nil
+	}
+
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	resets := start.AddDate(0, 1, 0)
+	return start, &resets
+}
+
+// NewQuotaStatus reports a quota against the bytes used in its current period
+func NewQuotaStatus(q *DataQuota, used int64, now time.Time) *QuotaStatus {
+	start, resets := q.Window(now)
+
+	status := &QuotaStatus{
+		LimitBytes:  q.LimitBytes,
+		UsedBytes:   used,
+		Period:      q.Period,
+		PeriodStart: start,
+		ResetsAt:    resets,
+		Exceeded:    used >= q.LimitBytes,
+	}
+	if remaining := q.LimitBytes - used; remaining > 0 {
+		status.RemainingBytes = remaining
+	}
+	if q.LimitBytes > 0 {
+		status.PercentUsed = float64(used) * 100 / float64(q.LimitBytes)
+	}
+	return status
+}
+
+// ParseQuotaWarnings parses a comma-separated list of warning thresholds in percent
+func ParseQuotaWarnings(value string) ([]int, error) {
+	var thresholds []int
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		percent, err := strconv.Atoi(field)
+		if err != nil || percent < 1 || percent > 99 {
+			return nil, fmt.Errorf("threshold %q must be a percentage between 1 and 99", field)
+		}
+		thresholds = append(thresholds, percent)
+	}
+	sort.Ints(thresholds)
+	return thresholds, nil
+}
+
+// ValidateQuotaWarnings checks warning thresholds given as a list, e.g. in a config file
+func ValidateQuotaWarnings(thresholds []int) error {
+	for _, percent := range thresholds {
+		if percent < 1 || percent > 99 {
+			return fmt.Errorf("threshold %d must be a percentage between 1 and 99", percent)
+		}
+	}
+	return nil
+}
+
+// QuotaWarningDue returns the highest threshold reached above the one already warned
+// about, or 0 if no warning is due
+func QuotaWarningDue(thresholds []int, warnedPercent int, percentUsed float64) int {
+	due := 0
+	for _, threshold := range thresholds {
+		if threshold > warnedPercent && percentUsed >= float64(threshold) && threshold > due {
+			due = threshold
+		}
+	}
+	return due
+}
+
+// QuotaManager stores per-user data quotas and sums the usage counted against them
+type QuotaManager struct {
+	db *DB
+}
+
+// NewQuotaManager creates a new data quota manager
+func NewQuotaManager(db *DB) *QuotaManager {
+	return &QuotaManager{db: db}
+}
+
+const quotaColumns = `username, limit_bytes, period, rolling_days, exceeded_at, warned_percent, warned_at, updated_at`
+
+// scanQuota reads a data quota selected with quotaColumns
+func scanQuota(row interface{ Scan(...interface{}) error }) (*DataQuota, error) {
+	var q DataQuota
+	var exceededAt, warnedAt sql.NullTime
+	if err := row.Scan(&q.Username, &q.LimitBytes, &q.Period, &q.RollingDays, &exceededAt,
+		&q.WarnedPercent, &warnedAt, &q.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if exceededAt.Valid {
+		q.ExceededAt = &exceededAt.Time
+	}
+	if warnedAt.Valid {
+		q.WarnedAt = &warnedAt.Time
+	}
+	return &q, nil
+}
+
+// GetQuota returns the data quota of a user, or sql.ErrNoRows if it has none
+func (qm *QuotaManager) GetQuota(username string) (*DataQuota, error) {
+	return scanQuota(qm.db.conn.QueryRow(`SELECT `+quotaColumns+` FROM data_quotas WHERE username = $1`, username))
+}
+
+// ListQuotas returns all data quotas
+func (qm *QuotaManager) ListQuotas() ([]DataQuota, error) {
+	rows, err := qm.db.conn.Query(`SELECT ` + quotaColumns + ` FROM data_quotas ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quotas := []DataQuota{}
+	for rows.Next() {
+		q, err := scanQuota(rows)
+		if err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, *q)
+	}
+	return quotas, rows.Err()
+}
+
+// SetQuota saves the data quota of a user. Warnings start over, since they refer to the old limit.
+func (qm *QuotaManager) SetQuota(q *DataQuota) error {
+	if err := q.Validate(); err != nil {
+		return fmt.Errorf("invalid data quota: %v", err)
+	}
+
+	return qm.db.conn.QueryRow(`
+		INSERT INTO data_quotas (username, limit_bytes, period, rolling_days, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (username) DO UPDATE SET
+			limit_bytes = EXCLUDED.limit_bytes,
+			period = EXCLUDED.period,
+			rolling_days = EXCLUDED.rolling_days,
+			warned_percent = 0,
+			warned_at = NULL,
+			updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`, q.Username, q.LimitBytes, q.Period, q.RollingDays).Scan(&q.UpdatedAt)
+}
+
+// DeleteQuota removes the data quota of a user, lifting a block it caused
+func (qm *QuotaManager) DeleteQuota(username string) error {
+	result, err := qm.db.conn.Exec(`DELETE FROM data_quotas WHERE username = $1`, username)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UsageSince returns the bytes a user transferred since a point in time. End-node counts
+// and client reports cover the same sessions, so the larger of the two totals is used:
+// clients cannot report their usage down, and their periodic reports count sessions
+// still in progress, which end-nodes only report when they end.
+func (qm *QuotaManager) UsageSince(username string, since time.Time) (int64, error) {
+	var used int64
+	err := qm.db.conn.QueryRow(`
+		SELECT GREATEST(
+			COALESCE(SUM(bytes_in + bytes_out) FILTER (WHERE source = $3), 0),
+			COALESCE(SUM(bytes_in + bytes_out) FILTER (WHERE source = $4), 0)
+		)
+		FROM vpn_statistics
+		WHERE username = $1 AND COALESCE(ended_at, started_at) >= $2
+	`, username, since, UsageSourceServer, UsageSourceClient).Scan(&used)
+	return used, err
+}
+
+// MarkWarned records the highest warning threshold reached in the current period
+func (qm *QuotaManager) MarkWarned(username string, percent int, at time.Time) error {
+	_, err := qm.db.conn.Exec(`
+		UPDATE data_quotas SET warned_percent = $2, warned_at = $3 WHERE username = $1
+	`, username, percent, at)
+	return err
+}
+
+// SetExceeded marks a user blocked for exceeding its quota, or unblocks it when at is nil
+func (qm *QuotaManager) SetExceeded(username string, at *time.Time) error {
+	_, err := qm.db.conn.Exec(`UPDATE data_quotas SET exceeded_at = $2 WHERE username = $1`, username, at)
+	return err
+}
+
+// ExceededUsers returns the users currently blocked for exceeding their quota
+func (qm *QuotaManager) ExceededUsers() (map[string]bool, error) {
+	rows, err := qm.db.conn.Query(`SELECT username FROM data_quotas WHERE exceeded_at IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make(map[string]bool)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		users[username] = true
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,100 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDataQuotaValidate(t *testing.T) {
+	q := DataQuota{Username: "alice", LimitBytes: 1 << 30}
+	if err := q.Validate(); err != nil {
+		t.Fatalf("Expected valid quota, got %v", err)
+	}
+	if q.Period != QuotaPeriodMonthly {
+		t.Errorf("Expected default period %s, got %s", QuotaPeriodMonthly, q.Period)
+	}
+
+	q = DataQuota{Username: "alice", LimitBytes: 1 << 30, Period: QuotaPeriodRolling}
+	if err := q.Validate(); err != nil {
+		t.Fatalf("Expected valid quota, got %v", err)
+	}
+	if q.RollingDays != defaultRollingDays {
+		t.Errorf("Expected default window of %d days, got %d", defaultRollingDays, q.RollingDays)
+	}
+
+	invalid := []DataQuota{
+		{LimitBytes: 1},
+		{Username: "alice"},
+		{Username: "alice", LimitBytes: 1, Period: "weekly"},
+		{Username: "alice", LimitBytes: 1, Period: QuotaPeriodRolling, RollingDays: maxRollingDays + 1},
+	}
+	for _, q := range invalid {
+		if err := q.Validate(); err == nil {
+			t.Errorf("Expected error for %+v", q)
+		}
+	}
+}
+
+func TestDataQuotaWindow(t *testing.T) {
+	now := time.Date(2026, 3, 15, 10, 30, 0, 0, time.UTC)
+
+	monthly := DataQuota{Period: QuotaPeriodMonthly}
+	start, resets := monthly.Window(now)
+	if !start.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected monthly period to start on March 1, got %v", start)
+	}
+	if resets == nil || !resets.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected monthly quota to reset on April 1, got %v", resets)
+	}
+
+	rolling := DataQuota{Period: QuotaPeriodRolling, RollingDays: 7}
+	start, resets = rolling.Window(now)
+	if !start.Equal(now.AddDate(0, 0, -7)) || resets != nil {
+		t.Errorf("Expected rolling window of 7 days without reset, got %v and %v", start, resets)
+	}
+}
+
+func TestNewQuotaStatus(t *testing.T) {
+	q := DataQuota{LimitBytes: 1000, Period: QuotaPeriodMonthly}
+
+	status := NewQuotaStatus(&q, 250, time.Now())
+	if status.RemainingBytes != 750 || status.PercentUsed != 25 || status.Exceeded {
+		t.Errorf("Expected 750 bytes remaining at 25%%, got %+v", status)
+	}
+
+	status = NewQuotaStatus(&q, 1200, time.Now())
+	if status.RemainingBytes != 0 || !status.Exceeded {
+		t.Errorf("Expected exceeded quota with nothing remaining, got %+v", status)
+	}
+}
+
+func TestQuotaWarnings(t *testing.T) {
+	thresholds, err := ParseQuotaWarnings("90, 80")
+	if err != nil {
+		t.Fatalf("Expected valid thresholds, got %v", err)
+	}
+	if len(thresholds) != 2 || thresholds[0] != 80 || thresholds[1] != 90 {
+		t.Errorf("Expected sorted thresholds [80 90], got %v", thresholds)
+	}
+	if _, err := ParseQuotaWarnings("80,100"); err == nil {
+		t.Error("Expected error for threshold 100")
+	}
+
+	tests := []struct {
+		warned  int
+		percent float64
+		due     int
+	}{
+		{0, 50, 0},
+		{0, 85, 80},
+		{0, 95, 90},
+		{80, 85, 0},
+		{80, 92, 90},
+		{90, 99, 0},
+	}
+	for _, tt := range tests {
+		if due := QuotaWarningDue(thresholds, tt.warned, tt.percent); due != tt.due {
+			t.Errorf("Warned %d at %.0f%%: expected %d, got %d", tt.warned, tt.percent, tt.due, due)
+		}
+	}
+}
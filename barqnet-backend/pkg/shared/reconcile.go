@@ -0,0 +1,130 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// NewDesiredState builds the desired user set from the management user list.
+// Inactive and expired users are left out. The version is a hash of the set, so it only
+// changes when a user is added, removed or changes protocol or port.
+func NewDesiredState(users []User, now time.Time) *DesiredState {
+	state := &DesiredState{
+		Users:       []DesiredUser{},
+		GeneratedAt: now,
+	}
+
+	for _, user := range users {
+		if !user.Active {
+			continue
+		}
+		if !user.ExpiresAt.IsZero() && user.ExpiresAt.Before(now) {
+			continue
+		}
+		state.Users = append(state.Users, DesiredUser{
+			Username: user.Username,
+			Port:     user.Port,
+			Protocol: user.Protocol,
+		})
+	}
+
+	sort.Slice(state.Users, func(i, j int) bool {
+		return state.Users[i].Username < state.Users[j].Username
+	})
+
+	hash := sha256.New()
+	for _, user := range state.Users {
+		fmt.Fprintf(hash, "%s:%s:%d\n", user.Username, user.Protocol, user.Port)
+	}
+	state.Version = hex.EncodeToString(hash.Sum(nil))[:16]
+
+	return state
+}
+
+// DiffUsers compares the desired users with an end-node's inventory.
+// A desired user is missing when it has no usable profile for its protocol. A local user
+// is unexpected when it is not desired but still holds a profile, certificate or session.
+func DiffUsers(desired []DesiredUser, actual []EndNodeUser) ([]DesiredUser, []string) {
+	local := make(map[string]EndNodeUser, len(actual))
+	for _, user := range actual {
+		local[user.Username] = user
+	}
+
+	wanted := make(map[string]bool, len(desired))
+	var missing []DesiredUser
+	for _, user := range desired {
+		wanted[user.Username] = true
+
+		have, ok := local[user.Username]
+		if user.Protocol == ProtocolWireGuard {
+			ok = ok && have.WireGuard
+		} else {
+			ok = ok && have.OvpnPath != "" && have.CertStatus == CertStatusValid
+		}
+		if !ok {
+			missing = append(missing, user)
+		}
+	}
+
+	var unexpected []string
+	for _, user := range actual {
+		if wanted[user.Username] {
+			continue
+		}
+		if user.OvpnPath != "" || user.WireGuard || user.CertStatus == CertStatusValid || user.Connected {
+			unexpected = append(unexpected, user.Username)
+		}
+	}
+
+	return missing, unexpected
+}
+
+// HasDrift reports whether the end-node differed from the desired state
+func (r *DriftReport) HasDrift() bool {
+	return len(r.Missing) > 0 || len(r.Unexpected) > 0 || len(r.Failed) > 0
+}
+
+// RecordReconciliation stores a drift report sent by an end-node
+func (sm *ServerManager) RecordReconciliation(report *DriftReport) error {
+	details, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal drift report: %v", err)
+	}
+
+	query := `
+		INSERT INTO node_reconciliations (server_id, version, desired_count, actual_count,
+			missing_count, unexpected_count, created_count, revoked_count, failed_count, details, reconciled_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	_, err = sm.db.conn.Exec(query,
+		report.ServerID, report.Version, report.DesiredCount, report.ActualCount,
+		len(report.Missing), len(report.Unexpected), len(report.Created), len(report.Revoked), len(report.Failed),
+		details, report.ReconciledAt,
+	)
+	return err
+}
+
+// GetLatestReconciliation returns the most recent drift report for a server
+func (sm *ServerManager) GetLatestReconciliation(serverID string) (*DriftReport, error) {
+	query := `
+		SELECT details FROM node_reconciliations WHERE server_id = $1
+		ORDER BY reconciled_at DESC LIMIT 1
+	`
+
+	var details []byte
+	if err := sm.db.conn.QueryRow(query, serverID).Scan(&details); err != nil {
+		return nil, err
+	}
+
+	var report DriftReport
+	if err := json.Unmarshal(details, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse drift report: %v", err)
+	}
+
+	return &report, nil
+}
@@ -0,0 +1,62 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+// TestNewDesiredState verifies filtering and that the version only depends on the user set
+func TestNewDesiredState(t *testing.T) {
+	now := time.Now()
+	users := []User{
+		{Username: "bob", Active: true, Port: 1194, Protocol: "udp"},
+		{Username: "alice", Active: true, Port: 51820, Protocol: ProtocolWireGuard},
+		{Username: "carol", Active: false, Port: 1194, Protocol: "udp"},
+		{Username: "dave", Active: true, Port: 1194, Protocol: "udp", ExpiresAt: now.Add(-time.Hour)},
+	}
+
+	state := NewDesiredState(users, now)
+	if len(state.Users) != 2 {
+		t.Fatalf("Expected 2 desired users, got %d", len(state.Users))
+	}
+	if state.Users[0].Username != "alice" || state.Users[1].Username != "bob" {
+		t.Errorf("Expected users sorted by name, got %+v", state.Users)
+	}
+
+	reordered := NewDesiredState([]User{users[1], users[0]}, now.Add(time.Minute))
+	if reordered.Version != state.Version {
+		t.Errorf("Expected version %s regardless of order, got %s", state.Version, reordered.Version)
+	}
+
+	users[0].Protocol = "tcp"
+	if changed := NewDesiredState(users, now); changed.Version == state.Version {
+		t.Error("Expected version to change when a user's protocol changes")
+	}
+}
+
+// TestDiffUsers verifies missing and unexpected users are detected per protocol
+func TestDiffUsers(t *testing.T) {
+	desired := []DesiredUser{
+		{Username: "alice", Protocol: "udp"},
+		{Username: "bob", Protocol: "udp"},
+		{Username: "carol", Protocol: ProtocolWireGuard},
+		{Username: "dave", Protocol: "udp"},
+	}
+	actual := []EndNodeUser{
+		{User: User{Username: "alice", OvpnPath: "/clients/alice.ovpn"}, CertStatus: CertStatusValid},
+		{User: User{Username: "bob", OvpnPath: "/clients/bob.ovpn"}, CertStatus: CertStatusExpired},
+		{User: User{Username: "carol"}, WireGuard: true, CertStatus: CertStatusNone},
+		{User: User{Username: "eve", OvpnPath: "/clients/eve.ovpn"}, CertStatus: CertStatusValid},
+		{User: User{Username: "frank"}, CertStatus: CertStatusRevoked},
+		{User: User{Username: "grace"}, CertStatus: CertStatusRevoked, Connected: true},
+	}
+
+	missing, unexpected := DiffUsers(desired, actual)
+
+	if len(missing) != 2 || missing[0].Username != "bob" || missing[1].Username != "dave" {
+		t.Errorf("Expected bob and dave to be missing, got %+v", missing)
+	}
+	if len(unexpected) != 2 || unexpected[0] != "eve" || unexpected[1] != "grace" {
+		t.Errorf("Expected eve and grace to be unexpected, got %v", unexpected)
+	}
+}
@@ -0,0 +1,501 @@
+package shared
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Markers around the route profile block of a client config, so it can be replaced
+const (
+	routeProfileBegin = "# Route profile: "
+	routeProfileEnd   = "# End route profile"
+)
+
+var (
+	routeProfileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 _.-]{0,99}$`)
+	planPattern             = regexp.MustCompile(`^[A-Za-z0-9_-]{1,50}$`)
+	wireGuardDNSPattern     = regexp.MustCompile(`(?m)^\s*DNS\s*=`)
+)
+
+// Validate checks that the route profile renders into working client directives
+func (rp *RouteProfile) Validate() error {
+	if !routeProfileNamePattern.MatchString(rp.Name) {
+		return fmt.Errorf("name must be 1-100 letters, digits, spaces, dots, dashes or underscores")
+	}
+	if len(rp.Description) > 500 {
+		return fmt.Errorf("description must be at most 500 characters")
+	}
+
+	for name, networks := range map[string][]string{"include": rp.Include, "exclude": rp.Exclude} {
+		if len(networks) > maxClientRoutes {
+			return fmt.Errorf("at most %d %s networks are allowed", maxClientRoutes, name)
+		}
+		seen := make(map[netip.Prefix]bool)
+		for _, network := range networks {
+			prefix, err := parseIPv4Network(network)
+			if err != nil {
+				return fmt.Errorf("invalid %s network: %v", name, err)
+			}
+			if prefix.Bits() == 0 {
+				return fmt.Errorf("%s network %s covers everything, leave include empty for the full tunnel", name, network)
+			}
+			if seen[prefix] {
+				return fmt.Errorf("duplicate %s network %s", name, network)
+			}
+			seen[prefix] = true
+		}
+	}
+
+	if rp.RouteNoPull && len(rp.Include) == 0 {
+		return fmt.Errorf("route_nopull ignores the server's routes, so include networks are required")
+	}
+
+	if len(rp.DNS) > 4 {
+		return fmt.Errorf("at most 4 DNS servers are allowed")
+	}
+	for _, dns := range rp.DNS {
+		if _, err := netip.ParseAddr(dns); err != nil {
+			return fmt.Errorf("invalid DNS server %q", dns)
+		}
+	}
+
+	return nil
+}
+
+// writeRouteSettings writes the client directives of a route profile between its markers
+func writeRouteSettings(b *bytes.Buffer, rp *RouteProfile) {
+	fmt.Fprintf(b, "%s%s\n", routeProfileBegin, rp.Name)
+
+	if rp.RouteNoPull {
+		// Also drops pushed redirect-gateway and DNS options
+		fmt.Fprintf(b, "route-nopull\n")
+	} else if len(rp.Include) > 0 {
+		fmt.Fprintf(b, "pull-filter ignore \"redirect-gateway\"\n")
+	}
+	for _, network := range rp.Include {
+		prefix, _ := parseIPv4Network(network)
+		fmt.Fprintf(b, "route %s %s vpn_gateway\n", prefix.Addr(), net.IP(net.CIDRMask(prefix.Bits(), 32)))
+	}
+	for _, network := range rp.Exclude {
+		prefix, _ := parseIPv4Network(network)
+		fmt.Fprintf(b, "route %s %s net_gateway\n", prefix.Addr(), net.IP(net.CIDRMask(prefix.Bits(), 32)))
+	}
+
+	if len(rp.DNS) > 0 {
+		if !rp.RouteNoPull {
+			fmt.Fprintf(b, "pull-filter ignore \"dhcp-option DNS\"\n")
+		}
+		for _, dns := range rp.DNS {
+			fmt.Fprintf(b, "dhcp-option DNS %s\n", dns)
+		}
+	}
+
+	fmt.Fprintf(b, "%s\n", routeProfileEnd)
+}
+
+// ApplyRouteProfile bakes a route profile into an existing client config, replacing the block
+// of a previously applied profile. The block goes right before the inline certificates.
+// A nil profile removes the block, restoring the full tunnel.
+func ApplyRouteProfile(content []byte, rp *RouteProfile) ([]byte, error) {
+	lines := strings.SplitAfter(string(content), "\n")
+
+	var kept []string
+	inBlock, afterBlock := false, false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, routeProfileBegin):
+			inBlock = true
+		case inBlock && trimmed == routeProfileEnd:
+			inBlock, afterBlock = false, true
+		case afterBlock && trimmed == "":
+			// The blank line separating the block from the inline certificates
+			afterBlock = false
+		case !inBlock:
+			afterBlock = false
+			kept = append(kept, line)
+		}
+	}
+	stripped := strings.Join(kept, "")
+
+	if rp == nil {
+		return []byte(stripped), nil
+	}
+	if err := rp.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid route profile: %v", err)
+	}
+
+	var block bytes.Buffer
+	writeRouteSettings(&block, rp)
+	block.WriteString("\n")
+
+	at := strings.Index(stripped, "<ca>")
+	if at == -1 {
+		return []byte(stripped + "\n" + block.String()), nil
+	}
+	return []byte(stripped[:at] + block.String() + stripped[at:]), nil
+}
+
+// WireGuardAllowedIPs returns the networks a WireGuard client sends through the tunnel under
+// the route profile: the include networks, or all IPv4 and IPv6 traffic, without the exclude
+// networks. WireGuard has no routes around the tunnel, so excluded networks are cut out.
+func (rp *RouteProfile) WireGuardAllowedIPs() []string {
+	var allowed []netip.Prefix
+	for _, network := range rp.Include {
+		prefix, _ := parseIPv4Network(network)
+		allowed = append(allowed, prefix)
+	}
+	if len(allowed) == 0 {
+		allowed = []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}
+	}
+
+	for _, network := range rp.Exclude {
+		excluded, _ := parseIPv4Network(network)
+		var remaining []netip.Prefix
+		for _, prefix := range allowed {
+			remaining = append(remaining, subtractPrefix(prefix, excluded)...)
+		}
+		allowed = remaining
+	}
+
+	networks := make([]string, 0, len(allowed))
+	for _, prefix := range allowed {
+		networks = append(networks, prefix.String())
+	}
+	return networks
+}
+
+// subtractPrefix returns the networks covering prefix without excluded
+func subtractPrefix(prefix, excluded netip.Prefix) []netip.Prefix {
+	if !prefix.Overlaps(excluded) {
+		return []netip.Prefix{prefix}
+	}
+	if excluded.Bits() <= prefix.Bits() {
+		return nil
+	}
+
+	// Split prefix in halves until excluded is one of them
+	bits := prefix.Bits() + 1
+	low := netip.PrefixFrom(prefix.Addr(), bits)
+	high := netip.PrefixFrom(lastAddr(low).Next(), bits)
+	return append(subtractPrefix(low, excluded), subtractPrefix(high, excluded)...)
+}
+
+// lastAddr returns the last address of a network
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr().AsSlice()
+	for i := range addr {
+		netBits := prefix.Bits() - i*8
+		switch {
+		case netBits <= 0:
+			addr[i] = 0xff
+		case netBits < 8:
+			addr[i] |= 0xff >> netBits
+		}
+	}
+	last, _ := netip.AddrFromSlice(addr)
+	return last
+}
+
+// ApplyWireGuardRouteProfile bakes a route profile into a WireGuard client config: AllowedIPs
+// of the peer become the profile's networks and its DNS servers replace the config's.
+func ApplyWireGuardRouteProfile(content []byte, rp *RouteProfile) ([]byte, error) {
+	if err := rp.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid route profile: %v", err)
+	}
+
+	// The client's own DNS line is replaced; without one, the profile's follows Address
+	hasDNS := wireGuardDNSPattern.Match(content)
+
+	var b strings.Builder
+	section := ""
+	allowedSet, dnsSet := false, false
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		key, _, _ := strings.Cut(trimmed, "=")
+		key = strings.TrimSpace(key)
+		if strings.HasPrefix(trimmed, "[") {
+			section = trimmed
+		}
+
+		switch {
+		case section == "[Peer]" && key == "AllowedIPs":
+			if !allowedSet {
+				fmt.Fprintf(&b, "AllowedIPs = %s\n", strings.Join(rp.WireGuardAllowedIPs(), ", "))
+				allowedSet = true
+			}
+		case section == "[Interface]" && key == "DNS" && len(rp.DNS) > 0:
+			if !dnsSet {
+				fmt.Fprintf(&b, "DNS = %s\n", strings.Join(rp.DNS, ", "))
+				dnsSet = true
+			}
+		case section == "[Interface]" && key == "Address" && !hasDNS && len(rp.DNS) > 0:
+			b.WriteString(line)
+			fmt.Fprintf(&b, "DNS = %s\n", strings.Join(rp.DNS, ", "))
+		default:
+			b.WriteString(line)
+		}
+	}
+	if !allowedSet {
+		return nil, fmt.Errorf("WireGuard config has no AllowedIPs for the server peer")
+	}
+
+	return []byte(b.String()), nil
+}
+
+// ValidatePlan checks a user plan name
+func ValidatePlan(plan string) error {
+	if !planPattern.MatchString(plan) {
+		return fmt.Errorf("plan must be 1-50 letters, digits, dashes or underscores")
+	}
+	return nil
+}
+
+// RouteProfileManager stores route profiles and their assignments on the management server
+type RouteProfileManager struct {
+	db *DB
+}
+
+// NewRouteProfileManager creates a new route profile manager
+func NewRouteProfileManager(db *DB) *RouteProfileManager {
+	return &RouteProfileManager{db: db}
+}
+
+// SaveProfile validates a route profile and stores it, replacing the profile with the same name.
+// Assigned users are marked unsynced so their apps fetch the new config.
+func (rm *RouteProfileManager) SaveProfile(rp *RouteProfile) error {
+	if err := rp.Validate(); err != nil {
+		return fmt.Errorf("invalid route profile: %v", err)
+	}
+
+	settings := *rp
+	settings.ID = 0
+	settings.Users = nil
+	settings.Plans = nil
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal route profile: %v", err)
+	}
+
+	rp.UpdatedAt = time.Now()
+	err = rm.db.conn.QueryRow(`
+		INSERT INTO route_profiles (name, settings, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET settings = EXCLUDED.settings, updated_at = EXCLUDED.updated_at
+		RETURNING id
+	`, rp.Name, data, rp.UpdatedAt).Scan(&rp.ID)
+	if err != nil {
+		return err
+	}
+
+	return rm.markUnsynced(rp.ID)
+}
+
+// ListProfiles returns all route profiles with their assigned users and plans
+func (rm *RouteProfileManager) ListProfiles() ([]RouteProfile, error) {
+	rows, err := rm.db.conn.Query(`
+		SELECT id, name, settings, updated_at FROM route_profiles ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []RouteProfile{}
+	index := make(map[int]int)
+	for rows.Next() {
+		rp, err := scanRouteProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[rp.ID] = len(profiles)
+		profiles = append(profiles, *rp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	assignments, err := rm.db.conn.Query(`
+		SELECT profile_id, COALESCE(username, ''), COALESCE(plan, '')
+		FROM route_profile_assignments ORDER BY username, plan
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer assignments.Close()
+
+	for assignments.Next() {
+		var (
+			profileID      int
+			username, plan string
+		)
+		if err := assignments.Scan(&profileID, &username, &plan); err != nil {
+			return nil, err
+		}
+		i, ok := index[profileID]
+		if !ok {
+			continue
+		}
+		if username != "" {
+			profiles[i].Users = append(profiles[i].Users, username)
+		} else {
+			profiles[i].Plans = append(profiles[i].Plans, plan)
+		}
+	}
+
+	return profiles, assignments.Err()
+}
+
+// GetProfile returns a route profile by ID
+func (rm *RouteProfileManager) GetProfile(id int) (*RouteProfile, error) {
+	row := rm.db.conn.QueryRow(`
+		SELECT id, name, settings, updated_at FROM route_profiles WHERE id = $1
+	`, id)
+	return scanRouteProfile(row)
+}
+
+// DeleteProfile removes a route profile; its users fall back to the full tunnel
+func (rm *RouteProfileManager) DeleteProfile(id int) error {
+	if err := rm.markUnsynced(id); err != nil {
+		return err
+	}
+
+	result, err := rm.db.conn.Exec(`DELETE FROM route_profiles WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AssignProfile assigns a route profile to a user or, when username is empty, to a plan.
+// A previous assignment of the same user or plan is replaced.
+func (rm *RouteProfileManager) AssignProfile(id int, username, plan string) error {
+	if (username == "") == (plan == "") {
+		return fmt.Errorf("invalid assignment: exactly one of username or plan is required")
+	}
+	if plan != "" {
+		if err := ValidatePlan(plan); err != nil {
+			return fmt.Errorf("invalid assignment: %v", err)
+		}
+	}
+
+	conflict := "(username) WHERE username IS NOT NULL"
+	if plan != "" {
+		conflict = "(plan) WHERE plan IS NOT NULL"
+	}
+
+	_, err := rm.db.conn.Exec(`
+		INSERT INTO route_profile_assignments (profile_id, username, plan)
+		VALUES ($1, $2, $3)
+		ON CONFLICT `+conflict+` DO UPDATE SET profile_id = EXCLUDED.profile_id, assigned_at = CURRENT_TIMESTAMP
+	`, id, sql.NullString{String: username, Valid: username != ""}, sql.NullString{String: plan, Valid: plan != ""})
+	if err != nil {
+		return err
+	}
+
+	return rm.markUnsynced(id)
+}
+
+// UnassignProfile removes the route profile assignment of a user or, when username is empty, a plan
+func (rm *RouteProfileManager) UnassignProfile(username, plan string) error {
+	var profileID int
+	err := rm.db.conn.QueryRow(`
+		DELETE FROM route_profile_assignments
+		WHERE username IS NOT DISTINCT FROM $1 AND plan IS NOT DISTINCT FROM $2
+		RETURNING profile_id
+	`, sql.NullString{String: username, Valid: username != ""}, sql.NullString{String: plan, Valid: plan != ""}).Scan(&profileID)
+	if err != nil {
+		return err
+	}
+
+	if username != "" {
+		_, err = rm.db.conn.Exec(`UPDATE users SET synced = false WHERE username = $1`, username)
+		return err
+	}
+	_, err = rm.db.conn.Exec(`UPDATE users SET synced = false WHERE plan = $1`, plan)
+	return err
+}
+
+// SetUserPlan sets the plan of a user; an empty plan clears it
+func (rm *RouteProfileManager) SetUserPlan(username, plan string) error {
+	if plan != "" {
+		if err := ValidatePlan(plan); err != nil {
+			return fmt.Errorf("invalid plan: %v", err)
+		}
+	}
+
+	result, err := rm.db.conn.Exec(`
+		UPDATE users SET plan = $2, synced = false WHERE username = $1
+	`, username, sql.NullString{String: plan, Valid: plan != ""})
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ResolveForUser returns the route profile of a user: the one assigned to the user, else the
+// one assigned to the user's plan. It returns nil when the user gets the full tunnel.
+func (rm *RouteProfileManager) ResolveForUser(username string) (*RouteProfile, error) {
+	row := rm.db.conn.QueryRow(`
+		SELECT p.id, p.name, p.settings, p.updated_at
+		FROM users u
+		JOIN route_profile_assignments a ON a.username = u.username OR (a.plan IS NOT NULL AND a.plan = u.plan)
+		JOIN route_profiles p ON p.id = a.profile_id
+		WHERE u.username = $1
+		ORDER BY a.username IS NOT NULL DESC
+		LIMIT 1
+	`, username)
+
+	rp, err := scanRouteProfile(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rp, err
+}
+
+// markUnsynced marks the users a route profile applies to as unsynced
+func (rm *RouteProfileManager) markUnsynced(id int) error {
+	_, err := rm.db.conn.Exec(`
+		UPDATE users SET synced = false
+		WHERE username IN (SELECT username FROM route_profile_assignments WHERE profile_id = $1)
+		   OR plan IN (SELECT plan FROM route_profile_assignments WHERE profile_id = $1)
+	`, id)
+	return err
+}
+
+// scanRouteProfile reads a route_profiles row; columns override the stored settings
+func scanRouteProfile(row interface{ Scan(...interface{}) error }) (*RouteProfile, error) {
+	var (
+		rp        RouteProfile
+		id        int
+		name      string
+		settings  []byte
+		updatedAt time.Time
+	)
+
+	if err := row.Scan(&id, &name, &settings, &updatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(settings, &rp); err != nil {
+		return nil, fmt.Errorf("failed to parse route profile %d: %v", id, err)
+	}
+
+	rp.ID = id
+	rp.Name = name
+	rp.UpdatedAt = updatedAt
+
+	return &rp, nil
+}
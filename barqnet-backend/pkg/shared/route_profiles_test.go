@@ -0,0 +1,135 @@
+package shared
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRouteProfileValidate verifies bad route profiles are rejected
+func TestRouteProfileValidate(t *testing.T) {
+	valid := RouteProfile{Name: "corporate", Include: []string{"10.0.0.0/8"}, DNS: []string{"10.0.0.53"}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Expected route profile to be valid, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(rp *RouteProfile)
+	}{
+		{"name", func(rp *RouteProfile) { rp.Name = "corp\nroute-nopull" }},
+		{"host bits", func(rp *RouteProfile) { rp.Include = []string{"10.0.0.1/8"} }},
+		{"default route", func(rp *RouteProfile) { rp.Include = []string{"0.0.0.0/0"} }},
+		{"ipv6", func(rp *RouteProfile) { rp.Exclude = []string{"fd00::/64"} }},
+		{"duplicate", func(rp *RouteProfile) { rp.Exclude = []string{"1.1.1.0/24", "1.1.1.0/24"} }},
+		{"nopull without include", func(rp *RouteProfile) { rp.Include = nil; rp.RouteNoPull = true }},
+		{"dns", func(rp *RouteProfile) { rp.DNS = []string{"dns.example.com"} }},
+	}
+
+	for _, tt := range tests {
+		rp := valid
+		tt.modify(&rp)
+		if err := rp.Validate(); err == nil {
+			t.Errorf("Expected %s to be rejected", tt.name)
+		}
+	}
+}
+
+// TestApplyRouteProfile verifies the baked block matches a rendered config and can be replaced
+func TestApplyRouteProfile(t *testing.T) {
+	profile := DefaultServerProfile()
+	params := OpenVPNClientParams{Username: "alice", ServerID: "server-1", Hosts: []string{"vpn.example.com"}, CA: "ca", Cert: "cert", Key: "key"}
+	full, err := RenderClientConfig(profile, params)
+	if err != nil {
+		t.Fatalf("Failed to render client config: %v", err)
+	}
+
+	rp := &RouteProfile{
+		Name:    "corporate",
+		Include: []string{"10.0.0.0/8"},
+		Exclude: []string{"10.99.0.0/16"},
+		DNS:     []string{"10.0.0.53"},
+	}
+	params.Routes = rp
+	split, err := RenderClientConfig(profile, params)
+	if err != nil {
+		t.Fatalf("Failed to render split-tunnel client config: %v", err)
+	}
+	for _, line := range []string{
+		"pull-filter ignore \"redirect-gateway\"",
+		"route 10.0.0.0 255.0.0.0 vpn_gateway",
+		"route 10.99.0.0 255.255.0.0 net_gateway",
+		"pull-filter ignore \"dhcp-option DNS\"",
+		"dhcp-option DNS 10.0.0.53",
+	} {
+		if !strings.Contains(string(split), line+"\n") {
+			t.Errorf("Expected split-tunnel config to contain %q", line)
+		}
+	}
+
+	applied, err := ApplyRouteProfile(full, rp)
+	if err != nil || string(applied) != string(split) {
+		t.Errorf("Expected applied route profile to match the rendered config (%v)", err)
+	}
+
+	reapplied, _ := ApplyRouteProfile(applied, rp)
+	if string(reapplied) != string(split) {
+		t.Error("Expected applying a route profile twice to be idempotent")
+	}
+
+	removed, _ := ApplyRouteProfile(split, nil)
+	if string(removed) != string(full) {
+		t.Error("Expected removing the route profile to restore the full-tunnel config")
+	}
+}
+
+// TestWireGuardAllowedIPs verifies excluded networks are cut out of the networks sent through the tunnel
+func TestWireGuardAllowedIPs(t *testing.T) {
+	tests := []struct {
+		name string
+		rp   RouteProfile
+		want string
+	}{
+		{"full tunnel", RouteProfile{}, "0.0.0.0/0, ::/0"},
+		{"include", RouteProfile{Include: []string{"10.0.0.0/8", "192.168.1.0/24"}}, "10.0.0.0/8, 192.168.1.0/24"},
+		{"exclude from include", RouteProfile{Include: []string{"10.0.0.0/8"}, Exclude: []string{"10.128.0.0/9"}}, "10.0.0.0/9"},
+		{"exclude nested", RouteProfile{Include: []string{"10.0.0.0/8"}, Exclude: []string{"10.64.0.0/10"}}, "10.0.0.0/10, 10.128.0.0/9"},
+		{"exclude covering include", RouteProfile{Include: []string{"10.1.0.0/16"}, Exclude: []string{"10.0.0.0/8"}}, ""},
+		{"exclude from full tunnel", RouteProfile{Exclude: []string{"128.0.0.0/1"}}, "0.0.0.0/1, ::/0"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.rp.WireGuardAllowedIPs(), ", "); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Every address outside the excluded network stays in the tunnel
+	rp := RouteProfile{Exclude: []string{"192.168.77.0/24"}}
+	networks := rp.WireGuardAllowedIPs()
+	if len(networks) != 25 {
+		t.Errorf("Expected 24 IPv4 networks and ::/0, got %d: %v", len(networks), networks)
+	}
+}
+
+// TestApplyWireGuardRouteProfile verifies AllowedIPs and DNS of a WireGuard config follow the route profile
+func TestApplyWireGuardRouteProfile(t *testing.T) {
+	config := "[Interface]\nPrivateKey = priv\nAddress = 10.9.0.2/32\n\n[Peer]\nPublicKey = pub\nEndpoint = vpn.example.com:51820\nAllowedIPs = 0.0.0.0/0, ::/0\n"
+	rp := &RouteProfile{Name: "corporate", Include: []string{"10.0.0.0/8"}, DNS: []string{"10.0.0.53"}}
+
+	applied, err := ApplyWireGuardRouteProfile([]byte(config), rp)
+	if err != nil {
+		t.Fatalf("ApplyWireGuardRouteProfile failed: %v", err)
+	}
+	want := "[Interface]\nPrivateKey = priv\nAddress = 10.9.0.2/32\nDNS = 10.0.0.53\n\n[Peer]\nPublicKey = pub\nEndpoint = vpn.example.com:51820\nAllowedIPs = 10.0.0.0/8\n"
+	if string(applied) != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, applied)
+	}
+
+	reapplied, _ := ApplyWireGuardRouteProfile(applied, rp)
+	if string(reapplied) != want {
+		t.Error("Expected applying a route profile twice to be idempotent")
+	}
+
+	if _, err := ApplyWireGuardRouteProfile([]byte("[Interface]\nPrivateKey = priv\n"), rp); err == nil {
+		t.Error("Expected a config without a peer to be rejected")
+	}
+}
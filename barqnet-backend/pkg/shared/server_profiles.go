@@ -0,0 +1,345 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"time"
+)
+
+// Settings accepted in a server profile. Everything else is rejected so a profile can
+// never render into a config OpenVPN refuses or one weaker than the defaults.
+var (
+	allowedDataCiphers = map[string]bool{
+		"AES-256-GCM":       true,
+		"AES-192-GCM":       true,
+		"AES-128-GCM":       true,
+		"CHACHA20-POLY1305": true,
+	}
+	allowedFallbackCiphers = map[string]bool{
+		"AES-256-GCM": true,
+		"AES-128-GCM": true,
+		"AES-256-CBC": true,
+		"AES-128-CBC": true,
+	}
+	allowedAuthDigests = map[string]bool{"SHA256": true, "SHA384": true, "SHA512": true}
+	allowedTopologies  = map[string]bool{"subnet": true, "net30": true, "p2p": true}
+	tlsCipherPattern   = regexp.MustCompile(`^TLS-[A-Z0-9-]+$`)
+)
+
+// DefaultServerProfile returns the profile used when management has none configured.
+// It matches scripts/openvpn-server.conf.template, with tls-crypt as used by the end-nodes.
+func DefaultServerProfile() *ServerProfile {
+	profile := &ServerProfile{
+		Name:          "default",
+		Port:          1194,
+		Protocol:      "udp",
+		DataCiphers:   []string{"AES-256-GCM", "AES-128-GCM", "CHACHA20-POLY1305"},
+		Auth:          "SHA256",
+		TLSVersionMin: "1.2",
+		TLSCiphers: []string{
+			"TLS-ECDHE-ECDSA-WITH-AES-256-GCM-SHA384",
+			"TLS-ECDHE-RSA-WITH-AES-256-GCM-SHA384",
+			"TLS-ECDHE-ECDSA-WITH-AES-128-GCM-SHA256",
+			"TLS-ECDHE-RSA-WITH-AES-128-GCM-SHA256",
+		},
+		TLSCrypt:          true,
+		Topology:          "subnet",
+		Subnet:            "10.8.0.0/24",
+		DNS:               []string{"8.8.8.8", "8.8.4.4"},
+		RedirectGateway:   true,
+		KeepaliveInterval: 10,
+		KeepaliveTimeout:  120,
+		MaxClients:        100,
+	}
+	profile.Version = profile.ComputeVersion()
+	return profile
+}
+
+// Validate checks that the profile renders into a working OpenVPN configuration
+func (p *ServerProfile) Validate() error {
+	if p.Name == "" || len(p.Name) > 100 {
+		return fmt.Errorf("name must be 1-100 characters")
+	}
+	if p.ServerID != "" && p.LocationID != 0 {
+		return fmt.Errorf("a profile applies to a server or a location, not both")
+	}
+
+	if p.Port < 1 || p.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	if p.Protocol != "udp" && p.Protocol != "tcp" {
+		return fmt.Errorf("protocol must be udp or tcp")
+	}
+
+	if len(p.DataCiphers) == 0 {
+		return fmt.Errorf("at least one data cipher is required")
+	}
+	seen := make(map[string]bool)
+	for _, cipher := range p.DataCiphers {
+		if !allowedDataCiphers[cipher] {
+			return fmt.Errorf("unsupported data cipher %q", cipher)
+		}
+		if seen[cipher] {
+			return fmt.Errorf("duplicate data cipher %q", cipher)
+		}
+		seen[cipher] = true
+	}
+	if p.DataCiphersFallback != "" && !allowedFallbackCiphers[p.DataCiphersFallback] {
+		return fmt.Errorf("unsupported fallback cipher %q", p.DataCiphersFallback)
+	}
+	if !allowedAuthDigests[p.Auth] {
+		return fmt.Errorf("auth must be SHA256, SHA384 or SHA512")
+	}
+	if p.TLSVersionMin != "1.2" && p.TLSVersionMin != "1.3" {
+		return fmt.Errorf("tls_version_min must be 1.2 or 1.3")
+	}
+	for _, cipher := range p.TLSCiphers {
+		if !tlsCipherPattern.MatchString(cipher) {
+			return fmt.Errorf("invalid TLS cipher %q", cipher)
+		}
+	}
+	if p.TLSCrypt && p.TLSCryptV2 {
+		return fmt.Errorf("tls_crypt and tls_crypt_v2 are mutually exclusive")
+	}
+
+	if !allowedTopologies[p.Topology] {
+		return fmt.Errorf("topology must be subnet, net30 or p2p")
+	}
+	subnet, err := netip.ParsePrefix(p.Subnet)
+	if err != nil || !subnet.Addr().Is4() {
+		return fmt.Errorf("subnet must be an IPv4 network such as 10.8.0.0/24")
+	}
+	if subnet.Masked() != subnet {
+		return fmt.Errorf("subnet %s is not a network address, use %s", p.Subnet, subnet.Masked())
+	}
+	if subnet.Bits() < 16 || subnet.Bits() > 29 {
+		return fmt.Errorf("subnet prefix must be between /16 and /29")
+	}
+	for _, dns := range p.DNS {
+		if _, err := netip.ParseAddr(dns); err != nil {
+			return fmt.Errorf("invalid DNS server %q", dns)
+		}
+	}
+
+	if p.KeepaliveInterval < 1 {
+		return fmt.Errorf("keepalive_interval must be positive")
+	}
+	if p.KeepaliveTimeout < 2*p.KeepaliveInterval {
+		return fmt.Errorf("keepalive_timeout must be at least twice keepalive_interval")
+	}
+	// The server takes the first address of the pool, the network and broadcast addresses are unusable
+	poolSize := 1<<(32-subnet.Bits()) - 3
+	if p.MaxClients < 1 || p.MaxClients > poolSize {
+		return fmt.Errorf("max_clients must be between 1 and %d for subnet %s", poolSize, p.Subnet)
+	}
+	if p.StaticAddresses < 0 || p.StaticAddresses >= poolSize {
+		return fmt.Errorf("static_addresses must be between 0 and %d for subnet %s", poolSize-1, p.Subnet)
+	}
+	if p.StaticAddresses > 0 && p.Topology != "subnet" {
+		return fmt.Errorf("static_addresses requires topology subnet")
+	}
+
+	return nil
+}
+
+// StaticRange returns the first and last address reserved for fixed client addresses.
+// ok is false when the profile reserves none. The profile must be valid.
+func (p *ServerProfile) StaticRange() (first, last netip.Addr, ok bool) {
+	if p.StaticAddresses <= 0 {
+		return netip.Addr{}, netip.Addr{}, false
+	}
+
+	subnet, err := netip.ParsePrefix(p.Subnet)
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, false
+	}
+
+	// The reserved block ends just below the broadcast address
+	network := subnet.Masked().Addr().As4()
+	broadcast := binary.BigEndian.Uint32(network[:]) | (1<<(32-subnet.Bits()) - 1)
+	return uint32ToAddr(broadcast - uint32(p.StaticAddresses)), uint32ToAddr(broadcast - 1), true
+}
+
+// uint32ToAddr converts a big-endian IPv4 address
+func uint32ToAddr(v uint32) netip.Addr {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return netip.AddrFrom4(b)
+}
+
+// ComputeVersion returns a hash of the profile settings. Identity and bookkeeping
+// fields are left out, so the version only changes when the rendered config would.
+func (p *ServerProfile) ComputeVersion() string {
+	settings := *p
+	settings.ID = 0
+	settings.ServerID = ""
+	settings.LocationID = 0
+	settings.Version = ""
+	settings.UpdatedAt = time.Time{}
+
+	data, _ := json.Marshal(settings)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// ServerProfileManager stores OpenVPN server profiles on the management server
+type ServerProfileManager struct {
+	db *DB
+}
+
+// NewServerProfileManager creates a new server profile manager
+func NewServerProfileManager(db *DB) *ServerProfileManager {
+	return &ServerProfileManager{db: db}
+}
+
+// SaveProfile validates a profile and stores it, replacing the profile with the same scope
+func (pm *ServerProfileManager) SaveProfile(profile *ServerProfile) error {
+	if err := profile.Validate(); err != nil {
+		return fmt.Errorf("invalid server profile: %v", err)
+	}
+
+	profile.Version = profile.ComputeVersion()
+	profile.UpdatedAt = time.Now()
+
+	settings, err := json.Marshal(profile)
+	if err != nil {
+		return fmt.Errorf("failed to marshal server profile: %v", err)
+	}
+
+	serverID := sql.NullString{String: profile.ServerID, Valid: profile.ServerID != ""}
+	locationID := sql.NullInt64{Int64: int64(profile.LocationID), Valid: profile.LocationID != 0}
+
+	tx, err := pm.db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		SELECT id FROM server_profiles
+		WHERE server_id IS NOT DISTINCT FROM $1 AND location_id IS NOT DISTINCT FROM $2
+		FOR UPDATE
+	`, serverID, locationID).Scan(&id)
+
+	switch {
+	case err == sql.ErrNoRows:
+		err = tx.QueryRow(`
+			INSERT INTO server_profiles (name, server_id, location_id, settings, version, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id
+		`, profile.Name, serverID, locationID, settings, profile.Version, profile.UpdatedAt).Scan(&id)
+	case err == nil:
+		_, err = tx.Exec(`
+			UPDATE server_profiles SET name = $1, settings = $2, version = $3, updated_at = $4
+			WHERE id = $5
+		`, profile.Name, settings, profile.Version, profile.UpdatedAt, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	profile.ID = id
+	return tx.Commit()
+}
+
+// ListProfiles returns all stored profiles, the global default first
+func (pm *ServerProfileManager) ListProfiles() ([]ServerProfile, error) {
+	rows, err := pm.db.conn.Query(`
+		SELECT id, name, server_id, location_id, settings, version, updated_at
+		FROM server_profiles
+		ORDER BY server_id IS NOT NULL, location_id IS NOT NULL, location_id, server_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []ServerProfile{}
+	for rows.Next() {
+		profile, err := scanServerProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, *profile)
+	}
+
+	return profiles, rows.Err()
+}
+
+// GetProfile returns a stored profile by ID
+func (pm *ServerProfileManager) GetProfile(id int) (*ServerProfile, error) {
+	row := pm.db.conn.QueryRow(`
+		SELECT id, name, server_id, location_id, settings, version, updated_at
+		FROM server_profiles WHERE id = $1
+	`, id)
+	return scanServerProfile(row)
+}
+
+// DeleteProfile removes a stored profile; affected end-nodes fall back to the next broader profile
+func (pm *ServerProfileManager) DeleteProfile(id int) error {
+	result, err := pm.db.conn.Exec(`DELETE FROM server_profiles WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ResolveProfile returns the profile an end-node runs: its own profile, else the profile
+// of its location, else the stored global default, else DefaultServerProfile
+func (pm *ServerProfileManager) ResolveProfile(serverID string) (*ServerProfile, error) {
+	row := pm.db.conn.QueryRow(`
+		SELECT p.id, p.name, p.server_id, p.location_id, p.settings, p.version, p.updated_at
+		FROM server_profiles p
+		LEFT JOIN servers s ON s.name = $1
+		WHERE p.server_id = $1
+		   OR (p.location_id IS NOT NULL AND p.location_id = s.location_id)
+		   OR (p.server_id IS NULL AND p.location_id IS NULL)
+		ORDER BY p.server_id IS NOT NULL DESC, p.location_id IS NOT NULL DESC
+		LIMIT 1
+	`, serverID)
+
+	profile, err := scanServerProfile(row)
+	if err == sql.ErrNoRows {
+		return DefaultServerProfile(), nil
+	}
+	return profile, err
+}
+
+// scanServerProfile reads a server_profiles row; columns override the stored settings
+func scanServerProfile(row interface{ Scan(...interface{}) error }) (*ServerProfile, error) {
+	var (
+		profile       ServerProfile
+		id            int
+		name, version string
+		serverID      sql.NullString
+		locationID    sql.NullInt64
+		settings      []byte
+		updatedAt     time.Time
+	)
+
+	if err := row.Scan(&id, &name, &serverID, &locationID, &settings, &version, &updatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(settings, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse server profile %d: %v", id, err)
+	}
+
+	profile.ID = id
+	profile.Name = name
+	profile.ServerID = serverID.String
+	profile.LocationID = int(locationID.Int64)
+	profile.Version = version
+	profile.UpdatedAt = updatedAt
+
+	return &profile, nil
+}
@@ -0,0 +1,220 @@
+package shared
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestServerProfileValidate verifies the default profile is valid and bad settings are rejected
+func TestServerProfileValidate(t *testing.T) {
+	if err := DefaultServerProfile().Validate(); err != nil {
+		t.Fatalf("Expected default profile to be valid, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(p *ServerProfile)
+	}{
+		{"port", func(p *ServerProfile) { p.Port = 70000 }},
+		{"protocol", func(p *ServerProfile) { p.Protocol = "sctp" }},
+		{"no ciphers", func(p *ServerProfile) { p.DataCiphers = nil }},
+		{"weak cipher", func(p *ServerProfile) { p.DataCiphers = []string{"BF-CBC"} }},
+		{"injected cipher", func(p *ServerProfile) { p.DataCiphers = []string{"AES-256-GCM\nscript-security 3"} }},
+		{"auth", func(p *ServerProfile) { p.Auth = "MD5" }},
+		{"tls version", func(p *ServerProfile) { p.TLSVersionMin = "1.0" }},
+		{"tls cipher", func(p *ServerProfile) { p.TLSCiphers = []string{"ALL"} }},
+		{"topology", func(p *ServerProfile) { p.Topology = "mesh" }},
+		{"subnet", func(p *ServerProfile) { p.Subnet = "10.8.0.1/24" }},
+		{"ipv6 subnet", func(p *ServerProfile) { p.Subnet = "fd00::/64" }},
+		{"dns", func(p *ServerProfile) { p.DNS = []string{"dns.example.com"} }},
+		{"keepalive", func(p *ServerProfile) { p.KeepaliveTimeout = 15 }},
+		{"max clients", func(p *ServerProfile) { p.MaxClients = 300 }},
+		{"scope", func(p *ServerProfile) { p.ServerID = "server-1"; p.LocationID = 3 }},
+	}
+
+	for _, tt := range tests {
+		profile := DefaultServerProfile()
+		tt.modify(profile)
+		if err := profile.Validate(); err == nil {
+			t.Errorf("Expected %s to be rejected", tt.name)
+		}
+	}
+}
+
+// TestServerProfileVersion verifies the version tracks settings but not identity
+func TestServerProfileVersion(t *testing.T) {
+	profile := DefaultServerProfile()
+	version := profile.ComputeVersion()
+
+	profile.ID = 7
+	profile.ServerID = "server-1"
+	if profile.ComputeVersion() != version {
+		t.Error("Expected version to ignore profile identity")
+	}
+
+	profile.DataCiphers = []string{"AES-256-GCM"}
+	if profile.ComputeVersion() == version {
+		t.Error("Expected version to change with the data ciphers")
+	}
+}
+
+// TestRenderConfigsAgree verifies server and client configs carry the same settings
+func TestRenderConfigsAgree(t *testing.T) {
+	profile := DefaultServerProfile()
+	profile.Port = 443
+	profile.Protocol = "tcp"
+	profile.Subnet = "10.20.0.0/22"
+	profile.DataCiphersFallback = "AES-256-CBC"
+
+	server, err := RenderServerConfig(profile, OpenVPNServerPaths{
+		CA:          "/etc/openvpn/ca.crt",
+		Cert:        "/etc/openvpn/server.crt",
+		Key:         "/etc/openvpn/server.key",
+		TLSCryptKey: "/etc/openvpn/tls-crypt.key",
+		CRL:         "/etc/openvpn/crl.pem",
+		Management:  "127.0.0.1:7505",
+	})
+	if err != nil {
+		t.Fatalf("RenderServerConfig failed: %v", err)
+	}
+
+	client, err := RenderClientConfig(profile, OpenVPNClientParams{
+		Username:    "alice",
+		ServerID:    "server-1",
+		Hosts:       []string{"203.0.113.10"},
+		CA:          "CA",
+		Cert:        "CERT",
+		Key:         "KEY",
+		TLSCryptKey: "TLSCRYPT",
+	})
+	if err != nil {
+		t.Fatalf("RenderClientConfig failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"port 443",
+		"proto tcp",
+		"server 10.20.0.0 255.255.252.0",
+		"dh none",
+		"tls-crypt /etc/openvpn/tls-crypt.key",
+		"management 127.0.0.1 7505",
+		"push \"dhcp-option DNS 8.8.8.8\"",
+	} {
+		if !strings.Contains(string(server), want+"\n") {
+			t.Errorf("Expected server config to contain %q", want)
+		}
+	}
+	if strings.Contains(string(server), "explicit-exit-notify") {
+		t.Error("Expected no explicit-exit-notify for tcp")
+	}
+
+	for _, want := range []string{"proto tcp", "remote 203.0.113.10 443", "<tls-crypt>\nTLSCRYPT\n</tls-crypt>"} {
+		if !strings.Contains(string(client), want) {
+			t.Errorf("Expected client config to contain %q", want)
+		}
+	}
+
+	// Every crypto setting must be identical on both sides
+	for _, directive := range []string{"data-ciphers", "data-ciphers-fallback", "auth", "tls-version-min", "tls-cipher"} {
+		serverLine, clientLine := findDirective(string(server), directive), findDirective(string(client), directive)
+		if serverLine == "" || serverLine != clientLine {
+			t.Errorf("Expected matching %s, got server %q and client %q", directive, serverLine, clientLine)
+		}
+	}
+}
+
+// findDirective returns the first line of config that sets directive
+func findDirective(config, directive string) string {
+	for _, line := range strings.Split(config, "\n") {
+		if strings.HasPrefix(line, directive+" ") {
+			return line
+		}
+	}
+	return ""
+}
+
+// TestRenderTLSCryptV2 verifies tls-crypt-v2 profiles reference the server key, verify keys with the
+// built-in hook and embed the user's own client key
+func TestRenderTLSCryptV2(t *testing.T) {
+	profile := DefaultServerProfile()
+	profile.TLSCryptV2 = true
+	if err := profile.Validate(); err == nil {
+		t.Error("Expected tls_crypt and tls_crypt_v2 together to be rejected")
+	}
+	profile.TLSCrypt = false
+
+	paths := OpenVPNServerPaths{
+		CA:   "/etc/openvpn/ca.crt",
+		Cert: "/etc/openvpn/server.crt",
+		Key:  "/etc/openvpn/server.key",
+		CRL:  "/etc/openvpn/crl.pem",
+	}
+	if _, err := RenderServerConfig(profile, paths); err == nil {
+		t.Error("Expected a missing tls-crypt-v2 server key path to be rejected")
+	}
+	paths.TLSCryptV2Key = "/etc/openvpn/tls-crypt-v2-server.key"
+	paths.HookBinary = "/usr/local/bin/endnode"
+	paths.HookAPI = "http://127.0.0.1:8081"
+
+	server, err := RenderServerConfig(profile, paths)
+	if err != nil {
+		t.Fatalf("RenderServerConfig failed: %v", err)
+	}
+	for _, want := range []string{
+		"tls-crypt-v2 /etc/openvpn/tls-crypt-v2-server.key\n",
+		"script-security 2\ntls-crypt-v2-verify \"/usr/local/bin/endnode tls-crypt-v2-verify -api http://127.0.0.1:8081\"\n",
+	} {
+		if !strings.Contains(string(server), want) {
+			t.Errorf("Expected server config to contain %q, got:\n%s", want, server)
+		}
+	}
+	if findDirective(string(server), "tls-crypt") != "" {
+		t.Error("Expected no shared tls-crypt key")
+	}
+
+	client, err := RenderClientConfig(profile, OpenVPNClientParams{
+		Username:    "alice",
+		ServerID:    "server-1",
+		Hosts:       []string{"203.0.113.10"},
+		TLSCryptKey: "V2KEY\n",
+	})
+	if err != nil {
+		t.Fatalf("RenderClientConfig failed: %v", err)
+	}
+	if !strings.Contains(string(client), "<tls-crypt-v2>\nV2KEY\n</tls-crypt-v2>") || strings.Contains(string(client), "<tls-crypt>") {
+		t.Errorf("Expected only a tls-crypt-v2 block, got:\n%s", client)
+	}
+}
+
+// TestRenderHookFailOpen verifies the built-in hooks that let clients in only fail open when asked to
+func TestRenderHookFailOpen(t *testing.T) {
+	profile := DefaultServerProfile()
+	profile.TLSCrypt = false
+	profile.TLSCryptV2 = true
+	paths := OpenVPNServerPaths{
+		CA:            "/etc/openvpn/ca.crt",
+		Cert:          "/etc/openvpn/server.crt",
+		Key:           "/etc/openvpn/server.key",
+		CRL:           "/etc/openvpn/crl.pem",
+		TLSCryptV2Key: "/etc/openvpn/tls-crypt-v2-server.key",
+		HookBinary:    "/usr/local/bin/endnode",
+		HookAPI:       "http://127.0.0.1:8081",
+	}
+
+	for _, failOpen := range []bool{false, true} {
+		paths.HookFailOpen = failOpen
+		server, err := RenderServerConfig(profile, paths)
+		if err != nil {
+			t.Fatalf("RenderServerConfig failed: %v", err)
+		}
+		for _, hook := range []string{"client-connect", "tls-crypt-v2-verify"} {
+			line := findDirective(string(server), hook)
+			if strings.Contains(line, " -fail-open") != failOpen {
+				t.Errorf("With fail-open %v, got %q", failOpen, line)
+			}
+		}
+		if line := findDirective(string(server), "client-disconnect"); strings.Contains(line, "-fail-open") {
+			t.Errorf("Expected client-disconnect without -fail-open, got %q", line)
+		}
+	}
+}
@@ -30,10 +30,31 @@ func (sm *ServerManager) AddServer(name, host string, port int, username, passwo
 	return err
 }
 
+// SetPublicEndpoints records the hosts VPN clients connect to for a server
+func (sm *ServerManager) SetPublicEndpoints(name string, endpoints []string) error {
+	query := `UPDATE servers SET public_endpoints = $1 WHERE name = $2`
+	_, err := sm.db.conn.Exec(query, Endpoints(endpoints), name)
+	return err
+}
+
+// SetListeners records the OpenVPN listeners a server declared
+func (sm *ServerManager) SetListeners(name string, listeners []Listener) error {
+	query := `UPDATE servers SET listeners = $1 WHERE name = $2`
+	_, err := sm.db.conn.Exec(query, Listeners(listeners), name)
+	return err
+}
+
+// SetLocation places a server in a location
+func (sm *ServerManager) SetLocation(name string, locationID int) error {
+	query := `UPDATE servers SET location_id = $1 WHERE name = $2`
+	_, err := sm.db.conn.Exec(query, locationID, name)
+	return err
+}
+
 // GetServer retrieves a server by name
 func (sm *ServerManager) GetServer(name string) (*Server, error) {
 	query := `
-		SELECT id, name, host, port, enabled, last_sync, server_type, created_at
+		SELECT id, name, host, port, enabled, last_sync, server_type, created_at, public_endpoints, listeners
 		FROM servers WHERE name = $1
 	`
 
@@ -42,7 +63,7 @@ func (sm *ServerManager) GetServer(name string) (*Server, error) {
 
 	err := sm.db.conn.QueryRow(query, name).Scan(
 		&server.ID, &server.Name, &server.Host, &server.Port,
-		&server.Enabled, &lastSync, &server.ServerType, &server.CreatedAt,
+		&server.Enabled, &lastSync, &server.ServerType, &server.CreatedAt, &server.PublicEndpoints, &server.Listeners,
 	)
 	
 	if err != nil {
@@ -59,7 +80,7 @@ func (sm *ServerManager) GetServer(name string) (*Server, error) {
 // ListServers returns all servers
 func (sm *ServerManager) ListServers() ([]Server, error) {
 	query := `
-		SELECT id, name, host, port, enabled, last_sync, server_type, created_at
+		SELECT id, name, host, port, enabled, last_sync, server_type, created_at, public_endpoints, listeners
 		FROM servers ORDER BY name
 	`
 
@@ -76,7 +97,7 @@ func (sm *ServerManager) ListServers() ([]Server, error) {
 
 		err := rows.Scan(
 			&server.ID, &server.Name, &server.Host, &server.Port,
-			&server.Enabled, &lastSync, &server.ServerType, &server.CreatedAt,
+			&server.Enabled, &lastSync, &server.ServerType, &server.CreatedAt, &server.PublicEndpoints, &server.Listeners,
 		)
 		if err != nil {
 			return nil, err
@@ -95,7 +116,7 @@ func (sm *ServerManager) ListServers() ([]Server, error) {
 // ListEndNodes returns all end-node servers
 func (sm *ServerManager) ListEndNodes() ([]Server, error) {
 	query := `
-		SELECT id, name, host, port, enabled, last_sync, server_type, created_at
+		SELECT id, name, host, port, enabled, last_sync, server_type, created_at, public_endpoints, listeners
 		FROM servers WHERE server_type = 'endnode' AND enabled = true ORDER BY name
 	`
 
@@ -112,7 +133,7 @@ func (sm *ServerManager) ListEndNodes() ([]Server, error) {
 
 		err := rows.Scan(
 			&server.ID, &server.Name, &server.Host, &server.Port,
-			&server.Enabled, &lastSync, &server.ServerType, &server.CreatedAt,
+			&server.Enabled, &lastSync, &server.ServerType, &server.CreatedAt, &server.PublicEndpoints, &server.Listeners,
 		)
 		if err != nil {
 			return nil, err
@@ -163,3 +184,37 @@ func (sm *ServerManager) ServerExists(name string) (bool, error) {
 	err := sm.db.conn.QueryRow(query, name).Scan(&count)
 	return count > 0, err
 }
+
+// RecordCRLPublication stores the result of a CRL publish reported by an end-node
+func (sm *ServerManager) RecordCRLPublication(pub *CRLPublication) error {
+	query := `
+		INSERT INTO crl_publications (server_id, crl_number, revoked_count, this_update, next_update, kicked_sessions, published_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := sm.db.conn.Exec(query,
+		pub.ServerID, pub.CRLNumber, pub.RevokedCount,
+		pub.ThisUpdate, pub.NextUpdate, pub.KickedSessions, pub.PublishedAt,
+	)
+	return err
+}
+
+// GetLatestCRLPublication returns the most recent CRL publish for a server
+func (sm *ServerManager) GetLatestCRLPublication(serverID string) (*CRLPublication, error) {
+	query := `
+		SELECT server_id, crl_number, revoked_count, this_update, next_update, kicked_sessions, published_at
+		FROM crl_publications WHERE server_id = $1
+		ORDER BY published_at DESC LIMIT 1
+	`
+
+	var pub CRLPublication
+	err := sm.db.conn.QueryRow(query, serverID).Scan(
+		&pub.ServerID, &pub.CRLNumber, &pub.RevokedCount,
+		&pub.ThisUpdate, &pub.NextUpdate, &pub.KickedSessions, &pub.PublishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pub, nil
+}
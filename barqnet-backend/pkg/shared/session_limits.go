@@ -0,0 +1,232 @@
+package shared
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// maxSessionLimit bounds a configured session limit
+const maxSessionLimit = 100
+
+// ValidateSessionPolicy checks a session limit policy; empty means the default
+func ValidateSessionPolicy(policy string) error {
+	switch policy {
+	case "", SessionPolicyReject, SessionPolicyKickOldest:
+		return nil
+	}
+	return fmt.Errorf("policy must be %q or %q", SessionPolicyReject, SessionPolicyKickOldest)
+}
+
+// Validate checks a session limit
+func (l *SessionLimit) Validate() error {
+	if (l.Username == "") == (l.Plan == "") {
+		return fmt.Errorf("exactly one of username or plan is required")
+	}
+	if l.Plan != "" {
+		if err := ValidatePlan(l.Plan); err != nil {
+			return err
+		}
+	}
+	if l.MaxSessions < 0 || l.MaxSessions > maxSessionLimit {
+		return fmt.Errorf("max_concurrent_sessions must be between 0 and %d", maxSessionLimit)
+	}
+	return ValidateSessionPolicy(l.Policy)
+}
+
+// SessionsToKick returns the oldest sessions to disconnect so one more fits within max
+func SessionsToKick(sessions []LiveSession, max int) []LiveSession {
+	excess := len(sessions) - max + 1
+	if max <= 0 || excess <= 0 {
+		return nil
+	}
+
+	oldest := append([]LiveSession{}, sessions...)
+	sort.SliceStable(oldest, func(i, j int) bool {
+		return oldest[i].ConnectedAt.Before(oldest[j].ConnectedAt)
+	})
+	return oldest[:excess]
+}
+
+// SessionLimitManager stores session limits and the live sessions counted against them
+type SessionLimitManager struct {
+	db *DB
+}
+
+// NewSessionLimitManager creates a new session limit manager
+func NewSessionLimitManager(db *DB) *SessionLimitManager {
+	return &SessionLimitManager{db: db}
+}
+
+// ListLimits returns all per-user and per-plan session limits
+func (sm *SessionLimitManager) ListLimits() ([]SessionLimit, error) {
+	rows, err := sm.db.conn.Query(`
+		SELECT COALESCE(username, ''), COALESCE(plan, ''), max_sessions, COALESCE(policy, ''), updated_at
+		FROM session_limits ORDER BY plan NULLS FIRST, username
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := []SessionLimit{}
+	for rows.Next() {
+		var l SessionLimit
+		if err := rows.Scan(&l.Username, &l.Plan, &l.MaxSessions, &l.Policy, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		limits = append(limits, l)
+	}
+	return limits, rows.Err()
+}
+
+// SetLimit saves the session limit of a user or plan, replacing a previous one
+func (sm *SessionLimitManager) SetLimit(l *SessionLimit) error {
+	if err := l.Validate(); err != nil {
+		return fmt.Errorf("invalid session limit: %v", err)
+	}
+
+	conflict := "(username) WHERE username IS NOT NULL"
+	if l.Plan != "" {
+		conflict = "(plan) WHERE plan IS NOT NULL"
+	}
+
+	return sm.db.conn.QueryRow(`
+		INSERT INTO session_limits (username, plan, max_sessions, policy, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT `+conflict+` DO UPDATE SET
+			max_sessions = EXCLUDED.max_sessions,
+			policy = EXCLUDED.policy,
+			updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`, sql.NullString{String: l.Username, Valid: l.Username != ""}, sql.NullString{String: l.Plan, Valid: l.Plan != ""},
+		l.MaxSessions, sql.NullString{String: l.Policy, Valid: l.Policy != ""}).Scan(&l.UpdatedAt)
+}
+
+// DeleteLimit removes the session limit of a user or, when username is empty, a plan
+func (sm *SessionLimitManager) DeleteLimit(username, plan string) error {
+	result, err := sm.db.conn.Exec(`
+		DELETE FROM session_limits
+		WHERE username IS NOT DISTINCT FROM $1 AND plan IS NOT DISTINCT FROM $2
+	`, sql.NullString{String: username, Valid: username != ""}, sql.NullString{String: plan, Valid: plan != ""})
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ResolveLimits returns the session limit that applies to each user with a limit of their
+// own or of their plan. Users without one are left out.
+func (sm *SessionLimitManager) ResolveLimits() (map[string]SessionLimit, error) {
+	rows, err := sm.db.conn.Query(`
+		SELECT DISTINCT ON (u.username) u.username, COALESCE(l.plan, ''), l.max_sessions, COALESCE(l.policy, ''), l.updated_at
+		FROM users u
+		JOIN session_limits l ON l.username = u.username OR (l.plan IS NOT NULL AND l.plan = u.plan)
+		ORDER BY u.username, l.username NULLS LAST
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := make(map[string]SessionLimit)
+	for rows.Next() {
+		var l SessionLimit
+		if err := rows.Scan(&l.Username, &l.Plan, &l.MaxSessions, &l.Policy, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		limits[l.Username] = l
+	}
+	return limits, rows.Err()
+}
+
+// ResolveForUser returns the session limit that applies to a user, or nil if neither
+// the user nor its plan has one
+func (sm *SessionLimitManager) ResolveForUser(username string) (*SessionLimit, error) {
+	var l SessionLimit
+	err := sm.db.conn.QueryRow(`
+		SELECT COALESCE(l.username, ''), COALESCE(l.plan, ''), l.max_sessions, COALESCE(l.policy, ''), l.updated_at
+		FROM users u
+		JOIN session_limits l ON l.username = u.username OR (l.plan IS NOT NULL AND l.plan = u.plan)
+		WHERE u.username = $1
+		ORDER BY l.username NULLS LAST
+		LIMIT 1
+	`, username).Scan(&l.Username, &l.Plan, &l.MaxSessions, &l.Policy, &l.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// LiveSessions returns the connected sessions of a user on end-nodes other than excludeServerID.
+// Sessions on end-nodes without a health report since healthySince are left out, so a crashed
+// end-node does not hold on to its users' sessions.
+func (sm *SessionLimitManager) LiveSessions(username, excludeServerID string, healthySince time.Time) ([]LiveSession, error) {
+	rows, err := sm.db.conn.Query(`
+		SELECT vc.username, vc.server_id, COALESCE(vc.connected_at, vc.updated_at)
+		FROM vpn_connections vc
+		WHERE vc.username = $1 AND vc.status = 'connected' AND vc.server_id <> $2
+		  AND EXISTS (
+			SELECT 1 FROM server_health h
+			WHERE h.server_id = vc.server_id AND h.last_check >= $3
+		  )
+		ORDER BY COALESCE(vc.connected_at, vc.updated_at)
+	`, username, excludeServerID, healthySince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []LiveSession
+	for rows.Next() {
+		var s LiveSession
+		if err := rows.Scan(&s.Username, &s.ServerID, &s.ConnectedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// RecordSessionStart marks a user connected on an end-node in vpn_connections
+func (sm *SessionLimitManager) RecordSessionStart(username, serverID, realAddress string, at time.Time) error {
+	var ip interface{}
+	if host, _, err := net.SplitHostPort(realAddress); err == nil {
+		ip = host
+	} else if net.ParseIP(realAddress) != nil {
+		ip = realAddress
+	}
+
+	_, err := sm.db.conn.Exec(`
+		INSERT INTO vpn_connections (username, status, server_id, ip_address, connected_at, disconnected_at, created_at, updated_at)
+		VALUES ($1, 'connected', $2, $3, $4, NULL, $4, $4)
+		ON CONFLICT (username, server_id)
+		DO UPDATE SET
+			status = EXCLUDED.status,
+			ip_address = EXCLUDED.ip_address,
+			connected_at = EXCLUDED.connected_at,
+			disconnected_at = NULL,
+			updated_at = EXCLUDED.updated_at
+	`, username, serverID, ip, at)
+	return err
+}
+
+// RecordSessionEnd marks a user disconnected from an end-node, unless the user connected
+// there again after the session ended
+func (sm *SessionLimitManager) RecordSessionEnd(username, serverID string, at time.Time) error {
+	_, err := sm.db.conn.Exec(`
+		UPDATE vpn_connections
+		SET status = 'disconnected', disconnected_at = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE username = $1 AND server_id = $2 AND status = 'connected'
+		  AND (connected_at IS NULL OR connected_at <= $3)
+	`, username, serverID, at)
+	return err
+}
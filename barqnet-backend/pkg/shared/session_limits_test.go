@@ -0,0 +1,60 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionLimitValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   SessionLimit
+		wantErr bool
+	}{
+		{"user limit", SessionLimit{Username: "alice", MaxSessions: 2}, false},
+		{"plan limit with policy", SessionLimit{Plan: "family", MaxSessions: 5, Policy: SessionPolicyKickOldest}, false},
+		{"unlimited", SessionLimit{Username: "alice", MaxSessions: 0}, false},
+		{"no target", SessionLimit{MaxSessions: 2}, true},
+		{"both targets", SessionLimit{Username: "alice", Plan: "family", MaxSessions: 2}, true},
+		{"negative", SessionLimit{Username: "alice", MaxSessions: -1}, true},
+		{"too many", SessionLimit{Username: "alice", MaxSessions: maxSessionLimit + 1}, true},
+		{"unknown policy", SessionLimit{Username: "alice", MaxSessions: 2, Policy: "kick-newest"}, true},
+	}
+
+	for _, tt := range tests {
+		err := tt.limit.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestSessionsToKick(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	sessions := []LiveSession{
+		{Username: "alice", ServerID: "node-b", ConnectedAt: base.Add(2 * time.Hour)},
+		{Username: "alice", ServerID: "node-a", ConnectedAt: base},
+		{Username: "alice", ServerID: "node-c", ConnectedAt: base.Add(time.Hour)},
+	}
+
+	kick := SessionsToKick(sessions, 3)
+	if len(kick) != 1 || kick[0].ServerID != "node-a" {
+		t.Errorf("Expected the session on node-a to be kicked, got %v", kick)
+	}
+
+	kick = SessionsToKick(sessions, 2)
+	if len(kick) != 2 || kick[0].ServerID != "node-a" || kick[1].ServerID != "node-c" {
+		t.Errorf("Expected the sessions on node-a and node-c to be kicked, got %v", kick)
+	}
+
+	if kick := SessionsToKick(sessions, 4); len(kick) != 0 {
+		t.Errorf("Expected no sessions kicked below the limit, got %v", kick)
+	}
+	if kick := SessionsToKick(sessions, 0); len(kick) != 0 {
+		t.Errorf("Expected no sessions kicked without a limit, got %v", kick)
+	}
+
+	if sessions[0].ServerID != "node-b" {
+		t.Errorf("Expected the sessions passed in to keep their order, got %v", sessions)
+	}
+}
@@ -0,0 +1,117 @@
+package shared
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedRequest builds a request signed by node-1
+func signedRequest(t *testing.T, method, target, body, secret string, direction SignatureDirection) *http.Request {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body == "" {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	if err := SignRequest(req, "node-1", secret, direction); err != nil {
+		t.Fatalf("SignRequest failed: %v", err)
+	}
+	return req
+}
+
+// TestRequestSigning verifies signed requests are accepted once and tampering is detected
+func TestRequestSigning(t *testing.T) {
+	secret, err := GenerateNodeSecret()
+	if err != nil {
+		t.Fatalf("GenerateNodeSecret failed: %v", err)
+	}
+	lookup := func(nodeID string) (string, error) {
+		if nodeID == "node-1" {
+			return secret, nil
+		}
+		return "", nil
+	}
+	verifier := NewRequestVerifier()
+
+	req := signedRequest(t, "POST", "/api/endnodes-health/node-1?full=1", `{"status":"healthy"}`, secret, SignedByNode)
+	nodeID, err := verifier.Verify(req, SignedByNode, lookup)
+	if err != nil || nodeID != "node-1" {
+		t.Fatalf("Verify = %q, %v, want node-1", nodeID, err)
+	}
+	if body, _ := io.ReadAll(req.Body); string(body) != `{"status":"healthy"}` {
+		t.Errorf("body after verification = %q, want it intact", body)
+	}
+
+	replay := req.Clone(req.Context())
+	replay.Body = io.NopCloser(strings.NewReader(`{"status":"healthy"}`))
+	if _, err := verifier.Verify(replay, SignedByNode, lookup); err == nil {
+		t.Error("replayed request was accepted")
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(r *http.Request)
+	}{
+		{"body", func(r *http.Request) { r.Body = io.NopCloser(strings.NewReader(`{"status":"down"}`)) }},
+		{"path", func(r *http.Request) { r.URL.Path = "/api/endnodes-health/node-2" }},
+		{"query", func(r *http.Request) { r.URL.RawQuery = "full=0" }},
+		{"method", func(r *http.Request) { r.Method = "PUT" }},
+		{"node", func(r *http.Request) { r.Header.Set(HeaderNodeID, "node-2") }},
+		{"timestamp", func(r *http.Request) {
+			r.Header.Set(HeaderNodeTimestamp, strconv.FormatInt(time.Now().Unix()+1, 10))
+		}},
+		{"unsigned", func(r *http.Request) { r.Header.Del(HeaderNodeSignature) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := signedRequest(t, "POST", "/api/endnodes-health/node-1?full=1", `{"status":"healthy"}`, secret, SignedByNode)
+			tt.tamper(req)
+			if _, err := verifier.Verify(req, SignedByNode, lookup); err == nil {
+				t.Error("tampered request was accepted")
+			}
+		})
+	}
+
+	t.Run("direction", func(t *testing.T) {
+		req := signedRequest(t, "GET", "/api/certs", "", secret, SignedByNode)
+		if _, err := verifier.Verify(req, SignedByManagement, lookup); err == nil {
+			t.Error("request signed by the end-node was accepted as signed by management")
+		}
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		other, _ := GenerateNodeSecret()
+		req := signedRequest(t, "GET", "/api/certs", "", other, SignedByManagement)
+		if _, err := verifier.Verify(req, SignedByManagement, lookup); err == nil {
+			t.Error("request signed with another credential was accepted")
+		}
+	})
+}
+
+// TestRequestSigningSkew verifies requests signed too long ago are rejected and their nonces forgotten
+func TestRequestSigningSkew(t *testing.T) {
+	secret, _ := GenerateNodeSecret()
+	lookup := func(string) (string, error) { return secret, nil }
+	verifier := NewRequestVerifier()
+
+	req := signedRequest(t, "GET", "/api/certs", "", secret, SignedByManagement)
+	if _, err := verifier.Verify(req, SignedByManagement, lookup); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	verifier.now = func() time.Time { return time.Now().Add(SignatureMaxSkew + time.Minute) }
+	if _, err := verifier.Verify(signedRequest(t, "GET", "/api/certs", "", secret, SignedByManagement), SignedByManagement, lookup); err == nil {
+		t.Error("request outside the allowed clock skew was accepted")
+	}
+
+	// Remembering a later nonce prunes the expired one
+	verifier.rememberNonce("node-1/later", verifier.now().Add(SignatureMaxSkew), verifier.now())
+	if len(verifier.nonces) != 1 {
+		t.Errorf("nonce cache holds %d entries, want the expired nonce pruned", len(verifier.nonces))
+	}
+}
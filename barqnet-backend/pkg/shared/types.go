@@ -32,6 +32,161 @@ type User struct {
 	CreatedBy  string    `json:"created_by"`
 }
 
+// EndNodeUser represents a user as held on an end-node's disk, with its certificate and session state
+type EndNodeUser struct {
+	User
+	CertStatus        string    `json:"cert_status"` // valid, expired, revoked or none
+	CertSerial        string    `json:"cert_serial,omitempty"`
+	CertExpiresAt     time.Time `json:"cert_expires_at,omitempty"`
+	WireGuard         bool      `json:"wireguard"`
+	WireGuardChecksum string    `json:"wireguard_checksum,omitempty"`
+	Connected         bool      `json:"connected"`
+	Sessions          int       `json:"sessions"`
+}
+
+// DesiredUser is a user an end-node should hold a profile for
+type DesiredUser struct {
+	Username string `json:"username"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// DesiredState is the versioned user set end-nodes pull from management and converge on
+type DesiredState struct {
+	Version     string        `json:"version"`
+	Users       []DesiredUser `json:"users"`
+	GeneratedAt time.Time     `json:"generated_at"`
+}
+
+// UserAccess is what an end-node checks when a user connects
+type UserAccess struct {
+	Username    string     `json:"username"`
+	Active      bool       `json:"active"`
+	ExpiresAt   time.Time  `json:"expires_at,omitempty"`
+	MaxSessions int        `json:"max_sessions,omitempty"` // concurrent sessions across end-nodes, 0 for no limit
+	Blocked     string     `json:"blocked,omitempty"`      // why the user is blocked, such as an exhausted data quota
+	Bandwidth   *Bandwidth `json:"bandwidth,omitempty"`    // rate limit applied to the user's tunnel address
+}
+
+// AccessList is the versioned user access end-nodes cache to authorize connections
+// without asking the management server on every connect
+type AccessList struct {
+	Version     string       `json:"version"`
+	Users       []UserAccess `json:"users"`
+	GeneratedAt time.Time    `json:"generated_at"`
+}
+
+// Session limit policies: what happens when a user at the limit opens another session
+const (
+	SessionPolicyReject     = "reject"      // the new session is refused
+	SessionPolicyKickOldest = "kick-oldest" // the oldest session is disconnected to make room
+)
+
+// SessionLimit caps the concurrent VPN sessions of a user or of every user on a plan.
+// A user's own limit wins over its plan's.
+type SessionLimit struct {
+	Username    string    `json:"username,omitempty"`
+	Plan        string    `json:"plan,omitempty"`
+	MaxSessions int       `json:"max_concurrent_sessions"` // 0 for no limit
+	Policy      string    `json:"policy,omitempty"`        // empty uses the management default
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// LiveSession is a VPN session counted against a user's session limit
+type LiveSession struct {
+	Username    string    `json:"username"`
+	ServerID    string    `json:"server_id"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// Bandwidth is a rate limit in kilobits per second for each direction, 0 for line rate.
+// Down is traffic to the client, up is traffic from it.
+type Bandwidth struct {
+	DownKbps int `json:"down_kbps"`
+	UpKbps   int `json:"up_kbps"`
+}
+
+// BandwidthLimit caps the bandwidth of a user or of every user on a plan.
+// A user's own limit wins over its plan's.
+type BandwidthLimit struct {
+	Username string `json:"username,omitempty"`
+	Plan     string `json:"plan,omitempty"`
+	Bandwidth
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Data quota periods
+const (
+	QuotaPeriodMonthly = "monthly" // the calendar month in UTC
+	QuotaPeriodRolling = "rolling" // the last RollingDays days
+)
+
+// DataQuota caps the VPN traffic of a user per period. Users over their quota are
+// disconnected and blocked until usage in the period drops below it again.
+type DataQuota struct {
+	Username    string     `json:"username"`
+	LimitBytes  int64      `json:"limit_bytes"`
+	Period      string     `json:"period"`
+	RollingDays int        `json:"rolling_days,omitempty"`
+	ExceededAt  *time.Time `json:"exceeded_at,omitempty"` // set while the user is blocked
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Highest warning threshold, in percent, reached in the current period
+	WarnedPercent int        `json:"-"`
+	WarnedAt      *time.Time `json:"-"`
+}
+
+// QuotaStatus is the usage of a user's data quota in the current period
+type QuotaStatus struct {
+	LimitBytes     int64      `json:"limit_bytes"`
+	UsedBytes      int64      `json:"used_bytes"`
+	RemainingBytes int64      `json:"remaining_bytes"`
+	PercentUsed    float64    `json:"percent_used"`
+	Period         string     `json:"period"`
+	PeriodStart    time.Time  `json:"period_start"`
+	ResetsAt       *time.Time `json:"resets_at,omitempty"` // monthly quotas only
+	Exceeded       bool       `json:"exceeded"`
+}
+
+// ConnectRequest is what the client-connect hook knows about a connecting client
+type ConnectRequest struct {
+	Username       string `json:"username"`
+	RealAddress    string `json:"real_address,omitempty"`
+	VirtualAddress string `json:"virtual_address,omitempty"`
+}
+
+// TLSCryptV2VerifyRequest is the metadata of the tls-crypt-v2 client key a client presents,
+// as wrapped by the end-node that issued it
+type TLSCryptV2VerifyRequest struct {
+	Username string `json:"username"`
+	IssuedAt int64  `json:"issued_at"`
+}
+
+// ConnectDecision tells the client-connect hook whether to accept a client and
+// which per-user config to hand back to OpenVPN
+type ConnectDecision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	Config  string `json:"config,omitempty"`
+}
+
+// DriftReport describes how an end-node differed from the desired state and what it changed
+type DriftReport struct {
+	ServerID     string            `json:"server_id"`
+	Version      string            `json:"version"`
+	DesiredCount int               `json:"desired_count"`
+	ActualCount  int               `json:"actual_count"`
+	Missing      []string          `json:"missing"`    // desired users without a usable profile
+	Unexpected   []string          `json:"unexpected"` // local users that should not exist
+	Created      []string          `json:"created"`
+	Revoked      []string          `json:"revoked"`
+	Failed       map[string]string `json:"failed,omitempty"` // username -> error
+	ReconciledAt time.Time         `json:"reconciled_at"`
+}
+
+// ProtocolWireGuard is the User.Protocol value for WireGuard; "udp" and "tcp" mean OpenVPN
+const ProtocolWireGuard = "wireguard"
+
 // Server represents a VPN server
 type Server struct {
 	ID            int       `json:"id"`
@@ -45,6 +200,132 @@ type Server struct {
 	ServerType    string    `json:"server_type"`
 	ManagementURL string    `json:"management_url"`
 	CreatedAt     time.Time `json:"created_at"`
+
+	// Addresses VPN clients connect to, in order of preference; Host is the API address
+	PublicEndpoints Endpoints `json:"public_endpoints,omitempty"`
+	// OpenVPN listeners the end-node declared, in order of preference; empty means the
+	// port and protocol of its server profile
+	Listeners Listeners `json:"listeners,omitempty"`
+}
+
+// CRLPublication represents the result of publishing a CRL on an end-node
+type CRLPublication struct {
+	ServerID       string    `json:"server_id"`
+	CRLNumber      int64     `json:"crl_number"`
+	RevokedCount   int       `json:"revoked_count"`
+	ThisUpdate     time.Time `json:"this_update"`
+	NextUpdate     time.Time `json:"next_update"`
+	KickedSessions int       `json:"kicked_sessions"`
+	PublishedAt    time.Time `json:"published_at"`
+}
+
+// ClientCertificate represents a client certificate issued by an end-node's certificate authority
+type ClientCertificate struct {
+	Username      string    `json:"username"`
+	ServerID      string    `json:"server_id"`
+	Serial        string    `json:"serial"`
+	NotAfter      time.Time `json:"not_after"`
+	Status        string    `json:"status"` // valid, expired or revoked
+	DaysRemaining int       `json:"days_remaining"`
+	UpdatedAt     time.Time `json:"updated_at,omitempty"`
+}
+
+// CertificateReport is sent by an end-node to report its client certificate inventory
+type CertificateReport struct {
+	ServerID     string              `json:"server_id"`
+	Certificates []ClientCertificate `json:"certificates"`
+	Renewed      []string            `json:"renewed,omitempty"` // usernames whose certificate was re-issued
+}
+
+// ServerProfile is the OpenVPN server configuration managed centrally on the management server.
+// A profile applies to one end-node (ServerID) or every end-node of a location (LocationID);
+// a profile with neither is the global default. End-nodes render both server.conf and client
+// profiles from it, so client and server settings always match.
+type ServerProfile struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	ServerID   string `json:"server_id,omitempty"`
+	LocationID int    `json:"location_id,omitempty"`
+
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"` // udp or tcp
+
+	// Data channel ciphers negotiated with clients, in order of preference
+	DataCiphers []string `json:"data_ciphers"`
+	// Cipher for clients too old to negotiate (OpenVPN < 2.4); empty rejects them
+	DataCiphersFallback string   `json:"data_ciphers_fallback,omitempty"`
+	Auth                string   `json:"auth"`
+	TLSVersionMin       string   `json:"tls_version_min"`
+	TLSCiphers          []string `json:"tls_ciphers,omitempty"` // TLS 1.2 control channel suites
+	TLSCrypt            bool     `json:"tls_crypt"`
+	// Per-client tls-crypt-v2 keys wrapped by the node's server key instead of one shared
+	// tls-crypt key; excludes tls_crypt
+	TLSCryptV2 bool `json:"tls_crypt_v2,omitempty"`
+
+	Topology        string   `json:"topology"` // subnet, net30 or p2p
+	Subnet          string   `json:"subnet"`   // client address pool, e.g. 10.8.0.0/24
+	DNS             []string `json:"dns"`
+	RedirectGateway bool     `json:"redirect_gateway"`
+
+	// Addresses at the end of the subnet reserved for fixed client addresses (CCD static IPs);
+	// the dynamic pool stops before them
+	StaticAddresses int `json:"static_addresses,omitempty"`
+
+	KeepaliveInterval int `json:"keepalive_interval"`
+	KeepaliveTimeout  int `json:"keepalive_timeout"`
+	MaxClients        int `json:"max_clients"`
+
+	Version   string    `json:"version"` // content hash, changes whenever a setting changes
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// ServerProfileReport is sent by an end-node after it tried to apply a server profile
+type ServerProfileReport struct {
+	ServerID   string    `json:"server_id"`
+	Version    string    `json:"version"`
+	Applied    bool      `json:"applied"`
+	Restarted  bool      `json:"restarted"` // OpenVPN was restarted to load the new server.conf
+	Error      string    `json:"error,omitempty"`
+	Rerendered []string  `json:"rerendered,omitempty"` // users whose client profile was re-rendered
+	AppliedAt  time.Time `json:"applied_at"`
+}
+
+// ClientConfigEntry is a user's OpenVPN client-config-dir (CCD) entry: a fixed tunnel address,
+// extra routes pushed to the client and, for site-to-site users, the networks behind the client.
+// An entry with a ServerID applies to that end-node only and overrides the user's entry for all end-nodes.
+type ClientConfigEntry struct {
+	Username  string    `json:"username"`
+	ServerID  string    `json:"server_id,omitempty"`
+	StaticIP  string    `json:"static_ip,omitempty"` // ifconfig-push
+	Routes    []string  `json:"routes,omitempty"`    // IPv4 networks pushed to the client
+	IRoutes   []string  `json:"iroutes,omitempty"`   // IPv4 networks behind the client
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// ClientConfigSet is the versioned set of CCD entries an end-node should hold
+type ClientConfigSet struct {
+	Version     string              `json:"version"`
+	Entries     []ClientConfigEntry `json:"entries"`
+	GeneratedAt time.Time           `json:"generated_at"`
+}
+
+// RouteProfile is a named split-tunnel policy baked into generated client configs.
+// It is assigned to users directly or through their plan; users without one get the full tunnel.
+type RouteProfile struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	Include     []string `json:"include,omitempty"`      // IPv4 networks sent through the tunnel; empty sends all traffic
+	Exclude     []string `json:"exclude,omitempty"`      // IPv4 networks that bypass the tunnel
+	RouteNoPull bool     `json:"route_nopull,omitempty"` // ignore routes and DNS pushed by the server
+	DNS         []string `json:"dns,omitempty"`          // replaces the DNS servers pushed by the server
+
+	// Assignments, filled in when listing profiles
+	Users []string `json:"users,omitempty"`
+	Plans []string `json:"plans,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // AuditLog represents an audit log entry
@@ -60,12 +341,93 @@ type AuditLog struct {
 
 // ServerHealth represents server health status
 type ServerHealth struct {
-	ID           int       `json:"id"`
-	ServerID     string    `json:"server_id"`
-	Status       string    `json:"status"`
-	LastCheck    time.Time `json:"last_check"`
-	ResponseTime int       `json:"response_time_ms"`
-	ErrorMessage string    `json:"error_message"`
+	ID           int          `json:"id"`
+	ServerID     string       `json:"server_id"`
+	Status       string       `json:"status"`
+	LastCheck    time.Time    `json:"last_check"`
+	ResponseTime int          `json:"response_time_ms"`
+	ErrorMessage string       `json:"error_message"`
+	Metrics      *NodeMetrics `json:"metrics,omitempty"` // reported by the end-node, nil for older end-nodes
+}
+
+// Health statuses reported by end-nodes
+const (
+	HealthStatusHealthy   = "healthy"
+	HealthStatusDegraded  = "degraded"
+	HealthStatusUnhealthy = "unhealthy"
+)
+
+// NodeMetrics are the resource metrics an end-node collects from /proc for its health reports
+type NodeMetrics struct {
+	CPUPercent float64 `json:"cpu_percent"` // busy share of all CPUs since the previous report
+	CPUCount   int     `json:"cpu_count"`
+	LoadAvg1   float64 `json:"load_avg_1"`
+	LoadAvg5   float64 `json:"load_avg_5"`
+	LoadAvg15  float64 `json:"load_avg_15"`
+
+	MemoryTotal     uint64  `json:"memory_total_bytes"`
+	MemoryAvailable uint64  `json:"memory_available_bytes"`
+	MemoryPercent   float64 `json:"memory_percent"`
+
+	Interfaces []InterfaceThroughput `json:"interfaces,omitempty"`
+
+	ConnectedClients int  `json:"connected_clients"`
+	OpenVPNRunning   bool `json:"openvpn_running"`
+
+	// File system holding the client profiles
+	DiskPath    string  `json:"disk_path"`
+	DiskTotal   uint64  `json:"disk_total_bytes"`
+	DiskFree    uint64  `json:"disk_free_bytes"`
+	DiskPercent float64 `json:"disk_percent"`
+
+	CollectedAt time.Time `json:"collected_at"`
+}
+
+// InterfaceThroughput is the traffic of a network interface since the previous report
+type InterfaceThroughput struct {
+	Name          string  `json:"name"`
+	RxBytes       uint64  `json:"rx_bytes"` // counters since boot
+	TxBytes       uint64  `json:"tx_bytes"`
+	RxBytesPerSec float64 `json:"rx_bytes_per_sec"`
+	TxBytesPerSec float64 `json:"tx_bytes_per_sec"`
+}
+
+// HealthReport is the health check an end-node posts to the management server
+type HealthReport struct {
+	ServerID     string       `json:"server_id"`
+	Status       string       `json:"status"`
+	Timestamp    int64        `json:"timestamp"`
+	ResponseTime int          `json:"response_time"` // round trip of the previous report in ms
+	Error        string       `json:"error,omitempty"`
+	Metrics      *NodeMetrics `json:"metrics,omitempty"`
+}
+
+// Sources of vpn_statistics records
+const (
+	UsageSourceClient = "client" // self-reported by the VPN client app
+	UsageSourceServer = "server" // counted by OpenVPN on the end-node
+)
+
+// SessionUsage is the traffic of one finished OpenVPN session as counted by the server.
+// Bytes are seen from the server: received from the client and sent to it.
+type SessionUsage struct {
+	SessionID       string    `json:"session_id"`
+	Username        string    `json:"username"`
+	BytesReceived   int64     `json:"bytes_received"`
+	BytesSent       int64     `json:"bytes_sent"`
+	DurationSeconds int       `json:"duration_seconds"`
+	ConnectedAt     time.Time `json:"connected_at"`
+	DisconnectedAt  time.Time `json:"disconnected_at"`
+	RealAddress     string    `json:"real_address,omitempty"`
+	VirtualAddress  string    `json:"virtual_address,omitempty"`
+}
+
+// SessionUsageBatch is a batch of finished sessions an end-node ships to the management server
+type SessionUsageBatch struct {
+	ServerID string         `json:"server_id"`
+	Source   string         `json:"source"`
+	Records  []SessionUsage `json:"records"`
+	SentAt   time.Time      `json:"sent_at"`
 }
 
 // EndNodeConfig represents end-node configuration
@@ -75,13 +437,92 @@ type EndNodeConfig struct {
 	APIKey        string `json:"api_key"`
 	Port          int    `json:"port"` // API server port for this end-node
 	Database      DatabaseConfig `json:"database"`
+
+	// Credential issued to this end-node by management; when set, requests to and from
+	// management are signed with it instead of carrying the shared API key
+	NodeSecret string `json:"node_secret"`
+	// Single-use token from management the end-node exchanges for its credential at first boot;
+	// the credential is then kept in NodeSecretFile and loaded from there on later starts
+	EnrollmentToken string `json:"enrollment_token"`
+	NodeSecretFile  string `json:"node_secret_file"`
+
+	// Advertised addresses: APIAddress is where management reaches the end-node API,
+	// PublicEndpoints are the hosts (IPv4, IPv6 or DNS names) VPN clients connect to
+	APIAddress      string   `json:"api_address"`
+	PublicEndpoints []string `json:"public_endpoints"`
+
+	// OpenVPN listeners (protocol and port) the server accepts clients on, in order of
+	// preference; empty uses the port and protocol of the server profile
+	OpenVPNListeners []Listener `json:"openvpn_listeners"`
+
+	// OpenVPN management interface (unix socket path or host:port)
+	OpenVPNManagement         string `json:"openvpn_management"`
+	OpenVPNManagementPassword string `json:"openvpn_management_password"`
+	CRLPath                   string `json:"crl_path"` // file read by OpenVPN's crl-verify
+
+	// OpenVPN server.conf rendered from the server profile managed on the management server
+	OpenVPNDir              string `json:"openvpn_dir"`
+	OpenVPNServerConfig     string `json:"openvpn_server_config"`
+	OpenVPNClientConnect    string `json:"openvpn_client_connect"`    // optional client-connect hook
+	OpenVPNClientDisconnect string `json:"openvpn_client_disconnect"` // optional client-disconnect hook
+	OpenVPNCCDDir           string `json:"openvpn_ccd_dir"`           // per-user client-config-dir
+	// End-node binary run by OpenVPN for the built-in client-connect and client-disconnect hooks;
+	// empty disables them
+	OpenVPNHookBinary string `json:"openvpn_hook_binary"`
+	// Let clients in when the client-connect and tls-crypt-v2-verify hooks cannot reach the
+	// end-node API, instead of rejecting them
+	OpenVPNHookFailOpen bool `json:"openvpn_hook_fail_open"`
+
+	// Directory client OVPN files are stored in
+	ClientsDir string `json:"clients_dir"`
+
+	// Certificate authority (EasyRSA-compatible pki directory)
+	PKIDir           string `json:"pki_dir"`
+	CertKeyType      string `json:"cert_key_type"`      // ecdsa, ed25519 or rsa
+	CertLifetimeDays int    `json:"cert_lifetime_days"`
+	// Client certificates are renewed this many days before they expire
+	CertRenewBeforeDays int `json:"cert_renew_before_days"`
+
+	// WireGuard server interface (wg-quick config managed by the end-node)
+	WireGuardInterface  string   `json:"wireguard_interface"`
+	WireGuardConfigPath string   `json:"wireguard_config_path"`
+	WireGuardDNS        []string `json:"wireguard_dns"`
+
+	// OpenVPN tunnel device per-user bandwidth limits are applied on; empty disables shaping
+	ShapingDevice string `json:"shaping_device"`
+
+	// Write-ahead file reports are queued in while management is unreachable; empty drops them
+	OutboxPath string `json:"outbox_path"`
+
+	// Mutual TLS with the management server, with a certificate issued by its node CA;
+	// empty serves and calls plain HTTP
+	TLS NodeTLSConfig `json:"tls"`
+	// Loopback port the OpenVPN hooks reach the end-node on while the API requires mutual TLS
+	HookPort int `json:"hook_port"`
 }
 
 // ManagementConfig represents management server configuration
 type ManagementConfig struct {
 	ServerID string `json:"server_id"`
+	Port     int    `json:"port"` // API server port
 	Database DatabaseConfig `json:"database"`
 	APIKey   string `json:"api_key"`
+
+	// Concurrent VPN sessions allowed per user across all end-nodes, 0 for no limit.
+	// Per-user and per-plan session limits override it.
+	MaxSessionsPerUser int `json:"max_sessions_per_user"`
+	// What happens when a user at the limit connects: reject or kick-oldest
+	SessionLimitPolicy string `json:"session_limit_policy"`
+	// Data quota usage, in percent, at which users are warned
+	QuotaWarnPercents []int `json:"quota_warn_percents"`
+
+	// Internal CA end-node certificates are issued from (EasyRSA-compatible pki directory);
+	// empty disables mutual TLS between management and end-nodes
+	NodeCADir string `json:"node_ca_dir"`
+	// Hosts end-nodes reach the node API on, the management certificate is valid for them
+	NodeTLSHosts []string `json:"node_tls_hosts"`
+	// Port of the API end-nodes call over mutual TLS
+	NodeAPIPort int `json:"node_api_port"`
 }
 
 // APIResponse represents a standard API response
@@ -106,6 +547,48 @@ type HealthCheck struct {
 	Timestamp int64  `json:"timestamp"`
 	Version   string `json:"version"`
 	ServerID string `json:"server_id"`
+
+	// Reports an end-node holds for the management server, end-nodes only
+	Outbox *OutboxStatus `json:"outbox,omitempty"`
+}
+
+// EndNodeAuditEvent is an audit event an end-node ships to the management audit log
+type EndNodeAuditEvent struct {
+	Action     string    `json:"action"`
+	Username   string    `json:"username,omitempty"`
+	Details    string    `json:"details,omitempty"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Enrollment token states
+const (
+	EnrollmentPending = "pending"
+	EnrollmentUsed    = "used"
+	EnrollmentExpired = "expired"
+	EnrollmentRevoked = "revoked"
+)
+
+// EnrollmentToken is a single-use token an end-node exchanges at first boot for its node
+// credential. The token itself is only shown when it is created.
+type EnrollmentToken struct {
+	ID         int        `json:"id"`
+	ServerID   string     `json:"server_id,omitempty"`   // server ID the end-node must enroll as; empty lets it choose
+	LocationID int        `json:"location_id,omitempty"` // location the end-node is placed in, 0 for none
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty"`
+	UsedBy     string     `json:"used_by,omitempty"` // server ID the token was exchanged for
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Status     string     `json:"status"`
+}
+
+// OutboxStatus describes the reports an end-node queued while management was unreachable
+type OutboxStatus struct {
+	Depth          int        `json:"depth"`
+	OldestQueuedAt *time.Time `json:"oldest_queued_at,omitempty"`
+	Dropped        int64      `json:"dropped,omitempty"` // dropped since start because the queue was full
 }
 
 // VPNConnectionStatus represents a VPN connection status
@@ -139,6 +622,8 @@ type UserStatisticsSummary struct {
 	TotalDuration  int       `json:"total_duration_seconds"`
 	ConnectionCount int      `json:"connection_count"`
 	LastConnection time.Time `json:"last_connection,omitempty"`
+	// Source of the totals: server when end-nodes reported sessions of the user, else client
+	Source string `json:"source"`
 }
 
 // ServerLocation represents a VPN server location
@@ -177,5 +662,8 @@ type VPNConfigResponse struct {
 	ServerPort         int    `json:"server_port"`
 	Protocol           string `json:"protocol"`
 	OVPNContent        string `json:"ovpn_content"`
+	WireGuardContent   string `json:"wireguard_content,omitempty"`
+	RouteProfile       *RouteProfile `json:"route_profile,omitempty"` // split-tunnel policy, nil for the full tunnel
+	Transports         []Listener    `json:"transports,omitempty"`    // OpenVPN listeners in the order the profile tries them
 	RecommendedServers []string `json:"recommended_servers"`
 }
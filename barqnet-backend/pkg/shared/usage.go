@@ -0,0 +1,108 @@
+package shared
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+)
+
+// maxUsageBatch caps the sessions accepted in one batch from an end-node
+const maxUsageBatch = 1000
+
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,64}$`)
+
+// Validate checks a session usage record reported by an end-node
+func (u *SessionUsage) Validate() error {
+	if !sessionIDPattern.MatchString(u.SessionID) {
+		return fmt.Errorf("session_id must be 8-64 alphanumeric characters")
+	}
+	if !ccdUsernamePattern.MatchString(u.Username) {
+		return fmt.Errorf("invalid username %q", u.Username)
+	}
+	if u.BytesReceived < 0 || u.BytesSent < 0 || u.DurationSeconds < 0 {
+		return fmt.Errorf("byte counts and duration must not be negative")
+	}
+	if u.ConnectedAt.IsZero() || u.DisconnectedAt.Before(u.ConnectedAt) {
+		return fmt.Errorf("disconnected_at must not be before connected_at")
+	}
+	if u.VirtualAddress != "" {
+		if _, err := netip.ParseAddr(u.VirtualAddress); err != nil {
+			return fmt.Errorf("invalid virtual_address %q", u.VirtualAddress)
+		}
+	}
+	if u.RealAddress != "" {
+		if _, err := netip.ParseAddrPort(u.RealAddress); err != nil {
+			if _, err := netip.ParseAddr(u.RealAddress); err != nil {
+				return fmt.Errorf("invalid real_address %q", u.RealAddress)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks a batch of session usage reported by an end-node
+func (b *SessionUsageBatch) Validate() error {
+	if b.Source != UsageSourceServer {
+		return fmt.Errorf("source must be %q", UsageSourceServer)
+	}
+	if len(b.Records) > maxUsageBatch {
+		return fmt.Errorf("at most %d records are allowed per batch", maxUsageBatch)
+	}
+	for i := range b.Records {
+		if err := b.Records[i].Validate(); err != nil {
+			return fmt.Errorf("record %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// UsageManager stores VPN usage statistics on the management server
+type UsageManager struct {
+	db *DB
+}
+
+// NewUsageManager creates a new usage manager
+func NewUsageManager(db *DB) *UsageManager {
+	return &UsageManager{db: db}
+}
+
+// RecordServerUsage stores server-counted session usage from an end-node in vpn_statistics.
+// Sessions already stored (a batch retried after a lost response) and sessions of unknown
+// users are skipped. It returns the number of sessions stored.
+func (um *UsageManager) RecordServerUsage(serverID string, records []SessionUsage) (int, error) {
+	tx, err := um.db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// vpn_statistics counts from the client's side: bytes_in is what the server sent to it
+	stmt, err := tx.Prepare(`
+		INSERT INTO vpn_statistics (username, server_id, bytes_in, bytes_out, duration_seconds,
+		                            started_at, ended_at, source, session_id)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9
+		WHERE EXISTS (SELECT 1 FROM users WHERE username = $1)
+		ON CONFLICT (server_id, session_id) WHERE session_id IS NOT NULL DO NOTHING
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	stored := 0
+	for _, record := range records {
+		result, err := stmt.Exec(record.Username, serverID, record.BytesSent, record.BytesReceived,
+			record.DurationSeconds, record.ConnectedAt, record.DisconnectedAt, UsageSourceServer, record.SessionID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to store session %s of %s: %v", record.SessionID, record.Username, err)
+		}
+		if rows, _ := result.RowsAffected(); rows > 0 {
+			stored++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return stored, nil
+}
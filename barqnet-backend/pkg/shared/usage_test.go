@@ -0,0 +1,48 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSessionUsageBatchValidate verifies server usage batches are checked record by record
+func TestSessionUsageBatchValidate(t *testing.T) {
+	connected := time.Unix(1700000000, 0)
+	record := SessionUsage{
+		SessionID:      "0123456789abcdef0123456789abcdef",
+		Username:       "alice",
+		BytesReceived:  1024,
+		BytesSent:      4096,
+		ConnectedAt:    connected,
+		DisconnectedAt: connected.Add(time.Minute),
+		RealAddress:    "[2001:db8::7]:51234",
+		VirtualAddress: "10.8.0.6",
+	}
+
+	batch := SessionUsageBatch{ServerID: "server-1", Source: UsageSourceServer, Records: []SessionUsage{record}}
+	if err := batch.Validate(); err != nil {
+		t.Errorf("Expected valid batch, got %v", err)
+	}
+
+	batch.Source = UsageSourceClient
+	if err := batch.Validate(); err == nil {
+		t.Error("Expected client source to be rejected")
+	}
+	batch.Source = UsageSourceServer
+
+	invalid := []func(u *SessionUsage){
+		func(u *SessionUsage) { u.SessionID = "short" },
+		func(u *SessionUsage) { u.Username = "../etc" },
+		func(u *SessionUsage) { u.BytesSent = -1 },
+		func(u *SessionUsage) { u.DisconnectedAt = connected.Add(-time.Second) },
+		func(u *SessionUsage) { u.VirtualAddress = "10.8.0.300" },
+	}
+	for i, mutate := range invalid {
+		bad := record
+		mutate(&bad)
+		batch.Records = []SessionUsage{record, bad}
+		if err := batch.Validate(); err == nil {
+			t.Errorf("Case %d: expected invalid record to be rejected", i)
+		}
+	}
+}
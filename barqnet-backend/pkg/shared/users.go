@@ -259,6 +259,13 @@ func (um *UserManager) MarkUserSynced(username string) error {
 	return err
 }
 
+// MarkUserUnsynced flags a user whose profile changed so clients fetch it again
+func (um *UserManager) MarkUserUnsynced(username string) error {
+	query := `UPDATE users SET synced = false WHERE username = $1`
+	_, err := um.db.conn.Exec(query, username)
+	return err
+}
+
 // GetDB returns the database connection
 func (um *UserManager) GetDB() *DB {
 	return um.db